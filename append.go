@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// appendBatchSize bounds a single append WRITE. 64KiB is the smallest
+// maximum write size any SMB2 dialect may negotiate, so a batch is never
+// split into several requests that another writer could slip between.
+const appendBatchSize = 64 << 10
+
+// appendRecords appends newline-terminated records from r to remote, which is
+// created if missing. The file is opened with append-only access; servers
+// with NTFS semantics then place every WRITE at the current end of file, so
+// records from several hosts appending at once land whole rather than
+// interleaved. go-smb2 offers no byte-range locks or leases to guard the end
+// of file otherwise.
+func appendRecords(ctx context.Context, share *smb2.Share, r io.Reader, remote string) (int, error) {
+	remote = normalizeRemotePath(remote)
+	if dir := path.Dir(remote); dir != "." {
+		if err := share.MkdirAll(dir, 0o755); err != nil {
+			if _, statErr := share.Stat(dir); statErr != nil {
+				return 0, fmt.Errorf("mkdir %s: %w", dir, err)
+			}
+		}
+	}
+
+	start := time.Now()
+	dst, err := share.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	opStats.observe("create", start)
+	if err != nil {
+		return 0, fmt.Errorf("open remote %s: %w", remote, err)
+	}
+	defer dst.Close()
+
+	n, err := writeRecords(timedWriter{dst, "write"}, ctxReader{ctx, r}, appendBatchSize)
+	if err != nil {
+		return n, fmt.Errorf("append to %s: %w", remote, err)
+	}
+	return n, nil
+}
+
+// writeRecords copies newline-terminated records from r to w, packing as many
+// whole records into each Write as fit in max bytes. A final record without a
+// newline gets one. It returns the number of records written.
+func writeRecords(w io.Writer, r io.Reader, max int) (int, error) {
+	br := bufio.NewReaderSize(r, max)
+	var batch bytes.Buffer
+	records, pending := 0, 0
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		if _, err := w.Write(batch.Bytes()); err != nil {
+			return err
+		}
+		batch.Reset()
+		records += pending
+		pending = 0
+		return nil
+	}
+	// Records already batched are still written before giving up.
+	tooLong := func() (int, error) {
+		if err := flush(); err != nil {
+			return records, err
+		}
+		return records, fmt.Errorf("record longer than %d bytes cannot be appended atomically", max)
+	}
+
+	for {
+		line, err := br.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return tooLong()
+		}
+		if len(line) > 0 {
+			size := len(line)
+			if line[size-1] != '\n' {
+				size++
+			}
+			if size > max {
+				return tooLong()
+			}
+			if batch.Len()+size > max {
+				if err := flush(); err != nil {
+					return records, err
+				}
+			}
+			batch.Write(line)
+			if line[len(line)-1] != '\n' {
+				batch.WriteByte('\n')
+			}
+			pending++
+		}
+		if err == io.EOF {
+			return records, flush()
+		}
+		if err != nil {
+			return records, err
+		}
+	}
+}
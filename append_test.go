@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+type recordingWriter struct {
+	writes []string
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func TestWriteRecordsKeepsRecordsWhole(t *testing.T) {
+	w := &recordingWriter{}
+	n, err := writeRecords(w, strings.NewReader("aaaa\nbbbb\ncccc\ndd"), 12)
+	if err != nil {
+		t.Fatalf("writeRecords: %v", err)
+	}
+	if n != 4 {
+		t.Fatalf("records = %d, want 4", n)
+	}
+	want := []string{"aaaa\nbbbb\n", "cccc\ndd\n"}
+	if strings.Join(w.writes, "|") != strings.Join(want, "|") {
+		t.Fatalf("writes = %q, want %q", w.writes, want)
+	}
+}
+
+func TestWriteRecordsRejectsOversizedRecord(t *testing.T) {
+	w := &recordingWriter{}
+	n, err := writeRecords(w, strings.NewReader("ok\n"+strings.Repeat("x", 40)+"\n"), 16)
+	if err == nil {
+		t.Fatal("expected error for a record larger than the batch size")
+	}
+	if n != 1 || len(w.writes) != 1 {
+		t.Fatalf("records = %d, writes = %q; want the first record flushed", n, w.writes)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+const (
+	attrReadonly uint32 = 0x1
+	attrHidden   uint32 = 0x2
+	attrSystem   uint32 = 0x4
+	attrArchive  uint32 = 0x20
+)
+
+// attribLetters maps the letters attrib.exe uses to attribute bits, in the
+// order its listing prints them.
+var attribLetters = []struct {
+	letter byte
+	bit    uint32
+}{
+	{'a', attrArchive},
+	{'s', attrSystem},
+	{'h', attrHidden},
+	{'r', attrReadonly},
+}
+
+func attribBit(letter byte) (uint32, bool) {
+	for _, a := range attribLetters {
+		if a.letter == letter {
+			return a.bit, true
+		}
+	}
+	return 0, false
+}
+
+// attribClearFlag is a boolean flag such as -h that queues the removal of an
+// attribute. Defining -r, -a, -s, and -h as flags lets them mix freely with
+// the +r style arguments, which the flag package leaves positional.
+type attribClearFlag struct {
+	changes *[]string
+	letter  string
+}
+
+func (f attribClearFlag) String() string   { return "false" }
+func (f attribClearFlag) IsBoolFlag() bool { return true }
+
+func (f attribClearFlag) Set(v string) error {
+	if v == "true" {
+		*f.changes = append(*f.changes, "-"+f.letter)
+	}
+	return nil
+}
+
+// parseAttribChanges turns +x/-x tokens into the bits to set and to clear.
+func parseAttribChanges(changes []string) (set, clear uint32, err error) {
+	for _, c := range changes {
+		if len(c) != 2 || (c[0] != '+' && c[0] != '-') {
+			return 0, 0, fmt.Errorf("invalid attribute change %q: want +r, -h, ...", c)
+		}
+		bit, ok := attribBit(strings.ToLower(c)[1])
+		if !ok {
+			return 0, 0, fmt.Errorf("unknown attribute %q: want r, h, a, or s", c[1:])
+		}
+		if c[0] == '+' {
+			set |= bit
+		} else {
+			clear |= bit
+		}
+	}
+	if both := set & clear; both != 0 {
+		return 0, 0, fmt.Errorf("attribute %s is both set and cleared", strings.Join(attributeNames(both), ", "))
+	}
+	return set, clear, nil
+}
+
+// formatAttrib renders attrs as attrib.exe does: one column per letter, blank
+// when the attribute is unset.
+func formatAttrib(attrs uint32) string {
+	b := []byte("    ")
+	for i, a := range attribLetters {
+		if attrs&a.bit != 0 {
+			b[i] = a.letter - 'a' + 'A'
+		}
+	}
+	return string(b)
+}
+
+// attribRemote applies set and clear to every path and prints the resulting
+// attributes. go-smb2 can only change READONLY (through Chmod), so asking to
+// change any other attribute fails unless it already has the wanted value.
+func attribRemote(share *smb2.Share, w io.Writer, paths []string, set, clear uint32) error {
+	for _, p := range paths {
+		p = normalizeRemotePath(p)
+		attrs, err := remoteAttributes(share, p)
+		if err != nil {
+			return err
+		}
+		want := attrs&^clear | set
+		if diff := (attrs ^ want) &^ attrReadonly; diff != 0 {
+			return fmt.Errorf("%s: cannot change %s: only READONLY can be changed over this SMB client", p, strings.Join(attributeNames(diff), ", "))
+		}
+		if (attrs^want)&attrReadonly != 0 {
+			mode := os.FileMode(0o644)
+			if want&attrReadonly != 0 {
+				mode = 0o444
+			}
+			start := time.Now()
+			err := share.Chmod(p, mode)
+			opStats.observe("setinfo", start)
+			if err != nil {
+				return fmt.Errorf("chmod %s: %w", p, err)
+			}
+			if attrs, err = remoteAttributes(share, p); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "%s  %s\n", formatAttrib(attrs), displayName(p, false))
+	}
+	return nil
+}
+
+func remoteAttributes(share *smb2.Share, p string) (uint32, error) {
+	start := time.Now()
+	fi, err := share.Lstat(p)
+	opStats.observe("stat", start)
+	if err != nil {
+		return 0, fmt.Errorf("stat %s: %w", p, err)
+	}
+	st, ok := fi.(*smb2.FileStat)
+	if !ok {
+		return 0, fmt.Errorf("stat %s: server returned no attributes", p)
+	}
+	return st.FileAttributes, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAttribChanges(t *testing.T) {
+	tests := []struct {
+		changes    []string
+		set, clear uint32
+		wantErr    bool
+	}{
+		{nil, 0, 0, false},
+		{[]string{"+r", "-h"}, attrReadonly, attrHidden, false},
+		{[]string{"+A", "+s"}, attrArchive | attrSystem, 0, false},
+		{[]string{"+r", "-r"}, 0, 0, true},
+		{[]string{"+x"}, 0, 0, true},
+		{[]string{"+rh"}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		set, clear, err := parseAttribChanges(tt.changes)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAttribChanges(%v) error = %v, wantErr %v", tt.changes, err, tt.wantErr)
+			continue
+		}
+		if set != tt.set || clear != tt.clear {
+			t.Errorf("parseAttribChanges(%v) = %#x, %#x; want %#x, %#x", tt.changes, set, clear, tt.set, tt.clear)
+		}
+	}
+}
+
+func TestFormatAttrib(t *testing.T) {
+	if got := formatAttrib(attrArchive | attrHidden | attrReadonly | 0x10); got != "A HR" {
+		t.Errorf("formatAttrib = %q, want %q", got, "A HR")
+	}
+	if got := formatAttrib(0); got != "    " {
+		t.Errorf("formatAttrib(0) = %q", got)
+	}
+}
+
+func TestAttribFlagsMixWithPlusArguments(t *testing.T) {
+	var opts smbOptions
+	fs := lookupCommand("attrib").flagSet(&opts)
+	args, err := parseInterspersed(fs, []string{"-h", "+r", "docs/a.txt", "-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"+r", "docs/a.txt"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("positional = %v, want %v", args, want)
+	}
+	if want := []string{"-h", "-a"}; !reflect.DeepEqual(opts.attribChanges, want) {
+		t.Errorf("attribChanges = %v, want %v", opts.attribChanges, want)
+	}
+}
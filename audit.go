@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// go-smb2 negotiates internally and keeps the outcome private, so
+// audit-hosts sends its own NEGOTIATE requests, which need no credentials,
+// and reads the server's answer directly.
+
+const (
+	smb2NegotiateCapEncryption = 0x40
+	smb2SigningEnabled         = 0x1
+	smb2SigningRequired        = 0x2
+
+	negCtxPreauth    = 1
+	negCtxEncryption = 2
+)
+
+// auditDialects are offered in every probe, oldest first.
+var auditDialects = []uint16{0x0202, 0x0210, 0x0300, 0x0302, 0x0311}
+
+var dialectNames = map[uint16]string{
+	0x0202: "2.0.2",
+	0x0210: "2.1",
+	0x0300: "3.0",
+	0x0302: "3.0.2",
+	0x0311: "3.1.1",
+}
+
+var cipherNames = map[uint16]string{
+	1: "AES-128-CCM",
+	2: "AES-128-GCM",
+	3: "AES-256-CCM",
+	4: "AES-256-GCM",
+}
+
+// hostPosture is one row of the audit report.
+type hostPosture struct {
+	Host       string `json:"host"`
+	Dialect    string `json:"dialect"`
+	Signing    string `json:"signing"`    // "required" or "enabled"
+	Encryption string `json:"encryption"` // cipher, "supported", or "none"
+	SMB1       bool   `json:"smb1"`
+	GuestAuth  bool   `json:"guest_auth"`
+	Error      string `json:"error,omitempty"`
+}
+
+// smb2NegotiateRequest builds a NEGOTIATE offering auditDialects with the
+// SMB 3.1.1 preauth-integrity and encryption contexts.
+func smb2NegotiateRequest() []byte {
+	b := make([]byte, 64, 256)
+	copy(b, "\xfeSMB")
+	binary.LittleEndian.PutUint16(b[4:], 64) // header size
+	binary.LittleEndian.PutUint16(b[14:], 1) // credits requested
+
+	b = binary.LittleEndian.AppendUint16(b, 36) // structure size
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(auditDialects)))
+	b = binary.LittleEndian.AppendUint16(b, smb2SigningEnabled)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, 0x7f) // all SMB 3 capabilities
+	guid := make([]byte, 16)
+	rand.Read(guid)
+	b = append(b, guid...)
+	ctxOffsetAt := len(b)
+	b = binary.LittleEndian.AppendUint32(b, 0) // context offset, patched below
+	b = binary.LittleEndian.AppendUint16(b, 2) // context count
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	for _, d := range auditDialects {
+		b = binary.LittleEndian.AppendUint16(b, d)
+	}
+
+	salt := make([]byte, 32)
+	rand.Read(salt)
+	preauth := binary.LittleEndian.AppendUint16(nil, 1) // one hash algorithm
+	preauth = binary.LittleEndian.AppendUint16(preauth, uint16(len(salt)))
+	preauth = binary.LittleEndian.AppendUint16(preauth, 1) // SHA-512
+	preauth = append(preauth, salt...)
+	ciphers := binary.LittleEndian.AppendUint16(nil, 4)
+	for _, c := range []uint16{4, 3, 2, 1} {
+		ciphers = binary.LittleEndian.AppendUint16(ciphers, c)
+	}
+
+	for i, ctx := range []struct {
+		typ  uint16
+		data []byte
+	}{{negCtxPreauth, preauth}, {negCtxEncryption, ciphers}} {
+		for len(b)%8 != 0 {
+			b = append(b, 0)
+		}
+		if i == 0 {
+			binary.LittleEndian.PutUint32(b[ctxOffsetAt:], uint32(len(b)))
+		}
+		b = binary.LittleEndian.AppendUint16(b, ctx.typ)
+		b = binary.LittleEndian.AppendUint16(b, uint16(len(ctx.data)))
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = append(b, ctx.data...)
+	}
+	return b
+}
+
+// parseNegotiateResponse fills in the dialect, signing, and encryption of p
+// from an SMB2 NEGOTIATE response.
+func parseNegotiateResponse(msg []byte, p *hostPosture) error {
+	if len(msg) < 64+64 || !bytes.Equal(msg[:4], []byte("\xfeSMB")) {
+		return errors.New("not an SMB2 negotiate response")
+	}
+	if status := binary.LittleEndian.Uint32(msg[8:]); status != 0 {
+		return fmt.Errorf("negotiate failed with status 0x%08x", status)
+	}
+	body := msg[64:]
+	security := binary.LittleEndian.Uint16(body[2:])
+	dialect := binary.LittleEndian.Uint16(body[4:])
+	ctxCount := int(binary.LittleEndian.Uint16(body[6:]))
+	caps := binary.LittleEndian.Uint32(body[24:])
+
+	p.Dialect = dialectNames[dialect]
+	if p.Dialect == "" {
+		p.Dialect = fmt.Sprintf("0x%04x", dialect)
+	}
+	p.Signing = "enabled"
+	if security&smb2SigningRequired != 0 {
+		p.Signing = "required"
+	}
+	p.Encryption = "none"
+	switch {
+	case dialect == 0x0311:
+		off := int(binary.LittleEndian.Uint32(body[60:]))
+		for i := 0; i < ctxCount; i++ {
+			off = (off + 7) &^ 7
+			if off+8 > len(msg) {
+				return errors.New("truncated negotiate contexts")
+			}
+			typ := binary.LittleEndian.Uint16(msg[off:])
+			n := int(binary.LittleEndian.Uint16(msg[off+2:]))
+			data := msg[off+8:]
+			if len(data) < n {
+				return errors.New("truncated negotiate contexts")
+			}
+			if typ == negCtxEncryption && n >= 4 && binary.LittleEndian.Uint16(data) > 0 {
+				if c := binary.LittleEndian.Uint16(data[2:]); c != 0 {
+					p.Encryption = cipherNames[c]
+					if p.Encryption == "" {
+						p.Encryption = fmt.Sprintf("cipher %d", c)
+					}
+				}
+			}
+			off += 8 + n
+		}
+	case dialect >= 0x0300 && caps&smb2NegotiateCapEncryption != 0:
+		p.Encryption = "supported"
+	}
+	return nil
+}
+
+// smb1NegotiateRequest offers only the NT LM 0.12 dialect, so a server
+// answers with SMB1 only if it still speaks it.
+func smb1NegotiateRequest() []byte {
+	b := make([]byte, 32)
+	copy(b, "\xffSMB")
+	b[4] = 0x72                                   // SMB_COM_NEGOTIATE
+	b[9] = 0x18                                   // case-insensitive, canonical paths
+	binary.LittleEndian.PutUint16(b[10:], 0xc001) // unicode, NT status, long names
+	binary.LittleEndian.PutUint16(b[26:], 0xfeff) // PID
+	dialect := []byte("\x02NT LM 0.12\x00")
+	b = append(b, 0) // word count
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(dialect)))
+	return append(b, dialect...)
+}
+
+// roundTrip sends msg framed for direct TCP transport and returns the reply.
+func roundTrip(conn net.Conn, msg []byte, timeout time.Duration) ([]byte, error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(msg)))
+	if _, err := conn.Write(append(frame, msg...)); err != nil {
+		return nil, err
+	}
+	var hdr [4]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:]) & 0xffffff
+	reply := make([]byte, n)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// auditHost probes one host: an SMB2 negotiate for dialect, signing, and
+// encryption, an SMB1-only negotiate, and a logon as a made-up user with
+// no password, which servers that map unknown users to guest accept.
+func auditHost(host string, timeout time.Duration) hostPosture {
+	p := hostPosture{Host: host}
+	conn, err := dialServer(host, timeout)
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	start := time.Now()
+	reply, err := roundTrip(conn, smb2NegotiateRequest(), timeout)
+	opStats.observe("negotiate", start)
+	conn.Close()
+	if err == nil {
+		err = parseNegotiateResponse(reply, &p)
+	}
+	if err != nil {
+		p.Error = fmt.Sprintf("smb2 negotiate: %v", err)
+		return p
+	}
+
+	if conn, err := dialServer(host, timeout); err == nil {
+		reply, err := roundTrip(conn, smb1NegotiateRequest(), timeout)
+		conn.Close()
+		p.SMB1 = err == nil && len(reply) >= 9 && bytes.Equal(reply[:4], []byte("\xffSMB")) && binary.LittleEndian.Uint32(reply[5:]) == 0
+	}
+
+	if conn, err := dialServer(host, timeout); err == nil {
+		user := make([]byte, 6)
+		rand.Read(user)
+		dialer := &smb2.Dialer{Initiator: &smb2.NTLMInitiator{User: "smbput-audit-" + hex.EncodeToString(user)}}
+		conn.SetDeadline(time.Now().Add(timeout))
+		if session, err := dialer.Dial(conn); err == nil {
+			p.GuestAuth = true
+			session.Logoff()
+		}
+		conn.Close()
+	}
+	return p
+}
+
+// readHostList reads one host or host:port per line; blank lines and lines
+// starting with # are ignored.
+func readHostList(r io.Reader) ([]string, error) {
+	var hosts []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+	return hosts, scanner.Err()
+}
+
+func writeAuditCSV(w io.Writer, rows []hostPosture) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"host", "dialect", "signing", "encryption", "smb1", "guest_auth", "error"})
+	for _, r := range rows {
+		cw.Write([]string{r.Host, r.Dialect, r.Signing, r.Encryption, strconv.FormatBool(r.SMB1), strconv.FormatBool(r.GuestAuth), r.Error})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// auditHosts probes every host in the list, jobs at a time, and writes the
+// report in input order as csv or json. Hosts that could not be probed are
+// reported with an error and make the command fail.
+func auditHosts(w io.Writer, listFile, format string, jobs int, timeout time.Duration) error {
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("invalid -format %q: want csv or json", format)
+	}
+	f, err := os.Open(listFile)
+	if err != nil {
+		return err
+	}
+	hosts, err := readHostList(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("read %s: %w", listFile, err)
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	rows := make([]hostPosture, len(hosts))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				rows[i] = auditHost(hosts[i], timeout)
+			}
+		}()
+	}
+	for i := range hosts {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(withSchemaEach("audit-hosts", rows))
+	} else {
+		err = writeAuditCSV(w, rows)
+	}
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range rows {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hosts could not be audited", failed, len(rows))
+	}
+	return nil
+}
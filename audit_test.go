@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// negotiateResponse builds an SMB2 NEGOTIATE response; for 3.1.1 it carries
+// an encryption context choosing cipher.
+func negotiateResponse(dialect, security uint16, caps uint32, cipher uint16) []byte {
+	b := make([]byte, 64)
+	copy(b, "\xfeSMB")
+	binary.LittleEndian.PutUint16(b[4:], 64)
+	b[12] = 1 // SMB2_FLAGS_SERVER_TO_REDIR
+
+	body := make([]byte, 64)
+	binary.LittleEndian.PutUint16(body[0:], 65)
+	binary.LittleEndian.PutUint16(body[2:], security)
+	binary.LittleEndian.PutUint16(body[4:], dialect)
+	binary.LittleEndian.PutUint32(body[24:], caps)
+	binary.LittleEndian.PutUint32(body[28:], 1<<20)
+	binary.LittleEndian.PutUint32(body[32:], 1<<20)
+	binary.LittleEndian.PutUint32(body[36:], 1<<20)
+	binary.LittleEndian.PutUint16(body[56:], 128)
+	if dialect == 0x0311 {
+		binary.LittleEndian.PutUint16(body[6:], 1)
+		binary.LittleEndian.PutUint32(body[60:], 128)
+	}
+	b = append(b, body...)
+	if dialect == 0x0311 {
+		b = binary.LittleEndian.AppendUint16(b, negCtxEncryption)
+		b = binary.LittleEndian.AppendUint16(b, 4)
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = binary.LittleEndian.AppendUint16(b, 1)
+		b = binary.LittleEndian.AppendUint16(b, cipher)
+	}
+	return b
+}
+
+func TestParseNegotiateResponse(t *testing.T) {
+	tests := []struct {
+		msg  []byte
+		want hostPosture
+	}{
+		{negotiateResponse(0x0311, smb2SigningEnabled|smb2SigningRequired, 0, 4), hostPosture{Dialect: "3.1.1", Signing: "required", Encryption: "AES-256-GCM"}},
+		{negotiateResponse(0x0311, smb2SigningEnabled, 0, 0), hostPosture{Dialect: "3.1.1", Signing: "enabled", Encryption: "none"}},
+		{negotiateResponse(0x0300, smb2SigningEnabled, smb2NegotiateCapEncryption, 0), hostPosture{Dialect: "3.0", Signing: "enabled", Encryption: "supported"}},
+		{negotiateResponse(0x0210, smb2SigningEnabled, smb2NegotiateCapEncryption, 0), hostPosture{Dialect: "2.1", Signing: "enabled", Encryption: "none"}},
+	}
+	for _, tt := range tests {
+		var got hostPosture
+		if err := parseNegotiateResponse(tt.msg, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("parseNegotiateResponse = %+v, want %+v", got, tt.want)
+		}
+	}
+	if err := parseNegotiateResponse([]byte("\xffSMB"), &hostPosture{}); err == nil {
+		t.Error("SMB1 reply accepted as an SMB2 negotiate response")
+	}
+}
+
+func TestSMB2NegotiateRequestLayout(t *testing.T) {
+	req := smb2NegotiateRequest()
+	body := req[64:]
+	if n := int(binary.LittleEndian.Uint16(body[2:])); n != len(auditDialects) {
+		t.Fatalf("dialect count = %d", n)
+	}
+	off := binary.LittleEndian.Uint32(body[28:])
+	if off%8 != 0 || int(off) != 64+36+2*len(auditDialects)+2 {
+		t.Fatalf("negotiate context offset = %d", off)
+	}
+	if typ := binary.LittleEndian.Uint16(req[off:]); typ != negCtxPreauth {
+		t.Fatalf("first context type = %d", typ)
+	}
+}
+
+// fakeSMBServer answers every SMB2 negotiate with reply and hangs up on
+// anything else, including SMB1 and session setup.
+func fakeSMBServer(t *testing.T, reply []byte) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					var hdr [4]byte
+					if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+						return
+					}
+					msg := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+					if _, err := io.ReadFull(conn, msg); err != nil {
+						return
+					}
+					if !bytes.HasPrefix(msg, []byte("\xfeSMB")) || binary.LittleEndian.Uint16(msg[12:]) != 0 {
+						return
+					}
+					conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(reply))), reply...))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestAuditHosts(t *testing.T) {
+	good := fakeSMBServer(t, negotiateResponse(0x0311, smb2SigningEnabled|smb2SigningRequired, 0, 2))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().String()
+	ln.Close()
+
+	list := filepath.Join(t.TempDir(), "hosts.txt")
+	if err := os.WriteFile(list, []byte("# file servers\n"+good+"\n\n"+closed+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = auditHosts(&buf, list, "csv", 2, 2*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Fatalf("auditHosts error = %v, want 1 of 2 hosts failing", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want header and 2 hosts: %v", len(rows), rows)
+	}
+	if want := []string{good, "3.1.1", "required", "AES-128-GCM", "false", "false", ""}; strings.Join(rows[1], ",") != strings.Join(want, ",") {
+		t.Errorf("row = %v, want %v", rows[1], want)
+	}
+	if rows[2][0] != closed || rows[2][6] == "" {
+		t.Errorf("unreachable host row = %v", rows[2])
+	}
+}
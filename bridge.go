@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// bridgeItem is one object or file to move across the bridge.
+type bridgeItem struct {
+	src, dst string
+	size     int64
+}
+
+// maxS3PutSize is the largest object a single PUT can store; larger ones
+// need a multipart upload, which the bridge does not implement.
+const maxS3PutSize = 5 << 30
+
+// s3RelativeKey maps an object key below prefix to a path relative to the
+// destination directory. A prefix not ending in / names a directory or a
+// single object, so logs matches logs/a.gz but not logs2024/a.gz. Folder
+// placeholder keys ending in / are skipped. A prefix naming a single object
+// maps to that object's base name.
+func s3RelativeKey(prefix, key string) (string, bool) {
+	if strings.HasSuffix(key, "/") || !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+	rel := strings.TrimPrefix(key, prefix)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") && rel != "" && !strings.HasPrefix(rel, "/") {
+		return "", false
+	}
+	rel = strings.TrimPrefix(rel, "/")
+	if rel == "" {
+		rel = path.Base(key)
+	}
+	return rel, true
+}
+
+// listS3Prefix lists the objects s3://bucket/prefix names: those below it
+// as a directory, or, when there are none, the object called prefix.
+func listS3Prefix(s3 *s3Client, bucket, prefix string) ([]s3Object, error) {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return s3.list(bucket, prefix)
+	}
+	objects, err := s3.list(bucket, prefix+"/")
+	if err != nil || len(objects) > 0 {
+		return objects, err
+	}
+	objects, err = s3.list(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		if obj.Key == prefix {
+			return []s3Object{obj}, nil
+		}
+	}
+	return nil, nil
+}
+
+// s3JoinKey appends a relative path to an object key prefix.
+func s3JoinKey(prefix, rel string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix + rel
+	}
+	return prefix + "/" + rel
+}
+
+// etagMatches compares a single-part object's ETag with the MD5 computed
+// while streaming. Multipart and SSE-KMS ETags are not plain MD5s; checked is
+// false for those.
+func etagMatches(etag string, sum []byte) (ok, checked bool) {
+	etag = strings.Trim(etag, `"`)
+	if len(etag) != md5.Size*2 {
+		return false, false
+	}
+	if _, err := hex.DecodeString(etag); err != nil {
+		return false, false
+	}
+	return strings.EqualFold(etag, hex.EncodeToString(sum)), true
+}
+
+// bridge moves data between S3 and the share in whichever direction the
+// arguments name: exactly one of src and dst must be an s3:// URL, the other
+// an smb:// URL or a path on -share.
+func bridge(ctx context.Context, opts smbOptions, src, dst string) error {
+	fromS3 := strings.HasPrefix(src, "s3://")
+	if fromS3 == strings.HasPrefix(dst, "s3://") {
+		return errors.New("bridge needs exactly one s3:// URL")
+	}
+	s3URL, smbArg := src, dst
+	if !fromS3 {
+		s3URL, smbArg = dst, src
+	}
+	bucket, prefix, err := parseS3URL(s3URL)
+	if err != nil {
+		return err
+	}
+	target, err := parseRemoteTarget(smbArg, opts.address, opts.share)
+	if err != nil {
+		return err
+	}
+	s3, err := newS3Client(opts.s3Endpoint, opts.s3Region)
+	if err != nil {
+		return err
+	}
+
+	shares, cleanup, err := openShareSet(opts)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer cleanup()
+	share, err := shares.mount(target.share)
+	if err != nil {
+		return err
+	}
+	if fromS3 {
+		return bridgeS3ToSMB(ctx, s3, bucket, prefix, share, target.path, opts.jobs)
+	}
+	return bridgeSMBToS3(ctx, share, target.path, s3, bucket, prefix, opts.jobs)
+}
+
+// runBridge copies items with up to jobs concurrent transfers, logging each
+// failure and returning an error if any item failed.
+func runBridge(ctx context.Context, items []bridgeItem, jobs int, copyItem func(it bridgeItem) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	var copied, bytes, failed atomic.Int64
+	work := make(chan bridgeItem)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range work {
+				if err := copyItem(it); err != nil {
+					log.Printf("%s -> %s: %v", it.src, it.dst, err)
+					failed.Add(1)
+					continue
+				}
+				copied.Add(1)
+				bytes.Add(it.size)
+			}
+		}()
+	}
+	for _, it := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- it
+	}
+	close(work)
+	wg.Wait()
+
+	fmt.Fprintf(os.Stderr, "%d copied (%s), %d failed\n", copied.Load(), humanBytes(bytes.Load()), failed.Load())
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if n := failed.Load(); n > 0 {
+		return fmt.Errorf("%d of %d transfers failed", n, len(items))
+	}
+	return nil
+}
+
+// bridgeS3ToSMB streams every object under s3://bucket/prefix into dir on the
+// share, verifying each against its ETag where that is an MD5.
+func bridgeS3ToSMB(ctx context.Context, s3 *s3Client, bucket, prefix string, share *smb2.Share, dir string, jobs int) error {
+	objects, err := listS3Prefix(s3, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	var items []bridgeItem
+	for _, obj := range objects {
+		if rel, ok := s3RelativeKey(prefix, obj.Key); ok {
+			items = append(items, bridgeItem{src: obj.Key, dst: joinRemote(dir, rel), size: obj.Size})
+		}
+	}
+
+	return runBridge(ctx, items, jobs, func(it bridgeItem) error {
+		body, etag, err := s3.get(bucket, it.src)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		if d := path.Dir(it.dst); d != "." {
+			share.MkdirAll(d, 0o755)
+		}
+		start := time.Now()
+		dst, err := share.Create(it.dst)
+		opStats.observe("create", start)
+		if err != nil {
+			return fmt.Errorf("create remote %s: %w", it.dst, err)
+		}
+		defer dst.Close()
+
+		h := md5.New()
+		if _, err := copyChunked(timedWriter{dst, "write"}, io.TeeReader(ctxReader{ctx, body}, h)); err != nil {
+			return err
+		}
+		if ok, checked := etagMatches(etag, h.Sum(nil)); checked && !ok {
+			return errors.New("checksum mismatch with S3 ETag")
+		}
+		return dst.Close()
+	})
+}
+
+// bridgeSMBToS3 uploads every file below dir on the share to
+// s3://bucket/prefix, checking the returned ETag against the MD5 of what was
+// read.
+func bridgeSMBToS3(ctx context.Context, share *smb2.Share, dir string, s3 *s3Client, bucket, prefix string, jobs int) error {
+	dir = normalizeRemotePath(dir)
+	var items []bridgeItem
+	fi, err := share.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", dir, err)
+	}
+	if !fi.IsDir() {
+		items = append(items, bridgeItem{src: dir, dst: s3JoinKey(prefix, path.Base(dir)), size: fi.Size()})
+	} else {
+		err = walkRemote(shareFS(share), dir, func(p string, fi os.FileInfo) error {
+			if !fi.IsDir() {
+				rel := p
+				if dir != "." {
+					rel = strings.TrimPrefix(p, dir+"/")
+				}
+				items = append(items, bridgeItem{src: p, dst: s3JoinKey(prefix, rel), size: fi.Size()})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return runBridge(ctx, items, jobs, func(it bridgeItem) error {
+		if it.size > maxS3PutSize {
+			return fmt.Errorf("%s is larger than the 5 GiB a single S3 upload takes, and multipart uploads are not supported", humanBytes(it.size))
+		}
+		start := time.Now()
+		src, err := share.Open(it.src)
+		opStats.observe("open", start)
+		if err != nil {
+			return fmt.Errorf("open remote %s: %w", it.src, err)
+		}
+		defer src.Close()
+
+		h := md5.New()
+		r := io.TeeReader(ctxReader{ctx, timedReader{src, "read"}}, h)
+		etag, err := s3.put(bucket, it.dst, r, it.size)
+		if err != nil {
+			return err
+		}
+		if ok, checked := etagMatches(etag, h.Sum(nil)); checked && !ok {
+			return errors.New("checksum mismatch with S3 ETag")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestS3RelativeKey(t *testing.T) {
+	tests := []struct {
+		prefix, key string
+		want        string
+		ok          bool
+	}{
+		{"exports/", "exports/2024/a.csv", "2024/a.csv", true},
+		{"exports", "exports/a.csv", "a.csv", true},
+		{"exports", "exports2024/a.csv", "", false},
+		{"exports", "exports.csv", "", false},
+		{"", "a.csv", "a.csv", true},
+		{"exports/a.csv", "exports/a.csv", "a.csv", true},
+		{"exports/", "exports/2024/", "", false},
+	}
+	for _, tc := range tests {
+		got, ok := s3RelativeKey(tc.prefix, tc.key)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("s3RelativeKey(%q, %q) = %q, %v; want %q, %v", tc.prefix, tc.key, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestListS3Prefix(t *testing.T) {
+	keys := []string{"logs/a.gz", "logs/sub/b.gz", "logs2024/a.gz", "report.csv", "report.csv.bak"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<ListBucketResult><IsTruncated>false</IsTruncated>")
+		for _, k := range keys {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>1</Size></Contents>", k)
+			}
+		}
+		fmt.Fprint(w, "</ListBucketResult>")
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	c := &s3Client{endpoint: u, region: "us-east-1", http: srv.Client(), now: time.Now}
+
+	for prefix, want := range map[string]string{
+		"logs":       "logs/a.gz logs/sub/b.gz",
+		"logs/":      "logs/a.gz logs/sub/b.gz",
+		"report.csv": "report.csv",
+		"missing":    "",
+	} {
+		objects, err := listS3Prefix(c, "bucket", prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, obj := range objects {
+			got = append(got, obj.Key)
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("listS3Prefix(%q) = %v, want %s", prefix, got, want)
+		}
+	}
+}
+
+func TestS3JoinKey(t *testing.T) {
+	for _, tc := range []struct{ prefix, rel, want string }{
+		{"", "a.csv", "a.csv"},
+		{"backup/", "x/a.csv", "backup/x/a.csv"},
+		{"backup", "a.csv", "backup/a.csv"},
+	} {
+		if got := s3JoinKey(tc.prefix, tc.rel); got != tc.want {
+			t.Errorf("s3JoinKey(%q, %q) = %q, want %q", tc.prefix, tc.rel, got, tc.want)
+		}
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	sum := md5.Sum([]byte("hello"))
+	tests := []struct {
+		etag        string
+		ok, checked bool
+	}{
+		{`"5d41402abc4b2a76b9719d911017c592"`, true, true},
+		{`"00000000000000000000000000000000"`, false, true},
+		{`"5d41402abc4b2a76b9719d911017c592-3"`, false, false},
+		{"", false, false},
+	}
+	for _, tc := range tests {
+		ok, checked := etagMatches(tc.etag, sum[:])
+		if ok != tc.ok || checked != tc.checked {
+			t.Errorf("etagMatches(%s) = %v, %v; want %v, %v", tc.etag, ok, checked, tc.ok, tc.checked)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// remoteBirthTime returns the creation time reported by the server for fi.
+func remoteBirthTime(fi os.FileInfo) (time.Time, bool) {
+	st, ok := fi.(*smb2.FileStat)
+	if !ok || st.CreationTime.IsZero() {
+		return time.Time{}, false
+	}
+	return st.CreationTime, true
+}
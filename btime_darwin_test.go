@@ -0,0 +1,30 @@
+//go:build darwin
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSetLocalBirthTime(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "a")
+	if err := os.WriteFile(p, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2021, 5, 4, 3, 2, 1, 0, time.UTC)
+	if err := setLocalBirthTime(p, created); err != nil {
+		t.Fatal(err)
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(p, &st); err != nil {
+		t.Fatal(err)
+	}
+	if got := time.Unix(st.Btim.Unix()); !got.Equal(created) {
+		t.Errorf("birth time = %v, want %v", got, created)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows && !darwin
+
+package main
+
+import "time"
+
+// setLocalBirthTime is a no-op: Linux has no call that sets a file's birth
+// time after creation.
+func setLocalBirthTime(path string, t time.Time) error {
+	return nil
+}
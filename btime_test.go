@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+func TestRemoteBirthTime(t *testing.T) {
+	created := time.Date(2021, 5, 4, 3, 2, 1, 0, time.UTC)
+	got, ok := remoteBirthTime(&smb2.FileStat{CreationTime: created, FileName: "a"})
+	if !ok || !got.Equal(created) {
+		t.Fatalf("remoteBirthTime = %v, %v; want %v, true", got, ok, created)
+	}
+
+	if _, ok := remoteBirthTime(&smb2.FileStat{FileName: "b"}); ok {
+		t.Fatalf("remoteBirthTime reported a zero creation time")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// foldCase maps a path to the form a case-insensitive share such as NTFS
+// compares names in.
+func foldCase(p string) string { return strings.ToUpper(p) }
+
+// caseCollisions finds the files of an upload that a case-insensitive share
+// would store as one: files whose remote paths differ only in case
+// (README.md and readme.md), and files named like a directory of the
+// upload. Each group lists the colliding local paths, relative to the tree
+// and sorted, a directory with a trailing slash; groups come sorted too.
+// Directories that differ only in case merely merge and are not reported.
+func (t *treeUpload) caseCollisions() [][]string {
+	groups := make(map[string][]string)
+	for _, it := range t.items {
+		key := foldCase(it.remote)
+		groups[key] = append(groups[key], t.rels[it.local])
+	}
+	for dir := range t.times.times {
+		key := foldCase(dir)
+		if files, ok := groups[key]; ok {
+			groups[key] = append(files, relRemote(t.remote, dir)+"/")
+		}
+	}
+	var out [][]string
+	for _, g := range groups {
+		if len(g) > 1 {
+			sort.Strings(g)
+			out = append(out, g)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i][0] < out[j][0] })
+	return out
+}
+
+// localCaseCollisions finds the files of a local tree that a
+// case-insensitive share would store as one, as caseCollisions does for an
+// upload. sync -two-way checks the whole tree rather than what it uploads,
+// since a file already on the share collides as well.
+func localCaseCollisions(local *localTree, rules []transferRule) [][]string {
+	t := &treeUpload{remote: ".", rels: make(map[string]string), times: newDirTimes()}
+	for rel := range localByName(local, rules) {
+		t.items = append(t.items, pipelineItem{local: rel, remote: matchRule(rules, rel).remoteName(rel)})
+		t.rels[rel] = rel
+	}
+	for dir := range local.dirs {
+		t.times.record(dir, time.Time{})
+	}
+	return t.caseCollisions()
+}
+
+// caseCollisionError reports the collisions of an upload, ending with fix,
+// what the user can do about them.
+func caseCollisionError(groups [][]string, fix string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d sets of local names differ only in case and would overwrite each other on the share:", len(groups))
+	for _, g := range groups {
+		fmt.Fprintf(&b, "\n  %s", strings.Join(g, ", "))
+	}
+	b.WriteString("\n" + fix)
+	return fmt.Errorf("%s", b.String())
+}
+
+// renameCollisions gives every colliding file but one a remote name of its
+// own: in each group, the first file in sorted order keeps its name unless
+// a directory has it, and the others get " (2)", " (3)", and so on before
+// their extension, skipping names already taken. Each rename is reported
+// to w.
+func (t *treeUpload) renameCollisions(w io.Writer) {
+	dirs := make(map[string]bool)
+	for dir := range t.times.times {
+		dirs[foldCase(dir)] = true
+	}
+	taken := make(map[string]bool)
+	for _, it := range t.items {
+		taken[foldCase(it.remote)] = true
+	}
+	byKey := make(map[string][]int)
+	for i, it := range t.items {
+		key := foldCase(it.remote)
+		byKey[key] = append(byKey[key], i)
+	}
+	var keys []string
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		idx := byKey[key]
+		sort.Slice(idx, func(a, b int) bool { return t.rels[t.items[idx[a]].local] < t.rels[t.items[idx[b]].local] })
+		if !dirs[key] {
+			idx = idx[1:]
+		}
+		for _, i := range idx {
+			it := &t.items[i]
+			for n := 2; ; n++ {
+				candidate := numberedName(it.remote, n)
+				if !taken[foldCase(candidate)] && !dirs[foldCase(candidate)] {
+					taken[foldCase(candidate)] = true
+					fmt.Fprintf(w, "renamed  %s -> %s (case collision)\n", t.rels[it.local], relRemote(t.remote, candidate))
+					it.remote = candidate
+					break
+				}
+			}
+		}
+	}
+}
+
+// numberedName inserts " (n)" into p's base name before its first
+// extension: a/report.tar.gz becomes a/report (2).tar.gz.
+func numberedName(p string, n int) string {
+	dir, base := path.Split(p)
+	stem, ext := base, ""
+	if i := strings.Index(base[1:], "."); i >= 0 {
+		stem, ext = base[:i+1], base[i+1:]
+	}
+	return fmt.Sprintf("%s%s (%d)%s", dir, stem, n, ext)
+}
+
+// checkCollisions fails an upload whose files collide by case, or with
+// rename, gives the colliding files names of their own.
+func (t *treeUpload) checkCollisions(w io.Writer, rename bool) error {
+	groups := t.caseCollisions()
+	if len(groups) == 0 {
+		return nil
+	}
+	if !rename {
+		return caseCollisionError(groups, "rename them, exclude all but one, or pass -rename-collisions")
+	}
+	t.renameCollisions(w)
+	return nil
+}
+
+// renameCollisionsFlag defines -rename-collisions.
+func renameCollisionsFlag(fs *flag.FlagSet, opts *smbOptions) {
+	fs.BoolVar(&opts.renameClashes, "rename-collisions", false, "Upload files whose names differ only in case as NAME (2).EXT and so on, instead of failing")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// skipCaseInsensitive skips tests whose trees need names that differ only
+// in case, which a case-insensitive local file system cannot hold.
+func skipCaseInsensitive(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a"), nil, 0o644)
+	if _, err := os.Stat(filepath.Join(dir, "A")); err == nil {
+		t.Skip("local file system is case-insensitive")
+	}
+}
+
+func TestCaseCollisions(t *testing.T) {
+	skipCaseInsensitive(t)
+	local := writeTestTree(t, map[string]string{
+		"README.md":   "a",
+		"readme.md":   "b",
+		"Docs/a.txt":  "c",
+		"docs/b.txt":  "d",
+		"build":       "file",
+		"BUILD/out.o": "o",
+		"unique.txt":  "u",
+	})
+	tu, err := scanTreeUpload(&bytes.Buffer{}, local, "dst", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprint(tu.caseCollisions())
+	if want := "[[BUILD/ build] [README.md readme.md]]"; got != want {
+		t.Errorf("collisions = %s, want %s", got, want)
+	}
+	if err := tu.checkCollisions(&bytes.Buffer{}, false); err == nil || !strings.Contains(err.Error(), "README.md, readme.md") {
+		t.Errorf("checkCollisions = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := tu.checkCollisions(&out, true); err != nil {
+		t.Fatal(err)
+	}
+	remotes := make(map[string]string)
+	for _, it := range tu.items {
+		remotes[tu.rels[it.local]] = it.remote
+	}
+	want := map[string]string{
+		"README.md": "dst/README.md",
+		"readme.md": "dst/readme (2).md",
+		"build":     "dst/build (2)",
+	}
+	for rel, remote := range want {
+		if remotes[rel] != remote {
+			t.Errorf("%s uploads to %s, want %s", rel, remotes[rel], remote)
+		}
+	}
+	if len(tu.caseCollisions()) != 0 {
+		t.Errorf("collisions left after renaming: %v", tu.caseCollisions())
+	}
+	if !strings.Contains(out.String(), "renamed  readme.md -> readme (2).md (case collision)") {
+		t.Errorf("output:\n%s", out.String())
+	}
+}
+
+func TestLocalCaseCollisions(t *testing.T) {
+	skipCaseInsensitive(t)
+	root := writeTestTree(t, map[string]string{
+		"README.md":   "a",
+		"readme.md":   "b",
+		"build":       "file",
+		"BUILD/out.o": "o",
+		"unique.txt":  "u",
+	})
+	local, err := scanLocalSide(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprint(localCaseCollisions(local, nil))
+	if want := "[[BUILD/ build] [README.md readme.md]]"; got != want {
+		t.Errorf("collisions = %s, want %s", got, want)
+	}
+}
+
+func TestNumberedName(t *testing.T) {
+	for in, want := range map[string]string{
+		"a/report.tar.gz": "a/report (3).tar.gz",
+		".bashrc":         ".bashrc (3)",
+		"Makefile":        "Makefile (3)",
+	} {
+		if got := numberedName(in, 3); got != want {
+			t.Errorf("numberedName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
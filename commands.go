@@ -0,0 +1,1501 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// command describes one subcommand. The registry drives dispatch, the usage
+// summary, and `smbput help COMMAND`.
+type command struct {
+	name      string
+	args      string // argument synopsis, e.g. "REMOTE_PATH LOCAL_PATH"
+	summary   string
+	details   string
+	setFlags  func(fs *flag.FlagSet, opts *smbOptions)
+	examples  []string
+	minArgs   int
+	maxArgs   int  // -1 for no limit
+	noShare   bool // works on the server without mounting a share
+	offline   bool // needs no connection at all
+	resumable bool // prints a resume token when its transfer is interrupted
+	run       func(ctx context.Context, opts smbOptions, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	// Registered here rather than in the literal so helpCommand can refer to
+	// the registry without an initialization cycle.
+	commands = []*command{
+		{
+			name:    "shares",
+			summary: "List the shares offered by the server.",
+			details: "Hidden shares (names ending in $) and the administrative shares IPC$, ADMIN$, PRINT$, and drive shares such as C$ are left out unless asked for.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.includeHidden, "include-hidden", false, "Also list hidden shares (names ending in $)")
+				fs.BoolVar(&opts.includeSpecial, "include-special", false, "Also list administrative shares (IPC$, ADMIN$, C$, ...)")
+			},
+			examples: []string{
+				"smbput -server nas.local -user alice shares",
+				"smbput -server fs01:1445 -user admin shares -include-hidden -include-special",
+			},
+			noShare: true,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return listShares(opts)
+			},
+		},
+		{
+			name:    "sessions",
+			summary: "List the sessions the connecting user has on the server.",
+			details: "Uses the srvsvc NetrSessionEnum RPC; recent Windows versions only allow it for administrators.",
+			examples: []string{
+				"smbput -server fs01 -user alice sessions",
+			},
+			noShare: true,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return listSessions(os.Stdout, opts)
+			},
+		},
+		{
+			name:    "logoff-others",
+			summary: "Log off the connecting user's stale sessions, e.g. left behind by crashed runs.",
+			details: "A client's sessions are torn down only when all of them have been idle for at least -idle, since the server logs off every session from a client at once; the session running this command is never idle, so stale sessions from the same machine are left alone. Uses the srvsvc NetrSessionDel RPC, which usually needs administrator rights.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.DurationVar(&opts.idle, "idle", 15*time.Minute, "Only log off clients whose sessions have been idle this long")
+			},
+			examples: []string{
+				"smbput -server fs01 -user svc-backup logoff-others -idle 1h",
+			},
+			noShare: true,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return logoffStale(os.Stdout, opts, opts.idle)
+			},
+		},
+		{
+			name:    "ls",
+			args:    "[REMOTE_PATH | PATTERN]",
+			summary: "List directory contents (defaults to the share root).",
+			details: "A glob such as exports/*.csv is matched by the server, so only matching entries are transferred. Names with control characters, invalid UTF-8, or other unprintable characters are printed as quoted, escaped strings unless -raw is given. With -color, directories are blue, archives red, and executables (by extension; SMB has no execute bit) green. " +
+				"Symlinks and junctions are marked l and shown with their target; -follow-symlinks shows what they point to instead and -skip-symlinks hides them. " +
+				"-snapshot lists the path as it was in a shadow copy (Previous Versions).",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.raw, "raw", false, "Print names exactly as stored, without escaping")
+				linkFlags(fs, opts)
+				snapshotFlag(fs, opts)
+				fs.StringVar(&opts.color, "color", "auto", "Colorize names: auto (when stdout is a terminal and NO_COLOR is unset), always, or never")
+				fs.BoolVar(&opts.icons, "icons", false, "Prefix names with Nerd Font icons")
+			},
+			examples: []string{
+				"smbput -server nas.local -share docs -user alice ls reports",
+				"smbput -server nas.local -share docs -user alice ls -color always -icons builds | less -R",
+				"smbput -server nas.local -share docs -user alice ls 'exports/2024-*.csv'",
+			},
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				lf, err := newListFormat(opts.color, opts.icons, opts.raw)
+				if err != nil {
+					return err
+				}
+				links, err := newLinkPolicy(opts.followLinks, opts.skipLinks)
+				if err != nil {
+					return err
+				}
+				token, err := snapshotToken(opts.snapshot)
+				if err != nil {
+					return err
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					return listRemote(share, snapshotPath(token, argOr(args, 0, ".")), lf, links)
+				})
+			},
+		},
+		{
+			name:    "tree",
+			args:    "[REMOTE_PATH]",
+			summary: "Print the directory structure below a path as an indented tree.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.IntVar(&opts.maxDepth, "depth", -1, "Descend at most this many levels (-1 for all)")
+			},
+			examples: []string{
+				"smbput -server nas.local -share projects -user alice tree -depth 2 archive",
+			},
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return treeRemote(share, os.Stdout, argOr(args, 0, "."), opts.maxDepth)
+				})
+			},
+		},
+		{
+			name:    "stat",
+			args:    "REMOTE_PATH...",
+			summary: "Print size, allocation size, times, and DOS attributes of remote entries.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.json, "json", false, "Print JSON instead of text")
+			},
+			examples: []string{
+				"smbput -server nas.local -share docs -user alice stat reports/q3.xlsx",
+				"smbput -server nas.local -share docs -user alice stat -json reports exports/latest.csv",
+			},
+			minArgs: 1,
+			maxArgs: -1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return statRemote(share, args, opts.json)
+				})
+			},
+		},
+		{
+			name:    "attrib",
+			args:    "[+r|-r] [+h|-h] [+a|-a] [+s|-s] REMOTE_PATH...",
+			summary: "Show or change the DOS attributes of remote entries.",
+			details: "Each path is printed after any change with the attributes it has, in attrib.exe columns (A archive, S system, H hidden, R read-only). " +
+				"Only read-only can currently be changed; asking to change hidden, archive, or system fails unless the entry already has that value.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				for _, a := range []struct{ letter, usage string }{
+					{"r", "Clear the read-only attribute"},
+					{"h", "Clear the hidden attribute"},
+					{"a", "Clear the archive attribute"},
+					{"s", "Clear the system attribute"},
+				} {
+					fs.Var(attribClearFlag{&opts.attribChanges, a.letter}, a.letter, a.usage)
+				}
+			},
+			examples: []string{
+				"smbput -server nas.local -share docs -user alice attrib reports/q3.xlsx",
+				"smbput -server nas.local -share docs -user alice attrib +r reports/final.pdf",
+			},
+			minArgs: 1,
+			maxArgs: -1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				changes := opts.attribChanges
+				var paths []string
+				for _, arg := range args {
+					if strings.HasPrefix(arg, "+") {
+						changes = append(changes, arg)
+					} else {
+						paths = append(paths, arg)
+					}
+				}
+				if len(paths) == 0 {
+					return errors.New("no REMOTE_PATH given")
+				}
+				set, clear, err := parseAttribChanges(changes)
+				if err != nil {
+					return err
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					return attribRemote(share, os.Stdout, paths, set, clear)
+				})
+			},
+		},
+		{
+			name:    "find",
+			args:    "[REMOTE_PATH]",
+			summary: "Print remote paths below a directory that match every given predicate.",
+			details: "-size takes +N (larger than), -N (smaller than), or N (exactly) bytes, with an optional k, M, G, or T suffix. Unprintable names are escaped as in ls unless -raw is given. " +
+				"Linked directories are not descended into unless -follow-symlinks is given.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.raw, "raw", false, "Print names exactly as stored, without escaping")
+				linkFlags(fs, opts)
+				fs.StringVar(&opts.findName, "name", "", "Match base names against this glob (case-insensitive)")
+				fs.StringVar(&opts.findType, "type", "", "Match only files (f), directories (d), or symlinks and junctions (l)")
+				fs.DurationVar(&opts.newerThan, "newer-than", 0, "Match entries modified less than this long ago (e.g. 24h)")
+				fs.StringVar(&opts.findSize, "size", "", "Match sizes: +N, -N, or N (e.g. +100M)")
+			},
+			examples: []string{
+				"smbput -server nas.local -share projects -user alice find archive -name '*.tmp' -type f",
+				"smbput -server nas.local -share projects -user alice find -size +1G -newer-than 168h",
+			},
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				filter, err := newFindFilter(opts.findName, opts.findType, opts.newerThan, opts.findSize)
+				if err != nil {
+					return err
+				}
+				links, err := newLinkPolicy(opts.followLinks, opts.skipLinks)
+				if err != nil {
+					return err
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					return findRemote(share, os.Stdout, argOr(args, 0, "."), filter, opts.raw, links)
+				})
+			},
+		},
+		{
+			name:    "grep",
+			args:    "PATTERN REMOTE_PATH... | REMOTE_GLOB...",
+			summary: "Print lines of remote files matching a regular expression, prefixed with their path.",
+			details: "PATTERN is a Go regular expression. Files are streamed rather than downloaded, and matches are printed as each file is searched; files with a NUL byte in their first 8000 bytes are treated as binary and only reported as matching. " +
+				"With -r, directories are searched through, without following links; otherwise they are skipped. Exits non-zero if nothing matched.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.StringVar(&opts.maxSize, "max-size", "", "Skip files larger than this (e.g. 100M; default no limit)")
+				fs.BoolVar(&opts.recursive, "r", false, "Search every file below directory arguments")
+				fs.BoolVar(&opts.lineNumbers, "n", false, "Prefix each line with its line number")
+			},
+			examples: []string{
+				"smbput -server nas.local -share logs -user alice grep 'ERROR|FATAL' 'app/2024-06-*.log'",
+				"smbput -server nas.local -share logs -user alice grep -max-size 50M '(?i)timeout' 'iis/*.log'",
+				"smbput -server nas.local -share logs -user alice grep -r -n 'OutOfMemory' app worker/current.log",
+			},
+			minArgs: 2,
+			maxArgs: -1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				re, err := regexp.Compile(args[0])
+				if err != nil {
+					return fmt.Errorf("invalid pattern: %w", err)
+				}
+				gopts := grepOptions{recursive: opts.recursive, lineNumbers: opts.lineNumbers}
+				if opts.maxSize != "" {
+					if gopts.maxSize, err = parseByteSize(opts.maxSize); err != nil {
+						return fmt.Errorf("-max-size: %w", err)
+					}
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					return grepRemote(ctx, share, os.Stdout, re, args[1:], gopts)
+				})
+			},
+		},
+		{
+			name:    "foreach",
+			args:    "'COMMAND {}' REMOTE_PATH... | REMOTE_GLOB...",
+			summary: "Run a local command for each remote file, with the file streamed into its standard input.",
+			details: "COMMAND runs through the shell (sh -c, or cmd /C on Windows) once per file, reading the file's content on stdin, so pipelines such as virus scans or conversions never write the file to local disk. {} is replaced by the quoted remote path, which is also in $SMBPUT_FILE. " +
+				"-jobs commands run at once over one session, sharing stdout and stderr, so their output may interleave. Directories are skipped. A command that exits non-zero is reported without stopping the others, and foreach then exits non-zero.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.IntVar(&opts.jobs, "jobs", 1, "Commands run concurrently")
+			},
+			examples: []string{
+				"smbput -server nas.local -share drop -user svc foreach 'clamscan --no-summary - || echo {}' 'incoming/*'",
+				"smbput -server nas.local -share exports -user svc foreach -jobs 4 'gzip -c > \"$(basename {}).gz\"' 'daily/*.csv'",
+			},
+			minArgs: 2,
+			maxArgs: -1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					var files []string
+					for _, arg := range args[1:] {
+						paths := []string{normalizeRemotePath(arg)}
+						if hasGlobMeta(arg) {
+							var err error
+							if paths, err = expandRemoteGlob(share, arg); err != nil {
+								return err
+							}
+							if len(paths) == 0 {
+								return fmt.Errorf("no match for %s", arg)
+							}
+						}
+						for _, p := range paths {
+							fi, err := share.Stat(p)
+							if err != nil {
+								return err
+							}
+							if fi.IsDir() {
+								fmt.Fprintf(os.Stderr, "%s: is a directory; skipped\n", p)
+								continue
+							}
+							files = append(files, p)
+						}
+					}
+					return foreachRemote(ctx, shareFS(share), args[0], files, opts.jobs, os.Stdout, os.Stderr)
+				})
+			},
+		},
+		{
+			name:    "hash",
+			args:    "REMOTE_PATH...",
+			summary: "Print the digest of remote files.",
+			details: "Files are streamed through the hash, never written locally. Output uses the sha256sum format, one \"DIGEST  PATH\" line per file.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.StringVar(&opts.algo, "algo", "sha256", "Digest algorithm: sha256, md5, or blake3")
+			},
+			examples: []string{
+				"smbput -server nas.local -share exports -user alice hash reports/2024.csv",
+				"smbput -server nas.local -share exports -user alice hash -algo blake3 images/a.iso images/b.iso",
+			},
+			minArgs: 1,
+			maxArgs: -1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return hashRemote(ctx, share, os.Stdout, args, opts.algo)
+				})
+			},
+		},
+		{
+			name:    "head",
+			args:    "REMOTE_PATH",
+			summary: "Print the first lines or bytes of a remote file.",
+			details: "Only as much of the file as needed is read.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.IntVar(&opts.lines, "n", 10, "Number of lines to print")
+				fs.Int64Var(&opts.headBytes, "c", 0, "Print this many bytes instead of lines")
+			},
+			examples: []string{
+				"smbput -server nas.local -share exports -user alice head -n 5 huge.csv",
+				"smbput -server nas.local -share exports -user alice head -c 4096 dump.bin | xxd",
+			},
+			minArgs: 1,
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return headRemote(ctx, share, os.Stdout, args[0], opts.lines, opts.headBytes)
+				})
+			},
+		},
+		{
+			name:    "tail",
+			args:    "REMOTE_PATH",
+			summary: "Print the last lines of a remote file, optionally following appends.",
+			details: "Only the end of the file is read. With -f the file size is polled every -interval and appended bytes are streamed until interrupted; a file that shrinks is treated as truncated and followed from its start.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.IntVar(&opts.lines, "n", 10, "Number of lines to print")
+				fs.BoolVar(&opts.follow, "f", false, "Keep printing data appended to the file")
+				fs.DurationVar(&opts.interval, "interval", time.Second, "How often -f polls the file size")
+			},
+			examples: []string{
+				"smbput -server nas.local -share logs -user alice tail -n 50 iis/u_ex240601.log",
+				"smbput -server nas.local -share logs -user alice tail -f -interval 5s app/service.log",
+			},
+			minArgs: 1,
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				if opts.interval <= 0 {
+					return errors.New("-interval must be positive")
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					return tailRemote(ctx, share, os.Stdout, args[0], opts.lines, opts.follow, opts.interval)
+				})
+			},
+		},
+		{
+			name:    "watch",
+			args:    "REMOTE_DIR",
+			summary: "Print files created, modified, deleted, or renamed in a remote directory.",
+			details: "Runs until interrupted, printing one line (or with -json one JSON object) per change. The directory is scanned every -interval and compared with the previous scan: go-smb2 does not expose SMB2 CHANGE_NOTIFY, so changes are polled rather than pushed, and a file created and deleted between two scans goes unseen. A deletion and a creation of the same size and modification time in one scan are reported as a rename.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.recursive, "r", false, "Watch subdirectories too")
+				fs.DurationVar(&opts.interval, "interval", 2*time.Second, "How often to scan the directory")
+				fs.BoolVar(&opts.json, "json", false, "Print one JSON object per event")
+			},
+			examples: []string{
+				"smbput -server nas.local -share inbox -user alice watch incoming",
+				"smbput -server nas.local -share inbox -user alice watch -r -json -interval 10s . | ./dispatch",
+			},
+			minArgs: 1,
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				if opts.interval <= 0 {
+					return errors.New("-interval must be positive")
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					return watchRemote(ctx, shareFS(share), os.Stdout, args[0], opts.recursive, opts.interval, opts.json)
+				})
+			},
+		},
+		{
+			name:    "get",
+			args:    "REMOTE_PATH LOCAL_PATH | -r REMOTE_DIR LOCAL_DIR",
+			summary: "Download a remote file or directory tree.",
+			details: "On Windows and macOS the remote creation time is restored on the local file. Dropped connections are retried and resume where they stopped. REMOTE_PATH may be an smb://HOST/SHARE/PATH URL on the -server host instead of using -share. " +
+				"-offset and -length fetch only a byte range, e.g. to sample a huge export. " +
+				"A symlink is downloaded as the file it points to unless -skip-symlinks is given. " +
+				"-snapshot fetches the file as it was in a shadow copy (Previous Versions), e.g. to restore yesterday's version. " +
+				"-r downloads the contents of REMOTE_DIR into LOCAL_DIR, creating its subdirectories, keeping relative paths and modification times, and fetching -jobs files at once; it prints a line for each file downloaded, skipped, or failed and exits non-zero if any failed. " +
+				"Links are skipped unless -follow-symlinks is given. Files stored compressed or encrypted by a profile rule are restored to their original content and name. -resume continues a partial LOCAL_PATH from its size, appending the rest of the remote file, or starts over if the local file is the larger; with -r, files an earlier run completed are not fetched again. " +
+				"-max-local-bytes stops a recursive download before it writes more than that many bytes: files that would cross the limit are not started, the run exits non-zero, and -resume continues once there is room. " +
+				"-delete-source turns get into a move, e.g. to consume a drop folder: each remote file is removed once its download is complete and the local copy has its size (with -verify, its SHA-256); with -r, a file that changed on the share while it was being fetched is kept. " +
+				"-segments fetches a single large file as several byte ranges at once, each written straight to its place in the local file, which is allocated to its full size first; files smaller than 16 MiB per segment use fewer segments. Progress is recorded in LOCAL_PATH.segments until the download completes, and a dropped connection or -resume continues each range from there. " +
+				"-no-clobber, -if-newer, and -backup decide what happens to an existing local file as they do for put.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				transferFlags(fs, opts)
+				resumeFlags(fs, opts)
+				linkFlags(fs, opts)
+				snapshotFlag(fs, opts)
+				progressFlag(fs, opts)
+				fs.BoolVar(&opts.recursive, "r", false, "Download the contents of a remote directory tree")
+				fs.BoolVar(&opts.recursive, "recursive", false, "Same as -r")
+				fs.IntVar(&opts.jobs, "jobs", 8, "Files downloaded concurrently with -r")
+				filterFlags(fs, opts)
+				fs.StringVar(&opts.maxLocalBytes, "max-local-bytes", "", "With -r, stop before writing more than this much locally (e.g. 200G)")
+				fs.BoolVar(&opts.deleteSource, "delete-source", false, "Remove each remote file once it is downloaded")
+				fs.BoolVar(&opts.verify, "verify", false, "Compare the SHA-256 of each download with the remote file, reading it again")
+				fs.Int64Var(&opts.offset, "offset", 0, "Start reading the remote file at this byte")
+				fs.Int64Var(&opts.length, "length", 0, "Fetch at most this many bytes (0 for up to the end)")
+				overwriteFlags(fs, opts)
+				fs.IntVar(&opts.segments, "segments", 1, fmt.Sprintf("Fetch a large file as this many ranges at once (1-%d)", maxSegments))
+			},
+			examples: []string{
+				"smbput -server nas.local -share drop -user alice get reports/weekly.pdf ./weekly.pdf",
+				"smbput -server nas.local -user alice get smb://nas.local/archive/2023/q4.tar ./q4.tar",
+				"smbput -server nas.local -share exports -user alice get -offset 1073741824 -length 1048576 huge.csv ./sample.csv",
+				"smbput -server nas.local -share docs -user alice get -snapshot 2024-05-01T07:00:00Z reports/q1.xlsx ./q1-may1.xlsx",
+				"smbput -server nas.local -share projects -user alice get -r www/site ./site",
+				"smbput -server nas.local -share images -user alice get -segments 8 -progress vm/disk.vhdx ./disk.vhdx",
+				"smbput -server partner.example.com -share outbound -user acme get -r -delete-source -verify to-acme ./inbox",
+			},
+			minArgs:   2,
+			maxArgs:   2,
+			resumable: true,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				if err := opts.overwrite.check(opts.resume, false); err != nil {
+					return err
+				}
+				if opts.recursive {
+					return getTree(ctx, opts, args)
+				}
+				if len(opts.filter) > 0 {
+					return errors.New("-include and -exclude need -r")
+				}
+				if opts.maxLocalBytes != "" {
+					return errors.New("-max-local-bytes needs -r")
+				}
+				if opts.offset < 0 || opts.length < 0 {
+					return errors.New("-offset and -length must not be negative")
+				}
+				if opts.segments < 1 || opts.segments > maxSegments {
+					return fmt.Errorf("-segments must be between 1 and %d", maxSegments)
+				}
+				if opts.segments > 1 && (opts.offset != 0 || opts.length != 0) {
+					return errors.New("-segments cannot be combined with -offset or -length")
+				}
+				if (opts.deleteSource || opts.verify) && (opts.offset != 0 || opts.length != 0) {
+					return errors.New("-delete-source and -verify fetch the whole file and cannot be combined with -offset or -length")
+				}
+				if opts.deleteSource && opts.snapshot != "" {
+					return errors.New("-delete-source cannot be combined with -snapshot: snapshots are read-only")
+				}
+				if _, err := newLinkPolicy(opts.followLinks, opts.skipLinks); err != nil {
+					return err
+				}
+				token, err := snapshotToken(opts.snapshot)
+				if err != nil {
+					return err
+				}
+				target, err := parseRemoteTarget(args[0], opts.address, opts.share)
+				if err != nil {
+					return err
+				}
+				target.path = snapshotPath(token, target.path)
+				progress := cliProgress(opts)
+				prepared := false
+				return withSessionReconnect(ctx, opts, func(shares *shareSet, resume bool) error {
+					if resume {
+						progress.retry()
+					}
+					share, err := shares.mount(target.share)
+					if err != nil {
+						return err
+					}
+					if !prepared && opts.overwrite.set() {
+						fi, err := share.Stat(normalizeRemotePath(target.path))
+						if err != nil {
+							return fmt.Errorf("stat %s: %w", target.path, err)
+						}
+						reason, err := opts.overwrite.prepareLocal(args[1], fi.ModTime())
+						if err != nil {
+							return err
+						}
+						if reason != "" {
+							fmt.Fprintf(os.Stderr, "skipping %s: %s\n", args[1], reason)
+							return nil
+						}
+					}
+					prepared = true
+					if opts.skipLinks {
+						if fi, err := share.Lstat(normalizeRemotePath(target.path)); err == nil && isLink(fi) {
+							fmt.Fprintf(os.Stderr, "skipping symlink %s%s\n", target.path, linkSuffix(share, normalizeRemotePath(target.path)))
+							return nil
+						}
+					}
+					topts := transferOptions{resume: resume || opts.resume, stallTimeout: opts.stall, offset: opts.offset, length: opts.length, progress: progress, segments: opts.segments}
+					if err := downloadFile(ctx, share, target.path, args[1], topts); err != nil {
+						return err
+					}
+					if !opts.deleteSource && !opts.verify {
+						return nil
+					}
+					remote := normalizeRemotePath(target.path)
+					if err := checkDownload(ctx, shareFS(share), remote, args[1], opts.verify); err != nil {
+						return err
+					}
+					if !opts.deleteSource {
+						return nil
+					}
+					if err := share.Remove(remote); err != nil {
+						return fmt.Errorf("downloaded, but could not remove %s: %w", remote, err)
+					}
+					return nil
+				})
+			},
+		},
+		{
+			name:    "put",
+			args:    "LOCAL_PATH REMOTE_PATH [REMOTE_PATH...] | -r LOCAL_DIR REMOTE_DIR",
+			summary: "Upload a local file or directory tree, creating missing remote directories.",
+			details: "Dropped connections are retried and resume where they stopped; -resume continues a partial upload left by an earlier run. " +
+				"Each REMOTE_PATH may be an smb://HOST/SHARE/PATH URL on the -server host; several destinations are written concurrently over one session, e.g. to replicate a file across shares. " +
+				"Once every destination is written, -done-marker names a file to create in each destination directory for consumers that poll for it; " +
+				"the name and the -done-template content are Go templates over .Share, .Dir, .Time, and .Files (each with .Name, .Path, .Size), and {{json .}} renders it all as JSON. " +
+				"-append adds the local file after the end of an existing remote file (creating it if missing); a dropped connection resumes after the bytes already appended. " +
+				"Before writing, each destination is checked for room, so a quota or full volume fails the upload up front. " +
+				"Uploads of 256 MiB or more first time a few writes to a scratch file in the first destination's directory to pick the write size and how many writes to keep in flight; -chunk-size and -inflight fix either instead. " +
+				"With -tmp-dir, each upload is written to a .part file in that directory and renamed over its destination once complete, so readers never see a partial file; the probe's scratch file goes there too, and -resume continues the .part file. Use clean-tmp to remove ones left by abandoned runs. " +
+				"-r uploads the contents of LOCAL_DIR into REMOTE_DIR, recreating its directories (with their modification times) and sending -jobs files at once, and prints a line for each file uploaded, skipped, or failed; it exits non-zero if any failed. Links, sockets, named pipes, and devices are skipped and reported, as are files a profile rule skips; other rules may compress, encrypt, or verify files. " +
+				"Reading a named pipe no one writes to would block forever, so pipes and devices are only read with -allow-special, as streams; without it put also refuses a LOCAL_PATH that is one. " +
+				"Uploaded files get the local modification time, and a destination that already has the local file's size and modification time is taken to be unchanged and not sent again, so re-running a put only transfers what changed; -ignore-times uploads every file regardless. " +
+				"-delete-source removes each local file only after it is written to every destination (and, with -done-marker, the markers are written too), turning put into a move; a file that fails to upload is kept. " +
+				"-verify first reads each upload back and compares its SHA-256 with the local file's, and with -r sends every file rather than trusting unchanged ones, so -delete-source -verify never removes a file whose copy differs. " +
+				"An existing destination is replaced unless -no-clobber (keep it), -if-newer (keep it unless the local file is newer), or -backup (rename it to NAME~ first) says otherwise; kept destinations are reported as skipped, and their local files are not removed by -delete-source. " +
+				"-backup-remote keeps several generations instead, as a safety net on shares without versioning: with suffix=.bak,keep=3 a replaced file becomes NAME.bak, the previous NAME.bak becomes NAME.bak.1, and so on up to NAME.bak.2. " +
+				"Since shares are usually case-insensitive, -r fails before uploading anything if two local names differ only in case (README.md and readme.md), listing them; -rename-collisions uploads the later ones as readme (2).md and so on instead.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				transferFlags(fs, opts)
+				tuningFlags(fs, opts)
+				tmpDirFlag(fs, opts)
+				resumeFlags(fs, opts)
+				fs.BoolVar(&opts.recursive, "r", false, "Upload the contents of a local directory tree")
+				fs.BoolVar(&opts.recursive, "recursive", false, "Same as -r")
+				fs.IntVar(&opts.jobs, "jobs", 8, "Files uploaded concurrently with -r")
+				fs.StringVar(&opts.doneMarker, "done-marker", "", "After a successful upload, write this file (a template) in each destination directory")
+				fs.StringVar(&opts.doneTemplate, "done-template", "", "Local template file for the done marker's content (default empty)")
+				fs.BoolVar(&opts.appendMode, "append", false, "Write after the end of an existing remote file instead of replacing it")
+				fs.BoolVar(&opts.ignoreTimes, "ignore-times", false, "Upload even when the destination has the same size and modification time")
+				overwriteFlags(fs, opts)
+				backupRemoteFlag(fs, opts)
+				renameCollisionsFlag(fs, opts)
+				fs.BoolVar(&opts.deleteSource, "delete-source", false, "Remove each local file once it is uploaded")
+				fs.BoolVar(&opts.verify, "verify", false, "Read every upload back and compare its SHA-256 with the local file")
+				allowSpecialFlag(fs, opts)
+				filterFlags(fs, opts)
+				dryRunFlag(fs, opts)
+				progressFlag(fs, opts)
+			},
+			examples: []string{
+				"smbput -server nas.local -share drop -user alice put ./notes.txt uploads/notes.txt",
+				"smbput -server nas.local -share backup -user svc put -deadline 06:00 -resume db.dump nightly/db.dump",
+				"smbput -server nas.local -user svc put db.dump smb://nas.local/backup1/db.dump smb://nas.local/backup2/db.dump",
+				"smbput -server nas.local -share etl -user svc put -done-marker _SUCCESS batch.csv incoming/batch.csv",
+				"smbput -server nas.local -share logs -user svc put -append /var/log/app.log.1 archive/app.log",
+				"smbput -server nas.local -share etl -user svc put -done-marker manifest.json -done-template manifest.tmpl batch.csv incoming/batch.csv",
+				"smbput -server nas.local -share etl -user svc put -tmp-dir .staging batch.csv incoming/batch.csv",
+				"smbput -server nas.local -share projects -user alice put -r ./site www/site",
+				"smbput -server nas.local -share archive -user svc put -r -delete-source -verify ./outbox archive/2026",
+			},
+			minArgs:   2,
+			maxArgs:   -1,
+			resumable: true,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				var err error
+				if opts.overwrite.remoteBackup, err = parseBackupSpec(opts.backupRemote); err != nil {
+					return err
+				}
+				if err := opts.overwrite.check(opts.resume, opts.appendMode); err != nil {
+					return err
+				}
+				if opts.recursive {
+					return putTree(ctx, opts, args)
+				}
+				if len(opts.filter) > 0 {
+					return errors.New("-include and -exclude need -r")
+				}
+				if opts.renameClashes {
+					return errors.New("-rename-collisions needs -r")
+				}
+				targets := make([]remoteTarget, 0, len(args)-1)
+				for _, arg := range args[1:] {
+					target, err := parseRemoteTarget(arg, opts.address, opts.share)
+					if err != nil {
+						return err
+					}
+					targets = append(targets, target)
+				}
+				marker, err := parseDoneMarker(opts.doneMarker, opts.doneTemplate)
+				if err != nil {
+					return err
+				}
+				if opts.appendMode && opts.resume {
+					return errors.New("-append cannot be combined with -resume: how much an earlier run appended is unknown")
+				}
+				if opts.appendMode && opts.tmpDir != "" {
+					return errors.New("-append cannot be combined with -tmp-dir: appending writes to the destination itself")
+				}
+				if opts.appendMode && (opts.deleteSource || opts.verify) {
+					return errors.New("-append cannot be combined with -delete-source or -verify")
+				}
+				if opts.deleteSource || opts.verify {
+					if info, err := os.Stat(args[0]); err == nil && !info.Mode().IsRegular() {
+						return fmt.Errorf("-delete-source and -verify need a regular file, not %s", args[0])
+					}
+				}
+				if opts.dryRun {
+					return withSessionReconnect(ctx, opts, func(shares *shareSet, resume bool) error {
+						open := func(name string) (remoteFS, error) {
+							share, err := shares.mount(name)
+							if err != nil {
+								return nil, err
+							}
+							return shareFS(share), nil
+						}
+						return previewPut(os.Stdout, open, args[0], targets, opts, marker != nil)
+					})
+				}
+				tuning, err := parseTuning(opts.chunkSize, opts.inFlight)
+				if err != nil {
+					return err
+				}
+				var appendBases []int64
+				prepared, kept, roomChecked, tuned := false, false, false, false
+				progress := cliProgress(opts)
+				err = withSessionReconnect(ctx, opts, func(shares *shareSet, resume bool) error {
+					if resume {
+						progress.retry()
+					}
+					if !prepared {
+						active, anyKept, err := prepareTargets(shares, args[0], targets, opts)
+						if err != nil {
+							return err
+						}
+						targets, kept, prepared = active, anyKept, true
+					}
+					if len(targets) == 0 {
+						return nil
+					}
+					topts := transferOptions{resume: resume || opts.resume, stallTimeout: opts.stall, appendMode: opts.appendMode, progress: progress, tmpDir: opts.tmpDir, allowSpecial: opts.allowSpecial, skipUnchanged: !opts.ignoreTimes && !opts.verify}
+					if !roomChecked {
+						if info, err := os.Stat(args[0]); err == nil {
+							if err := checkTargetsRoom(shares, targets, opts.user, info.Size(), opts.appendMode || opts.tmpDir != ""); err != nil {
+								return err
+							}
+						}
+						roomChecked = true
+					}
+					if !tuned {
+						if info, err := os.Stat(args[0]); err == nil {
+							share, err := shares.mount(targets[0].share)
+							if err != nil {
+								return err
+							}
+							probeDir := path.Dir(normalizeRemotePath(targets[0].path))
+							if opts.tmpDir != "" {
+								probeDir = opts.tmpDir
+								share.MkdirAll(normalizeRemotePath(probeDir), 0o755)
+							}
+							tuning = uploadTuning(shareFS(share), probeDir, info.Size(), tuning)
+						}
+						tuned = true
+					}
+					topts.tuning = tuning
+					if opts.appendMode && appendBases == nil {
+						sizes, err := remoteSizes(shares, targets)
+						if err != nil {
+							return err
+						}
+						appendBases = sizes
+					}
+					if err := uploadToTargets(ctx, shares, args[0], targets, topts, appendBases); err != nil {
+						return err
+					}
+					if opts.verify {
+						if err := verifyTargets(ctx, shares, args[0], targets); err != nil {
+							return err
+						}
+					}
+					if marker == nil {
+						return nil
+					}
+					info, err := os.Stat(args[0])
+					if err != nil {
+						return err
+					}
+					return writeDoneMarkers(shares, marker, groupMarkers(targets, info.Size(), time.Now()))
+				})
+				if err != nil || !opts.deleteSource {
+					return err
+				}
+				if kept {
+					fmt.Fprintf(os.Stderr, "keeping %s: not every destination was replaced\n", args[0])
+					return nil
+				}
+				// Only now is every destination written (and verified).
+				if err := os.Remove(args[0]); err != nil {
+					return fmt.Errorf("uploaded, but could not remove the local file: %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:    "sync",
+			args:    "LOCAL_DIR REMOTE_DIR | -pull REMOTE_DIR LOCAL_DIR | -two-way LOCAL_DIR REMOTE_DIR",
+			summary: "Bring a remote directory up to date with a local one, the other way round, or both ways.",
+			details: "A file is sent when REMOTE_DIR lacks it or holds a different size or modification time; unchanged files are left alone, so a repeated sync only sends what changed. " +
+				"Files are uploaded -jobs at once and profile rules apply as for put -r: links, special files, and files a rule skips are not sent. " +
+				"-delete also removes remote files and directories that no longer exist locally, except links and files a rule skips. " +
+				"A remote file with the same content as a new local one is renamed into place rather than deleted and uploaded again. " +
+				"Deletions are planned before the first upload, saved in the user's configuration directory (or $SMBPUT_SYNC_STATE), and carried out only once every upload succeeded, so a failed or interrupted sync never leaves a file deleted whose replacement was not uploaded; the next sync of the same directory finishes them. " +
+				"-pull mirrors REMOTE_DIR down to LOCAL_DIR instead, downloading new and changed files as get -r does; with -delete, local files and directories the share no longer has are removed, except links, special files, and files a rule skips. " +
+				"-two-way propagates changes in both directions: a state file kept next to the delete journals records each file as both sides last agreed on it, so new, changed, and deleted files are told apart on either side and copied or deleted on the other. " +
+				"A file changed on both sides is a conflict, settled by -conflict: newer keeps the most recently modified version, local or remote always keeps that side's, and rename keeps both, moving the local one to NAME.conflict-TIMESTAMP.EXT. A modification always wins over a deletion. " +
+				"-checksum compares files of equal size by SHA-256 of their content instead of by modification time, reading both sides, for trees whose times do not survive the trip between systems; it does not combine with -two-way. " +
+				"-backup-remote renames each remote file a sync replaces aside first, keeping generations as put -backup-remote does; -delete leaves the backups of files that still exist alone. " +
+				"-index keeps an index of the local files' sizes, times, and SHA-256 next to the journals, so -delete recognises a file renamed or moved locally since the last successful sync and renames it on the share without reading any remote file; the first run with -index reads every local file once to build it. " +
+				"Local names that differ only in case fail the sync up front, as with put -r, unless -rename-collisions is given; -two-way checks the whole local tree and cannot rename them, since the renamed copies would come back as new files.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				transferFlags(fs, opts)
+				fs.BoolVar(&opts.pull, "pull", false, "Mirror a remote directory down to a local one")
+				fs.BoolVar(&opts.twoWay, "two-way", false, "Propagate changes in both directions")
+				fs.StringVar(&opts.conflict, "conflict", conflictNewer, "With -two-way, the version kept of a file changed on both sides: newer, local, remote, or rename")
+				fs.BoolVar(&opts.delete, "delete", false, "Remove files and directories the source no longer has")
+				fs.BoolVar(&opts.checksum, "checksum", false, "Compare the content of equal-sized files instead of their times")
+				fs.BoolVar(&opts.syncIndex, "index", false, "With -delete, recognise locally renamed files from a local index instead of reading remote files")
+				backupRemoteFlag(fs, opts)
+				renameCollisionsFlag(fs, opts)
+				allowSpecialFlag(fs, opts)
+				filterFlags(fs, opts)
+				dryRunFlag(fs, opts)
+				fs.IntVar(&opts.jobs, "jobs", 8, "Files transferred concurrently")
+			},
+			examples: []string{
+				"smbput -server nas.local -share projects -user alice sync ./site www/site",
+				"smbput -server nas.local -share backup -user svc sync -delete /srv/data nightly/data",
+				"smbput -server nas.local -share drop -user svc sync -pull -delete inbound /srv/inbound",
+				"smbput -server nas.local -share home -user alice sync -two-way -conflict rename ~/notes notes",
+			},
+			minArgs: 2,
+			maxArgs: 2,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				var err error
+				if opts.overwrite.remoteBackup, err = parseBackupSpec(opts.backupRemote); err != nil {
+					return err
+				}
+				if opts.overwrite.set() && (opts.twoWay || opts.pull) {
+					return errors.New("-backup-remote applies to the files a sync uploads and cannot be combined with -pull or -two-way")
+				}
+				if opts.renameClashes && (opts.twoWay || opts.pull) {
+					return errors.New("-rename-collisions applies to the files a sync uploads and cannot be combined with -pull or -two-way")
+				}
+				if opts.syncIndex && (opts.twoWay || opts.pull || !opts.delete) {
+					return errors.New("-index finds files a sync -delete can rename instead of uploading and needs -delete, without -pull or -two-way")
+				}
+				if opts.twoWay {
+					return syncTwoWay(ctx, opts, args)
+				}
+				if opts.pull {
+					return syncPull(ctx, opts, args)
+				}
+				return syncPush(ctx, opts, args)
+			},
+		},
+		{
+			name:    "symlink",
+			args:    "TARGET LINK_PATH",
+			summary: "Create a symbolic link on the share.",
+			details: "TARGET is stored as given; a relative target is resolved from the link's directory. Windows servers only allow this for accounts with the Create symbolic links privilege, and Samba only when it is configured to store reparse points.",
+			examples: []string{
+				"smbput -server nas.local -share projects -user alice symlink releases/v2.3 releases/current",
+			},
+			minArgs: 2,
+			maxArgs: 2,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return symlinkRemote(share, args[0], args[1])
+				})
+			},
+		},
+		{
+			name:    "mkdir",
+			args:    "REMOTE_DIR...",
+			summary: "Create remote directories.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.parents, "p", false, "Create missing parents; an existing directory is not an error")
+			},
+			examples: []string{
+				"smbput -server nas.local -share projects -user alice mkdir -p 2024/q3/reports",
+			},
+			minArgs: 1,
+			maxArgs: -1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					for _, dir := range args {
+						if err := makeRemoteDir(shareFS(share), dir, opts.parents); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+			},
+		},
+		{
+			name:    "rmdir",
+			args:    "REMOTE_DIR...",
+			summary: "Remove empty remote directories.",
+			examples: []string{
+				"smbput -server nas.local -share projects -user alice rmdir 2024/q3/reports",
+			},
+			minArgs: 1,
+			maxArgs: -1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					for _, dir := range args {
+						if err := removeRemoteDir(shareFS(share), dir); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+			},
+		},
+		{
+			name:    "rm",
+			args:    "REMOTE_PATH...",
+			summary: "Remove remote files, or whole directory trees with -r.",
+			details: "Paths may be server-side globs. With -r, directories are emptied depth-first and then removed, -jobs entries at a time; links to directories are removed themselves, never emptied. The number of entries removed is printed to stderr.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.recursive, "r", false, "Remove directories and their contents")
+				fs.BoolVar(&opts.recursive, "recursive", false, "Same as -r")
+				fs.IntVar(&opts.jobs, "jobs", 8, "Entries removed concurrently with -r")
+				dryRunFlag(fs, opts)
+			},
+			examples: []string{
+				"smbput -server nas.local -share drop -user alice rm uploads/notes.txt",
+				"smbput -server nas.local -share scratch -user ci rm -r 'builds/2023-*'",
+			},
+			minArgs: 1,
+			maxArgs: -1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				jobs := opts.jobs
+				if opts.dryRun {
+					// One at a time keeps the listing in depth-first order.
+					jobs = 1
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					removed := 0
+					defer func() {
+						if opts.dryRun {
+							dryRunSummary(fmt.Sprintf("%d entries to remove", removed))
+						} else {
+							fmt.Fprintf(os.Stderr, "removed %d entries\n", removed)
+						}
+					}()
+					for _, arg := range args {
+						paths := []string{arg}
+						if hasGlobMeta(arg) {
+							var err error
+							if paths, err = expandRemoteGlob(share, arg); err != nil {
+								return err
+							}
+						}
+						for _, p := range paths {
+							n, err := removeRemote(dryRunFS(shareFS(share), opts.dryRun), p, opts.recursive, jobs)
+							removed += n
+							if err != nil {
+								return err
+							}
+						}
+					}
+					return nil
+				})
+			},
+		},
+		{
+			name:    "cp",
+			args:    "SRC DST",
+			summary: "Copy a remote file to another path on the same share, entirely on the server.",
+			details: "Uses server-side copy (FSCTL_SRV_COPYCHUNK), so no data passes through this machine; servers that lack it get a streamed copy. A DST that is an existing directory receives SRC inside it. An existing destination file is only replaced with -force.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.force, "force", false, "Replace an existing destination file")
+			},
+			examples: []string{
+				"smbput -server nas.local -share vms -user alice cp golden/base.vhdx clones/test01.vhdx",
+			},
+			minArgs: 2,
+			maxArgs: 2,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					_, err := copyRemote(shareFS(share.WithContext(ctx)), args[0], args[1], opts.force)
+					return err
+				})
+			},
+		},
+		{
+			name:    "mv",
+			args:    "SRC DST",
+			summary: "Move or rename a remote file or directory on the server.",
+			details: "Nothing is transferred; the server renames the entry. A DST that is an existing directory receives SRC inside it. An existing file at the destination is only replaced with -force.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.force, "force", false, "Replace an existing destination file")
+				dryRunFlag(fs, opts)
+			},
+			examples: []string{
+				"smbput -server nas.local -share drop -user alice mv uploads/notes.txt archive/",
+				"smbput -server nas.local -share drop -user alice mv -force report-new.pdf report.pdf",
+			},
+			minArgs: 2,
+			maxArgs: 2,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return moveRemote(dryRunFS(shareFS(share), opts.dryRun), args[0], args[1], opts.force)
+				})
+			},
+		},
+		{
+			name:    "append",
+			args:    "LOCAL_FILE|- REMOTE_PATH",
+			summary: "Append newline-terminated records to a remote file shared by several writers.",
+			details: "Whole records are packed into writes of at most 64 KiB on an append-only handle, so concurrent appenders on servers with NTFS semantics never interleave partial records. Use - to read from stdin. Not retried on reconnect, since that could duplicate records.",
+			examples: []string{
+				"tail -n0 -F /var/log/app.log | smbput -server nas.local -share logs -user svc append - app/all-hosts.log",
+			},
+			minArgs: 2,
+			maxArgs: 2,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				var src io.Reader = os.Stdin
+				if args[0] != "-" {
+					f, err := os.Open(args[0])
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+					src = f
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					n, err := appendRecords(ctx, share, src, args[1])
+					fmt.Fprintf(os.Stderr, "appended %d records\n", n)
+					return err
+				})
+			},
+		},
+		{
+			name:    "patch",
+			args:    "REMOTE_PATH [LOCAL_FILE|-]",
+			summary: "Overwrite part of an existing remote file in place, starting at -offset.",
+			details: "Reads stdin when LOCAL_FILE is omitted or -. The remote file must exist and is never truncated; writing past its end extends it. Suited to preallocated files such as VM images or fixed-format datasets.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.Int64Var(&opts.offset, "offset", 0, "Byte offset in REMOTE_PATH to start writing at")
+			},
+			examples: []string{
+				"smbput -server nas.local -share vms -user svc patch -offset 1048576 disks/vm1.img header.bin",
+				"printf 'v2' | smbput -server nas.local -share data -user svc patch -offset 12 fixed/records.dat",
+			},
+			minArgs: 1,
+			maxArgs: 2,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				var src io.Reader = os.Stdin
+				if local := argOr(args, 1, "-"); local != "-" {
+					f, err := os.Open(local)
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+					src = f
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					n, err := patchRemote(ctx, share, args[0], src, opts.offset)
+					fmt.Fprintf(os.Stderr, "wrote %d bytes at offset %d\n", n, opts.offset)
+					return err
+				})
+			},
+		},
+		{
+			name:    "bridge",
+			args:    "SRC DST",
+			summary: "Stream objects between S3-compatible storage and the share, in either direction.",
+			details: "One side is s3://BUCKET/PREFIX, the other an smb://HOST/SHARE/PATH URL or a path on -share. Nothing is staged locally. " +
+				"Each transfer is checked against the S3 ETag where that is an MD5 (single-part, non-KMS objects). Credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN. A prefix without a trailing slash names a directory or a single object: logs matches logs/a.gz, not logs2024/a.gz. Files over 5 GiB fail to copy to S3, since multipart uploads are not supported.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.IntVar(&opts.jobs, "jobs", 4, "Objects transferred concurrently")
+				fs.StringVar(&opts.s3Endpoint, "s3-endpoint", "", "S3 endpoint URL (default AWS_ENDPOINT_URL, then AWS)")
+				fs.StringVar(&opts.s3Region, "s3-region", "", "S3 region (default AWS_REGION, then us-east-1)")
+			},
+			examples: []string{
+				"smbput -server nas.local -user svc bridge s3://archive/exports/ smb://nas.local/data/exports",
+				"smbput -server nas.local -share data -user svc bridge -s3-endpoint https://minio:9000 -jobs 16 projects s3://backup/projects/",
+			},
+			minArgs: 2,
+			maxArgs: 2,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return bridge(ctx, opts, args[0], args[1])
+			},
+		},
+		{
+			name:    "relay",
+			args:    "SRC DST",
+			summary: "Stream a file between an SSH host and the share in one hop.",
+			details: "One side is ssh://[USER@]HOST[:PORT]/PATH (/~/PATH is relative to the login directory), the other an smb:// URL or a path on -share. " +
+				"Authentication uses the SSH agent or an unencrypted ~/.ssh/id_* key, and the host key must be in ~/.ssh/known_hosts. The SSH host needs a POSIX shell with cat: the file moves over an exec channel, not SCP or SFTP, so sftp:// and scp:// URLs are refused.",
+			examples: []string{
+				"smbput -server fs01 -share drop -user alice relay ssh://ops@bastion/var/backups/db.dump nightly/db.dump",
+				"smbput -server fs01 -user alice relay smb://fs01/exports/q3.csv ssh://bastion/~/q3.csv",
+			},
+			minArgs: 2,
+			maxArgs: 2,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return relay(ctx, opts, args[0], args[1])
+			},
+		},
+		{
+			name:    "verify-manifest",
+			args:    "SHA256SUMS REMOTE_DIR",
+			summary: "Check remote files against a sha256sum-format manifest.",
+			details: "Each entry is reported as OK, FAILED, or MISSING. Exits non-zero if any entry does not verify.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.IntVar(&opts.jobs, "jobs", 4, "Files hashed concurrently")
+			},
+			examples: []string{
+				"smbput -server nas.local -share releases -user ci verify-manifest SHA256SUMS v1.4.0",
+			},
+			minArgs: 2,
+			maxArgs: 2,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return verifyManifest(ctx, share, args[0], args[1], opts.jobs)
+				})
+			},
+		},
+		{
+			name:    "exec",
+			args:    "SCRIPT_FILE",
+			summary: "Run a script of put, get, rm, mkdir, mv, and similar commands over one connection.",
+			details: "Each line of SCRIPT_FILE (- for stdin) is a command with its flags and arguments, quoted as in a shell; blank lines and # comments are skipped. " +
+				"The whole script is checked before anything runs. Every command shares one session, dialed again if the connection drops, so hundreds of small operations do not each pay for a connection and login. " +
+				"Connection flags (-server, -share, -user, ...) apply to the whole script and cannot appear on its lines. The script stops at the first failing command unless -keep-going is given. " +
+				"Usable commands: put, get, rm, mkdir, rmdir, mv, cp, symlink, ls, and stat.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.keepGoing, "keep-going", false, "Run the remaining commands after one fails, and fail at the end")
+			},
+			examples: []string{
+				"smbput -server nas.local -share drop -user svc exec nightly.smbput",
+				"generate-uploads | smbput -server nas.local -share drop -user svc exec -keep-going -",
+			},
+			minArgs: 1,
+			maxArgs: 1,
+			noShare: true,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return execScript(ctx, opts, args[0], opts.keepGoing)
+			},
+		},
+		{
+			name:    "diff",
+			args:    "LOCAL_DIR REMOTE_DIR",
+			summary: "List files that differ between a local and a remote tree.",
+			details: "Files are compared by size and modification time (within 2 seconds, for file systems that store coarse times); with -checksum, files of equal size are read on both sides and compared by SHA-256 instead. " +
+				"Each file that differs or exists on one side only is printed as changed, missing_remote, or missing_local. Links and special files are not compared. Exits non-zero if anything differs, so a script can check a tree before trusting a sync.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.checksum, "checksum", false, "Compare the content of equal-sized files instead of their times")
+				fs.BoolVar(&opts.json, "json", false, "Print JSON instead of text")
+			},
+			examples: []string{
+				"smbput -server nas.local -share projects -user alice diff ./site www/site",
+				"smbput -server nas.local -share backup -user svc diff -checksum -json /srv/exports nightly/exports",
+			},
+			minArgs: 2,
+			maxArgs: 2,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return diffRemote(ctx, shareFS(share), os.Stdout, args[0], args[1], opts.checksum, opts.json)
+				})
+			},
+		},
+		{
+			name:    "clean-tmp",
+			args:    "[TMP_DIR]",
+			summary: "Remove partial uploads and scratch files abandoned in a -tmp-dir.",
+			details: "Only files smbput stages there (.part uploads and write-size probe files) that have not been modified for -older-than are removed; anything else in the directory is left alone. TMP_DIR defaults to -tmp-dir or tmp-dir in the profile. " +
+				"A removed .part file can no longer be resumed, so keep the threshold well above the longest interruption a -resume run should survive.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				tmpDirFlag(fs, opts)
+				fs.DurationVar(&opts.olderThan, "older-than", 24*time.Hour, "Only remove files last modified at least this long ago")
+			},
+			examples: []string{
+				"smbput -server nas.local -share etl -user svc clean-tmp .staging",
+				"smbput -server nas.local -share etl -user svc clean-tmp -tmp-dir .staging -older-than 72h",
+			},
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				dir := opts.tmpDir
+				if len(args) == 1 {
+					dir = args[0]
+				}
+				if dir == "" {
+					return errors.New("no temporary directory: give TMP_DIR, -tmp-dir, or tmp-dir in the profile")
+				}
+				if opts.olderThan < 0 {
+					return errors.New("-older-than must not be negative")
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					return cleanTmpRemote(shareFS(share), os.Stdout, dir, opts.olderThan)
+				})
+			},
+		},
+		{
+			name:    "report",
+			args:    "[REMOTE_DIR]",
+			summary: "Summarize usage by extension, size, and age, with the largest and oldest files.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.IntVar(&opts.top, "top", 10, "Number of largest/oldest files to show")
+				fs.BoolVar(&opts.json, "json", false, "Print JSON instead of tables")
+			},
+			examples: []string{
+				"smbput -server nas.local -share projects -user alice report archive",
+				"smbput -server nas.local -share projects -user alice report -json -top 50 archive > usage.json",
+			},
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return reportRemote(share, argOr(args, 0, "."), opts.top, opts.json)
+				})
+			},
+		},
+		{
+			name:    "du",
+			args:    "[REMOTE_PATH]",
+			summary: "Show the total size of each directory below a path.",
+			details: "Directories are listed after their subdirectories, with the total for REMOTE_PATH last. Linked directories are not counted unless -follow-symlinks is given.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				linkFlags(fs, opts)
+				fs.IntVar(&opts.maxDepth, "max-depth", -1, "Only list directories this many levels below REMOTE_PATH (-1 for all)")
+				fs.BoolVar(&opts.humanReadable, "h", false, "Print sizes in KiB, MiB, GiB instead of bytes")
+			},
+			examples: []string{
+				"smbput -server nas.local -share projects -user alice du -max-depth 1 -h archive",
+			},
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				links, err := newLinkPolicy(opts.followLinks, opts.skipLinks)
+				if err != nil {
+					return err
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					return duRemote(share, argOr(args, 0, "."), opts.maxDepth, opts.humanReadable, links)
+				})
+			},
+		},
+		{
+			name:    "df",
+			args:    "[REMOTE_PATH]",
+			summary: "Show the size, used, and available space of the share.",
+			details: "Available is what the server lets this user write, which quotas may make smaller than the volume's free space. With -min-free the command fails when less than that is available, so scripts can check before a large upload.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.humanReadable, "h", false, "Print sizes in KiB, MiB, GiB instead of bytes")
+				fs.BoolVar(&opts.json, "json", false, "Print JSON instead of text")
+				fs.StringVar(&opts.minFree, "min-free", "", "Fail unless at least this much is available (e.g. 50G)")
+			},
+			examples: []string{
+				"smbput -server nas.local -share backups -user alice df -h",
+				"smbput -server nas.local -share backups -user alice df -min-free 200G",
+			},
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				var minFree int64
+				if opts.minFree != "" {
+					var err error
+					if minFree, err = parseByteSize(opts.minFree); err != nil {
+						return fmt.Errorf("-min-free: %w", err)
+					}
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					return dfRemote(share, os.Stdout, opts.share, argOr(args, 0, "."), opts.humanReadable, opts.json, minFree)
+				})
+			},
+		},
+		{
+			name:    "selftest",
+			args:    "[REMOTE_DIR]",
+			summary: "Check which file operations the server handles correctly.",
+			details: "Runs mkdir, a small and an 8 MiB upload read back for comparison, ranged reads, setting the modification time and READONLY, rename, and delete in a scratch directory below REMOTE_DIR, and prints ok, failed, or skipped for each, with the server's error. " +
+				"A check is skipped when one it builds on failed. The scratch directory is removed afterwards. Exits non-zero unless every check passed, so the output can go straight into a bug report.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.json, "json", false, "Print JSON instead of text")
+			},
+			examples: []string{
+				"smbput -server nas.local -share scratch -user alice selftest",
+				"smbput -profile nas selftest -json tmp",
+			},
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return selftestRemote(shareFS(share), share.Chmod, os.Stdout, argOr(args, 0, "."), opts.json)
+				})
+			},
+		},
+		{
+			name:    "seed",
+			args:    "ARCHIVE REMOTE_DIR",
+			summary: "Expand a local tar archive directly onto the share.",
+			details: "Meant for the first copy of a large tree over a fast network: the archive (.tar, .tar.gz, .tgz, .tar.zst, or .tzst) is read once and small files are written -jobs at a time, without comparing anything with the share. " +
+				"Existing files are overwritten. File and directory modification times are restored; symlinks, hard links, and devices are skipped.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.IntVar(&opts.jobs, "jobs", 8, "Files written concurrently")
+			},
+			examples: []string{
+				"smbput -server nas.local -share projects -user alice seed build-tree.tar.zst builds/2024-06",
+			},
+			minArgs: 2,
+			maxArgs: 2,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return seedRemote(ctx, share, args[0], args[1], opts.jobs)
+				})
+			},
+		},
+		{
+			name:    "quota",
+			args:    "[USER]",
+			summary: "Show the logged-in user's quota limit, usage, and remaining space on the share.",
+			details: "Servers with NTFS quotas, and Samba with quota support, report the volume to a user as no larger than their limit; a quota is shown when less space is available to the user than is free on the volume. Only the logged-in user's quota can be read; USER, if given, must name that user.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.humanReadable, "h", false, "Print sizes in KiB, MiB, GiB instead of bytes")
+				fs.BoolVar(&opts.json, "json", false, "Print JSON instead of text")
+			},
+			examples: []string{
+				"smbput -server nas.local -share home -user alice quota -h",
+			},
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return quotaRemote(share, os.Stdout, opts.share, opts.user, argOr(args, 0, ""), opts.humanReadable, opts.json)
+				})
+			},
+		},
+		{
+			name:    "dedup-report",
+			args:    "[REMOTE_DIR]",
+			summary: "Find groups of identical files and the space they waste.",
+			details: "Only files that share their size with another file are hashed (SHA-256), so most of a tree is never read. Linked directories are not searched unless -follow-symlinks is given.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				linkFlags(fs, opts)
+				fs.IntVar(&opts.jobs, "jobs", 4, "Files hashed concurrently")
+				fs.BoolVar(&opts.json, "json", false, "Print JSON instead of text")
+			},
+			examples: []string{
+				"smbput -server nas.local -share media -user alice dedup-report photos",
+			},
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				links, err := newLinkPolicy(opts.followLinks, opts.skipLinks)
+				if err != nil {
+					return err
+				}
+				return withShare(opts, func(share *smb2.Share) error {
+					return dedupRemote(ctx, share, argOr(args, 0, "."), opts.jobs, opts.json, links)
+				})
+			},
+		},
+		{
+			name:    "drop",
+			args:    "LOCAL_FILE",
+			summary: "Upload to the drop directory under a free name and print its UNC path.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				transferFlags(fs, opts)
+				fs.StringVar(&opts.dropDir, "drop-dir", ".", "Remote directory to upload into (or drop-dir in the profile)")
+			},
+			examples: []string{
+				"smbput drop ./screenshot.png",
+				"smbput -profile team drop -drop-dir incoming/bob ./build.log",
+			},
+			minArgs: 1,
+			maxArgs: 1,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return withShare(opts, func(share *smb2.Share) error {
+					return dropFile(ctx, share, opts, args[0])
+				})
+			},
+		},
+		{
+			name:    "audit-hosts",
+			args:    "HOSTS_FILE",
+			summary: "Report the SMB security posture of many servers without logging in.",
+			details: "HOSTS_FILE lists one host or host:port per line (# starts a comment). For each host the report gives the negotiated SMB2 dialect, whether signing is required or only enabled, the encryption cipher (SMB 3.1.1) or whether encryption is supported (SMB 3.0), whether SMB1 is still accepted, and whether a logon as an unknown user with no password succeeds, i.e. the server maps bad users to guest. " +
+				"No credentials are sent and nothing is read or written on the servers. Exits non-zero if any host could not be probed.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.StringVar(&opts.format, "format", "csv", "Report format: csv or json")
+				fs.IntVar(&opts.jobs, "jobs", 8, "Hosts probed concurrently")
+			},
+			examples: []string{
+				"smbput audit-hosts fileservers.txt > smb-posture.csv",
+				"smbput audit-hosts -format json fileservers.txt | jq '.[] | select(.signing != \"required\" or .smb1)'",
+			},
+			minArgs: 1,
+			maxArgs: 1,
+			offline: true,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return auditHosts(os.Stdout, args[0], opts.format, opts.jobs, opts.timeout)
+			},
+		},
+		{
+			name:    "resolve",
+			args:    "HOST",
+			summary: "Resolve a server name the way connections do.",
+			details: "Names are tried through the system resolver, then with a .local suffix, then by LLMNR multicast. -explain runs every stage and shows which one answered, all candidate addresses, and the time each took.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.explain, "explain", false, "Run the whole cascade and show per-stage results and timing")
+			},
+			examples: []string{
+				"smbput resolve nas",
+				"smbput resolve -explain -timeout 2s nas",
+			},
+			minArgs: 1,
+			maxArgs: 1,
+			offline: true,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				if opts.explain {
+					return explainResolve(ctx, os.Stdout, args[0], opts.timeout, resolveSteps(args[0]))
+				}
+				ips, err := resolveHost(ctx, args[0], opts.timeout)
+				if err != nil {
+					return err
+				}
+				for _, ip := range ips {
+					fmt.Println(ip)
+				}
+				return nil
+			},
+		},
+		{
+			name:    "stats",
+			summary: "Show the traffic smbput has sent to each server and share.",
+			details: "Every command that connects adds its SMB operation count and file bytes read and written to a small database in the user's configuration directory (override with SMBPUT_USAGE=PATH, disable with SMBPUT_USAGE=off), keyed by -server and -share.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.json, "json", false, "Print JSON")
+				fs.BoolVar(&opts.humanReadable, "h", false, "Print sizes in KiB, MiB, GiB instead of bytes")
+				fs.BoolVar(&opts.resetUsage, "reset", false, "Delete the accumulated usage")
+			},
+			examples: []string{
+				"smbput stats -h",
+				"smbput stats -json | jq 'to_entries | sort_by(-.value.bytes_written) | .[0]'",
+			},
+			offline: true,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return showUsage(os.Stdout, opts.json, opts.humanReadable, opts.resetUsage)
+			},
+		},
+		{
+			name:    "version",
+			summary: "Print version, build details, and supported features.",
+			setFlags: func(fs *flag.FlagSet, opts *smbOptions) {
+				fs.BoolVar(&opts.json, "json", false, "Print JSON")
+			},
+			examples: []string{
+				"smbput version",
+				"smbput version -json | jq -e '.features.kerberos'",
+			},
+			offline: true,
+			run: func(ctx context.Context, opts smbOptions, args []string) error {
+				return printVersion(os.Stdout, opts.json)
+			},
+		},
+		helpCommand,
+	}
+}
+
+var helpCommand = &command{
+	name:    "help",
+	args:    "[COMMAND]",
+	summary: "Show usage for all commands or details for one.",
+	examples: []string{
+		"smbput help get",
+	},
+	maxArgs: 1,
+	offline: true,
+	run: func(ctx context.Context, opts smbOptions, args []string) error {
+		if len(args) == 0 {
+			printUsage()
+			return nil
+		}
+		cmd := lookupCommand(args[0])
+		if cmd == nil {
+			return fmt.Errorf("unknown command %q", args[0])
+		}
+		printCommandHelp(os.Stdout, cmd)
+		return nil
+	},
+}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// acceptsArgs reports whether n positional arguments are valid for cmd.
+func (c *command) acceptsArgs(n int) bool {
+	return n >= c.minArgs && (c.maxArgs < 0 || n <= c.maxArgs)
+}
+
+func (c *command) synopsis() string {
+	if c.args == "" {
+		return c.name
+	}
+	return c.name + " " + c.args
+}
+
+func printUsage() {
+	var b strings.Builder
+	b.WriteString("Usage:\n  smbput -server HOST[:PORT] -share NAME -user USER -password PASS <command> [flags] [args...]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "  %-40s %s\n", cmd.synopsis(), cmd.summary)
+	}
+	b.WriteString("\nRun 'smbput help COMMAND' for its flags and examples.\n\nGlobal flags:\n")
+	fmt.Fprint(os.Stderr, b.String())
+	flag.CommandLine.SetOutput(os.Stderr)
+	flag.PrintDefaults()
+}
+
+func printCommandHelp(w io.Writer, cmd *command) {
+	usage := cmd.name
+	if cmd.setFlags != nil {
+		usage += " [flags]"
+	}
+	if cmd.args != "" {
+		usage += " " + cmd.args
+	}
+	fmt.Fprintf(w, "Usage: smbput [global flags] %s\n\n%s\n", usage, cmd.summary)
+	if cmd.details != "" {
+		fmt.Fprintf(w, "%s\n", cmd.details)
+	}
+	if cmd.setFlags != nil {
+		fmt.Fprintln(w, "\nFlags:")
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		cmd.setFlags(fs, &smbOptions{})
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+	fmt.Fprintln(w, "\nGlobal flags (-server, -share, -user, -profile, -stats, ...) may appear before or after the command; see 'smbput -h'.")
+	if len(cmd.examples) > 0 {
+		fmt.Fprintln(w, "\nExamples:")
+		for _, ex := range cmd.examples {
+			fmt.Fprintf(w, "  %s\n", ex)
+		}
+	}
+}
+
+// withShare connects, runs fn against the mounted share, and disconnects.
+func withShare(opts smbOptions, fn func(share *smb2.Share) error) error {
+	share, cleanup, err := connect(opts)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer cleanup()
+	return fn(share)
+}
+
+// argOr returns args[i], or def when it was not given.
+func argOr(args []string, i int, def string) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return def
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCommandRegistry(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, cmd := range commands {
+		if seen[cmd.name] {
+			t.Fatalf("duplicate command %q", cmd.name)
+		}
+		seen[cmd.name] = true
+		if cmd.summary == "" || len(cmd.examples) == 0 || cmd.run == nil {
+			t.Fatalf("command %q is missing summary, examples, or run", cmd.name)
+		}
+		if cmd.maxArgs >= 0 && cmd.maxArgs < cmd.minArgs {
+			t.Fatalf("command %q has maxArgs < minArgs", cmd.name)
+		}
+	}
+	if lookupCommand("put") == nil || lookupCommand("nope") != nil {
+		t.Fatalf("lookupCommand returned unexpected results")
+	}
+}
+
+func TestCommandAcceptsArgs(t *testing.T) {
+	get := lookupCommand("get")
+	if get.acceptsArgs(1) || !get.acceptsArgs(2) || get.acceptsArgs(3) {
+		t.Fatalf("get should accept exactly two arguments")
+	}
+	ls := lookupCommand("ls")
+	if !ls.acceptsArgs(0) || !ls.acceptsArgs(1) || ls.acceptsArgs(2) {
+		t.Fatalf("ls should accept zero or one argument")
+	}
+}
+
+func TestPrintCommandHelp(t *testing.T) {
+	var buf bytes.Buffer
+	printCommandHelp(&buf, &command{
+		name:     "demo",
+		args:     "PATH",
+		summary:  "Demo command.",
+		examples: []string{"smbput demo x"},
+	})
+	out := buf.String()
+	for _, want := range []string{"Usage: smbput [global flags] demo PATH", "Demo command.", "Examples:", "smbput demo x"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("help output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultProfile = "default"
+
+// configPath returns the profile file location: $SMBPUT_CONFIG, or
+// smbput/config under the user's configuration directory.
+func configPath() string {
+	if p := os.Getenv("SMBPUT_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "smbput", "config")
+}
+
+// parseConfig reads an INI-style file of [profile] sections holding
+// "key = value" lines. Lines starting with '#' or ';' are comments.
+func parseConfig(r io.Reader) (map[string]map[string]string, error) {
+	profiles := make(map[string]map[string]string)
+	var current map[string]string
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if profiles[name] == nil {
+				profiles[name] = make(map[string]string)
+			}
+			current = profiles[name]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: setting outside of a [profile] section", lineNo)
+		}
+		current[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// loadProfile returns the named profile from the config file. A missing file
+// or profile is only an error when the profile was asked for explicitly.
+func loadProfile(path, name string, explicit bool) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open config: %w", err)
+	}
+	defer f.Close()
+
+	profiles, err := parseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	profile, ok := profiles[name]
+	if !ok && explicit {
+		return nil, fmt.Errorf("profile %q not found in %s", name, path)
+	}
+	return profile, nil
+}
+
+// applyProfile fills options that were not set on the command line from the
+// profile. setFlags holds the names of flags given explicitly.
+func applyProfile(opts *smbOptions, profile map[string]string, setFlags map[string]bool) {
+	fields := map[string]*string{
+		"server":      &opts.address,
+		"share":       &opts.share,
+		"user":        &opts.user,
+		"password":    &opts.password,
+		"credentials": &opts.credentials,
+		"domain":      &opts.domain,
+		"drop-dir":    &opts.dropDir,
+		"tmp-dir":     &opts.tmpDir,
+		"encrypt-key": &opts.encryptKey,
+	}
+	for key, field := range fields {
+		if v, ok := profile[key]; ok && !setFlags[key] {
+			*field = v
+		}
+	}
+}
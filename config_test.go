@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	input := `# smbput profiles
+[default]
+server = nas.local
+share  = drop
+user   = alice
+
+; second profile
+[backup]
+server = backup01:1445
+drop-dir = incoming/alice
+`
+	profiles, err := parseConfig(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseConfig returned error: %v", err)
+	}
+	if got := profiles["default"]["share"]; got != "drop" {
+		t.Fatalf("default share = %q, want drop", got)
+	}
+	if got := profiles["backup"]["drop-dir"]; got != "incoming/alice" {
+		t.Fatalf("backup drop-dir = %q, want incoming/alice", got)
+	}
+}
+
+func TestParseConfigRejectsMalformedLines(t *testing.T) {
+	for _, input := range []string{
+		"server = nas\n",
+		"[default]\nserver\n",
+	} {
+		if _, err := parseConfig(strings.NewReader(input)); err == nil {
+			t.Fatalf("expected error for %q", input)
+		}
+	}
+}
+
+func TestApplyProfileKeepsExplicitFlags(t *testing.T) {
+	opts := smbOptions{address: "cli-host", dropDir: "."}
+	profile := map[string]string{
+		"server":   "profile-host",
+		"share":    "drop",
+		"drop-dir": "incoming",
+	}
+
+	applyProfile(&opts, profile, map[string]bool{"server": true})
+
+	if opts.address != "cli-host" {
+		t.Fatalf("address = %q, want cli-host", opts.address)
+	}
+	if opts.share != "drop" || opts.dropDir != "incoming" {
+		t.Fatalf("share/dropDir = %q/%q, want drop/incoming", opts.share, opts.dropDir)
+	}
+}
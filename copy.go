@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// copyRemote duplicates src to dst on the same share. On an SMB share both
+// handles come from one *smb2.Share, which is what lets go-smb2 issue FSCTL_SRV_COPYCHUNK so
+// the data never leaves the server; servers without it get a streamed copy
+// instead. A DST that is an existing directory receives the file inside it,
+// and an existing file is only replaced with force set.
+func copyRemote(share remoteFS, src, dst string, force bool) (int64, error) {
+	src = normalizeRemotePath(src)
+	dst = normalizeRemotePath(dst)
+
+	start := time.Now()
+	in, err := share.Open(src)
+	opStats.observe("open", start)
+	if err != nil {
+		return 0, fmt.Errorf("open remote %s: %w", src, err)
+	}
+	defer in.Close()
+	if fi, err := in.Stat(); err != nil {
+		return 0, fmt.Errorf("stat %s: %w", src, err)
+	} else if fi.IsDir() {
+		return 0, fmt.Errorf("%s is a directory", src)
+	}
+
+	if fi, err := share.Stat(dst); err == nil && fi.IsDir() {
+		dst = moveDestination(src, dst, true)
+	}
+	if dst == src {
+		return 0, fmt.Errorf("%s and %s are the same file", src, dst)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	start = time.Now()
+	out, err := share.OpenFile(dst, flags, 0o644)
+	opStats.observe("create", start)
+	if err != nil {
+		if !force {
+			if _, statErr := share.Stat(dst); statErr == nil {
+				return 0, fmt.Errorf("%s already exists; use -force to replace it", dst)
+			}
+		}
+		return 0, fmt.Errorf("create remote %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	start = time.Now()
+	n, err := out.ReadFrom(in)
+	opStats.observe("copy", start)
+	if err != nil {
+		return n, fmt.Errorf("copy %s -> %s: %w", src, dst, err)
+	}
+	if err := out.Close(); err != nil {
+		return n, fmt.Errorf("close remote %s: %w", dst, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// credentials are what an NTLM logon needs. Empty fields are left for the
+// next provider in a chain to fill.
+type credentials struct {
+	user     string
+	password string
+	domain   string
+}
+
+func (c credentials) complete() bool { return c.user != "" && c.password != "" }
+
+// credentialProvider is a source of secrets, one per -credentials kind.
+// Connection code only asks a provider for credentials, so adding a secret
+// store means adding a kind to parseCredentialSource.
+type credentialProvider interface {
+	credentials(ctx context.Context) (credentials, error)
+}
+
+// staticCredentials returns fixed credentials, typically from flags or a
+// profile.
+type staticCredentials credentials
+
+func (s staticCredentials) credentials(context.Context) (credentials, error) {
+	return credentials(s), nil
+}
+
+// envCredentials reads SMB_USER, SMB_PASSWORD, and SMB_DOMAIN.
+type envCredentials struct{}
+
+func (envCredentials) credentials(context.Context) (credentials, error) {
+	return credentials{
+		user:     os.Getenv("SMB_USER"),
+		password: os.Getenv("SMB_PASSWORD"),
+		domain:   os.Getenv("SMB_DOMAIN"),
+	}, nil
+}
+
+// fileCredentials reads an smbclient-style authentication file with
+// username, password, and domain lines of the form "key = value". The file
+// must not be readable by group or others.
+type fileCredentials struct {
+	path string
+}
+
+func (f fileCredentials) credentials(context.Context) (credentials, error) {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return credentials{}, fmt.Errorf("credentials file: %w", err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0o077 != 0 {
+		return credentials{}, fmt.Errorf("credentials file %s is accessible by others (mode %04o); chmod 600 it", f.path, fi.Mode().Perm())
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return credentials{}, fmt.Errorf("credentials file: %w", err)
+	}
+	fields, err := parseCredentialFields(bytes.NewReader(data))
+	if err != nil {
+		return credentials{}, fmt.Errorf("credentials file %s: %w", f.path, err)
+	}
+	return credentialsFromFields(fields), nil
+}
+
+// commandCredentials runs a helper through the shell and reads
+// "key=value" lines (username, password, domain) from its standard output,
+// as git credential helpers do. The helper sees the target in SMBPUT_SERVER,
+// SMBPUT_SHARE, and SMBPUT_USER.
+type commandCredentials struct {
+	command string
+	server  string
+	share   string
+	user    string
+}
+
+func (c commandCredentials) credentials(ctx context.Context) (credentials, error) {
+	cmd := shellCommand(ctx, c.command)
+	cmd.Env = append(os.Environ(), "SMBPUT_SERVER="+c.server, "SMBPUT_SHARE="+c.share, "SMBPUT_USER="+c.user)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return credentials{}, fmt.Errorf("credential helper %q: %w", c.command, err)
+	}
+	fields, err := parseCredentialFields(bytes.NewReader(out))
+	if err != nil {
+		return credentials{}, fmt.Errorf("credential helper %q: %w", c.command, err)
+	}
+	return credentialsFromFields(fields), nil
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// keyringCredentials looks up the password for User@Server in the OS
+// keyring under service: with secret-tool on Linux (attributes service,
+// server, and user) and the login keychain on macOS (account user@server).
+type keyringCredentials struct {
+	service string
+	server  string
+	user    string
+}
+
+func (k keyringCredentials) credentials(ctx context.Context) (credentials, error) {
+	if k.user == "" {
+		return credentials{}, errors.New("keyring: a user is needed to look up the password")
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.CommandContext(ctx, "secret-tool", "lookup", "service", k.service, "server", k.server, "user", k.user)
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "security", "find-generic-password", "-s", k.service, "-a", k.user+"@"+k.server, "-w")
+	default:
+		return credentials{}, fmt.Errorf("keyring: not supported on %s; use a credential helper", runtime.GOOS)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return credentials{}, fmt.Errorf("keyring lookup for %s@%s: %w", k.user, k.server, err)
+	}
+	password := strings.TrimRight(string(out), "\r\n")
+	if password == "" {
+		return credentials{}, fmt.Errorf("keyring has no password for %s@%s", k.user, k.server)
+	}
+	return credentials{password: password}, nil
+}
+
+// vaultCredentials reads a HashiCorp Vault KV secret (version 1 or 2) with
+// username, password, and domain keys. addr and token default to VAULT_ADDR
+// and VAULT_TOKEN, then ~/.vault-token.
+type vaultCredentials struct {
+	addr   string
+	token  string
+	path   string
+	client *http.Client
+}
+
+func (v vaultCredentials) credentials(ctx context.Context) (credentials, error) {
+	addr := v.addr
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return credentials{}, errors.New("vault: VAULT_ADDR is not set")
+	}
+	token := v.token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			data, _ := os.ReadFile(filepath.Join(home, ".vault-token"))
+			token = strings.TrimSpace(string(data))
+		}
+	}
+	if token == "" {
+		return credentials{}, errors.New("vault: no token in VAULT_TOKEN or ~/.vault-token")
+	}
+
+	url := strings.TrimRight(addr, "/") + "/v1/" + strings.TrimLeft(v.path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return credentials{}, fmt.Errorf("vault: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	client := v.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return credentials{}, fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return credentials{}, fmt.Errorf("vault: read %s: %s: %s", v.path, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return credentials{}, fmt.Errorf("vault: decode %s: %w", v.path, err)
+	}
+	// KV version 2 nests the secret under data.data alongside its metadata.
+	fields := make(map[string]string)
+	if nested, ok := secret.Data["data"]; ok && secret.Data["metadata"] != nil {
+		if err := json.Unmarshal(nested, &fields); err != nil {
+			return credentials{}, fmt.Errorf("vault: decode %s: %w", v.path, err)
+		}
+	} else {
+		for k, raw := range secret.Data {
+			var s string
+			if json.Unmarshal(raw, &s) == nil {
+				fields[k] = s
+			}
+		}
+	}
+	return credentialsFromFields(fields), nil
+}
+
+// credentialChain asks each provider in turn, keeping the first non-empty
+// value of every field, and stops once user and password are known.
+type credentialChain []credentialProvider
+
+func (chain credentialChain) credentials(ctx context.Context) (credentials, error) {
+	var c credentials
+	for _, p := range chain {
+		if c.complete() {
+			break
+		}
+		got, err := p.credentials(ctx)
+		if err != nil {
+			return c, err
+		}
+		if c.user == "" {
+			c.user = got.user
+		}
+		if c.password == "" {
+			c.password = got.password
+		}
+		if c.domain == "" {
+			c.domain = got.domain
+		}
+	}
+	return c, nil
+}
+
+// parseCredentialFields reads "key = value" lines, skipping blanks and
+// # comments. Keys are lower-cased.
+func parseCredentialFields(r io.Reader) (map[string]string, error) {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		fields[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	return fields, scanner.Err()
+}
+
+func credentialsFromFields(fields map[string]string) credentials {
+	c := credentials{password: fields["password"], domain: fields["domain"]}
+	if c.user = fields["username"]; c.user == "" {
+		c.user = fields["user"]
+	}
+	return c
+}
+
+// parseCredentialSource turns a -credentials value into a provider:
+// env, file:PATH, exec:COMMAND, keyring[:SERVICE], or vault:PATH.
+func parseCredentialSource(spec string, opts smbOptions) (credentialProvider, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	user := opts.user
+	if user == "" {
+		user = os.Getenv("SMB_USER")
+	}
+	switch kind {
+	case "env":
+		return envCredentials{}, nil
+	case "file":
+		if arg == "" {
+			return nil, errors.New("-credentials file: needs a path")
+		}
+		return fileCredentials{path: arg}, nil
+	case "exec":
+		if arg == "" {
+			return nil, errors.New("-credentials exec: needs a command")
+		}
+		return commandCredentials{command: arg, server: opts.address, share: opts.share, user: user}, nil
+	case "keyring":
+		if arg == "" {
+			arg = "smbput"
+		}
+		return keyringCredentials{service: arg, server: opts.address, user: user}, nil
+	case "vault":
+		if arg == "" {
+			return nil, errors.New("-credentials vault: needs a secret path")
+		}
+		return vaultCredentials{path: arg}, nil
+	}
+	return nil, fmt.Errorf("invalid -credentials %q: want env, file:PATH, exec:COMMAND, keyring[:SERVICE], or vault:PATH", spec)
+}
+
+// newCredentialChain builds the chain for a run: flags and profile first,
+// then the -credentials source, then the environment.
+func newCredentialChain(opts smbOptions) (credentialProvider, error) {
+	chain := credentialChain{staticCredentials{user: opts.user, password: opts.password, domain: opts.domain}}
+	if opts.credentials != "" {
+		p, err := parseCredentialSource(opts.credentials, opts)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, p)
+	}
+	return append(chain, envCredentials{}), nil
+}
+
+// resolveCredentials fills opts.user, opts.password, and opts.domain from
+// the run's credential chain.
+func resolveCredentials(ctx context.Context, opts *smbOptions) error {
+	p, err := newCredentialChain(*opts)
+	if err != nil {
+		return err
+	}
+	c, err := p.credentials(ctx)
+	if err != nil {
+		return err
+	}
+	opts.user, opts.password, opts.domain = c.user, c.password, c.domain
+	return nil
+}
+
+// guestUser is the account a run without credentials logs on as. Servers
+// that map unknown users to guest (Samba's "map to guest = bad user", an
+// open NAS share) accept it with no password; the share decides what guest
+// may do, often only read.
+const guestUser = "guest"
+
+// checkLogon makes a run with neither a user nor a password a guest logon
+// and reports credentials that are only half given.
+func checkLogon(opts *smbOptions) error {
+	switch {
+	case opts.user == "" && opts.password == "":
+		opts.user = guestUser
+	case opts.user == "":
+		return errors.New("a password needs -user")
+	case opts.password == "" && !strings.EqualFold(opts.user, guestUser):
+		return fmt.Errorf("no password for user %s: use -password, SMB_PASSWORD, or -credentials, or omit -user to log on as guest", opts.user)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCredentialChainFillsMissingFields(t *testing.T) {
+	chain := credentialChain{
+		staticCredentials{user: "alice"},
+		staticCredentials{user: "bob", password: "secret"},
+		staticCredentials{domain: "CORP"},
+	}
+	got, err := chain.credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The chain stops once user and password are known.
+	want := credentials{user: "alice", password: "secret"}
+	if got != want {
+		t.Fatalf("credentials() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCredentialProviderPrefersFlagsOverEnvironment(t *testing.T) {
+	t.Setenv("SMB_USER", "env-user")
+	t.Setenv("SMB_PASSWORD", "env-pass")
+	t.Setenv("SMB_DOMAIN", "")
+	opts := smbOptions{user: "flag-user"}
+	if err := resolveCredentials(context.Background(), &opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.user != "flag-user" || opts.password != "env-pass" {
+		t.Fatalf("user, password = %q, %q; want flag-user, env-pass", opts.user, opts.password)
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "creds")
+	content := "# backup account\nusername = svc\npassword = p=ss word\ndomain = CORP\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fileCredentials{path: path}.credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := credentials{user: "svc", password: "p=ss word", domain: "CORP"}
+	if got != want {
+		t.Fatalf("credentials() = %+v, want %+v", got, want)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (fileCredentials{path: path}).credentials(context.Background()); err == nil {
+		t.Fatal("expected error for a world-readable credentials file")
+	}
+}
+
+func TestCommandCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("helper uses sh")
+	}
+	c := commandCredentials{command: `printf 'username=%s\npassword=from-%s\n' "$SMBPUT_USER" "$SMBPUT_SERVER"`, server: "nas", user: "alice"}
+	got, err := c.credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.user != "alice" || got.password != "from-nas" {
+		t.Fatalf("credentials() = %+v", got)
+	}
+
+	if _, err := (commandCredentials{command: "exit 3"}).credentials(context.Background()); err == nil {
+		t.Fatal("expected error from a failing helper")
+	}
+}
+
+func TestVaultCredentials(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+	}{
+		{"kv1", `{"data":{"username":"svc","password":"s3cret","domain":"CORP"}}`},
+		{"kv2", `{"data":{"data":{"username":"svc","password":"s3cret","domain":"CORP"},"metadata":{"version":3}}}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/secret/data/smb" || r.Header.Get("X-Vault-Token") != "tok" {
+					http.Error(w, "permission denied", http.StatusForbidden)
+					return
+				}
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			got, err := vaultCredentials{addr: srv.URL, token: "tok", path: "secret/data/smb"}.credentials(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := credentials{user: "svc", password: "s3cret", domain: "CORP"}
+			if got != want {
+				t.Fatalf("credentials() = %+v, want %+v", got, want)
+			}
+
+			if _, err := (vaultCredentials{addr: srv.URL, token: "wrong", path: "secret/data/smb"}).credentials(context.Background()); err == nil {
+				t.Fatal("expected error for a rejected token")
+			}
+		})
+	}
+}
+
+func TestParseCredentialSource(t *testing.T) {
+	opts := smbOptions{address: "nas", user: "alice"}
+	for _, tc := range []struct {
+		spec string
+		ok   bool
+	}{
+		{"env", true},
+		{"file:/etc/smbput/creds", true},
+		{"exec:pass show smb/nas", true},
+		{"keyring", true},
+		{"keyring:backup", true},
+		{"vault:secret/data/smb", true},
+		{"file:", false},
+		{"vault", false},
+		{"ldap:x", false},
+	} {
+		_, err := parseCredentialSource(tc.spec, opts)
+		if (err == nil) != tc.ok {
+			t.Errorf("parseCredentialSource(%q) error = %v, want ok=%v", tc.spec, err, tc.ok)
+		}
+	}
+	p, _ := parseCredentialSource("keyring", opts)
+	if k := p.(keyringCredentials); k.service != "smbput" || k.server != "nas" || k.user != "alice" {
+		t.Fatalf("keyring provider = %+v", k)
+	}
+}
+
+func TestCheckLogon(t *testing.T) {
+	for _, tc := range []struct {
+		user, password string
+		wantUser       string
+		ok             bool
+	}{
+		{"", "", guestUser, true},
+		{"Guest", "", "Guest", true},
+		{"alice", "secret", "alice", true},
+		{"alice", "", "alice", false},
+		{"", "secret", "", false},
+	} {
+		opts := smbOptions{user: tc.user, password: tc.password}
+		err := checkLogon(&opts)
+		if (err == nil) != tc.ok || opts.user != tc.wantUser {
+			t.Errorf("checkLogon(%q, %q): user %q, err %v", tc.user, tc.password, opts.user, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+type dupGroup struct {
+	Size    int64    `json:"size"`
+	SHA256  string   `json:"sha256"`
+	Paths   []string `json:"paths"`
+	Savings int64    `json:"savings"`
+}
+
+type dedupReport struct {
+	Root    string     `json:"root"`
+	Files   int        `json:"files"`
+	Hashed  int        `json:"hashed"`
+	Groups  []dupGroup `json:"groups"`
+	Savings int64      `json:"savings"`
+}
+
+// findDuplicates groups files with identical content. Only files sharing
+// their size with another file are hashed, so a tree of mostly unique sizes
+// costs little more than the walk. Files that cannot be hashed are skipped
+// with a warning. Groups are ordered by savings, largest first.
+func findDuplicates(bySize map[int64][]string, hash func(p string) (string, error), jobs int) ([]dupGroup, int) {
+	var candidates []string
+	sizeOf := make(map[string]int64)
+	for size, paths := range bySize {
+		if size == 0 || len(paths) < 2 {
+			continue
+		}
+		for _, p := range paths {
+			candidates = append(candidates, p)
+			sizeOf[p] = size
+		}
+	}
+	sort.Strings(candidates)
+
+	sums := make([]string, len(candidates))
+	if jobs < 1 {
+		jobs = 1
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				sum, err := hash(candidates[i])
+				if err != nil {
+					log.Printf("warning: hash %s: %v", candidates[i], err)
+					continue
+				}
+				sums[i] = sum
+			}
+		}()
+	}
+	for i := range candidates {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	byContent := make(map[string]*dupGroup)
+	var keys []string
+	for i, p := range candidates {
+		if sums[i] == "" {
+			continue
+		}
+		key := fmt.Sprintf("%d:%s", sizeOf[p], sums[i])
+		g, ok := byContent[key]
+		if !ok {
+			g = &dupGroup{Size: sizeOf[p], SHA256: sums[i]}
+			byContent[key] = g
+			keys = append(keys, key)
+		}
+		g.Paths = append(g.Paths, p)
+	}
+
+	var groups []dupGroup
+	for _, key := range keys {
+		g := byContent[key]
+		if len(g.Paths) < 2 {
+			continue
+		}
+		g.Savings = g.Size * int64(len(g.Paths)-1)
+		groups = append(groups, *g)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Savings != groups[j].Savings {
+			return groups[i].Savings > groups[j].Savings
+		}
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+	return groups, len(candidates)
+}
+
+// dedupRemote walks remote and reports groups of identical files.
+func dedupRemote(ctx context.Context, share *smb2.Share, remote string, jobs int, asJSON bool, links linkPolicy) error {
+	remote = normalizeRemotePath(remote)
+	bySize := make(map[int64][]string)
+	files := 0
+	err := walkRemoteLinks(shareFS(share), remote, links, func(p string, fi os.FileInfo) error {
+		// An unfollowed link would be hashed as its target and reported as
+		// a copy of it.
+		if !fi.IsDir() && !isLink(fi) {
+			bySize[fi.Size()] = append(bySize[fi.Size()], p)
+			files++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	groups, hashed := findDuplicates(bySize, func(p string) (string, error) {
+		return hashRemoteFile(ctx, shareFS(share), p, "sha256")
+	}, jobs)
+	r := dedupReport{Root: remote, Files: files, Hashed: hashed, Groups: groups}
+	for _, g := range groups {
+		r.Savings += g.Savings
+	}
+	if r.Groups == nil {
+		r.Groups = []dupGroup{}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(withSchema("dedup-report", r))
+	}
+	writeDedupReport(os.Stdout, r)
+	return nil
+}
+
+func writeDedupReport(w io.Writer, r dedupReport) {
+	for _, g := range r.Groups {
+		fmt.Fprintf(w, "%d copies of %s (%s wasted)\n", len(g.Paths), humanBytes(g.Size), humanBytes(g.Savings))
+		for _, p := range g.Paths {
+			fmt.Fprintf(w, "  %s\n", p)
+		}
+	}
+	fmt.Fprintf(w, "%s: %d files, %d hashed, %d duplicate groups, %s reclaimable\n",
+		r.Root, r.Files, r.Hashed, len(r.Groups), humanBytes(r.Savings))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	bySize := map[int64][]string{
+		100: {"a/one.iso", "b/one-copy.iso", "c/other.iso"},
+		10:  {"x.txt", "y.txt", "z.txt"},
+		7:   {"unique.bin"},
+		0:   {"empty1", "empty2"},
+	}
+	sums := map[string]string{
+		"a/one.iso":      "aaa",
+		"b/one-copy.iso": "aaa",
+		"c/other.iso":    "bbb",
+		"x.txt":          "ttt",
+		"y.txt":          "ttt",
+	}
+	var mu sync.Mutex
+	var hashed []string
+	hash := func(p string) (string, error) {
+		mu.Lock()
+		hashed = append(hashed, p)
+		mu.Unlock()
+		if sum, ok := sums[p]; ok {
+			return sum, nil
+		}
+		return "", errors.New("read failed")
+	}
+
+	groups, n := findDuplicates(bySize, hash, 2)
+	want := []dupGroup{
+		{Size: 100, SHA256: "aaa", Paths: []string{"a/one.iso", "b/one-copy.iso"}, Savings: 100},
+		{Size: 10, SHA256: "ttt", Paths: []string{"x.txt", "y.txt"}, Savings: 10},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Fatalf("groups = %+v, want %+v", groups, want)
+	}
+	if n != 6 || len(hashed) != 6 {
+		t.Fatalf("hashed %d files (%v), want only the 6 sharing a non-zero size", n, hashed)
+	}
+}
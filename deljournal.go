@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// deleteJournal records the deletions a mirror with --delete has decided on
+// but not yet carried out, by path relative to the mirrored root. Deletions
+// run only after every upload of the run has succeeded, and the plan is saved
+// before any upload starts, so an interrupted run never leaves the
+// destination missing a file whose replacement was not uploaded yet, and the
+// next run finishes the deletions the interrupted one had planned.
+type deleteJournal struct {
+	Version int      `json:"version"`
+	Root    string   `json:"root"`
+	Pending []string `json:"pending"`
+}
+
+const deleteJournalVersion = 1
+
+// loadDeleteJournal reads the journal for a mirror of root. A missing file
+// yields an empty journal; one left by a mirror of another root is an error
+// rather than a list of paths to delete somewhere else.
+func loadDeleteJournal(path, root string) (*deleteJournal, error) {
+	j := &deleteJournal{Version: deleteJournalVersion, Root: root}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read delete journal %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("parse delete journal %s: %w", path, err)
+	}
+	if j.Version != deleteJournalVersion {
+		return nil, fmt.Errorf("delete journal %s has unsupported version %d", path, j.Version)
+	}
+	if j.Root != root {
+		return nil, fmt.Errorf("delete journal %s belongs to a mirror of %s, not %s", path, j.Root, root)
+	}
+	return j, nil
+}
+
+// plan adds paths to the pending deletions. Entries are kept deepest first so
+// a directory's contents go before the directory itself.
+func (j *deleteJournal) plan(paths []string) {
+	seen := make(map[string]bool, len(j.Pending)+len(paths))
+	merged := j.Pending[:0:0]
+	for _, p := range append(j.Pending, paths...) {
+		if !seen[p] {
+			seen[p] = true
+			merged = append(merged, p)
+		}
+	}
+	sort.Slice(merged, func(a, b int) bool {
+		da, db := strings.Count(merged[a], "/"), strings.Count(merged[b], "/")
+		if da != db {
+			return da > db
+		}
+		return merged[a] < merged[b]
+	})
+	j.Pending = merged
+}
+
+// save writes the journal atomically, or removes it once nothing is pending.
+func (j *deleteJournal) save(path string) error {
+	if len(j.Pending) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove delete journal %s: %w", path, err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write delete journal %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename delete journal %s: %w", path, err)
+	}
+	return nil
+}
+
+// apply carries out the pending deletions with remove once the uploads
+// finished with uploadErr == nil; otherwise they are postponed and the
+// journal is kept for the next run. Paths that are already gone count as
+// deleted. Paths of one depth are removed jobs at a time, and a depth is
+// finished before the next shallower one starts, so a directory goes only
+// after its contents. On a failed deletion the remaining ones stay in the
+// journal.
+func (j *deleteJournal) apply(path string, uploadErr error, jobs int, remove func(p string) error) (int, error) {
+	if uploadErr != nil {
+		if err := j.save(path); err != nil {
+			return 0, errors.Join(uploadErr, err)
+		}
+		if len(j.Pending) > 0 {
+			return 0, fmt.Errorf("%w (%d deletions postponed until the uploads succeed)", uploadErr, len(j.Pending))
+		}
+		return 0, uploadErr
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	deleted := 0
+	for len(j.Pending) > 0 {
+		depth := strings.Count(j.Pending[0], "/")
+		level := 1
+		for level < len(j.Pending) && strings.Count(j.Pending[level], "/") == depth {
+			level++
+		}
+		errs := make([]error, level)
+		work := make(chan int)
+		var wg sync.WaitGroup
+		for range min(jobs, level) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range work {
+					if err := remove(j.Pending[i]); err != nil && !isNotExist(err) {
+						errs[i] = fmt.Errorf("delete %s: %w", j.Pending[i], err)
+					}
+				}
+			}()
+		}
+		for i := range level {
+			work <- i
+		}
+		close(work)
+		wg.Wait()
+
+		var failed []string
+		var firstErr error
+		for i, err := range errs {
+			if err == nil {
+				deleted++
+				continue
+			}
+			failed = append(failed, j.Pending[i])
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		j.Pending = append(failed, j.Pending[level:]...)
+		if firstErr != nil {
+			if saveErr := j.save(path); saveErr != nil {
+				return deleted, errors.Join(firstErr, saveErr)
+			}
+			return deleted, firstErr
+		}
+	}
+	return deleted, j.save(path)
+}
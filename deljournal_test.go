@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDeleteJournalPlanOrdersDeepestFirst(t *testing.T) {
+	j := &deleteJournal{Version: deleteJournalVersion, Root: "backup"}
+	j.plan([]string{"old", "old/a.txt", "z.txt"})
+	j.plan([]string{"old/sub/b.txt", "z.txt", "old/sub"})
+	want := []string{"old/sub/b.txt", "old/a.txt", "old/sub", "old", "z.txt"}
+	if !reflect.DeepEqual(j.Pending, want) {
+		t.Fatalf("Pending = %v, want %v", j.Pending, want)
+	}
+}
+
+func TestDeleteJournalPostponesUntilUploadsSucceed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deletes.json")
+	j, err := loadDeleteJournal(path, "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.plan([]string{"gone.txt", "missing.txt", "dir"})
+
+	removed := []string{}
+	remove := func(p string) error {
+		if p == "missing.txt" {
+			return os.ErrNotExist
+		}
+		removed = append(removed, p)
+		return nil
+	}
+
+	uploadErr := errors.New("upload failed")
+	if n, err := j.apply(path, uploadErr, 1, remove); !errors.Is(err, uploadErr) || n != 0 {
+		t.Fatalf("apply after failed upload = %d, %v", n, err)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("deleted %v before the uploads succeeded", removed)
+	}
+
+	// The next run resumes the plan it finds on disk.
+	j, err = loadDeleteJournal(path, "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(j.Pending) != 3 {
+		t.Fatalf("reloaded Pending = %v, want 3 entries", j.Pending)
+	}
+	n, err := j.apply(path, nil, 1, remove)
+	if err != nil || n != 3 {
+		t.Fatalf("apply = %d, %v; want 3, nil", n, err)
+	}
+	if want := []string{"dir", "gone.txt"}; !reflect.DeepEqual(removed, want) {
+		t.Fatalf("removed %v, want %v", removed, want)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("journal still present after all deletions: %v", err)
+	}
+}
+
+func TestDeleteJournalKeepsRemainderOnFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deletes.json")
+	j := &deleteJournal{Version: deleteJournalVersion, Root: "backup"}
+	j.plan([]string{"a.txt", "b.txt"})
+	denied := errors.New("access denied")
+	_, err := j.apply(path, nil, 4, func(p string) error {
+		if p == "b.txt" {
+			return denied
+		}
+		return nil
+	})
+	if !errors.Is(err, denied) {
+		t.Fatalf("apply error = %v, want %v", err, denied)
+	}
+	j, err = loadDeleteJournal(path, "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b.txt"}; !reflect.DeepEqual(j.Pending, want) {
+		t.Fatalf("Pending = %v, want %v", j.Pending, want)
+	}
+	if _, err := loadDeleteJournal(path, "other"); err == nil {
+		t.Fatal("loading another root's journal succeeded")
+	}
+}
+
+func TestDeleteJournalApplyConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deletes.json")
+	j := &deleteJournal{Version: deleteJournalVersion, Root: "backup"}
+	j.plan([]string{"d", "d/a", "d/b", "d/e", "d/e/x", "d/e/y", "top.txt"})
+	var (
+		mu   sync.Mutex
+		gone = map[string]bool{}
+	)
+	n, err := j.apply(path, nil, 4, func(p string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for q := range gone {
+			if strings.HasPrefix(p, q+"/") {
+				t.Errorf("%s deleted after its directory %s", p, q)
+			}
+		}
+		gone[p] = true
+		return nil
+	})
+	if err != nil || n != 7 {
+		t.Fatalf("apply = %d, %v; want 7, nil", n, err)
+	}
+}
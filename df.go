@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// shareSpace is the capacity the server reports for the volume behind a
+// share. Available honours per-user quotas and may be less than Free.
+type shareSpace struct {
+	Share     string `json:"share"`
+	Path      string `json:"path"`
+	Total     int64  `json:"total"`
+	Used      int64  `json:"used"`
+	Free      int64  `json:"free"`
+	Available int64  `json:"available"`
+}
+
+func newShareSpace(shareName, p string, fs smb2.FileFsInfo) shareSpace {
+	unit := int64(fs.BlockSize() * fs.FragmentSize())
+	s := shareSpace{
+		Share:     shareName,
+		Path:      p,
+		Total:     int64(fs.TotalBlockCount()) * unit,
+		Free:      int64(fs.FreeBlockCount()) * unit,
+		Available: int64(fs.AvailableBlockCount()) * unit,
+	}
+	s.Used = s.Total - s.Free
+	return s
+}
+
+// statShareSpace queries the file system size information for p.
+func statShareSpace(share *smb2.Share, shareName, p string) (shareSpace, error) {
+	p = normalizeRemotePath(p)
+	start := time.Now()
+	fs, err := share.Statfs(p)
+	opStats.observe("statfs", start)
+	if err != nil {
+		return shareSpace{}, fmt.Errorf("statfs %s: %w", p, err)
+	}
+	return newShareSpace(shareName, p, fs), nil
+}
+
+// writeShareSpace prints s as a df(1)-style table.
+func writeShareSpace(w io.Writer, s shareSpace, human bool) {
+	size := func(n int64) string {
+		if human {
+			return humanBytes(n)
+		}
+		return strconv.FormatInt(n, 10)
+	}
+	pct := "-"
+	if s.Total > 0 {
+		pct = fmt.Sprintf("%d%%", (s.Used*100+s.Total-1)/s.Total)
+	}
+	fmt.Fprintf(w, "%-20s %14s %14s %14s %5s\n", "Share", "Size", "Used", "Avail", "Use%")
+	fmt.Fprintf(w, "%-20s %14s %14s %14s %5s\n", s.Share, size(s.Total), size(s.Used), size(s.Available), pct)
+}
+
+// dfRemote prints the space of the share and fails when less than minFree
+// bytes are available to the caller, so scripts can check before uploading.
+func dfRemote(share *smb2.Share, w io.Writer, shareName, p string, human, asJSON bool, minFree int64) error {
+	s, err := statShareSpace(share, shareName, p)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(withSchema("df", s)); err != nil {
+			return err
+		}
+	} else {
+		writeShareSpace(w, s, human)
+	}
+	if minFree > 0 && s.Available < minFree {
+		return fmt.Errorf("only %s available on %s, need %s", humanBytes(s.Available), shareName, humanBytes(minFree))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type fakeFsInfo struct {
+	total, free, avail uint64
+}
+
+func (f fakeFsInfo) BlockSize() uint64           { return 512 }
+func (f fakeFsInfo) FragmentSize() uint64        { return 8 }
+func (f fakeFsInfo) TotalBlockCount() uint64     { return f.total }
+func (f fakeFsInfo) FreeBlockCount() uint64      { return f.free }
+func (f fakeFsInfo) AvailableBlockCount() uint64 { return f.avail }
+
+func TestNewShareSpace(t *testing.T) {
+	s := newShareSpace("backups", ".", fakeFsInfo{total: 1000, free: 400, avail: 100})
+	want := shareSpace{Share: "backups", Path: ".", Total: 4096000, Used: 2457600, Free: 1638400, Available: 409600}
+	if s != want {
+		t.Errorf("newShareSpace = %+v, want %+v", s, want)
+	}
+}
+
+func TestWriteShareSpace(t *testing.T) {
+	var buf bytes.Buffer
+	writeShareSpace(&buf, shareSpace{Share: "backups", Total: 3 << 30, Used: 1 << 30, Available: 2 << 30}, true)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	fields := strings.Fields(lines[1])
+	if fields[0] != "backups" || fields[len(fields)-1] != "34%" || !strings.Contains(lines[1], "3.0 GiB") {
+		t.Errorf("unexpected row %q", lines[1])
+	}
+}
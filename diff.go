@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// mtimeWindow is how far apart two modification times may be and still
+// count as equal: FAT and some NAS file systems keep times to 2 seconds.
+const mtimeWindow = 2 * time.Second
+
+// treeFile is what diff compares of a file without reading it.
+type treeFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// treeDiff is one file that is not the same on both sides.
+type treeDiff struct {
+	Path string `json:"path"`
+	// Status is changed, missing_remote, or missing_local.
+	Status string `json:"status"`
+	// Reason says what differs for changed files: size, mtime, or content.
+	Reason string `json:"reason,omitempty"`
+	// Detail describes the difference for people, e.g. both sizes.
+	Detail string `json:"detail,omitempty"`
+}
+
+type diffReport struct {
+	Local       string     `json:"local"`
+	Remote      string     `json:"remote"`
+	Compared    int        `json:"compared"`
+	Differences []treeDiff `json:"differences"`
+}
+
+// scanLocalTree lists the regular files below root by slash-separated
+// relative path. Links and other special files are left out.
+func scanLocalTree(root string) (map[string]treeFile, error) {
+	files := make(map[string]treeFile)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = treeFile{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// scanRemoteTree lists the files below root by path relative to it. Links
+// are left out, as on the local side.
+func scanRemoteTree(share remoteFS, root string) (map[string]treeFile, error) {
+	root = normalizeRemotePath(root)
+	files := make(map[string]treeFile)
+	err := walkRemote(share, root, func(p string, fi os.FileInfo) error {
+		if fi.IsDir() || isLink(fi) {
+			return nil
+		}
+		files[relRemote(root, p)] = treeFile{size: fi.Size(), modTime: fi.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// relRemote returns p, a path below root, relative to root.
+func relRemote(root, p string) string {
+	if root == "." {
+		return p
+	}
+	return p[len(root)+1:]
+}
+
+// diffTrees compares two scans. Files of different sizes differ. With
+// sameContent set, files of equal size are compared by it alone; otherwise
+// they differ when their modification times are further than mtimeWindow
+// apart. The result is sorted by path.
+func diffTrees(local, remote map[string]treeFile, sameContent func(rel string) (bool, error)) ([]treeDiff, error) {
+	var diffs []treeDiff
+	for rel, l := range local {
+		r, ok := remote[rel]
+		switch {
+		case !ok:
+			diffs = append(diffs, treeDiff{Path: rel, Status: "missing_remote"})
+		case l.size != r.size:
+			diffs = append(diffs, treeDiff{Path: rel, Status: "changed", Reason: "size",
+				Detail: fmt.Sprintf("%d bytes local, %d remote", l.size, r.size)})
+		case sameContent != nil:
+			same, err := sameContent(rel)
+			if err != nil {
+				return nil, fmt.Errorf("compare %s: %w", rel, err)
+			}
+			if !same {
+				diffs = append(diffs, treeDiff{Path: rel, Status: "changed", Reason: "content"})
+			}
+		case !withinWindow(l.modTime, r.modTime):
+			diffs = append(diffs, treeDiff{Path: rel, Status: "changed", Reason: "mtime",
+				Detail: fmt.Sprintf("modified %s local, %s remote", l.modTime.Format(time.RFC3339), r.modTime.Format(time.RFC3339))})
+		}
+	}
+	for rel := range remote {
+		if _, ok := local[rel]; !ok {
+			diffs = append(diffs, treeDiff{Path: rel, Status: "missing_local"})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs, nil
+}
+
+func withinWindow(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d < mtimeWindow && d > -mtimeWindow
+}
+
+// diffRemote compares the tree at localDir with remoteDir and prints every
+// file that differs or exists on one side only. With checksum, files of
+// equal size are read on both sides and compared by SHA-256 instead of by
+// modification time. It fails when anything differs, so scripts can gate a
+// sync on it.
+func diffRemote(ctx context.Context, share remoteFS, w io.Writer, localDir, remoteDir string, checksum, asJSON bool) error {
+	local, err := scanLocalTree(localDir)
+	if err != nil {
+		return fmt.Errorf("scan %s: %w", localDir, err)
+	}
+	remoteDir = normalizeRemotePath(remoteDir)
+	remote, err := scanRemoteTree(share, remoteDir)
+	if err != nil {
+		return err
+	}
+	var sameContent func(string) (bool, error)
+	if checksum {
+		sameContent = func(rel string) (bool, error) {
+			l, err := hashLocalFile(ctx, filepath.Join(localDir, filepath.FromSlash(rel)))
+			if err != nil {
+				return false, err
+			}
+			r, err := hashRemoteFile(ctx, share, joinRemote(remoteDir, rel), "sha256")
+			if err != nil {
+				return false, err
+			}
+			return l == r, nil
+		}
+	}
+	diffs, err := diffTrees(local, remote, sameContent)
+	if err != nil {
+		return err
+	}
+
+	compared := len(local)
+	for rel := range remote {
+		if _, ok := local[rel]; !ok {
+			compared++
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(withSchema("diff", diffReport{Local: localDir, Remote: remoteDir, Compared: compared, Differences: append([]treeDiff{}, diffs...)})); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range diffs {
+			line := fmt.Sprintf("%-14s %s", d.Status, d.Path)
+			if d.Detail != "" {
+				line += " (" + d.Detail + ")"
+			} else if d.Reason != "" {
+				line += " (" + d.Reason + ")"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%d of %d files differ", len(diffs), compared)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffTrees(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	local := map[string]treeFile{
+		"same":       {size: 3, modTime: t0},
+		"coarse":     {size: 3, modTime: t0.Add(time.Second)},
+		"grown":      {size: 5, modTime: t0},
+		"touched":    {size: 3, modTime: t0.Add(time.Hour)},
+		"only/local": {size: 1, modTime: t0},
+	}
+	remote := map[string]treeFile{
+		"same":        {size: 3, modTime: t0},
+		"coarse":      {size: 3, modTime: t0},
+		"grown":       {size: 3, modTime: t0},
+		"touched":     {size: 3, modTime: t0},
+		"only/remote": {size: 1, modTime: t0},
+	}
+	got, err := diffTrees(local, remote, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary []string
+	for _, d := range got {
+		summary = append(summary, d.Status+" "+d.Path+" "+d.Reason)
+	}
+	want := []string{"changed grown size", "missing_remote only/local ", "missing_local only/remote ", "changed touched mtime"}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("diffTrees = %q, want %q", summary, want)
+	}
+
+	// By content, the touched file is the same and "same" is not.
+	got, err = diffTrees(local, remote, func(rel string) (bool, error) { return rel != "same", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary = nil
+	for _, d := range got {
+		summary = append(summary, d.Status+" "+d.Path+" "+d.Reason)
+	}
+	want = []string{"changed grown size", "missing_remote only/local ", "missing_local only/remote ", "changed same content"}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("diffTrees by content = %q, want %q", summary, want)
+	}
+}
+
+func TestDiffRemote(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := newTestDirFS(t, map[string]string{"dst/a.txt": "alpha", "dst/sub/b.txt": "beta", "dst/gone.txt": "x"})
+	local := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "alpha", "sub/b.txt": "BETA", "new.txt": "n"} {
+		p := filepath.Join(local, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, mtime, mtime)
+		if name != "new.txt" {
+			fsys.Chtimes("dst/"+name, mtime, mtime)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := diffRemote(context.Background(), fsys, &buf, local, "dst", false, false)
+	if err == nil || !strings.Contains(err.Error(), "2 of 4 files differ") {
+		t.Fatalf("diffRemote = %v", err)
+	}
+	want := "missing_local  gone.txt\nmissing_remote new.txt\n"
+	if buf.String() != want {
+		t.Errorf("by time:\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	diffRemote(context.Background(), fsys, &buf, local, "dst", true, true)
+	var report diffReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Compared != 4 || len(report.Differences) != 3 || report.Differences[2] != (treeDiff{Path: "sub/b.txt", Status: "changed", Reason: "content"}) {
+		t.Errorf("by checksum = %+v", report)
+	}
+
+	os.Remove(filepath.Join(local, "new.txt"))
+	fsys.Remove("dst/gone.txt")
+	os.WriteFile(filepath.Join(local, "sub", "b.txt"), []byte("beta"), 0o644)
+	buf.Reset()
+	if err := diffRemote(context.Background(), fsys, &buf, local, "dst", true, false); err != nil || buf.Len() != 0 {
+		t.Errorf("identical trees: %v, output %q", err, buf.String())
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// makeRemoteDir creates dir. With parents set, missing parents are created
+// too and an existing directory is not an error, like mkdir -p.
+func makeRemoteDir(share remoteFS, dir string, parents bool) error {
+	dir = normalizeRemotePath(dir)
+	start := time.Now()
+	var err error
+	if parents {
+		err = share.MkdirAll(dir, 0o755)
+	} else {
+		err = share.Mkdir(dir, 0o755)
+	}
+	opStats.observe("mkdir", start)
+	if err != nil {
+		return fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	return nil
+}
+
+// removeRemoteDir removes dir, which must be an empty directory.
+func removeRemoteDir(share remoteFS, dir string) error {
+	dir = normalizeRemotePath(dir)
+	if dir == "." {
+		return fmt.Errorf("refusing to remove the share root")
+	}
+	fi, err := share.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", dir, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	_, err = removeEntry(share, dir)
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dirTimes remembers the source modification time of every directory a
+// recursive upload touches. Writing a file bumps its parent's mtime on the
+// server, so the times can only be applied once all contents are in place,
+// and deepest directories first so setting a child never disturbs a parent
+// that was already fixed up.
+type dirTimes struct {
+	times map[string]time.Time
+}
+
+func newDirTimes() *dirTimes {
+	return &dirTimes{times: make(map[string]time.Time)}
+}
+
+// record notes that remote directory dir should end up with mtime.
+func (d *dirTimes) record(dir string, mtime time.Time) {
+	d.times[dir] = mtime
+}
+
+// order returns the recorded directories deepest first; siblings are sorted
+// by name so the order is deterministic.
+func (d *dirTimes) order() []string {
+	dirs := make([]string, 0, len(d.times))
+	for dir := range d.times {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		di, dj := strings.Count(dirs[i], "/"), strings.Count(dirs[j], "/")
+		if di != dj {
+			return di > dj
+		}
+		return dirs[i] < dirs[j]
+	})
+	return dirs
+}
+
+// apply sets the recorded times bottom-up. It keeps going after a failure and
+// returns the first error.
+func (d *dirTimes) apply(share remoteFS) error {
+	var firstErr error
+	for _, dir := range d.order() {
+		mtime := d.times[dir]
+		if err := share.Chtimes(dir, mtime, mtime); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("set times on %s: %w", dir, err)
+		}
+	}
+	return firstErr
+}
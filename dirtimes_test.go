@@ -0,0 +1,20 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDirTimesOrderIsBottomUp(t *testing.T) {
+	d := newDirTimes()
+	now := time.Now()
+	for _, dir := range []string{"a", "a/b/c", "a/b", "z", "a/x"} {
+		d.record(dir, now)
+	}
+
+	want := []string{"a/b/c", "a/b", "a/x", "a", "z"}
+	if got := d.order(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("order = %q, want %q", got, want)
+	}
+}
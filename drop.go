@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// dropCandidate returns the i-th name tried for base: the name itself, then
+// "name-1.ext", "name-2.ext", ...
+func dropCandidate(base string, i int) string {
+	if i == 0 {
+		return base
+	}
+	ext := path.Ext(base)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(base, ext), i, ext)
+}
+
+// reserveRemoteName exclusively creates the first free candidate name in dir
+// so concurrent drops never overwrite each other.
+func reserveRemoteName(share *smb2.Share, dir, base string) (string, error) {
+	const maxAttempts = 1000
+	for i := 0; i < maxAttempts; i++ {
+		name := joinRemote(dir, dropCandidate(base, i))
+		f, err := share.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			f.Close()
+			return name, nil
+		}
+		if _, statErr := share.Stat(name); statErr != nil {
+			return "", fmt.Errorf("create remote %s: %w", name, err)
+		}
+	}
+	return "", fmt.Errorf("no free name for %s in %s after %d attempts", base, dir, maxAttempts)
+}
+
+// uncPath formats a share-relative path as \\server\share\path.
+func uncPath(server, share, remote string) string {
+	unc := `\\` + server + `\` + share
+	if remote != "." && remote != "" {
+		unc += `\` + strings.ReplaceAll(remote, "/", `\`)
+	}
+	return unc
+}
+
+// smbURL formats a share-relative path as a percent-encoded
+// smb://server/share/path URL, with an IPv6 server in brackets.
+func smbURL(server, share, remote string) string {
+	if strings.Contains(server, ":") {
+		server = "[" + server + "]"
+	}
+	p := "/" + share
+	if remote != "." && remote != "" {
+		p += "/" + remote
+	}
+	u := url.URL{Scheme: "smb", Host: server, Path: p}
+	return u.String()
+}
+
+// dropFile uploads local into the profile's drop directory under a
+// collision-free name and prints the resulting UNC path and smb:// URL.
+func dropFile(ctx context.Context, share *smb2.Share, opts smbOptions, local string) error {
+	dir := normalizeRemotePath(opts.dropDir)
+	if dir != "." {
+		if err := share.MkdirAll(dir, 0o755); err != nil {
+			if _, statErr := share.Stat(dir); statErr != nil {
+				return fmt.Errorf("mkdir %s: %w", dir, err)
+			}
+		}
+	}
+
+	remote, err := reserveRemoteName(share, dir, filepath.Base(local))
+	if err != nil {
+		return err
+	}
+	if err := uploadFile(ctx, share, local, remote, transferOptions{stallTimeout: opts.stall}); err != nil {
+		share.Remove(remote)
+		return err
+	}
+
+	host, _, err := splitServerAddress(opts.address)
+	if err != nil {
+		return err
+	}
+	fmt.Println(uncPath(host, opts.share, remote))
+	fmt.Println(smbURL(host, opts.share, remote))
+	return nil
+}
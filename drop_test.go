@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestDropCandidate(t *testing.T) {
+	tests := []struct {
+		base string
+		i    int
+		want string
+	}{
+		{"report.pdf", 0, "report.pdf"},
+		{"report.pdf", 1, "report-1.pdf"},
+		{"archive.tar.gz", 2, "archive.tar-2.gz"},
+		{"README", 3, "README-3"},
+	}
+	for _, tc := range tests {
+		if got := dropCandidate(tc.base, tc.i); got != tc.want {
+			t.Fatalf("dropCandidate(%q, %d) = %q, want %q", tc.base, tc.i, got, tc.want)
+		}
+	}
+}
+
+func TestUNCPath(t *testing.T) {
+	if got, want := uncPath("nas", "drop", "incoming/a.txt"), `\\nas\drop\incoming\a.txt`; got != want {
+		t.Fatalf("uncPath = %q, want %q", got, want)
+	}
+	if got, want := uncPath("nas", "drop", "."), `\\nas\drop`; got != want {
+		t.Fatalf("uncPath = %q, want %q", got, want)
+	}
+}
+
+func TestSMBURL(t *testing.T) {
+	tests := []struct {
+		server, share, remote string
+		want                  string
+	}{
+		{"nas", "drop", "incoming/a.txt", "smb://nas/drop/incoming/a.txt"},
+		{"nas", "drop", "q3 report #2.pdf", "smb://nas/drop/q3%20report%20%232.pdf"},
+		{"nas", "drop", ".", "smb://nas/drop"},
+		{"fd00::5", "drop", "a.txt", "smb://[fd00::5]/drop/a.txt"},
+		{"fe80::1%eth0", "drop", "a.txt", "smb://[fe80::1%25eth0]/drop/a.txt"},
+	}
+	for _, tc := range tests {
+		if got := smbURL(tc.server, tc.share, tc.remote); got != tc.want {
+			t.Errorf("smbURL(%q, %q, %q) = %q, want %q", tc.server, tc.share, tc.remote, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errDryRun refuses an operation that would write file data during a dry
+// run. Commands with -dry-run print their transfers before reaching one, so
+// seeing it means a command forgot to.
+var errDryRun = errors.New("not written: dry run")
+
+// dryRunFlag defines -dry-run.
+func dryRunFlag(fs *flag.FlagSet, opts *smbOptions) {
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "Print what would be transferred, renamed, or deleted without changing anything")
+}
+
+// dryRunInterceptor turns changes to the share into "would" lines on w:
+// directories made, entries removed or renamed, and times set are printed
+// and reported as done without reaching the server, while reads go through,
+// so commands walk and check the share as they normally would. Creating or
+// writing a file fails with errDryRun.
+func dryRunInterceptor(w io.Writer) Interceptor {
+	return func(op Op, next func() error) error {
+		switch op.Name {
+		case "mkdir":
+			fmt.Fprintf(w, "would create %s\n", op.Path)
+		case "remove":
+			fmt.Fprintf(w, "would remove %s\n", op.Path)
+		case "rename":
+			fmt.Fprintf(w, "would rename %s -> %s\n", op.Path, op.NewPath)
+		case "chtimes":
+		case "create", "write", "truncate", "copy":
+			return fmt.Errorf("%s %s: %w", op.Name, op.Path, errDryRun)
+		default:
+			return next()
+		}
+		return nil
+	}
+}
+
+// dryRunFS returns share wrapped in dryRunInterceptor when dryRun is set.
+func dryRunFS(share remoteFS, dryRun bool) remoteFS {
+	if !dryRun {
+		return share
+	}
+	return interceptFS(share, dryRunInterceptor(os.Stdout))
+}
+
+// preview prints the uploads a run would make: the directories it would
+// create, the files not yet finished, and the local files it would remove.
+func (t *treeUpload) preview(w io.Writer) (files int, bytes int64) {
+	for _, dir := range t.empty {
+		fmt.Fprintf(w, "would create %s\n", dir)
+	}
+	for _, it := range t.items {
+		if !t.finished[it.local] {
+			fmt.Fprintf(w, "would upload %s (%s)\n", t.rels[it.local], humanBytes(it.size))
+			files++
+			bytes += it.size
+		}
+		if t.deleteSource && !it.special && !t.kept[it.local] {
+			fmt.Fprintf(w, "would remove local %s\n", t.rels[it.local])
+		}
+	}
+	return files, bytes
+}
+
+// preview prints the downloads a run would make.
+func (t *treeDownload) preview(w io.Writer) (files int, bytes int64) {
+	for _, it := range t.items {
+		if !t.finished[it.remote] {
+			fmt.Fprintf(w, "would download %s (%s)\n", it.rel, humanBytes(it.size))
+			files++
+			bytes += it.size
+		}
+	}
+	return files, bytes
+}
+
+// previewDeletes prints the deletions a run would make, those an earlier
+// run left pending included.
+func previewDeletes(w io.Writer, pending []string) {
+	for _, p := range pending {
+		fmt.Fprintf(w, "would delete %s\n", p)
+	}
+}
+
+// dryRunSummary reports the totals of a dry run on stderr.
+func dryRunSummary(parts ...string) {
+	fmt.Fprintf(os.Stderr, "dry run: %s; nothing was changed\n", strings.Join(parts, ", "))
+}
+
+// previewPut prints the uploads put would make of local, checking it as the
+// upload would. open mounts the share of a target. Destinations that already
+// hold the file, or that the overwrite policy keeps, are reported as
+// skipped, and backups it would make as renames, just as the real run
+// decides.
+func previewPut(w io.Writer, open func(share string) (remoteFS, error), local string, targets []remoteTarget, opts smbOptions, marker bool) error {
+	info, err := os.Stat(local)
+	if err != nil {
+		return fmt.Errorf("stat local %s: %w", local, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("local path %s is a directory; use -r to upload its contents", local)
+	}
+	verb := "upload"
+	if opts.appendMode {
+		verb = "append"
+	}
+	// As uploadFile, only files whose time is copied can be unchanged.
+	skipUnchanged := !opts.ignoreTimes && !opts.verify && !opts.appendMode && info.Mode().IsRegular()
+	uploads, active, kept := 0, 0, false
+	for _, target := range targets {
+		share, err := open(target.share)
+		if err != nil {
+			return err
+		}
+		remote := normalizeRemotePath(target.path)
+		if skipUnchanged && unchangedRemote(share, remote, info) {
+			fmt.Fprintf(w, "would skip %s: unchanged\n", target)
+			active++
+			continue
+		}
+		reason, err := opts.overwrite.prepareRemote(interceptFS(share, dryRunInterceptor(w)), remote, info.ModTime())
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			fmt.Fprintf(w, "would skip %s: %s\n", target, reason)
+			kept = true
+			continue
+		}
+		fmt.Fprintf(w, "would %s %s to %s (%s)\n", verb, local, target, humanBytes(info.Size()))
+		uploads++
+		active++
+	}
+	if marker && active > 0 {
+		fmt.Fprintln(w, "would write the done marker in each destination directory")
+	}
+	if opts.deleteSource && !kept {
+		fmt.Fprintf(w, "would remove %s\n", local)
+	}
+	dryRunSummary(fmt.Sprintf("%d uploads of %s", uploads, humanBytes(info.Size())), fmt.Sprintf("%d skipped", len(targets)-uploads))
+	return nil
+}
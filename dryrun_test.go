@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDryRunInterceptorRemove(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"old/a.txt": "a", "old/sub/b.txt": "b"})
+	var out bytes.Buffer
+	n, err := removeRemote(interceptFS(fsys, dryRunInterceptor(&out)), "old", true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("counted %d removals, want 4", n)
+	}
+	for _, want := range []string{"would remove old/a.txt", "would remove old/sub/b.txt", "would remove old/sub", "would remove old\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+	if got := readTestFile(t, fsys, "old/sub/b.txt"); got != "b" {
+		t.Errorf("b.txt = %q after a dry run", got)
+	}
+}
+
+func TestDryRunInterceptorMove(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"a.txt": "a", "archive/keep": ""})
+	var out bytes.Buffer
+	if err := moveRemote(interceptFS(fsys, dryRunInterceptor(&out)), "a.txt", "archive/", false); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "would rename a.txt -> archive/a.txt\n" {
+		t.Errorf("output = %q", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(fsys.root, "a.txt")); err != nil {
+		t.Errorf("a.txt moved by a dry run: %v", err)
+	}
+}
+
+func TestDryRunInterceptorRefusesWrites(t *testing.T) {
+	fsys := newTestDirFS(t, nil)
+	_, err := interceptFS(fsys, dryRunInterceptor(&bytes.Buffer{})).Create("new.txt")
+	if !errors.Is(err, errDryRun) {
+		t.Errorf("create during a dry run: %v", err)
+	}
+}
+
+func TestTreeUploadPreview(t *testing.T) {
+	local := writeTestTree(t, map[string]string{"a.txt": "alpha", "done.txt": "d"})
+	os.Mkdir(filepath.Join(local, "empty"), 0o755)
+	tu, err := scanTreeUpload(&bytes.Buffer{}, local, "dst", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.finished[filepath.Join(local, "done.txt")] = true
+
+	var out bytes.Buffer
+	n, size := tu.preview(&out)
+	if n != 1 || size != 5 {
+		t.Errorf("preview = %d files, %d bytes", n, size)
+	}
+	if want := "would create dst/empty\nwould upload a.txt (5 B)\n"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestPreviewPut(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	local := filepath.Join(writeTestTree(t, map[string]string{"a.txt": "alpha"}), "a.txt")
+	os.Chtimes(local, mtime, mtime)
+	fsys := newTestDirFS(t, map[string]string{"same.txt": "alpha", "old.txt": "x", "new.txt": "x"})
+	fsys.Chtimes("same.txt", mtime, mtime)
+	fsys.Chtimes("old.txt", mtime.Add(-time.Hour), mtime.Add(-time.Hour))
+	fsys.Chtimes("new.txt", mtime.Add(time.Hour), mtime.Add(time.Hour))
+	open := func(string) (remoteFS, error) { return fsys, nil }
+	var targets []remoteTarget
+	for _, p := range []string{"same.txt", "old.txt", "new.txt", "missing.txt"} {
+		targets = append(targets, remoteTarget{share: "s", path: p})
+	}
+
+	tests := []struct {
+		name   string
+		policy overwritePolicy
+		want   []string
+	}{
+		{"replace", overwritePolicy{}, []string{
+			"would skip s:same.txt: unchanged", "would upload " + local + " to s:old.txt (5 B)", "would upload " + local + " to s:new.txt (5 B)", "would upload " + local + " to s:missing.txt (5 B)", "would remove " + local,
+		}},
+		{"no-clobber", overwritePolicy{noClobber: true}, []string{
+			"would skip s:same.txt: unchanged", "would skip s:old.txt: exists", "would skip s:new.txt: exists", "would upload " + local + " to s:missing.txt (5 B)",
+		}},
+		{"if-newer", overwritePolicy{ifNewer: true}, []string{
+			"would skip s:same.txt: unchanged", "would upload " + local + " to s:old.txt (5 B)", "would skip s:new.txt: not older than the source", "would upload " + local + " to s:missing.txt (5 B)",
+		}},
+		{"backup", overwritePolicy{backup: true}, []string{
+			"would skip s:same.txt: unchanged", "would rename old.txt -> old.txt~", "would upload " + local + " to s:old.txt (5 B)", "would rename new.txt -> new.txt~", "would upload " + local + " to s:new.txt (5 B)", "would upload " + local + " to s:missing.txt (5 B)", "would remove " + local,
+		}},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		opts := smbOptions{overwrite: tt.policy, deleteSource: true}
+		if err := previewPut(&out, open, local, targets, opts, false); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got, want := strings.TrimSpace(out.String()), strings.Join(tt.want, "\n"); got != want {
+			t.Errorf("%s: output\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+	if got := readTestFile(t, fsys, "old.txt"); got != "x" {
+		t.Errorf("old.txt = %q after a dry run", got)
+	}
+}
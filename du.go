@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// duEntry is the total size of the files below one directory.
+type duEntry struct {
+	Path  string
+	Bytes int64
+}
+
+// diskUsage accumulates per-directory totals during a walk of root.
+type diskUsage struct {
+	root  string
+	sizes map[string]int64
+}
+
+func newDiskUsage(root string) *diskUsage {
+	return &diskUsage{root: root, sizes: map[string]int64{root: 0}}
+}
+
+// add records one walked entry: directories get a (possibly empty) total,
+// and a file's size counts toward every directory up to root.
+func (u *diskUsage) add(p string, fi os.FileInfo) {
+	if fi.IsDir() {
+		if _, ok := u.sizes[p]; !ok {
+			u.sizes[p] = 0
+		}
+		return
+	}
+	for d := path.Dir(p); ; d = path.Dir(d) {
+		u.sizes[d] += fi.Size()
+		if d == u.root || d == "." || d == "/" {
+			return
+		}
+	}
+}
+
+// depth is how many levels p lies below root.
+func (u *diskUsage) depth(p string) int {
+	if p == u.root {
+		return 0
+	}
+	rel := p
+	if u.root != "." {
+		rel = strings.TrimPrefix(p, u.root+"/")
+	}
+	return strings.Count(rel, "/") + 1
+}
+
+// result returns the directories at most maxDepth levels below root (all of
+// them when maxDepth is negative), each listed after its subdirectories as
+// du(1) does, so the root total comes last.
+func (u *diskUsage) result(maxDepth int) []duEntry {
+	var entries []duEntry
+	for p, n := range u.sizes {
+		if maxDepth < 0 || u.depth(p) <= maxDepth {
+			entries = append(entries, duEntry{Path: p, Bytes: n})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return duLess(entries[i].Path, entries[j].Path)
+	})
+	return entries
+}
+
+// duLess orders paths depth-first with children before their parent.
+func duLess(a, b string) bool {
+	if strings.HasPrefix(b, a+"/") || (a == "." && b != ".") {
+		return false
+	}
+	if strings.HasPrefix(a, b+"/") || (b == "." && a != ".") {
+		return true
+	}
+	ca, cb := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(ca) && i < len(cb); i++ {
+		if ca[i] != cb[i] {
+			return ca[i] < cb[i]
+		}
+	}
+	return false
+}
+
+func duRemote(share *smb2.Share, remote string, maxDepth int, human bool, links linkPolicy) error {
+	remote = normalizeRemotePath(remote)
+	u := newDiskUsage(remote)
+	err := walkRemoteLinks(shareFS(share), remote, links, func(p string, fi os.FileInfo) error {
+		u.add(p, fi)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	writeDiskUsage(os.Stdout, u.result(maxDepth), human)
+	return nil
+}
+
+func writeDiskUsage(w io.Writer, entries []duEntry, human bool) {
+	for _, e := range entries {
+		size := strconv.FormatInt(e.Bytes, 10)
+		if human {
+			size = humanBytes(e.Bytes)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", size, e.Path)
+	}
+}
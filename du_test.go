@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiskUsage(t *testing.T) {
+	now := time.Now()
+	u := newDiskUsage("data")
+	u.add("data/a", testFileInfo("a", 100, now, false))
+	u.add("data/logs", testFileInfo("logs", 0, now, true))
+	u.add("data/logs/old", testFileInfo("old", 0, now, true))
+	u.add("data/logs/old/x", testFileInfo("x", 30, now, false))
+	u.add("data/logs/y", testFileInfo("y", 20, now, false))
+	u.add("data/empty", testFileInfo("empty", 0, now, true))
+
+	tests := []struct {
+		maxDepth int
+		want     []duEntry
+	}{
+		{-1, []duEntry{{"data/empty", 0}, {"data/logs/old", 30}, {"data/logs", 50}, {"data", 150}}},
+		{1, []duEntry{{"data/empty", 0}, {"data/logs", 50}, {"data", 150}}},
+		{0, []duEntry{{"data", 150}}},
+	}
+	for _, tt := range tests {
+		if got := u.result(tt.maxDepth); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("result(%d) = %v, want %v", tt.maxDepth, got, tt.want)
+		}
+	}
+}
+
+func TestDiskUsageShareRoot(t *testing.T) {
+	now := time.Now()
+	u := newDiskUsage(".")
+	u.add("b", testFileInfo("b", 0, now, true))
+	u.add("b/f", testFileInfo("f", 7, now, false))
+	u.add("g", testFileInfo("g", 5, now, false))
+
+	want := []duEntry{{"b", 7}, {".", 12}}
+	if got := u.result(-1); !reflect.DeepEqual(got, want) {
+		t.Fatalf("result = %v, want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	writeDiskUsage(&buf, []duEntry{{"b", 2048}}, true)
+	if got := buf.String(); got != "2.0 KiB\tb\n" {
+		t.Fatalf("human output = %q", got)
+	}
+}
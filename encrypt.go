@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Encrypted files are a magic string, a random 16-byte nonce prefix, and
+// the plaintext in encChunkSize pieces, each sealed with XChaCha20-Poly1305
+// under the prefix and its sequence number. The last piece is sealed with
+// different additional data, so a file cut at a chunk boundary fails to
+// decrypt instead of coming back short.
+const (
+	encMagic     = "SMBPUTE1"
+	encChunkSize = 64 << 10
+	encPrefixLen = 16
+)
+
+var (
+	encMore = []byte{0}
+	encLast = []byte{1}
+)
+
+// loadEncryptKey reads a 256-bit key stored as 64 hex digits, as written by
+// openssl rand -hex 32.
+func loadEncryptKey(name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read encryption key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("encryption key %s: want %d bytes as hex", name, chacha20poly1305.KeySize)
+	}
+	return key, nil
+}
+
+func encNonce(prefix []byte, seq uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[encPrefixLen:], seq)
+	return nonce
+}
+
+// encryptWriter encrypts what is written to it onto w. Close seals the last
+// chunk; it does not close w.
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	seq    uint64
+	buf    []byte
+	header bool
+}
+
+func newEncryptWriter(w io.Writer, key []byte) (*encryptWriter, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, encPrefixLen)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, encChunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// A full buffer is only sealed once more data arrives, so the last
+		// chunk is known to be last when Close seals it.
+		if len(e.buf) == encChunkSize {
+			if err := e.seal(encMore); err != nil {
+				return n, err
+			}
+		}
+		k := copy(e.buf[len(e.buf):encChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+k]
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+func (e *encryptWriter) seal(ad []byte) error {
+	if !e.header {
+		if _, err := io.WriteString(e.w, encMagic); err != nil {
+			return err
+		}
+		if _, err := e.w.Write(e.prefix); err != nil {
+			return err
+		}
+		e.header = true
+	}
+	out := e.aead.Seal(nil, encNonce(e.prefix, e.seq), e.buf, ad)
+	e.seq++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(out)
+	return err
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(encLast)
+}
+
+// decryptReader reads the plaintext of an encrypted stream.
+type decryptReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	seq    uint64
+	chunk  []byte
+	plain  []byte
+	done   bool
+}
+
+func newDecryptReader(r io.Reader, key []byte) (*decryptReader, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, len(encMagic)+encPrefixLen)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.HasPrefix(header, []byte(encMagic)) {
+		return nil, errors.New("not an smbput encrypted file")
+	}
+	return &decryptReader{
+		r:      bufio.NewReader(r),
+		aead:   aead,
+		prefix: header[len(encMagic):],
+		chunk:  make([]byte, encChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk. A short chunk is the last one; a
+// full one is last when nothing follows it.
+func (d *decryptReader) open() error {
+	n, err := io.ReadFull(d.r, d.chunk)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		d.done = true
+	case err != nil:
+		return err
+	default:
+		if _, err := d.r.Peek(1); err == io.EOF {
+			d.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+	ad := encMore
+	if d.done {
+		ad = encLast
+	}
+	plain, err := d.aead.Open(d.chunk[:0], encNonce(d.prefix, d.seq), d.chunk[:n], ad)
+	if err != nil {
+		return errors.New("encrypted file is corrupt, truncated, or under another key")
+	}
+	d.seq++
+	d.plain = plain
+	return nil
+}
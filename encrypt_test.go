@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func encryptBytes(t *testing.T, plain []byte, key []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	ew, err := newEncryptWriter(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ew.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptBytes(sealed []byte, key []byte) ([]byte, error) {
+	dr, err := newDecryptReader(bytes.NewReader(sealed), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(dr)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, encChunkSize - 1, encChunkSize, encChunkSize + 1, 3*encChunkSize + 17} {
+		plain := bytes.Repeat([]byte("0123456789abcdef"), size/16+1)[:size]
+		sealed := encryptBytes(t, plain, testKey(1))
+		got, err := decryptBytes(sealed, testKey(1))
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("size %d: got %d bytes, %v", size, len(got), err)
+		}
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	plain := bytes.Repeat([]byte("x"), 2*encChunkSize)
+	sealed := encryptBytes(t, plain, testKey(1))
+	chunk := encChunkSize + 16
+	header := len(encMagic) + encPrefixLen
+
+	flipped := append([]byte{}, sealed...)
+	flipped[header+5] ^= 1
+	tests := map[string][]byte{
+		"wrong key":            nil,
+		"truncated at a chunk": sealed[:header+chunk],
+		"truncated mid-chunk":  sealed[:len(sealed)-3],
+		"tampered":             flipped,
+		"not encrypted":        []byte("plain text"),
+	}
+	for name, data := range tests {
+		key := testKey(1)
+		if data == nil {
+			data, key = sealed, testKey(2)
+		}
+		if _, err := decryptBytes(data, key); err == nil {
+			t.Errorf("%s: decrypted without error", name)
+		}
+	}
+}
+
+func TestLoadEncryptKey(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good")
+	os.WriteFile(good, []byte(strings.Repeat("ab", 32)+"\n"), 0o600)
+	if key, err := loadEncryptKey(good); err != nil || len(key) != 32 || key[0] != 0xab {
+		t.Errorf("loadEncryptKey = %x, %v", key, err)
+	}
+	short := filepath.Join(dir, "short")
+	os.WriteFile(short, []byte("abcd"), 0o600)
+	if _, err := loadEncryptKey(short); err == nil {
+		t.Error("accepted a short key")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// filterRule is one -include or -exclude pattern.
+type filterRule struct {
+	pattern string
+	include bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// pathFilter is the -include and -exclude patterns of a recursive transfer,
+// in the order given. As in rsync, the first pattern matching a path
+// decides, a path no pattern matches is included, and an excluded
+// directory is not descended into, so nothing below it can be included.
+type pathFilter []filterRule
+
+// newFilterRule compiles an rsync-style pattern. A pattern with no slash
+// matches a name at any depth; one with a slash inside matches a path at
+// any depth, and one starting with / only from the top of the transfer. A
+// trailing / matches directories only. * and ? match within one path
+// element, ** across elements (**/ also matches no directory at all), and
+// [...] a character class, and \ makes the next character literal.
+// Matching ignores case, as SMB does.
+func newFilterRule(pattern string, include bool) (filterRule, error) {
+	r := filterRule{pattern: pattern, include: include}
+	p := pattern
+	if strings.HasSuffix(p, "/") {
+		r.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	anchored := strings.HasPrefix(p, "/")
+	p = strings.TrimLeft(p, "/")
+	if p == "" {
+		return r, fmt.Errorf("empty pattern %q", pattern)
+	}
+
+	var re strings.Builder
+	re.WriteString("(?is)")
+	if anchored {
+		re.WriteString("^")
+	} else {
+		re.WriteString("(?:^|/)")
+	}
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '*':
+			switch {
+			case strings.HasPrefix(p[i:], "**/"):
+				// Zero or more whole directories: **/x also matches x.
+				re.WriteString("(?:.*/)?")
+				i += 2
+			case strings.HasPrefix(p[i:], "**"):
+				re.WriteString(".*")
+				i++
+			default:
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '\\':
+			if i+1 < len(p) {
+				i++
+			}
+			re.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		case '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				return r, fmt.Errorf("unterminated [ in pattern %q", pattern)
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			re.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	re.WriteString("$")
+	var err error
+	if r.re, err = regexp.Compile(re.String()); err != nil {
+		return r, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return r, nil
+}
+
+// excluded reports whether the filter leaves out the entry at rel, a
+// slash-separated path relative to the top of the transfer.
+func (f pathFilter) excluded(rel string, dir bool) bool {
+	rel = path.Clean(rel)
+	for _, r := range f {
+		if r.dirOnly && !dir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			return !r.include
+		}
+	}
+	return false
+}
+
+// filterFlag adds the patterns of one of -include and -exclude to a shared
+// list, so the two keep their command-line order.
+type filterFlag struct {
+	filter  *pathFilter
+	include bool
+}
+
+func (f filterFlag) String() string { return "" }
+
+func (f filterFlag) Set(pattern string) error {
+	r, err := newFilterRule(pattern, f.include)
+	if err != nil {
+		return err
+	}
+	*f.filter = append(*f.filter, r)
+	return nil
+}
+
+// filterFlags defines the repeatable -include and -exclude flags.
+func filterFlags(fs *flag.FlagSet, opts *smbOptions) {
+	fs.Var(filterFlag{&opts.filter, true}, "include", "Transfer paths matching this pattern even if a later -exclude matches (repeatable)")
+	fs.Var(filterFlag{&opts.filter, false}, "exclude", "Leave out paths matching this pattern, e.g. .git/ or **/*.tmp (repeatable)")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFilterRuleMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		dir     bool
+		want    bool
+	}{
+		{"*.tmp", "a.tmp", false, true},
+		{"*.tmp", "deep/down/a.TMP", false, true},
+		{"*.tmp", "a.tmp.txt", false, false},
+		{".git/", ".git", true, true},
+		{".git/", "sub/.git", true, true},
+		{".git/", ".git", false, false},
+		{"build/out", "build/out", false, true},
+		{"build/out", "x/build/out", false, true},
+		{"/build", "build", true, true},
+		{"/build", "x/build", true, false},
+		{"**/cache/*.bin", "cache/a.bin", false, true},
+		{"**/cache/*.bin", "a/b/cache/a.bin", false, true},
+		{"logs/**", "logs/2024/app.log", false, true},
+		{"logs/*", "logs/2024/app.log", false, false},
+		{"file?.[ch]", "file1.c", false, true},
+		{"file?.[!ch]", "file1.c", false, false},
+	}
+	for _, tt := range tests {
+		r, err := newFilterRule(tt.pattern, false)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.pattern, err)
+		}
+		if got := (pathFilter{r}).excluded(tt.rel, tt.dir); got != tt.want {
+			t.Errorf("%s matches %s (dir %v) = %v, want %v", tt.pattern, tt.rel, tt.dir, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "/", "a[b"} {
+		if _, err := newFilterRule(bad, false); err == nil {
+			t.Errorf("pattern %q accepted", bad)
+		}
+	}
+}
+
+func TestFilterFlagsKeepOrder(t *testing.T) {
+	var opts smbOptions
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	filterFlags(fs, &opts)
+	if err := fs.Parse([]string{"-include", "keep.log", "-exclude", "*.log", "-exclude", "node_modules/"}); err != nil {
+		t.Fatal(err)
+	}
+	f := opts.filter
+	if f.excluded("keep.log", false) || !f.excluded("other.log", false) || !f.excluded("web/node_modules", true) || f.excluded("a.txt", false) {
+		t.Errorf("filter %+v decides wrongly", f)
+	}
+}
+
+func TestScanTreeUploadFilter(t *testing.T) {
+	local := writeTestTree(t, map[string]string{
+		"src/main.go":   "m",
+		"src/main.o":    "o",
+		".git/HEAD":     "h",
+		"keep.o":        "k",
+		"docs/.git/x":   "x",
+		"docs/index.md": "i",
+	})
+	var filter pathFilter
+	for _, arg := range []struct {
+		p       string
+		include bool
+	}{{"/keep.o", true}, {"*.o", false}, {".git/", false}} {
+		r, err := newFilterRule(arg.p, arg.include)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filter = append(filter, r)
+	}
+	var out bytes.Buffer
+	tu, err := scanTreeUpload(&out, local, "dst", nil, filter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rels []string
+	for _, it := range tu.items {
+		rels = append(rels, tu.rels[it.local])
+	}
+	if got := strings.Join(rels, " "); got != "docs/index.md keep.o src/main.go" {
+		t.Errorf("uploaded %q", got)
+	}
+	if tu.skipped != 0 || out.Len() != 0 {
+		t.Errorf("excluded paths reported: %d\n%s", tu.skipped, out.String())
+	}
+
+	fsys := newTestDirFS(t, map[string]string{"src/a.o": "o", "src/a.c": "c", "src/.git/config": "g"})
+	td, err := scanTreeDownload(fsys, io.Discard, "src", t.TempDir(), linksKeep, nil, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(td.items) != 1 || td.items[0].rel != "a.c" {
+		t.Errorf("download items %+v", td.items)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// findFilter holds the predicates of a find; all set predicates must match.
+type findFilter struct {
+	name      string        // glob against the base name, case-insensitive
+	kind      byte          // 'f', 'd', 'l', or 0 for any
+	newerThan time.Duration // modified less than this long ago; 0 disables
+	sizeOp    byte          // '+', '-', '=', or 0 when -size is unset
+	size      int64
+}
+
+func newFindFilter(name, kind string, newerThan time.Duration, size string) (findFilter, error) {
+	f := findFilter{name: strings.ToLower(name), newerThan: newerThan}
+	if _, err := path.Match(f.name, ""); err != nil {
+		return findFilter{}, fmt.Errorf("invalid -name pattern %q: %w", name, err)
+	}
+	switch kind {
+	case "":
+	case "f", "d", "l":
+		f.kind = kind[0]
+	default:
+		return findFilter{}, fmt.Errorf("invalid -type %q: want f, d, or l", kind)
+	}
+	if size != "" {
+		op, n, err := parseSizePredicate(size)
+		if err != nil {
+			return findFilter{}, err
+		}
+		f.sizeOp, f.size = op, n
+	}
+	return f, nil
+}
+
+// parseSizePredicate parses -size values: +N (larger than), -N (smaller
+// than), or N (exactly), with an optional k, M, G, or T binary suffix.
+func parseSizePredicate(s string) (byte, int64, error) {
+	op, num := byte('='), s
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		op, num = s[0], s[1:]
+	}
+	n, err := parseByteSize(num)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid -size %q: want +N, -N, or N with an optional k, M, G, or T suffix", s)
+	}
+	return op, n, nil
+}
+
+// parseByteSize parses a byte count with an optional k, M, G, or T binary
+// suffix, e.g. "512", "64k", "100M".
+func parseByteSize(s string) (int64, error) {
+	mult := int64(1)
+	num := s
+	if num != "" {
+		switch num[len(num)-1] {
+		case 'k', 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			num = num[:len(num)-1]
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+func (f findFilter) match(fi os.FileInfo, now time.Time) bool {
+	if f.name != "" {
+		if ok, _ := path.Match(f.name, strings.ToLower(fi.Name())); !ok {
+			return false
+		}
+	}
+	switch f.kind {
+	case 'f':
+		if fi.IsDir() {
+			return false
+		}
+	case 'd':
+		if !fi.IsDir() {
+			return false
+		}
+	case 'l':
+		if !isLink(fi) {
+			return false
+		}
+	}
+	if f.newerThan > 0 && now.Sub(fi.ModTime()) >= f.newerThan {
+		return false
+	}
+	switch f.sizeOp {
+	case '+':
+		return fi.Size() > f.size
+	case '-':
+		return fi.Size() < f.size
+	case '=':
+		return fi.Size() == f.size
+	}
+	return true
+}
+
+// findRemote prints every path below root that matches f, one per line,
+// escaping unsafe names unless raw is set.
+func findRemote(share *smb2.Share, w io.Writer, root string, f findFilter, raw bool, links linkPolicy) error {
+	now := time.Now()
+	return walkRemoteLinks(shareFS(share), root, links, func(p string, fi os.FileInfo) error {
+		if f.match(fi, now) {
+			fmt.Fprintln(w, displayName(p, raw))
+		}
+		return nil
+	})
+}
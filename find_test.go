@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSizePredicate(t *testing.T) {
+	tests := []struct {
+		in     string
+		op     byte
+		n      int64
+		wantOK bool
+	}{
+		{"+100M", '+', 100 << 20, true},
+		{"-1k", '-', 1 << 10, true},
+		{"512", '=', 512, true},
+		{"2G", '=', 2 << 30, true},
+		{"+", 0, 0, false},
+		{"10X", 0, 0, false},
+		{"--5", 0, 0, false},
+	}
+	for _, tt := range tests {
+		op, n, err := parseSizePredicate(tt.in)
+		if (err == nil) != tt.wantOK {
+			t.Errorf("parseSizePredicate(%q) error = %v", tt.in, err)
+			continue
+		}
+		if tt.wantOK && (op != tt.op || n != tt.n) {
+			t.Errorf("parseSizePredicate(%q) = %c %d, want %c %d", tt.in, op, n, tt.op, tt.n)
+		}
+	}
+}
+
+func TestFindFilterMatch(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	file := testFileInfo("Report.TMP", 2<<20, now.Add(-2*time.Hour), false)
+	dir := testFileInfo("cache.tmp", 0, now.Add(-48*time.Hour), true)
+
+	tests := []struct {
+		name      string
+		glob      string
+		kind      string
+		newerThan time.Duration
+		size      string
+		wantFile  bool
+		wantDir   bool
+	}{
+		{name: "no predicates", wantFile: true, wantDir: true},
+		{name: "name case-insensitive", glob: "*.tmp", wantFile: true, wantDir: true},
+		{name: "name mismatch", glob: "*.csv"},
+		{name: "files only", kind: "f", wantFile: true},
+		{name: "dirs only", kind: "d", wantDir: true},
+		{name: "newer than a day", newerThan: 24 * time.Hour, wantFile: true},
+		{name: "larger than 1M", size: "+1M", wantFile: true},
+		{name: "smaller than 1M", size: "-1M", wantDir: true},
+		{name: "combined", glob: "report*", kind: "f", size: "2M", wantFile: true},
+	}
+	for _, tt := range tests {
+		f, err := newFindFilter(tt.glob, tt.kind, tt.newerThan, tt.size)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := f.match(file, now); got != tt.wantFile {
+			t.Errorf("%s: file match = %v, want %v", tt.name, got, tt.wantFile)
+		}
+		if got := f.match(dir, now); got != tt.wantDir {
+			t.Errorf("%s: dir match = %v, want %v", tt.name, got, tt.wantDir)
+		}
+	}
+
+	if _, err := newFindFilter("", "x", 0, ""); err == nil {
+		t.Error("invalid -type accepted")
+	}
+	if _, err := newFindFilter("[", "", 0, ""); err == nil {
+		t.Error("invalid -name accepted")
+	}
+}
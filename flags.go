@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+// registerGlobalFlags defines the flags shared by every command: connection
+// settings and run-wide reporting.
+func registerGlobalFlags(fs *flag.FlagSet, opts *smbOptions) {
+	fs.StringVar(&opts.address, "server", "", "SMB server address (host or host:port)")
+	fs.StringVar(&opts.share, "share", "", "SMB share name")
+	fs.StringVar(&opts.user, "user", "", "SMB username (default guest, with no password)")
+	fs.StringVar(&opts.password, "password", "", "SMB password (or set SMB_PASSWORD env var)")
+	fs.StringVar(&opts.credentials, "credentials", "", "Credential source: env, file:PATH, exec:COMMAND, keyring[:SERVICE], or vault:PATH")
+	fs.StringVar(&opts.domain, "domain", "", "SMB domain (optional)")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "Dial timeout")
+	fs.StringVar(&opts.profile, "profile", defaultProfile, "Config profile supplying connection defaults")
+	fs.BoolVar(&opts.stats, "stats", false, "Print per-operation latency statistics to stderr on exit")
+	fs.StringVar(&opts.metricsFile, "metrics-file", "", "Write latency metrics in Prometheus text format to this file")
+	fs.StringVar(&opts.pushMetrics, "push-metrics", "", "On exit, push run metrics to a Pushgateway (http://HOST:9091) or statsd (statsd://HOST:8125)")
+	fs.BoolVar(&opts.showVersion, "version", false, "Print version information and exit")
+	fs.StringVar(&opts.resumeToken, "resume-token", "", "Continue the transfer described by a token printed by an interrupted run")
+}
+
+// transferFlags defines the flags common to commands that move file data.
+func transferFlags(fs *flag.FlagSet, opts *smbOptions) {
+	fs.IntVar(&opts.reconnects, "reconnect", 3, "Reconnect attempts when the connection drops")
+	fs.DurationVar(&opts.stall, "stall-timeout", 0, "Abort and retry a transfer that makes no progress for this long (0 disables)")
+	fs.DurationVar(&opts.maxDuration, "max-duration", 0, "Stop transfers cleanly after this long (e.g. 4h)")
+	fs.StringVar(&opts.deadline, "deadline", "", "Stop transfers cleanly at this local time (HH:MM)")
+}
+
+// resumeFlags defines the flags of commands whose interrupted transfers can
+// be continued.
+func resumeFlags(fs *flag.FlagSet, opts *smbOptions) {
+	fs.BoolVar(&opts.resume, "resume", false, "Continue a partial transfer left by an interrupted run")
+	fs.BoolVar(&opts.json, "json", false, "Report an interrupted transfer and its resume token as JSON on stdout")
+}
+
+// flagSet returns the command's own flag set. Global flags are added too,
+// bound to the values already parsed from before the command name, so they
+// may appear on either side of it.
+func (c *command) flagSet(opts *smbOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("smbput "+c.name, flag.ContinueOnError)
+	if c.setFlags != nil {
+		c.setFlags(fs, opts)
+	}
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	fs.Usage = func() { printCommandHelp(fs.Output(), c) }
+	return fs
+}
+
+// parseInterspersed parses args with fs, allowing flags after positional
+// arguments (put a.txt b.txt -resume). Everything after "--" is positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional, tail []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, tail = args[:i], args[i+1:]
+			break
+		}
+	}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return append(positional, tail...), nil
+}
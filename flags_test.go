@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	var opts smbOptions
+	fs := flag.NewFlagSet("put", flag.ContinueOnError)
+	fs.BoolVar(&opts.resume, "resume", false, "")
+	fs.IntVar(&opts.reconnects, "reconnect", 3, "")
+
+	args, err := parseInterspersed(fs, []string{"a.txt", "-resume", "b.txt", "--reconnect=5", "--", "-odd-name"})
+	if err != nil {
+		t.Fatalf("parseInterspersed returned error: %v", err)
+	}
+	if want := []string{"a.txt", "b.txt", "-odd-name"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("args = %q, want %q", args, want)
+	}
+	if !opts.resume || opts.reconnects != 5 {
+		t.Fatalf("resume/reconnect = %v/%d, want true/5", opts.resume, opts.reconnects)
+	}
+}
+
+func TestParseInterspersedUnknownFlag(t *testing.T) {
+	fs := flag.NewFlagSet("smbput ls", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := parseInterspersed(fs, []string{"-bogus"}); err == nil {
+		t.Fatalf("expected error for unknown flag")
+	}
+}
+
+func TestCommandFlagSetAcceptsGlobalFlags(t *testing.T) {
+	var opts smbOptions
+	saved := flag.CommandLine
+	defer func() { flag.CommandLine = saved }()
+	flag.CommandLine = flag.NewFlagSet("smbput", flag.ContinueOnError)
+	registerGlobalFlags(flag.CommandLine, &opts)
+	if err := flag.CommandLine.Parse([]string{"-server", "nas", "report"}); err != nil {
+		t.Fatalf("global parse: %v", err)
+	}
+
+	fs := lookupCommand("report").flagSet(&opts)
+	args, err := parseInterspersed(fs, []string{"archive", "-share", "docs", "-top", "3"})
+	if err != nil {
+		t.Fatalf("command parse: %v", err)
+	}
+	if opts.address != "nas" || opts.share != "docs" || opts.top != 3 {
+		t.Fatalf("opts = %+v, want server nas, share docs, top 3", opts)
+	}
+	if !reflect.DeepEqual(args, []string{"archive"}) {
+		t.Fatalf("args = %q, want [archive]", args)
+	}
+}
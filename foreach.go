@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// foreachPlaceholder is replaced in a foreach command by the quoted remote
+// path of the file being fed to it.
+const foreachPlaceholder = "{}"
+
+// localShellQuote quotes s as one word for the shell shellCommand runs.
+func localShellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return shellQuote(s)
+}
+
+// foreachRemote runs command once per remote file in paths, jobs at a time,
+// with the file streamed into its standard input; nothing is written to
+// local disk. {} in command stands for the remote path, which is also in
+// $SMBPUT_FILE. The commands share stdout and stderr, so with several jobs
+// their output may interleave, as with xargs -P. A command that exits
+// non-zero is reported and counted, and does not stop the others.
+func foreachRemote(ctx context.Context, share remoteFS, command string, paths []string, jobs int, stdout, stderr io.Writer) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		work   = make(chan string)
+		failed int
+	)
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range work {
+				if err := foreachFile(ctx, share, command, p, stdout, stderr); err != nil && ctx.Err() == nil {
+					mu.Lock()
+					fmt.Fprintf(stderr, "foreach: %s: %v\n", p, err)
+					failed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, p := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- p
+	}
+	close(work)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d commands failed", failed, len(paths))
+	}
+	return nil
+}
+
+// foreachFile runs command with the remote file p as its standard input.
+func foreachFile(ctx context.Context, share remoteFS, command, p string, stdout, stderr io.Writer) error {
+	start := time.Now()
+	f, err := share.Open(p)
+	opStats.observe("open", start)
+	if err != nil {
+		return fmt.Errorf("open remote %s: %w", p, err)
+	}
+	defer f.Close()
+
+	cmd := shellCommand(ctx, strings.ReplaceAll(command, foreachPlaceholder, localShellQuote(p)))
+	cmd.Env = append(os.Environ(), "SMBPUT_FILE="+p)
+	cmd.Stdin = ctxReader{ctx, timedReader{f, "read"}}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
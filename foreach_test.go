@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestForeachRemote(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	fsys := newTestDirFS(t, map[string]string{"in/a b.txt": "alpha\n", "in/c.txt": "gamma\n"})
+
+	var stdout, stderr bytes.Buffer
+	err := foreachRemote(context.Background(), fsys, `printf '%s %s ' {} "$SMBPUT_FILE"; tr a-z A-Z`, []string{"in/a b.txt", "in/c.txt"}, 1, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr.String())
+	}
+	if want := "in/a b.txt in/a b.txt ALPHA\nin/c.txt in/c.txt GAMMA\n"; stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestForeachRemoteFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	fsys := newTestDirFS(t, map[string]string{"ok.txt": "ok", "bad.txt": "bad"})
+
+	var stdout, stderr bytes.Buffer
+	err := foreachRemote(context.Background(), fsys, `grep -q ok`, []string{"ok.txt", "bad.txt", "missing.txt"}, 1, &stdout, &stderr)
+	if err == nil || err.Error() != "2 of 3 commands failed" {
+		t.Fatalf("err = %v", err)
+	}
+	for _, want := range []string{"foreach: bad.txt: exit status 1", "foreach: missing.txt: open remote"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("stderr lacks %q:\n%s", want, stderr.String())
+		}
+	}
+}
+
+func TestLocalShellQuote(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX quoting")
+	}
+	if got := localShellQuote("it's"); got != `'it'\''s'` {
+		t.Errorf("localShellQuote = %s", got)
+	}
+}
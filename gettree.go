@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// downloadItem is one remote file of a recursive get. rule is the rule the
+// file was stored under when its name carries the rule's suffixes, and is
+// undone on the way down.
+type downloadItem struct {
+	remote, rel, local string
+	size               int64
+	modTime            time.Time
+	rule               transferRule
+}
+
+// treeDownload is a recursive get of a remote directory. Like treeUpload it
+// survives reconnects by remembering which files are finished.
+type treeDownload struct {
+	remote, local string
+	items         []downloadItem
+	dirs          []string
+	times         map[string]time.Time
+	skipped       int
+	finished      map[string]bool
+	resumed       int
+	downloaded    int
+	failed        int
+	bytes         int64
+	budget        *localBudget
+	deferred      int
+	// deleteSource removes each remote file once it is downloaded and
+	// checked; verify makes the check compare content.
+	deleteSource bool
+	verify       bool
+	removed      int
+}
+
+// errLocalBudget stops a download that would write more than
+// -max-local-bytes.
+var errLocalBudget = errors.New("local byte limit reached")
+
+// localBudget caps the bytes a recursive get writes locally. Each file
+// reserves its remote size before it starts, and grows the reservation if
+// undoing a rule's compression makes it larger, so concurrent downloads
+// cannot overshoot the limit together. A nil budget allows everything.
+type localBudget struct {
+	mu          sync.Mutex
+	limit, used int64
+}
+
+func (b *localBudget) reserve(n int64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used+n > b.limit {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+func (b *localBudget) release(n int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+}
+
+// budgetWriter writes to w within the reservation it holds, extending it
+// as needed.
+type budgetWriter struct {
+	w                 io.Writer
+	budget            *localBudget
+	reserved, written int64
+}
+
+func (bw *budgetWriter) Write(p []byte) (int, error) {
+	if need := bw.written + int64(len(p)) - bw.reserved; need > 0 {
+		if !bw.budget.reserve(need) {
+			return 0, errLocalBudget
+		}
+		bw.reserved += need
+	}
+	n, err := bw.w.Write(p)
+	bw.written += int64(n)
+	return n, err
+}
+
+// storedRule returns the rule under which a file named name was stored, and
+// the name it had before: app.log.zst was app.log if a rule compresses
+// *.log. Files no transforming rule explains are returned as they are, with
+// the rule matching their own name.
+func storedRule(rules []transferRule, name string) (transferRule, string) {
+	orig := strings.TrimSuffix(name, ".enc")
+	orig = strings.TrimSuffix(orig, ".zst")
+	if orig != name {
+		if r := matchRule(rules, orig); r.transforms() && r.remoteName(orig) == name {
+			return r, orig
+		}
+	}
+	return matchRule(rules, name), name
+}
+
+// localPathUnder joins rel, a slash-separated path below a remote tree, to
+// the local directory root, failing if the cleaned result is not inside
+// root.
+func localPathUnder(root, rel string) (string, error) {
+	p := filepath.Join(root, filepath.FromSlash(rel))
+	r, err := filepath.Rel(root, p)
+	if err != nil || r == "." || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) || filepath.IsAbs(r) || filepath.VolumeName(r) != "" {
+		return "", fmt.Errorf("%s leads outside %s", rel, root)
+	}
+	return p, nil
+}
+
+// scanTreeDownload lists what downloading remoteDir into localDir involves.
+// Links are reported and left out unless links is linksFollow; files the
+// rules skip are left out too, and paths the filter excludes silently. The
+// filter sees files under their local names.
+func scanTreeDownload(share remoteFS, w io.Writer, remoteDir, localDir string, links linkPolicy, rules []transferRule, filter pathFilter) (*treeDownload, error) {
+	t := &treeDownload{
+		remote:   normalizeRemotePath(remoteDir),
+		local:    localDir,
+		times:    make(map[string]time.Time),
+		finished: make(map[string]bool),
+	}
+	fi, err := share.Stat(t.remote)
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %w", t.remote, err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", t.remote)
+	}
+	t.dirs = append(t.dirs, localDir)
+	t.times[localDir] = fi.ModTime()
+
+	err = walkRemoteLinks(share, t.remote, links, func(p string, fi os.FileInfo) error {
+		rel := relRemote(t.remote, p)
+		if fi.IsDir() && !isLink(fi) && filter.excluded(rel, true) {
+			return fs.SkipDir
+		}
+		switch {
+		case isLink(fi):
+			fmt.Fprintf(w, "skipped    %s (symbolic link)\n", rel)
+			t.skipped++
+		case fi.IsDir():
+			dir, err := localPathUnder(localDir, rel)
+			if err != nil {
+				return err
+			}
+			t.dirs = append(t.dirs, dir)
+			t.times[dir] = fi.ModTime()
+		default:
+			rule, orig := storedRule(rules, rel)
+			if filter.excluded(orig, false) {
+				return nil
+			}
+			if rule.skip {
+				fmt.Fprintf(w, "skipped    %s (rule %s)\n", rel, rule.pattern)
+				t.skipped++
+				return nil
+			}
+			local, err := localPathUnder(localDir, orig)
+			if err != nil {
+				return err
+			}
+			t.items = append(t.items, downloadItem{
+				remote:  p,
+				rel:     rel,
+				local:   local,
+				size:    fi.Size(),
+				modTime: fi.ModTime(),
+				rule:    rule,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// skipDownloaded marks finished the files an earlier, interrupted run
+// already downloaded: those whose local copy carries the remote
+// modification time, which is set only once a file is complete, and for
+// files stored as they are, the remote size.
+func (t *treeDownload) skipDownloaded() {
+	for _, it := range t.items {
+		fi, err := os.Stat(it.local)
+		if err != nil || fi.IsDir() || !withinWindow(fi.ModTime(), it.modTime) {
+			continue
+		}
+		if !it.rule.transforms() && fi.Size() != it.size {
+			continue
+		}
+		t.finished[it.remote] = true
+		t.resumed++
+	}
+}
+
+// applyOverwrite is treeUpload.applyOverwrite for a download: files whose
+// local copy is to be kept are reported as skipped, those whose local copy
+// cannot be checked as failed, and both are marked finished; the local
+// copies of the others are backed up if p asks.
+func (t *treeDownload) applyOverwrite(p overwritePolicy, w io.Writer) {
+	if !p.set() {
+		return
+	}
+	for _, it := range t.items {
+		if t.finished[it.remote] {
+			continue
+		}
+		reason, err := p.prepareLocal(it.local, it.modTime)
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "failed     %s: %v\n", it.rel, err)
+			t.failed++
+			t.finished[it.remote] = true
+		case reason != "":
+			fmt.Fprintf(w, "skipped    %s (%s)\n", it.rel, reason)
+			t.skipped++
+			t.finished[it.remote] = true
+		}
+	}
+}
+
+// run downloads the files not yet finished, jobs at a time, printing a line
+// to w for each. As with treeUpload.run, files lost to a dropped connection
+// stay pending and the connection error is returned.
+func (t *treeDownload) run(ctx context.Context, share remoteFS, w io.Writer, jobs int) error {
+	for _, dir := range t.dirs {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	t.deferred = 0
+	var pending []downloadItem
+	for _, it := range t.items {
+		if !t.finished[it.remote] {
+			pending = append(pending, it)
+		}
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		work    = make(chan downloadItem)
+		connErr error
+	)
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range work {
+				err := downloadTreeItem(ctx, share, it, t.budget)
+				var removeErr error
+				if err == nil {
+					removeErr = t.removeSource(ctx, share, it)
+				}
+				mu.Lock()
+				switch {
+				case errors.Is(err, errLocalBudget):
+					// Left for a later -resume run, like the files
+					// never started.
+					t.deferred++
+				case err == nil:
+					fmt.Fprintf(w, "downloaded %s (%s)\n", it.rel, humanBytes(it.size))
+					t.downloaded++
+					t.bytes += it.size
+					t.finished[it.remote] = true
+					switch {
+					case removeErr != nil:
+						fmt.Fprintf(w, "failed     %s: downloaded, but %v\n", it.rel, removeErr)
+						t.failed++
+					case t.deleteSource:
+						t.removed++
+					}
+				case isConnectionError(err):
+					if connErr == nil {
+						connErr = err
+					}
+				case ctx.Err() != nil:
+					// Interrupted, not failed; a -resume run picks it up.
+				default:
+					fmt.Fprintf(w, "failed     %s: %v\n", it.rel, err)
+					t.failed++
+					t.finished[it.remote] = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i, it := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		if !t.budget.reserve(it.size) {
+			mu.Lock()
+			t.deferred += len(pending) - i
+			mu.Unlock()
+			break
+		}
+		work <- it
+	}
+	close(work)
+	wg.Wait()
+	if connErr != nil {
+		return connErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Writing files bumps their directories' times, so those go last,
+	// deepest first.
+	d := &dirTimes{times: t.times}
+	for _, dir := range d.order() {
+		mtime := t.times[dir]
+		if err := os.Chtimes(dir, mtime, mtime); err != nil {
+			log.Printf("warning: set times on %s: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// downloadTreeItem fetches one file, undoing its rule's transformations,
+// and gives it the remote modification time. The caller has reserved
+// it.size bytes of budget; what the file does not use is released, and a
+// file that would exceed the budget is removed again, failing with
+// errLocalBudget.
+func downloadTreeItem(ctx context.Context, share remoteFS, it downloadItem, budget *localBudget) (err error) {
+	bw := &budgetWriter{budget: budget, reserved: it.size}
+	defer func() {
+		if err != nil {
+			budget.release(bw.reserved)
+		} else {
+			budget.release(bw.reserved - bw.written)
+		}
+	}()
+	start := time.Now()
+	src, err := share.Open(it.remote)
+	opStats.observe("open", start)
+	if err != nil {
+		return fmt.Errorf("open remote %s: %w", it.remote, err)
+	}
+	defer src.Close()
+	dst, err := os.Create(it.local)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	bw.w = dst
+
+	var r io.Reader = ctxReader{ctx, timedReader{src, "read"}}
+	if it.rule.encrypt {
+		if r, err = newDecryptReader(r, it.rule.key); err != nil {
+			return fmt.Errorf("%s: %w", it.remote, err)
+		}
+	}
+	if it.rule.compress {
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	if _, err := copyChunked(bw, r); err != nil {
+		if errors.Is(err, errLocalBudget) {
+			dst.Close()
+			os.Remove(it.local)
+		}
+		return fmt.Errorf("copy %s -> %s: %w", it.remote, it.local, err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("close local %s: %w", it.local, err)
+	}
+	return os.Chtimes(it.local, it.modTime, it.modTime)
+}
+
+// removeSource deletes the remote file of a downloaded item, if
+// deleteSource is set, once it is sure the local copy is whole: the remote
+// file must still have the size and time it was listed with, so one a
+// sender was still writing is kept, and the local file its size (or, with
+// verify, its SHA-256). Files a rule transformed were checked by decoding
+// them and are compared by their remote attributes only.
+func (t *treeDownload) removeSource(ctx context.Context, share remoteFS, it downloadItem) error {
+	if !t.deleteSource {
+		return nil
+	}
+	fi, err := share.Stat(it.remote)
+	if err != nil {
+		return err
+	}
+	if fi.Size() != it.size || !fi.ModTime().Equal(it.modTime) {
+		return errors.New("the remote file changed during the download; kept it")
+	}
+	if !it.rule.transforms() {
+		if err := checkDownload(ctx, share, it.remote, it.local, t.verify); err != nil {
+			return err
+		}
+	}
+	start := time.Now()
+	err = share.Remove(it.remote)
+	opStats.observe("remove", start)
+	return err
+}
+
+// checkDownload confirms that local holds all of remote: the sizes match
+// and, with hash, so do the SHA-256 sums of both, the remote one read
+// again from the share.
+func checkDownload(ctx context.Context, share remoteFS, remote, local string, hash bool) error {
+	rfi, err := share.Stat(remote)
+	if err != nil {
+		return err
+	}
+	lfi, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	if lfi.Size() != rfi.Size() {
+		return fmt.Errorf("%s has %d bytes but %s has %d", local, lfi.Size(), remote, rfi.Size())
+	}
+	if !hash {
+		return nil
+	}
+	want, err := hashRemoteFile(ctx, share, remote, "sha256")
+	if err != nil {
+		return err
+	}
+	got, err := hashLocalFile(ctx, local)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("%s differs from %s", local, remote)
+	}
+	return nil
+}
+
+// summary reports the outcome, failing if any file could not be downloaded.
+func (t *treeDownload) summary(elapsed time.Duration) error {
+	fmt.Fprintf(os.Stderr, "downloaded %d files (%s) into %s in %s", t.downloaded, humanBytes(t.bytes), t.local, elapsed.Round(time.Millisecond))
+	if t.resumed > 0 {
+		fmt.Fprintf(os.Stderr, ", %d already there", t.resumed)
+	}
+	if t.skipped > 0 {
+		fmt.Fprintf(os.Stderr, ", skipped %d", t.skipped)
+	}
+	if t.failed > 0 {
+		fmt.Fprintf(os.Stderr, ", %d failed", t.failed)
+	}
+	if t.deferred > 0 {
+		fmt.Fprintf(os.Stderr, ", %d not fetched", t.deferred)
+	}
+	if t.deleteSource {
+		fmt.Fprintf(os.Stderr, ", %d remote files removed", t.removed)
+	}
+	fmt.Fprintln(os.Stderr)
+	if t.failed > 0 {
+		return fmt.Errorf("%d of %d files failed", t.failed, len(t.items))
+	}
+	if t.deferred > 0 {
+		return fmt.Errorf("stopped before writing more than %s locally: %d files not fetched; make room and run again with -resume to continue", humanBytes(t.budget.limit), t.deferred)
+	}
+	return nil
+}
+
+// getTree is get -r: it downloads the contents of the remote directory
+// into the local one.
+func getTree(ctx context.Context, opts smbOptions, args []string) error {
+	if opts.offset != 0 || opts.length != 0 {
+		return errors.New("-r cannot be combined with -offset or -length")
+	}
+	if opts.segments > 1 {
+		return errors.New("-segments splits a single file; -r fetches -jobs files at once instead")
+	}
+	if opts.deleteSource && opts.snapshot != "" {
+		return errors.New("-delete-source cannot be combined with -snapshot: snapshots are read-only")
+	}
+	links, err := newLinkPolicy(opts.followLinks, opts.skipLinks)
+	if err != nil {
+		return err
+	}
+	token, err := snapshotToken(opts.snapshot)
+	if err != nil {
+		return err
+	}
+	target, err := parseRemoteTarget(args[0], opts.address, opts.share)
+	if err != nil {
+		return err
+	}
+	target.path = snapshotPath(token, target.path)
+	var budget *localBudget
+	if opts.maxLocalBytes != "" {
+		limit, err := parseByteSize(opts.maxLocalBytes)
+		if err != nil {
+			return fmt.Errorf("-max-local-bytes: %w", err)
+		}
+		budget = &localBudget{limit: limit}
+	}
+
+	var t *treeDownload
+	start := time.Now()
+	err = withSessionReconnect(ctx, opts, func(shares *shareSet, resume bool) error {
+		share, err := shares.mount(target.share)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			if t, err = scanTreeDownload(shareFS(share), os.Stdout, target.path, args[1], links, opts.rules, opts.filter); err != nil {
+				return err
+			}
+			if opts.resume {
+				t.skipDownloaded()
+			}
+			t.budget = budget
+			t.deleteSource, t.verify = opts.deleteSource, opts.verify
+			// Files an earlier run fetched but did not get to remove.
+			for _, it := range t.items {
+				if t.finished[it.remote] {
+					if err := t.removeSource(ctx, shareFS(share), it); err != nil {
+						fmt.Fprintf(os.Stdout, "failed     %s: downloaded, but %v\n", it.rel, err)
+						t.failed++
+					} else if t.deleteSource {
+						t.removed++
+					}
+				}
+			}
+			t.applyOverwrite(opts.overwrite, os.Stdout)
+		}
+		return t.run(ctx, shareFS(share), os.Stdout, opts.jobs)
+	})
+	if t == nil {
+		return err
+	}
+	if serr := t.summary(time.Since(start)); err == nil {
+		err = serr
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestStoredRule(t *testing.T) {
+	rules := []transferRule{
+		{pattern: "*.log", compress: true},
+		{pattern: "*.sql", compress: true, encrypt: true},
+		{pattern: "*.iso", skip: true},
+	}
+	tests := []struct {
+		name, orig, pattern string
+	}{
+		{"app.log.zst", "app.log", "*.log"},
+		{"db.sql.zst.enc", "db.sql", "*.sql"},
+		{"db.sql.enc", "db.sql.enc", ""},
+		{"data.zst", "data.zst", ""},
+		{"disk.iso", "disk.iso", "*.iso"},
+	}
+	for _, tt := range tests {
+		r, orig := storedRule(rules, tt.name)
+		if orig != tt.orig || r.pattern != tt.pattern {
+			t.Errorf("storedRule(%q) = %q, %q; want %q, %q", tt.name, r.pattern, orig, tt.pattern, tt.orig)
+		}
+	}
+}
+
+func TestTreeDownload(t *testing.T) {
+	var packed bytes.Buffer
+	zw, _ := zstd.NewWriter(&packed)
+	zw.Write([]byte("log line\n"))
+	zw.Close()
+	fsys := newTestDirFS(t, map[string]string{
+		"src/a.txt":           "alpha",
+		"src/sub/b.txt":       "beta",
+		"src/sub/app.log.zst": packed.String(),
+		"src/big.iso":         "iso",
+	})
+	fsys.MkdirAll("src/empty", 0o755)
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, p := range []string{"src/a.txt", "src/sub/b.txt", "src/sub"} {
+		fsys.Chtimes(p, mtime, mtime)
+	}
+	rules := []transferRule{{pattern: "*.log", compress: true}, {pattern: "*.iso", skip: true}}
+
+	local := filepath.Join(t.TempDir(), "out")
+	var out bytes.Buffer
+	td, err := scanTreeDownload(fsys, &out, "src", local, linksKeep, rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first read of b.txt drops the connection.
+	dropped := false
+	share := interceptFS(fsys, func(op Op, next func() error) error {
+		if op.Name == "open" && op.Path == "src/sub/b.txt" && !dropped {
+			dropped = true
+			return io.ErrUnexpectedEOF
+		}
+		return next()
+	})
+	if err := td.run(context.Background(), share, &out, 2); !isConnectionError(err) {
+		t.Fatalf("first run = %v, want the connection error", err)
+	}
+	if err := td.run(context.Background(), share, &out, 2); err != nil {
+		t.Fatal(err)
+	}
+	if td.downloaded != 3 || td.failed != 0 || td.skipped != 1 {
+		t.Errorf("downloaded %d, failed %d, skipped %d", td.downloaded, td.failed, td.skipped)
+	}
+	for name, want := range map[string]string{"a.txt": "alpha", "sub/b.txt": "beta", "sub/app.log": "log line\n"} {
+		p := filepath.Join(local, filepath.FromSlash(name))
+		if got, err := os.ReadFile(p); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v", name, got, err)
+		}
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub"} {
+		if fi, err := os.Stat(filepath.Join(local, filepath.FromSlash(name))); err != nil || !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s: mtime not restored (%v)", name, err)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(local, "empty")); err != nil || !fi.IsDir() {
+		t.Errorf("empty directory not created: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(local, "big.iso")); !os.IsNotExist(err) {
+		t.Error("skipped file was downloaded")
+	}
+	if !strings.Contains(out.String(), "skipped    big.iso (rule *.iso)") {
+		t.Errorf("output:\n%s", out.String())
+	}
+
+	again, err := scanTreeDownload(fsys, io.Discard, "src", local, linksKeep, rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.skipDownloaded()
+	if again.resumed != 3 {
+		t.Errorf("resume found %d finished files, want 3", again.resumed)
+	}
+}
+
+func TestTreeDownloadBudget(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{
+		"in/a.txt": strings.Repeat("a", 40),
+		"in/b.txt": strings.Repeat("b", 40),
+		"in/c.txt": strings.Repeat("c", 40),
+	})
+	local := t.TempDir()
+	td, err := scanTreeDownload(fsys, io.Discard, "in", local, linksKeep, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td.budget = &localBudget{limit: 100}
+	var out bytes.Buffer
+	if err := td.run(context.Background(), fsys, &out, 1); err != nil {
+		t.Fatal(err)
+	}
+	if td.downloaded != 2 || td.deferred != 1 || td.budget.used != 80 {
+		t.Fatalf("downloaded %d, deferred %d, used %d:\n%s", td.downloaded, td.deferred, td.budget.used, out.String())
+	}
+	if _, err := os.Stat(filepath.Join(local, "c.txt")); !os.IsNotExist(err) {
+		t.Errorf("c.txt written past the limit: %v", err)
+	}
+	if err := td.summary(time.Second); err == nil || !strings.Contains(err.Error(), "-resume") {
+		t.Errorf("summary = %v", err)
+	}
+
+	// A later -resume run fetches only what is missing.
+	td, err = scanTreeDownload(fsys, io.Discard, "in", local, linksKeep, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td.skipDownloaded()
+	td.budget = &localBudget{limit: 100}
+	if err := td.run(context.Background(), fsys, &out, 1); err != nil {
+		t.Fatal(err)
+	}
+	if td.downloaded != 1 || td.deferred != 0 || td.summary(time.Second) != nil {
+		t.Errorf("resumed run downloaded %d, deferred %d", td.downloaded, td.deferred)
+	}
+}
+
+func TestBudgetWriterGrowsReservation(t *testing.T) {
+	budget := &localBudget{limit: 10}
+	if !budget.reserve(4) {
+		t.Fatal("reserve 4 of 10 refused")
+	}
+	var buf bytes.Buffer
+	bw := &budgetWriter{w: &buf, budget: budget, reserved: 4}
+	if _, err := bw.Write([]byte("12345678")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bw.Write([]byte("abc")); err != errLocalBudget {
+		t.Errorf("write past the limit: %v", err)
+	}
+	if budget.used != 8 || buf.String() != "12345678" {
+		t.Errorf("used %d, wrote %q", budget.used, buf.String())
+	}
+}
+
+func TestTreeDownloadDeleteSource(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"drop/a.csv": "alpha", "drop/b.csv": "beta"})
+	local := filepath.Join(t.TempDir(), "inbox")
+	td, err := scanTreeDownload(fsys, io.Discard, "drop", local, linksKeep, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td.deleteSource, td.verify = true, true
+	// The sender appends to b.csv after it was listed.
+	os.WriteFile(filepath.Join(fsys.root, "drop", "b.csv"), []byte("beta, more"), 0o644)
+
+	var out bytes.Buffer
+	if err := td.run(context.Background(), fsys, &out, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("drop/a.csv"); !isNotExist(err) {
+		t.Errorf("a.csv kept on the share: %v", err)
+	}
+	if got := readTestFile(t, fsys, "drop/b.csv"); got != "beta, more" {
+		t.Errorf("b.csv = %q, want it kept", got)
+	}
+	if td.removed != 1 || td.failed != 1 || !strings.Contains(out.String(), "failed     b.csv: downloaded, but the remote file changed") {
+		t.Errorf("removed %d, failed %d, output:\n%s", td.removed, td.failed, out.String())
+	}
+}
+
+func TestCheckDownload(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"f": "remote"})
+	local := filepath.Join(t.TempDir(), "f")
+	os.WriteFile(local, []byte("REMOTE"), 0o644)
+	if err := checkDownload(context.Background(), fsys, "f", local, false); err != nil {
+		t.Errorf("equal sizes: %v", err)
+	}
+	if err := checkDownload(context.Background(), fsys, "f", local, true); err == nil {
+		t.Error("different content passed with hash")
+	}
+	os.WriteFile(local, []byte("remo"), 0o644)
+	if err := checkDownload(context.Background(), fsys, "f", local, false); err == nil {
+		t.Error("short local file passed")
+	}
+}
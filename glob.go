@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// hasGlobMeta reports whether p contains any glob metacharacters.
+func hasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// expandRemoteGlob returns the remote paths matching pattern, normalized to
+// forward slashes. go-smb2 sends the final path element to the server as the
+// QUERY_DIRECTORY file name pattern, so a flat directory with hundreds of
+// thousands of entries only returns the matching ones over the wire.
+func expandRemoteGlob(share *smb2.Share, pattern string) ([]string, error) {
+	pattern = normalizeRemotePath(pattern)
+	matches, err := share.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("glob %s: %w", pattern, err)
+	}
+	out := make([]string, 0, len(matches))
+	for _, m := range matches {
+		out = append(out, normalizeRemotePath(m))
+	}
+	return out, nil
+}
+
+// listRemoteGlob lists the entries matching pattern. Only the directory
+// part is expanded with expandRemoteGlob; the last element is matched
+// against each directory's listing, whose entries already carry the size,
+// times and attributes an ls line needs, so no match costs a stat of its
+// own. Directories that cannot be read contribute nothing, as with Glob.
+func listRemoteGlob(share *smb2.Share, pattern string, lf listFormat, links linkPolicy) error {
+	pattern = normalizeRemotePath(pattern)
+	dir, base := path.Dir(pattern), path.Base(pattern)
+	if _, err := smb2.Match(base, ""); err != nil {
+		return fmt.Errorf("glob %s: %w", pattern, err)
+	}
+	dirs := []string{dir}
+	if hasGlobMeta(dir) {
+		var err error
+		if dirs, err = expandRemoteGlob(share, dir); err != nil {
+			return err
+		}
+	}
+	found := false
+	for _, d := range dirs {
+		start := time.Now()
+		entries, err := share.ReadDir(d)
+		opStats.observe("readdir", start)
+		if err != nil {
+			continue
+		}
+		for _, fi := range entries {
+			if ok, _ := smb2.Match(base, fi.Name()); !ok {
+				continue
+			}
+			m := path.Join(d, fi.Name())
+			found = true
+			printListEntry(share, m, fi, lf.name(m, fi.IsDir()), links)
+		}
+	}
+	if !found {
+		return fmt.Errorf("no match for %s", pattern)
+	}
+	return nil
+}
+
+// printListEntry prints one ls line for the entry at p. Links are shown
+// with their target, resolved to what they point at, or left out,
+// according to links.
+func printListEntry(share *smb2.Share, p string, fi os.FileInfo, name string, links linkPolicy) {
+	if isLink(fi) {
+		switch links {
+		case linksSkip:
+			return
+		case linksKeep:
+			name += linkSuffix(share, p)
+		case linksFollow:
+			if target, err := share.Stat(p); err == nil {
+				fi = target
+			} else {
+				name += " (broken link)"
+			}
+		}
+	}
+	printEntry(fi, name)
+}
+
+func printEntry(fi os.FileInfo, name string) {
+	mod := fi.ModTime().UTC().Format(time.RFC3339)
+	fmt.Printf("%s %s %12d %s\n", entryTypeLetter(fi), mod, fi.Size(), name)
+}
+
+// entryTypeLetter is the first column of an ls line: l for links, d for
+// directories, - for files.
+func entryTypeLetter(fi os.FileInfo) string {
+	switch {
+	case isLink(fi):
+		return "l"
+	case fi.IsDir():
+		return "d"
+	}
+	return "-"
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestHasGlobMeta(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"reports/weekly.csv", false},
+		{"reports/*.csv", true},
+		{"logs/app-?.log", true},
+		{"data/[ab]*.bin", true},
+		{"", false},
+	}
+
+	for _, tc := range tests {
+		if got := hasGlobMeta(tc.input); got != tc.want {
+			t.Fatalf("hasGlobMeta(%q) = %v, want %v", tc.input, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// grepSniffSize is how much of a file is checked for NUL bytes to decide
+// whether it is binary, as grep(1) does.
+const grepSniffSize = 8000
+
+// grepStream writes each line of r matching re as "name:line", or with
+// lineNumbers as "name:N:line". A binary file is reported once as "Binary
+// file NAME matches" instead. It returns the number of matching lines.
+func grepStream(w io.Writer, name string, r io.Reader, re *regexp.Regexp, lineNumbers bool) (int, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	head, err := br.Peek(grepSniffSize)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return 0, err
+	}
+	binary := bytes.IndexByte(head, 0) >= 0
+
+	matches := 0
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimRight(line, "\r\n")
+			if re.Match(line) {
+				matches++
+				if binary {
+					fmt.Fprintf(w, "Binary file %s matches\n", name)
+					return matches, nil
+				}
+				if lineNumbers {
+					fmt.Fprintf(w, "%s:%d:%s\n", name, n, line)
+				} else {
+					fmt.Fprintf(w, "%s:%s\n", name, line)
+				}
+			}
+		}
+		if err == io.EOF {
+			return matches, nil
+		}
+		if err != nil {
+			return matches, err
+		}
+	}
+}
+
+// grepOptions are the flags of grep.
+type grepOptions struct {
+	maxSize     int64 // skip larger files when positive
+	recursive   bool  // search everything below directory arguments
+	lineNumbers bool
+}
+
+// grepRemote searches every file named by patterns (remote globs or single
+// paths) for re, skipping files larger than maxSize. Directories are
+// searched through with recursive, and otherwise skipped. Files are
+// streamed, never downloaded whole, and results are printed as each file is
+// searched.
+func grepRemote(ctx context.Context, share *smb2.Share, w io.Writer, re *regexp.Regexp, patterns []string, gopts grepOptions) error {
+	matches, searched, failed := 0, 0, 0
+	search := func(p string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		searched++
+		n, err := grepRemoteFile(ctx, share, w, re, p, gopts)
+		if err != nil {
+			log.Printf("%s: %v", p, err)
+			failed++
+		}
+		matches += n
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		paths := []string{normalizeRemotePath(pattern)}
+		if hasGlobMeta(pattern) {
+			var err error
+			if paths, err = expandRemoteGlob(share, pattern); err != nil {
+				return err
+			}
+			if len(paths) == 0 {
+				return fmt.Errorf("no match for %s", pattern)
+			}
+		}
+		for _, p := range paths {
+			start := time.Now()
+			fi, err := share.Stat(p)
+			opStats.observe("stat", start)
+			if err != nil {
+				log.Printf("%s: %v", p, err)
+				searched++
+				failed++
+				continue
+			}
+			if !fi.IsDir() {
+				if err := search(p); err != nil {
+					return err
+				}
+				continue
+			}
+			if !gopts.recursive {
+				if !hasGlobMeta(pattern) {
+					log.Printf("%s: is a directory; use -r to search below it", p)
+				}
+				continue
+			}
+			err = walkRemote(shareFS(share), p, func(q string, fi os.FileInfo) error {
+				if fi.IsDir() || isLink(fi) {
+					return nil
+				}
+				return search(q)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be searched", failed, searched)
+	}
+	if matches == 0 {
+		return errors.New("no matches")
+	}
+	return nil
+}
+
+func grepRemoteFile(ctx context.Context, share *smb2.Share, w io.Writer, re *regexp.Regexp, p string, gopts grepOptions) (int, error) {
+	start := time.Now()
+	f, err := share.Open(p)
+	opStats.observe("open", start)
+	if err != nil {
+		return 0, fmt.Errorf("open remote: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat: %w", err)
+	}
+	if gopts.maxSize > 0 && fi.Size() > gopts.maxSize {
+		fmt.Fprintf(os.Stderr, "%s: skipped, %s exceeds -max-size\n", p, humanBytes(fi.Size()))
+		return 0, nil
+	}
+	return grepStream(w, p, ctxReader{ctx, timedReader{f, "read"}}, re, gopts.lineNumbers)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGrepStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		pattern string
+		numbers bool
+		want    string
+		matches int
+	}{
+		{"text", "ok\nERROR one\r\nfine\nERROR two", "ERROR", false, "app.log:ERROR one\napp.log:ERROR two\n", 2},
+		{"line numbers", "ok\nERROR one\r\nfine\nERROR two", "ERROR", true, "app.log:2:ERROR one\napp.log:4:ERROR two\n", 2},
+		{"no match", "ok\nfine\n", "ERROR", false, "", 0},
+		{"binary", "head\x00\nERROR\nERROR\n", "ERROR", true, "Binary file app.log matches\n", 1},
+		{"binary without match", "\x00\x01\x02", "ERROR", false, "", 0},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		n, err := grepStream(&buf, "app.log", strings.NewReader(tt.input), regexp.MustCompile(tt.pattern), tt.numbers)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if buf.String() != tt.want || n != tt.matches {
+			t.Errorf("%s: got %q (%d), want %q (%d)", tt.name, buf.String(), n, tt.want, tt.matches)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"512", 512, true},
+		{"64k", 64 << 10, true},
+		{"100M", 100 << 20, true},
+		{"", 0, false},
+		{"M", 0, false},
+		{"-1", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+	"lukechampine.com/blake3"
+)
+
+// newHasher returns a fresh hash for one of the algorithms hash accepts.
+func newHasher(algo string) (hash.Hash, error) {
+	switch algo {
+	case "sha256":
+		return sha256.New(), nil
+	case "md5":
+		return md5.New(), nil
+	case "blake3":
+		return blake3.New(32, nil), nil
+	}
+	return nil, fmt.Errorf("unknown -algo %q: want sha256, md5, or blake3", algo)
+}
+
+// hashRemote streams each remote file through algo and prints its digest in
+// the "DIGEST  PATH" format of sha256sum(1), so output can be checked with
+// the coreutils tools against local copies.
+func hashRemote(ctx context.Context, share *smb2.Share, w io.Writer, paths []string, algo string) error {
+	if _, err := newHasher(algo); err != nil {
+		return err
+	}
+	failed := 0
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p = normalizeRemotePath(p)
+		sum, err := hashRemoteFile(ctx, shareFS(share), p, algo)
+		if err != nil {
+			log.Printf("%s: %v", p, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "%s  %s\n", sum, p)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be hashed", failed, len(paths))
+	}
+	return nil
+}
+
+// hashRemoteFile streams the remote file p through algo and returns its
+// hex digest. It stops when ctx is done.
+func hashRemoteFile(ctx context.Context, share remoteFS, p, algo string) (string, error) {
+	h, err := newHasher(algo)
+	if err != nil {
+		return "", err
+	}
+	start := time.Now()
+	f, err := share.Open(p)
+	opStats.observe("open", start)
+	if err != nil {
+		return "", fmt.Errorf("open remote: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("stat: %w", err)
+	}
+	if fi.IsDir() {
+		return "", errors.New("is a directory")
+	}
+	if _, err := hashPipelined(h, ctxReader{ctx, timedReader{f, "read"}}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+)
+
+func TestNewHasher(t *testing.T) {
+	tests := []struct {
+		algo string
+		want string
+	}{
+		{"sha256", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"md5", "900150983cd24fb0d6963f7d28e17f72"},
+		{"blake3", "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+	}
+	for _, tt := range tests {
+		h, err := newHasher(tt.algo)
+		if err != nil {
+			t.Fatalf("newHasher(%q): %v", tt.algo, err)
+		}
+		h.Write([]byte("abc"))
+		if got := hex.EncodeToString(h.Sum(nil)); got != tt.want {
+			t.Errorf("%s(abc) = %s, want %s", tt.algo, got, tt.want)
+		}
+	}
+	if _, err := newHasher("sha1"); err == nil {
+		t.Error("newHasher(sha1) succeeded, want an error")
+	}
+}
+
+func TestHashRemoteFile(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"dir/a.txt": "abc"})
+	got, err := hashRemoteFile(context.Background(), fsys, "dir/a.txt", "md5")
+	if err != nil || got != "900150983cd24fb0d6963f7d28e17f72" {
+		t.Errorf("hashRemoteFile = %s, %v", got, err)
+	}
+	if _, err := hashRemoteFile(context.Background(), fsys, "dir", "sha256"); err == nil {
+		t.Error("hashed a directory")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := hashRemoteFile(ctx, fsys, "dir/a.txt", "sha256"); err == nil {
+		t.Error("hashed a file after ctx was cancelled")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"hash"
+	"io"
+)
+
+// hashPipelineDepth is the number of chunks that may be read ahead of the
+// hasher.
+const hashPipelineDepth = 4
+
+type hashChunk struct {
+	buf []byte
+	n   int
+	err error
+}
+
+// hashPipelined feeds r into h while the next chunk is already being read, so
+// hashing overlaps with network I/O instead of alternating with it.
+func hashPipelined(h hash.Hash, r io.Reader) (int64, error) {
+	free := make(chan []byte, hashPipelineDepth)
+	for i := 0; i < hashPipelineDepth; i++ {
+		free <- make([]byte, copyBufferSize)
+	}
+	full := make(chan hashChunk, hashPipelineDepth)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		defer close(full)
+		for {
+			var buf []byte
+			select {
+			case buf = <-free:
+			case <-stop:
+				return
+			}
+			n, err := io.ReadFull(r, buf)
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			select {
+			case full <- hashChunk{buf: buf, n: n, err: err}:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var total int64
+	for c := range full {
+		if c.n > 0 {
+			h.Write(c.buf[:c.n])
+			total += int64(c.n)
+		}
+		if c.err == io.EOF {
+			return total, nil
+		}
+		if c.err != nil {
+			return total, c.err
+		}
+		free <- c.buf
+	}
+	return total, nil
+}
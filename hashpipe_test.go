@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestHashPipelinedMatchesDirectHash(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), (3*copyBufferSize)/16+7)
+	want := sha256.Sum256(data)
+
+	h := sha256.New()
+	n, err := hashPipelined(h, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("hashPipelined returned error: %v", err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("hashed %d bytes, want %d", n, len(data))
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Fatalf("digest mismatch")
+	}
+}
+
+func TestHashPipelinedPropagatesReadError(t *testing.T) {
+	boom := errors.New("boom")
+	r := io.MultiReader(bytes.NewReader([]byte("partial")), errReader{boom})
+
+	if _, err := hashPipelined(sha256.New(), r); !errors.Is(err, boom) {
+		t.Fatalf("hashPipelined error = %v, want %v", err, boom)
+	}
+}
+
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
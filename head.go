@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// headRemote prints the first n lines of remote, or its first c bytes when c
+// is positive.
+func headRemote(ctx context.Context, share *smb2.Share, w io.Writer, remote string, n int, c int64) error {
+	remote = normalizeRemotePath(remote)
+	start := time.Now()
+	f, err := share.Open(remote)
+	opStats.observe("open", start)
+	if err != nil {
+		return fmt.Errorf("open remote %s: %w", remote, err)
+	}
+	defer f.Close()
+
+	r := ctxReader{ctx, timedReader{f, "read"}}
+	if c > 0 {
+		_, err = copyChunked(w, io.LimitReader(r, c))
+	} else {
+		err = copyLines(w, r, n)
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", remote, err)
+	}
+	return nil
+}
+
+// copyLines copies the first n lines of r to w and stops reading.
+func copyLines(w io.Writer, r io.Reader, n int) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	for i := 0; i < n; i++ {
+		line, err := br.ReadBytes('\n')
+		if _, werr := w.Write(line); werr != nil {
+			return werr
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCopyLines(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"a\nb\nc\n", 2, "a\nb\n"},
+		{"a\nb", 5, "a\nb"},
+		{"a\nb\n", 0, ""},
+		{"", 3, ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := copyLines(&buf, strings.NewReader(tt.in), tt.n); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("copyLines(%q, %d) = %q, want %q", tt.in, tt.n, buf.String(), tt.want)
+		}
+	}
+}
@@ -136,7 +136,109 @@ func TestSambaIntegration_ShowsSharesAndTransfersFiles(t *testing.T) {
 		t.Fatalf("downloaded payload %q, want %q", string(got), payload)
 	}
 
-	// Remote cleanup is optional; the container will be discarded after the test.
+	rangePath := filepath.Join(localTemp, "range.txt")
+	if err := downloadFile(context.Background(), share, "integration/put.txt", rangePath, transferOptions{offset: 4, length: 3}); err != nil {
+		t.Fatalf("ranged download failed: %v", err)
+	}
+	if got, _ := os.ReadFile(rangePath); string(got) != payload[4:7] {
+		t.Fatalf("ranged download = %q, want %q", got, payload[4:7])
+	}
+
+	// A resumed download appends the rest to a partial local file, and
+	// starts over when the local file is larger than the remote one.
+	resumePath := filepath.Join(localTemp, "resume.txt")
+	for _, partial := range []string{payload[:5], payload + "stale"} {
+		os.WriteFile(resumePath, []byte(partial), 0o644)
+		if err := downloadFile(context.Background(), share, "integration/put.txt", resumePath, transferOptions{resume: true}); err != nil {
+			t.Fatalf("resumed download failed: %v", err)
+		}
+		if got, _ := os.ReadFile(resumePath); string(got) != payload {
+			t.Fatalf("resumed download from %q = %q, want %q", partial, got, payload)
+		}
+	}
+
+	if err := putFile(share, putFilePath, "integration/other.txt"); err != nil {
+		t.Fatalf("putFile failed: %v", err)
+	}
+	if err := moveRemote(shareFS(share), "integration/other.txt", "integration/put.txt", false); err == nil {
+		t.Fatalf("mv over an existing file succeeded without -force")
+	}
+	if err := moveRemote(shareFS(share), "integration/other.txt", "integration/put.txt", true); err != nil {
+		t.Fatalf("mv -force failed: %v", err)
+	}
+
+	n, err := copyRemote(shareFS(share), "integration/put.txt", "integration/copy.txt", false)
+	if err != nil {
+		t.Fatalf("copyRemote failed: %v", err)
+	}
+	if n != int64(len(payload)) {
+		t.Fatalf("copied %d bytes, want %d", n, len(payload))
+	}
+	if _, err := copyRemote(shareFS(share), "integration/put.txt", "integration/copy.txt", false); err == nil {
+		t.Fatalf("cp over an existing file succeeded without -force")
+	}
+	if err := listRemoteGlob(share, "integration/*.txt", listFormat{}, linksKeep); err != nil {
+		t.Fatalf("ls of a glob failed: %v", err)
+	}
+	if err := listRemoteGlob(share, "integration/*.none", listFormat{}, linksKeep); err == nil {
+		t.Fatalf("ls of a glob matching nothing succeeded")
+	}
+
+	if _, err := patchRemote(context.Background(), share, "integration/copy.txt", strings.NewReader("XY"), 1); err != nil {
+		t.Fatalf("patchRemote failed: %v", err)
+	}
+	patched, err := share.ReadFile("integration/copy.txt")
+	if err != nil {
+		t.Fatalf("read patched file: %v", err)
+	}
+	if want := payload[:1] + "XY" + payload[3:]; string(patched) != want {
+		t.Fatalf("patched contents = %q, want %q", patched, want)
+	}
+
+	appendOpts := transferOptions{appendMode: true}
+	if err := uploadFile(context.Background(), share, putFilePath, "integration/copy.txt", appendOpts); err != nil {
+		t.Fatalf("append upload failed: %v", err)
+	}
+	// A resumed append whose first attempt already finished writes nothing.
+	appendOpts.resume, appendOpts.appendBase = true, int64(len(patched))
+	if err := uploadFile(context.Background(), share, putFilePath, "integration/copy.txt", appendOpts); err != nil {
+		t.Fatalf("resumed append upload failed: %v", err)
+	}
+	if appended, _ := share.ReadFile("integration/copy.txt"); string(appended) != string(patched)+payload {
+		t.Fatalf("appended contents = %q, want %q", appended, string(patched)+payload)
+	}
+
+	space, err := statShareSpace(share, "share", ".")
+	if err != nil {
+		t.Fatalf("statShareSpace failed: %v", err)
+	}
+	if space.Total <= 0 || space.Available > space.Total {
+		t.Fatalf("implausible share space %+v", space)
+	}
+	if err := checkUploadRoom(share, "share", "user", space.Available+1); err == nil {
+		t.Fatalf("checkUploadRoom accepted more than the available space")
+	}
+
+	if err := makeRemoteDir(shareFS(share), "integration/empty/nested", true); err != nil {
+		t.Fatalf("mkdir -p failed: %v", err)
+	}
+	if err := removeRemoteDir(shareFS(share), "integration/empty"); err == nil {
+		t.Fatalf("rmdir of a non-empty directory succeeded")
+	}
+	if err := removeRemoteDir(shareFS(share), "integration/empty/nested"); err != nil {
+		t.Fatalf("rmdir failed: %v", err)
+	}
+
+	removed, err := removeRemote(shareFS(share), "integration", true, 8)
+	if err != nil {
+		t.Fatalf("removeRemote failed: %v", err)
+	}
+	if removed != 4 {
+		t.Fatalf("removed %d entries, want 4", removed)
+	}
+	if _, err := share.Stat("integration"); err == nil {
+		t.Fatalf("integration directory still exists after rm -r")
+	}
 }
 
 func containsShare(shares []string, name string) bool {
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Op describes one share operation on its way to the server.
+type Op struct {
+	// Name is the operation: open, create, stat, lstat, readdir, mkdir,
+	// remove, rename, chtimes, read, write, copy, truncate, or close.
+	Name string
+	// Path is the share path operated on; NewPath is the destination of a
+	// rename.
+	Path    string
+	NewPath string
+	// Size is the number of bytes asked for by a read or write.
+	Size int
+}
+
+// Interceptor wraps a share operation, like HTTP middleware: it may inspect
+// op, delay or refuse it by not calling next, and observe the result, which
+// for a read at the end of a file is io.EOF as usual. -dry-run is one,
+// turning changes into "would" lines (see dryRunFS). Only code working on a
+// remoteFS can be intercepted: transfers and the commands that take an
+// *smb2.Share directly are not.
+type Interceptor func(op Op, next func() error) error
+
+// interceptFS returns fsys with every operation, including reads and writes
+// on the files it opens, run through chain.
+func interceptFS(fsys remoteFS, chain ...Interceptor) remoteFS {
+	return interceptedFS{fs: fsys, chain: chain}
+}
+
+type interceptedFS struct {
+	fs    remoteFS
+	chain []Interceptor
+}
+
+func (i interceptedFS) do(op Op, fn func() error) error {
+	call := fn
+	for k := len(i.chain) - 1; k >= 0; k-- {
+		ic, next := i.chain[k], call
+		call = func() error { return ic(op, next) }
+	}
+	return call()
+}
+
+func (i interceptedFS) file(f remoteFile, path string, err error) (remoteFile, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &interceptedFile{remoteFile: f, fsys: i, path: path}, nil
+}
+
+func (i interceptedFS) Open(name string) (remoteFile, error) {
+	var f remoteFile
+	err := i.do(Op{Name: "open", Path: name}, func() (err error) {
+		f, err = i.fs.Open(name)
+		return err
+	})
+	return i.file(f, name, err)
+}
+
+func (i interceptedFS) Create(name string) (remoteFile, error) {
+	var f remoteFile
+	err := i.do(Op{Name: "create", Path: name}, func() (err error) {
+		f, err = i.fs.Create(name)
+		return err
+	})
+	return i.file(f, name, err)
+}
+
+func (i interceptedFS) OpenFile(name string, flag int, perm os.FileMode) (remoteFile, error) {
+	opName := "open"
+	if flag&os.O_CREATE != 0 {
+		opName = "create"
+	}
+	var f remoteFile
+	err := i.do(Op{Name: opName, Path: name}, func() (err error) {
+		f, err = i.fs.OpenFile(name, flag, perm)
+		return err
+	})
+	return i.file(f, name, err)
+}
+
+func (i interceptedFS) Stat(name string) (os.FileInfo, error) {
+	var fi os.FileInfo
+	err := i.do(Op{Name: "stat", Path: name}, func() (err error) {
+		fi, err = i.fs.Stat(name)
+		return err
+	})
+	return fi, err
+}
+
+func (i interceptedFS) Lstat(name string) (os.FileInfo, error) {
+	var fi os.FileInfo
+	err := i.do(Op{Name: "lstat", Path: name}, func() (err error) {
+		fi, err = i.fs.Lstat(name)
+		return err
+	})
+	return fi, err
+}
+
+func (i interceptedFS) ReadDir(name string) ([]os.FileInfo, error) {
+	var entries []os.FileInfo
+	err := i.do(Op{Name: "readdir", Path: name}, func() (err error) {
+		entries, err = i.fs.ReadDir(name)
+		return err
+	})
+	return entries, err
+}
+
+func (i interceptedFS) Mkdir(name string, perm os.FileMode) error {
+	return i.do(Op{Name: "mkdir", Path: name}, func() error { return i.fs.Mkdir(name, perm) })
+}
+
+func (i interceptedFS) MkdirAll(name string, perm os.FileMode) error {
+	return i.do(Op{Name: "mkdir", Path: name}, func() error { return i.fs.MkdirAll(name, perm) })
+}
+
+func (i interceptedFS) Remove(name string) error {
+	return i.do(Op{Name: "remove", Path: name}, func() error { return i.fs.Remove(name) })
+}
+
+func (i interceptedFS) Rename(oldname, newname string) error {
+	return i.do(Op{Name: "rename", Path: oldname, NewPath: newname}, func() error { return i.fs.Rename(oldname, newname) })
+}
+
+func (i interceptedFS) Chtimes(name string, atime, mtime time.Time) error {
+	return i.do(Op{Name: "chtimes", Path: name}, func() error { return i.fs.Chtimes(name, atime, mtime) })
+}
+
+// interceptedFile runs data operations on an open file through the chain of
+// the file system that opened it.
+type interceptedFile struct {
+	remoteFile
+	fsys interceptedFS
+	path string
+}
+
+func (f *interceptedFile) Read(p []byte) (n int, err error) {
+	err = f.fsys.do(Op{Name: "read", Path: f.path, Size: len(p)}, func() error {
+		n, err = f.remoteFile.Read(p)
+		return err
+	})
+	return n, err
+}
+
+func (f *interceptedFile) ReadAt(p []byte, off int64) (n int, err error) {
+	err = f.fsys.do(Op{Name: "read", Path: f.path, Size: len(p)}, func() error {
+		n, err = f.remoteFile.ReadAt(p, off)
+		return err
+	})
+	return n, err
+}
+
+func (f *interceptedFile) Write(p []byte) (n int, err error) {
+	err = f.fsys.do(Op{Name: "write", Path: f.path, Size: len(p)}, func() error {
+		n, err = f.remoteFile.Write(p)
+		return err
+	})
+	return n, err
+}
+
+func (f *interceptedFile) WriteAt(p []byte, off int64) (n int, err error) {
+	err = f.fsys.do(Op{Name: "write", Path: f.path, Size: len(p)}, func() error {
+		n, err = f.remoteFile.WriteAt(p, off)
+		return err
+	})
+	return n, err
+}
+
+// ReadFrom hands an intercepted source to the underlying file unwrapped, so
+// a server-side copy between two share files still happens as one operation.
+func (f *interceptedFile) ReadFrom(r io.Reader) (n int64, err error) {
+	op := Op{Name: "write", Path: f.path}
+	if in, ok := r.(*interceptedFile); ok {
+		r = in.remoteFile
+		op = Op{Name: "copy", Path: in.path, NewPath: f.path}
+	}
+	err = f.fsys.do(op, func() error {
+		n, err = f.remoteFile.ReadFrom(r)
+		return err
+	})
+	return n, err
+}
+
+func (f *interceptedFile) Truncate(size int64) error {
+	return f.fsys.do(Op{Name: "truncate", Path: f.path}, func() error { return f.remoteFile.Truncate(size) })
+}
+
+func (f *interceptedFile) Close() error {
+	return f.fsys.do(Op{Name: "close", Path: f.path}, func() error { return f.remoteFile.Close() })
+}
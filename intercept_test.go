@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestInterceptorOrder(t *testing.T) {
+	var calls []string
+	mark := func(name string) Interceptor {
+		return func(op Op, next func() error) error {
+			calls = append(calls, name+" before "+op.Name)
+			err := next()
+			calls = append(calls, name+" after "+op.Name)
+			return err
+		}
+	}
+	fsys := interceptFS(newTestDirFS(t, map[string]string{"a.txt": "hi"}), mark("outer"), mark("inner"))
+	if _, err := fsys.Stat("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"outer before stat", "inner before stat", "inner after stat", "outer after stat"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %q, want %q", calls, want)
+	}
+}
+
+func TestInterceptorRefuses(t *testing.T) {
+	errDenied := errors.New("denied by policy")
+	base := newTestDirFS(t, map[string]string{"a.txt": "hi"})
+	fsys := interceptFS(base, func(op Op, next func() error) error {
+		if op.Name == "remove" {
+			return errDenied
+		}
+		return next()
+	})
+	if _, err := removeRemote(fsys, "a.txt", false, 1); !errors.Is(err, errDenied) {
+		t.Fatalf("removeRemote = %v, want %v", err, errDenied)
+	}
+	if got := readTestFile(t, base, "a.txt"); got != "hi" {
+		t.Fatalf("a.txt = %q after refused remove", got)
+	}
+}
+
+func TestInterceptorSeesFileOps(t *testing.T) {
+	var ops []Op
+	base := newTestDirFS(t, map[string]string{"a.txt": "hello"})
+	fsys := interceptFS(base, func(op Op, next func() error) error {
+		ops = append(ops, op)
+		return next()
+	})
+
+	f, err := fsys.Create("b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err = fsys.Open("b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	if _, err := f.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(buf); err != io.EOF {
+		t.Fatalf("second Read = %v, want io.EOF", err)
+	}
+	f.Close()
+	if err := fsys.Rename("b.txt", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Op{
+		{Name: "create", Path: "b.txt"},
+		{Name: "write", Path: "b.txt", Size: 3},
+		{Name: "close", Path: "b.txt"},
+		{Name: "open", Path: "b.txt"},
+		{Name: "read", Path: "b.txt", Size: 8},
+		{Name: "read", Path: "b.txt", Size: 8},
+		{Name: "close", Path: "b.txt"},
+		{Name: "rename", Path: "b.txt", NewPath: "c.txt"},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("ops = %+v\nwant %+v", ops, want)
+	}
+}
+
+func TestInterceptorCopy(t *testing.T) {
+	var copies []Op
+	base := newTestDirFS(t, map[string]string{"a.txt": "hello"})
+	fsys := interceptFS(base, func(op Op, next func() error) error {
+		if op.Name == "copy" {
+			copies = append(copies, op)
+		}
+		return next()
+	})
+	if _, err := copyRemote(fsys, "a.txt", "b.txt", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, base, "b.txt"); got != "hello" {
+		t.Fatalf("b.txt = %q", got)
+	}
+	want := []Op{{Name: "copy", Path: "a.txt", NewPath: "b.txt"}}
+	if !reflect.DeepEqual(copies, want) {
+		t.Fatalf("copies = %+v, want %+v", copies, want)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// indexEntry is what the local index remembers about one file.
+type indexEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256"`
+}
+
+// localIndex maps slash-separated paths relative to the synced root to their
+// last known size, mtime, and content hash. Sync keeps it between runs so it
+// can recognise files that were renamed or moved locally.
+type localIndex struct {
+	Version int                   `json:"version"`
+	Entries map[string]indexEntry `json:"entries"`
+}
+
+const localIndexVersion = 1
+
+type rename struct {
+	from, to string
+}
+
+func newLocalIndex() *localIndex {
+	return &localIndex{Version: localIndexVersion, Entries: make(map[string]indexEntry)}
+}
+
+// loadLocalIndex reads an index file. A missing file yields an empty index.
+func loadLocalIndex(path string) (*localIndex, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return newLocalIndex(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read index %s: %w", path, err)
+	}
+	ix := newLocalIndex()
+	if err := json.Unmarshal(data, ix); err != nil {
+		return nil, fmt.Errorf("parse index %s: %w", path, err)
+	}
+	if ix.Version != localIndexVersion {
+		return nil, fmt.Errorf("index %s has unsupported version %d", path, ix.Version)
+	}
+	if ix.Entries == nil {
+		ix.Entries = make(map[string]indexEntry)
+	}
+	return ix, nil
+}
+
+// save writes the index atomically next to its final location.
+func (ix *localIndex) save(path string) error {
+	data, err := json.Marshal(ix)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write index %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename index %s: %w", path, err)
+	}
+	return nil
+}
+
+// buildLocalIndex indexes the files of an upload by their path below its
+// destination. Special files and files a rule stores transformed are left
+// out, since they cannot be renamed into place on the share. Hashes from prev
+// are reused when size and mtime are unchanged, so only new or modified files
+// are read.
+func buildLocalIndex(ctx context.Context, t *treeUpload, prev *localIndex) (*localIndex, error) {
+	ix := newLocalIndex()
+	for _, it := range t.items {
+		if it.special || it.rule.transforms() {
+			continue
+		}
+		rel := relRemote(t.remote, it.remote)
+		entry := indexEntry{Size: it.size, ModTime: it.modTime.UTC()}
+		if old, ok := prev.Entries[rel]; ok && old.Size == entry.Size && old.ModTime.Equal(entry.ModTime) && old.SHA256 != "" {
+			entry.SHA256 = old.SHA256
+		} else {
+			sum, err := hashLocalFile(ctx, it.local)
+			if err != nil {
+				return nil, err
+			}
+			entry.SHA256 = sum
+		}
+		ix.Entries[rel] = entry
+	}
+	return ix, nil
+}
+
+func hashLocalFile(ctx context.Context, p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, ctxReader{ctx, f}); err != nil {
+		return "", fmt.Errorf("hash %s: %w", p, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// detectRenames pairs paths that disappeared since prev with new paths in cur
+// that have the same size and hash. Each old path is used at most once, and
+// pairs are returned sorted by destination.
+func detectRenames(prev, cur *localIndex) []rename {
+	gone := make(map[string][]string)
+	for p, e := range prev.Entries {
+		if _, ok := cur.Entries[p]; ok || e.SHA256 == "" {
+			continue
+		}
+		key := fmt.Sprintf("%d:%s", e.Size, e.SHA256)
+		gone[key] = append(gone[key], p)
+	}
+	for _, paths := range gone {
+		sort.Strings(paths)
+	}
+
+	added := make([]string, 0)
+	for p := range cur.Entries {
+		if _, ok := prev.Entries[p]; !ok {
+			added = append(added, p)
+		}
+	}
+	sort.Strings(added)
+
+	var out []rename
+	for _, p := range added {
+		e := cur.Entries[p]
+		key := fmt.Sprintf("%d:%s", e.Size, e.SHA256)
+		if candidates := gone[key]; len(candidates) > 0 {
+			out = append(out, rename{from: candidates[0], to: p})
+			gone[key] = candidates[1:]
+		}
+	}
+	return out
+}
+
+// syncIndex is the local index of a sync as the last successful run left it
+// and as the local tree is now.
+type syncIndex struct {
+	prev, cur *localIndex
+}
+
+// renames returns the local renames detectRenames finds that a sync can
+// carry out on the share: the old path is a remote file about to be deleted
+// that still has the size and time it was uploaded with, and the new one a
+// file about to be uploaded. No remote file is read.
+func (s *syncIndex) renames(deletes, uploads []syncFile, remote *remoteTree) []rename {
+	deleting := make(map[string]bool, len(deletes))
+	for _, d := range deletes {
+		deleting[d.path] = true
+	}
+	uploading := make(map[string]bool, len(uploads))
+	for _, u := range uploads {
+		uploading[u.path] = true
+	}
+	var out []rename
+	for _, r := range detectRenames(s.prev, s.cur) {
+		fi, ok := remote.files[r.from]
+		was := s.prev.Entries[r.from]
+		if ok && deleting[r.from] && uploading[r.to] && fi.Size() == was.Size && withinWindow(fi.ModTime(), was.ModTime) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDetectRenames(t *testing.T) {
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := newLocalIndex()
+	prev.Entries["old/big.iso"] = indexEntry{Size: 100, ModTime: mtime, SHA256: "aaa"}
+	prev.Entries["keep.txt"] = indexEntry{Size: 5, ModTime: mtime, SHA256: "bbb"}
+	prev.Entries["deleted.txt"] = indexEntry{Size: 7, ModTime: mtime, SHA256: "ccc"}
+
+	cur := newLocalIndex()
+	cur.Entries["new/big.iso"] = indexEntry{Size: 100, ModTime: mtime, SHA256: "aaa"}
+	cur.Entries["keep.txt"] = indexEntry{Size: 5, ModTime: mtime, SHA256: "bbb"}
+	cur.Entries["copy-of-keep.txt"] = indexEntry{Size: 5, ModTime: mtime, SHA256: "bbb"}
+	cur.Entries["fresh.txt"] = indexEntry{Size: 7, ModTime: mtime, SHA256: "ddd"}
+
+	got := detectRenames(prev, cur)
+	want := []rename{{from: "old/big.iso", to: "new/big.iso"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("detectRenames = %+v, want %+v", got, want)
+	}
+}
+
+func TestBuildLocalIndexReusesHashes(t *testing.T) {
+	root := writeTestTree(t, map[string]string{"sub/a.txt": "hello", "b.log": "log"})
+	rules := []transferRule{{pattern: "*.log", compress: true}}
+	tu, err := scanTreeUpload(&bytes.Buffer{}, root, "dst", rules, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ix, err := buildLocalIndex(context.Background(), tu, newLocalIndex())
+	if err != nil {
+		t.Fatalf("buildLocalIndex: %v", err)
+	}
+	entry, ok := ix.Entries["sub/a.txt"]
+	if !ok || entry.Size != 5 || entry.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	if len(ix.Entries) != 1 {
+		t.Fatalf("indexed %v, want only the file stored as is", ix.Entries)
+	}
+
+	// A stale hash with matching size and mtime must be reused, not recomputed.
+	entry.SHA256 = "cached"
+	ix.Entries["sub/a.txt"] = entry
+	again, err := buildLocalIndex(context.Background(), tu, ix)
+	if err != nil {
+		t.Fatalf("buildLocalIndex: %v", err)
+	}
+	if got := again.Entries["sub/a.txt"].SHA256; got != "cached" {
+		t.Fatalf("hash = %q, want cached value", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := again.save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := loadLocalIndex(path)
+	if err != nil {
+		t.Fatalf("loadLocalIndex: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Entries, again.Entries) {
+		t.Fatalf("round trip mismatch: %+v vs %+v", loaded.Entries, again.Entries)
+	}
+}
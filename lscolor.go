@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// listFormat controls how ls renders entry names.
+type listFormat struct {
+	raw   bool // print names without escaping
+	color bool // wrap names in ANSI colors by kind
+	icons bool // prefix names with a Nerd Font glyph by kind
+}
+
+// newListFormat resolves the -color mode; auto colors only when stdout is a
+// terminal and NO_COLOR is unset.
+func newListFormat(color string, icons, raw bool) (listFormat, error) {
+	lf := listFormat{raw: raw, icons: icons}
+	switch color {
+	case "always":
+		lf.color = true
+	case "never":
+	case "auto", "":
+		lf.color = os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	default:
+		return listFormat{}, fmt.Errorf("invalid -color %q: want auto, always, or never", color)
+	}
+	return lf, nil
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+type entryKind int
+
+const (
+	kindFile entryKind = iota
+	kindDir
+	kindArchive
+	kindExecutable
+)
+
+// SMB carries no execute bit, so archives and executables are recognised by
+// extension, as Windows itself does.
+var kindByExt = map[string]entryKind{
+	".zip": kindArchive, ".tar": kindArchive, ".gz": kindArchive, ".tgz": kindArchive,
+	".bz2": kindArchive, ".xz": kindArchive, ".zst": kindArchive, ".7z": kindArchive,
+	".rar": kindArchive, ".cab": kindArchive, ".iso": kindArchive,
+	".exe": kindExecutable, ".com": kindExecutable, ".bat": kindExecutable, ".cmd": kindExecutable,
+	".ps1": kindExecutable, ".msi": kindExecutable, ".sh": kindExecutable,
+}
+
+func classifyEntry(name string, dir bool) entryKind {
+	if dir {
+		return kindDir
+	}
+	return kindByExt[strings.ToLower(path.Ext(name))]
+}
+
+var (
+	kindColors = map[entryKind]string{kindDir: "01;34", kindArchive: "01;31", kindExecutable: "01;32"}
+	kindIcons  = map[entryKind]string{kindFile: "\uf15b", kindDir: "\uf07b", kindArchive: "\uf1c6", kindExecutable: "\uf489"}
+)
+
+// name renders one entry name, escaping it first so colors never wrap
+// untrusted control characters.
+func (lf listFormat) name(name string, dir bool) string {
+	kind := classifyEntry(name, dir)
+	s := displayName(name, lf.raw)
+	if c, ok := kindColors[kind]; ok && lf.color {
+		s = "\x1b[" + c + "m" + s + "\x1b[0m"
+	}
+	if lf.icons {
+		s = kindIcons[kind] + " " + s
+	}
+	return s
+}
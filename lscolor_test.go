@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestListFormatName(t *testing.T) {
+	tests := []struct {
+		lf   listFormat
+		name string
+		dir  bool
+		want string
+	}{
+		{listFormat{}, "notes.txt", false, "notes.txt"},
+		{listFormat{color: true}, "notes.txt", false, "notes.txt"},
+		{listFormat{color: true}, "builds", true, "\x1b[01;34mbuilds\x1b[0m"},
+		{listFormat{color: true}, "Backup.ZIP", false, "\x1b[01;31mBackup.ZIP\x1b[0m"},
+		{listFormat{color: true}, "setup.exe", false, "\x1b[01;32msetup.exe\x1b[0m"},
+		{listFormat{icons: true}, "builds", true, "\uf07b builds"},
+		{listFormat{color: true}, "a\x1bb.sh", false, "\x1b[01;32m\"a\\x1bb.sh\"\x1b[0m"},
+	}
+	for _, tt := range tests {
+		if got := tt.lf.name(tt.name, tt.dir); got != tt.want {
+			t.Errorf("%+v.name(%q) = %q, want %q", tt.lf, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewListFormat(t *testing.T) {
+	if lf, err := newListFormat("always", false, false); err != nil || !lf.color {
+		t.Errorf("always: got %+v, %v", lf, err)
+	}
+	if lf, err := newListFormat("never", true, false); err != nil || lf.color || !lf.icons {
+		t.Errorf("never: got %+v, %v", lf, err)
+	}
+	if _, err := newListFormat("sometimes", false, false); err == nil {
+		t.Error("invalid mode accepted")
+	}
+}
@@ -19,155 +19,251 @@ import (
 )
 
 type smbOptions struct {
-	address  string
-	share    string
-	user     string
-	password string
-	domain   string
-	timeout  time.Duration
+	address        string
+	share          string
+	user           string
+	password       string
+	credentials    string
+	domain         string
+	timeout        time.Duration
+	reconnects     int
+	stats          bool
+	metricsFile    string
+	pushMetrics    string
+	maxDuration    time.Duration
+	deadline       string
+	resume         bool
+	ignoreTimes    bool
+	segments       int
+	overwrite      overwritePolicy
+	backupRemote   string
+	renameClashes  bool
+	deleteSource   bool
+	verify         bool
+	stall          time.Duration
+	json           bool
+	top            int
+	jobs           int
+	profile        string
+	dropDir        string
+	showVersion    bool
+	explain        bool
+	includeHidden  bool
+	includeSpecial bool
+	recursive      bool
+	delete         bool
+	syncIndex      bool
+	allowSpecial   bool
+	dryRun         bool
+	filter         pathFilter
+	pull           bool
+	twoWay         bool
+	conflict       string
+	parents        bool
+	force          bool
+	resumeToken    string
+	s3Endpoint     string
+	s3Region       string
+	maxDepth       int
+	humanReadable  bool
+	doneMarker     string
+	doneTemplate   string
+	findName       string
+	findType       string
+	newerThan      time.Duration
+	findSize       string
+	maxSize        string
+	lineNumbers    bool
+	chunkSize      string
+	inFlight       string
+	checksum       bool
+	keepGoing      bool
+	tmpDir         string
+	encryptKey     string
+	rules          []transferRule
+	olderThan      time.Duration
+	offset         int64
+	lines          int
+	follow         bool
+	interval       time.Duration
+	idle           time.Duration
+	length         int64
+	headBytes      int64
+	algo           string
+	raw            bool
+	color          string
+	icons          bool
+	minFree        string
+	maxLocalBytes  string
+	appendMode     bool
+	attribChanges  []string
+	resetUsage     bool
+	format         string
+	followLinks    bool
+	skipLinks      bool
+	snapshot       string
+	progress       bool
+
+	// session is the shared session of an exec script, reused instead of
+	// dialing one per command.
+	session *scriptSession
 }
 
 func main() {
 	var opts smbOptions
 
-	flag.StringVar(&opts.address, "server", "", "SMB server address (host or host:port)")
-	flag.StringVar(&opts.share, "share", "", "SMB share name")
-	flag.StringVar(&opts.user, "user", "", "SMB username")
-	flag.StringVar(&opts.password, "password", "", "SMB password (or set SMB_PASSWORD env var)")
-	flag.StringVar(&opts.domain, "domain", "", "SMB domain (optional)")
-	flag.DurationVar(&opts.timeout, "timeout", 10*time.Second, "Dial timeout")
+	registerGlobalFlags(flag.CommandLine, &opts)
+	flag.Usage = printUsage
 	flag.Parse()
 
-	if opts.password == "" {
-		opts.password = os.Getenv("SMB_PASSWORD")
+	if opts.showVersion {
+		if err := printVersion(os.Stdout, false); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
 	args := flag.Args()
+	var token *resumeToken
+	if opts.resumeToken != "" {
+		t, err := decodeResumeToken(opts.resumeToken)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if len(args) == 0 {
+			args = append([]string{t.Command}, t.Args...)
+		}
+		token = &t
+	}
 	if len(args) < 1 {
 		printUsage()
 		os.Exit(2)
 	}
 
-	if opts.address == "" || opts.user == "" || opts.password == "" {
-		fmt.Fprintln(os.Stderr, "server, user, and password are required")
-		flag.Usage()
+	cmd := lookupCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		printUsage()
 		os.Exit(2)
 	}
 
-	command := args[0]
-	if command != "shares" && opts.share == "" {
-		fmt.Fprintln(os.Stderr, "share is required for this command")
-		flag.Usage()
+	// Global flags are accepted after the command too, so the command's flag
+	// set shares their values with the top-level one.
+	fs := cmd.flagSet(&opts)
+	cmdArgs, err := parseInterspersed(fs, args[1:])
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+	if !cmd.acceptsArgs(len(cmdArgs)) {
+		fmt.Fprintf(os.Stderr, "%s: expected %s\n", cmd.name, cmd.synopsis())
+		fs.Usage()
 		os.Exit(2)
 	}
 
-	switch command {
-	case "shares":
-		if err := listShares(opts); err != nil {
-			log.Fatalf("shares failed: %v", err)
-		}
-	case "ls":
-		share, cleanup, err := connect(opts)
-		if err != nil {
-			log.Fatalf("failed to connect: %v", err)
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	if token != nil {
+		if token.Command != cmd.name {
+			fmt.Fprintf(os.Stderr, "-resume-token is for %s, not %s\n", token.Command, cmd.name)
+			os.Exit(2)
 		}
-		defer cleanup()
-		remote := "."
-		if len(args) > 1 {
-			remote = args[1]
+		applyResumeToken(&opts, *token, setFlags)
+	}
+	profile, err := loadProfile(configPath(), opts.profile, setFlags["profile"])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	applyProfile(&opts, profile, setFlags)
+	if opts.rules, err = parseRules(profile); err == nil {
+		err = loadRuleKey(opts.rules, opts.encryptKey)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "profile %s: %v\n", opts.profile, err)
+		os.Exit(2)
+	}
+
+	if !cmd.offline {
+		if err := resolveCredentials(context.Background(), &opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
 		}
-		if err := listRemote(share, remote); err != nil {
-			log.Fatalf("ls failed: %v", err)
+		if opts.address == "" {
+			fmt.Fprintln(os.Stderr, "server is required")
+			fs.Usage()
+			os.Exit(2)
 		}
-	case "get":
-		share, cleanup, err := connect(opts)
-		if err != nil {
-			log.Fatalf("failed to connect: %v", err)
+		if err := checkLogon(&opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
 		}
-		defer cleanup()
-		if len(args) != 3 {
-			printUsage()
+		if !cmd.noShare && opts.share == "" && !hasRemoteURL(cmdArgs) {
+			fmt.Fprintln(os.Stderr, "share is required for this command")
+			fs.Usage()
 			os.Exit(2)
 		}
-		if err := getFile(share, args[1], args[2]); err != nil {
-			log.Fatalf("get failed: %v", err)
+	}
+
+	start := time.Now()
+	ctx, cancel, err := runContext(opts, start)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer cancel()
+
+	err = cmd.run(ctx, opts, cmdArgs)
+	if !cmd.offline {
+		if err := recordUsage(opts); err != nil {
+			log.Printf("warning: usage accounting: %v", err)
 		}
-	case "put":
-		share, cleanup, err := connect(opts)
-		if err != nil {
-			log.Fatalf("failed to connect: %v", err)
+	}
+	if opts.pushMetrics != "" {
+		if err := pushMetrics(opts.pushMetrics, newRunSummary(cmd.name, start, err)); err != nil {
+			log.Printf("warning: %v", err)
 		}
-		defer cleanup()
-		if len(args) != 3 {
-			printUsage()
-			os.Exit(2)
+	}
+	// Failed and slow runs are what the statistics are for, so they are
+	// reported whatever the outcome.
+	if statsErr := reportStats(opts); statsErr != nil {
+		if err == nil {
+			log.Fatalf("stats failed: %v", statsErr)
 		}
-		if err := putFile(share, args[1], args[2]); err != nil {
-			log.Fatalf("put failed: %v", err)
+		log.Printf("warning: stats: %v", statsErr)
+	}
+	if err != nil {
+		if cmd.resumable && offersResume(ctx, err) {
+			t := resumeToken{Version: resumeTokenVersion, Command: cmd.name, Server: opts.address, Share: opts.share, Args: cmdArgs, Offset: opts.offset, Length: opts.length, Snapshot: opts.snapshot, Recursive: opts.recursive}
+			writeResumeToken(os.Stdout, os.Stderr, t, err, opts.json)
 		}
-	default:
-		printUsage()
-		os.Exit(2)
+		fatalCommand(ctx, cmd.name, err)
 	}
 }
 
-func printUsage() {
-	fmt.Fprintln(os.Stderr, `Usage:
-  smbput -server HOST[:PORT] -share NAME -user USER -password PASS <command> [args...]
-
-Commands:
-  shares
-  ls [REMOTE PATH]
-  get REMOTE_PATH LOCAL_PATH
-  put LOCAL_PATH REMOTE_PATH`)
-}
-
 func connect(opts smbOptions) (*smb2.Share, func(), error) {
-	session, cleanup, err := dialSession(opts)
+	shares, cleanup, err := openShareSet(opts)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	share, err := session.Mount(opts.share)
+	share, err := shares.mount(opts.share)
 	if err != nil {
 		cleanup()
-		return nil, nil, fmt.Errorf("mount share %s: %w", opts.share, err)
+		return nil, nil, err
 	}
-
-	return share, func() {
-		share.Umount()
-		cleanup()
-	}, nil
+	return share, cleanup, nil
 }
 
 func dialSession(opts smbOptions) (*smb2.Session, func(), error) {
-	host, port, err := splitServerAddress(opts.address)
+	conn, err := dialServer(opts.address, opts.timeout)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
-	defer cancel()
-
-	ips, err := resolveHost(ctx, host, opts.timeout)
-	if err != nil {
-		return nil, nil, fmt.Errorf("resolve host %s: %w", host, err)
-	}
-
-	tcpDialer := &net.Dialer{Timeout: opts.timeout}
-	var conn net.Conn
-	var dialErr error
-	for _, ip := range ips {
-		address := net.JoinHostPort(ip.String(), port)
-		conn, dialErr = tcpDialer.DialContext(ctx, "tcp", address)
-		if dialErr == nil {
-			break
-		}
-	}
-	if dialErr != nil {
-		return nil, nil, fmt.Errorf("dial %s:%s: %w", host, port, dialErr)
-	}
-
 	dialer := &smb2.Dialer{
 		Initiator: &smb2.NTLMInitiator{
 			User:     opts.user,
@@ -176,7 +272,9 @@ func dialSession(opts smbOptions) (*smb2.Session, func(), error) {
 		},
 	}
 
+	start := time.Now()
 	session, err := dialer.Dial(conn)
+	opStats.observe("negotiate", start)
 	if err != nil {
 		conn.Close()
 		return nil, nil, fmt.Errorf("smb negotiate: %w", err)
@@ -190,25 +288,107 @@ func dialSession(opts smbOptions) (*smb2.Session, func(), error) {
 	return session, cleanup, nil
 }
 
-func listRemote(share *smb2.Share, remote string) error {
+// dialServer resolves address (host or host:port, port 445 by default) and
+// opens a TCP connection to the first address that accepts one.
+func dialServer(address string, timeout time.Duration) (net.Conn, error) {
+	host, port, err := splitServerAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ips, err := resolveHost(ctx, host, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("resolve host %s: %w", host, err)
+	}
+
+	tcpDialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var dialErr error
+	for _, ip := range ips {
+		address := net.JoinHostPort(ip.String(), port)
+		start := time.Now()
+		conn, dialErr = tcpDialer.DialContext(ctx, "tcp", address)
+		opStats.observe("connect", start)
+		if dialErr == nil {
+			break
+		}
+	}
+	if dialErr != nil {
+		return nil, fmt.Errorf("dial %s:%s: %w", host, port, dialErr)
+	}
+	return conn, nil
+}
+
+func listRemote(share *smb2.Share, remote string, lf listFormat, links linkPolicy) error {
+	if hasGlobMeta(remote) {
+		return listRemoteGlob(share, remote, lf, links)
+	}
+
 	remote = normalizeRemotePath(remote)
+	start := time.Now()
 	files, err := share.ReadDir(remote)
+	opStats.observe("readdir", start)
 	if err != nil {
 		return fmt.Errorf("readdir %s: %w", remote, err)
 	}
 
 	for _, fi := range files {
-		mod := fi.ModTime().UTC().Format(time.RFC3339)
-		kind := "-"
-		if fi.IsDir() {
-			kind = "d"
-		}
-		fmt.Printf("%s %s %12d %s\n", kind, mod, fi.Size(), fi.Name())
+		printListEntry(share, joinRemote(remote, fi.Name()), fi, lf.name(fi.Name(), fi.IsDir()), links)
 	}
 	return nil
 }
 
+// transferOptions tunes a single get or put.
+type transferOptions struct {
+	// resume keeps bytes already present at the destination and continues
+	// from that offset.
+	resume bool
+	// stallTimeout aborts the transfer with errStalled when no data moves for
+	// this long. Zero disables the check.
+	stallTimeout time.Duration
+	// offset and length restrict a download to a byte range of the remote
+	// file; a zero length means up to its end.
+	offset, length int64
+	// appendMode writes an upload after the existing end of the remote file
+	// instead of replacing it. appendBase is the remote size before the first
+	// attempt, so a resumed append knows how much it already wrote.
+	appendMode bool
+	appendBase int64
+	// progress receives the transfer's progress; nil reports nothing.
+	progress *progressTracker
+	// tuning shapes an upload's writes; unset fields take defaultTuning.
+	tuning transferTuning
+	// tmpDir stages uploads: each is written to stagingPath inside it and
+	// renamed to its destination once complete. Empty writes in place.
+	tmpDir string
+	// stage is the staging path of the upload under way, set from tmpDir
+	// for each destination.
+	stage string
+	// allowSpecial lets an upload read a named pipe or device as a stream.
+	allowSpecial bool
+	// skipUnchanged leaves a destination alone that already has the local
+	// file's size and modification time.
+	skipUnchanged bool
+	// segments splits a whole-file download into this many ranges
+	// fetched at once; 0 or 1 reads it front to back.
+	segments int
+}
+
 func getFile(share *smb2.Share, remote, local string) error {
+	return downloadFile(context.Background(), share, remote, local, transferOptions{})
+}
+
+// downloadFile copies remote to local. With resume set, an existing local
+// file that is not larger than remote is treated as a partial download and
+// the transfer continues from its current size, or, after a segmented
+// download, from where the segments its sidecar records got to.
+func downloadFile(ctx context.Context, share *smb2.Share, remote, local string, topts transferOptions) error {
+	share, watch := watchStall(ctx, share, topts.stallTimeout)
+	defer watch.stop()
+
 	remote = normalizeRemotePath(remote)
 	dir := filepath.Dir(local)
 	if dir != "" && dir != "." {
@@ -217,39 +397,165 @@ func getFile(share *smb2.Share, remote, local string) error {
 		}
 	}
 
+	start := time.Now()
 	src, err := share.Open(remote)
+	opStats.observe("open", start)
 	if err != nil {
 		return fmt.Errorf("open remote %s: %w", remote, err)
 	}
 	defer src.Close()
 
-	dst, err := os.Create(local)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if topts.resume {
+		flags = os.O_WRONLY | os.O_CREATE
+	}
+	dst, err := os.OpenFile(local, flags, 0o644)
 	if err != nil {
 		return fmt.Errorf("create local %s: %w", local, err)
 	}
 	defer dst.Close()
 
-	if _, err := io.Copy(dst, src); err != nil {
-		return fmt.Errorf("copy %s -> %s: %w", remote, local, err)
+	var done int64
+	if topts.resume {
+		if done, err = dst.Seek(0, io.SeekEnd); err != nil {
+			return fmt.Errorf("seek local %s: %w", local, err)
+		}
+	}
+	total := int64(-1)
+	if fi, err := src.Stat(); err == nil {
+		total = max(fi.Size()-topts.offset, 0)
+		if topts.length > 0 {
+			total = min(total, topts.length)
+		}
+	}
+	if done > 0 && total >= 0 && done > total {
+		// Larger than what it would be a part of, so not a partial download.
+		if err := dst.Truncate(0); err != nil {
+			return fmt.Errorf("truncate local %s: %w", local, err)
+		}
+		if done, err = dst.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("seek local %s: %w", local, err)
+		}
+	}
+	var r io.Reader = src
+	if topts.length > 0 {
+		r = io.NewSectionReader(src, topts.offset+done, max(topts.length-done, 0))
+	} else if pos := topts.offset + done; pos > 0 {
+		if _, err := src.Seek(pos, io.SeekStart); err != nil {
+			return fmt.Errorf("seek remote %s: %w", remote, err)
+		}
+	}
+
+	// A segmented download allocates the local file to its full size at
+	// once, so its size only counts with the sidecar recording how far the
+	// segments got; one that is not usable means starting over.
+	whole := topts.offset == 0 && topts.length == 0
+	statePath := segmentStatePath(local)
+	var segs []segment
+	if whole && !topts.resume {
+		os.Remove(statePath)
+	} else if whole && total >= 0 {
+		if segs, err = loadSegments(statePath, total); err != nil {
+			log.Printf("warning: %v; downloading %s from the start", err, remote)
+			os.Remove(statePath)
+			if err := dst.Truncate(0); err != nil {
+				return fmt.Errorf("truncate local %s: %w", local, err)
+			}
+			done = 0
+		} else if segs != nil {
+			done = segs[0].start
+		}
+	}
+	if segs == nil && topts.segments > 1 && whole && total > done {
+		segs = splitSegments(done, total, topts.segments)
+	}
+
+	var n int64
+	if segs != nil {
+		have := done
+		for _, s := range segs {
+			have += s.done
+		}
+		progress := topts.progress.rangeReader(remote, have, total)
+		n, err = copySegmented(dst, src, segs, func(r io.Reader) io.Reader {
+			return watch.reader(ctxReader{ctx, progress(timedReader{r, "read"})})
+		}, func(segs []segment) error {
+			return saveSegments(statePath, total, segs)
+		})
+	} else {
+		n, err = copyChunked(dst, watch.reader(ctxReader{ctx, topts.progress.reader(remote, done, total, timedReader{r, "read"})}))
+	}
+	if err != nil {
+		return fmt.Errorf("copy %s -> %s: %w", remote, local, watch.cause(err))
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("close local %s: %w", local, err)
+	}
+	if segs != nil {
+		os.Remove(statePath)
+	}
+	topts.progress.finish(remote, done+n, total)
+	if topts.offset > 0 || topts.length > 0 {
+		return nil // a byte range is not the remote file, so keep its own times
+	}
+
+	// Restore the remote creation time where the local OS allows it, so
+	// restored files don't all show as created today.
+	if fi, err := src.Stat(); err == nil {
+		if btime, ok := remoteBirthTime(fi); ok {
+			if err := setLocalBirthTime(local, btime); err != nil {
+				log.Printf("warning: set creation time on %s: %v", local, err)
+			}
+		}
 	}
 	return nil
 }
 
 func putFile(share *smb2.Share, local, remote string) error {
+	return uploadFile(context.Background(), share, local, remote, transferOptions{})
+}
+
+// uploadFile copies local to remote. With resume set, an existing remote file
+// that is not larger than local is treated as a partial upload and the
+// transfer continues from its current size.
+func uploadFile(ctx context.Context, share *smb2.Share, local, remote string, topts transferOptions) error {
+	share, watch := watchStall(ctx, share, topts.stallTimeout)
+	defer watch.stop()
+
 	info, err := os.Stat(local)
 	if err != nil {
 		return fmt.Errorf("stat local %s: %w", local, err)
 	}
 	if info.IsDir() {
-		return fmt.Errorf("local path %s is a directory", local)
+		return fmt.Errorf("local path %s is a directory; use -r to upload its contents", local)
+	}
+	if !info.Mode().IsRegular() && !(topts.allowSpecial && isStreamable(info.Mode())) {
+		if isStreamable(info.Mode()) {
+			return fmt.Errorf("local path %s is a %s; pass -allow-special to upload what can be read from it", local, fileKind(info.Mode()))
+		}
+		return fmt.Errorf("local path %s is a %s and cannot be uploaded", local, fileKind(info.Mode()))
 	}
 
 	remote = normalizeRemotePath(remote)
-	dir := path.Dir(remote)
-	if dir != "." && dir != "/" {
-		if err := share.MkdirAll(dir, 0o755); err != nil {
-			// Ignore errors - directory may already exist, or we'll fail at Create
-			// MkdirAll typically succeeds if path already exists
+	// Only files whose time is copied can be recognised as unchanged.
+	keepTime := !topts.appendMode && info.Mode().IsRegular()
+	if keepTime && topts.skipUnchanged && unchangedRemote(shareFS(share), remote, info) {
+		fmt.Fprintf(os.Stderr, "skipping %s: unchanged (same size and modification time; -ignore-times uploads it anyway)\n", remote)
+		return nil
+	}
+	// final is where a staged upload goes once written to remote, its
+	// staging path.
+	final, shown := "", remote
+	if topts.stage != "" {
+		final, remote = remote, normalizeRemotePath(topts.stage)
+	}
+	for _, p := range []string{final, remote} {
+		dir := path.Dir(p)
+		if p != "" && dir != "." && dir != "/" {
+			if err := share.MkdirAll(dir, 0o755); err != nil {
+				// Ignore errors - directory may already exist, or we'll fail at Create
+				// MkdirAll typically succeeds if path already exists
+			}
 		}
 	}
 
@@ -259,18 +565,78 @@ func putFile(share *smb2.Share, local, remote string) error {
 	}
 	defer src.Close()
 
-	dst, err := share.Create(remote)
+	// offset is where reading local starts, dstOffset where writing remote
+	// starts; they differ only when appending.
+	var offset, dstOffset int64
+	switch {
+	case topts.appendMode:
+		if fi, err := share.Stat(remote); err == nil {
+			dstOffset = fi.Size()
+		}
+		if topts.resume {
+			done := dstOffset - topts.appendBase
+			if done < 0 || done > info.Size() {
+				return fmt.Errorf("resume append to %s: remote changed size unexpectedly (%d bytes before, %d now)", remote, topts.appendBase, dstOffset)
+			}
+			offset = done
+		}
+	case topts.resume:
+		if fi, err := share.Stat(remote); err == nil && fi.Size() <= info.Size() {
+			offset = fi.Size()
+			dstOffset = offset
+		}
+	}
+
+	var dst *smb2.File
+	start := time.Now()
+	if topts.appendMode || offset > 0 {
+		dst, err = share.OpenFile(remote, os.O_WRONLY|os.O_CREATE, 0o644)
+	} else {
+		dst, err = share.Create(remote)
+	}
+	opStats.observe("create", start)
 	if err != nil {
 		return fmt.Errorf("create remote %s: %w", remote, err)
 	}
 	defer dst.Close()
 
-	if _, err := io.Copy(dst, src); err != nil {
-		return fmt.Errorf("copy %s -> %s: %w", local, remote, err)
+	if offset > 0 {
+		if _, err := src.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("seek local %s: %w", local, err)
+		}
 	}
+	n, err := copyTuned(dst, dstOffset, watch.reader(ctxReader{ctx, topts.progress.reader(shown, offset, info.Size(), src)}), topts.tuning.withDefaults())
+	if err != nil {
+		return fmt.Errorf("copy %s -> %s: %w", local, remote, watch.cause(err))
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", remote, err)
+	}
+	if final != "" {
+		if err := commitStaged(shareFS(share), remote, final); err != nil {
+			return err
+		}
+	}
+	// The time is set after closing, which would otherwise bump it. The
+	// data is in place by now, so a share that refuses the time only costs
+	// the next run its unchanged check.
+	if keepTime {
+		mtime := info.ModTime()
+		if err := share.Chtimes(shown, mtime, mtime); err != nil {
+			log.Printf("warning: set times on %s: %v", shown, err)
+		}
+	}
+	topts.progress.finish(shown, offset+n, info.Size())
 	return nil
 }
 
+// unchangedRemote reports whether remote already holds a file of local's
+// size and modification time, which put takes to be the same file.
+func unchangedRemote(share remoteFS, remote string, local os.FileInfo) bool {
+	fi, err := share.Stat(remote)
+	return err == nil && sameVersion(local.Size(), local.ModTime(), fi, false)
+}
+
 func normalizeRemotePath(p string) string {
 	if p == "" {
 		return "."
@@ -311,13 +677,48 @@ func splitServerAddress(address string) (string, string, error) {
 		return address, "445", nil
 	}
 
-	if ip := net.ParseIP(address); ip != nil {
+	if _, ok := parseIPLiteral(address); ok {
 		return address, "445", nil
 	}
 
 	return "", "", fmt.Errorf("parse server address %q: %w", address, err)
 }
 
+// shareKind classifies a share name: "special" for the administrative shares
+// Windows creates itself (IPC$, ADMIN$, and drive shares such as C$), "hidden"
+// for any other name ending in $, and "" for ordinary shares.
+func shareKind(name string) string {
+	if !strings.HasSuffix(name, "$") {
+		return ""
+	}
+	upper := strings.ToUpper(name)
+	if upper == "IPC$" || upper == "ADMIN$" || upper == "PRINT$" || (len(upper) == 2 && upper[0] >= 'A' && upper[0] <= 'Z') {
+		return "special"
+	}
+	return "hidden"
+}
+
+// filterShares keeps ordinary shares plus the hidden and special ones asked
+// for, sorted by name.
+func filterShares(names []string, includeHidden, includeSpecial bool) []string {
+	var out []string
+	for _, name := range names {
+		switch shareKind(name) {
+		case "hidden":
+			if !includeHidden {
+				continue
+			}
+		case "special":
+			if !includeSpecial {
+				continue
+			}
+		}
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
 func listShares(opts smbOptions) error {
 	session, cleanup, err := dialSession(opts)
 	if err != nil {
@@ -325,18 +726,24 @@ func listShares(opts smbOptions) error {
 	}
 	defer cleanup()
 
+	start := time.Now()
 	names, err := session.ListSharenames()
+	opStats.observe("shares", start)
 	if err != nil {
 		return fmt.Errorf("list shares: %w", err)
 	}
 
+	names = filterShares(names, opts.includeHidden, opts.includeSpecial)
 	if len(names) == 0 {
 		fmt.Println("No shares found.")
 		return nil
 	}
 
-	sort.Strings(names)
 	for _, name := range names {
+		if kind := shareKind(name); kind != "" {
+			fmt.Printf("%s\t(%s)\n", name, kind)
+			continue
+		}
 		fmt.Println(name)
 	}
 	return nil
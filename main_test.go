@@ -1,6 +1,12 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestSplitServerAddress(t *testing.T) {
 	tests := []struct {
@@ -40,6 +46,18 @@ func TestSplitServerAddress(t *testing.T) {
 			wantIP:   "2001:db8::1",
 			wantPort: "1445",
 		},
+		{
+			name:     "ipv6 link-local with zone",
+			input:    "fe80::1%eth0",
+			wantIP:   "fe80::1%eth0",
+			wantPort: "445",
+		},
+		{
+			name:     "bracketed ipv6 zone custom port",
+			input:    "[fe80::1%eth0]:1445",
+			wantIP:   "fe80::1%eth0",
+			wantPort: "1445",
+		},
 		{
 			name:    "empty input",
 			input:   "",
@@ -86,3 +104,41 @@ func TestNormalizeRemotePath(t *testing.T) {
 		}
 	}
 }
+
+func TestFilterShares(t *testing.T) {
+	names := []string{"public", "IPC$", "C$", "ADMIN$", "backup$", "docs", "print$"}
+	tests := []struct {
+		hidden, special bool
+		want            []string
+	}{
+		{false, false, []string{"docs", "public"}},
+		{true, false, []string{"backup$", "docs", "public"}},
+		{false, true, []string{"ADMIN$", "C$", "IPC$", "docs", "print$", "public"}},
+		{true, true, []string{"ADMIN$", "C$", "IPC$", "backup$", "docs", "print$", "public"}},
+	}
+	for _, tc := range tests {
+		got := filterShares(names, tc.hidden, tc.special)
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("filterShares(hidden=%v, special=%v) = %v, want %v", tc.hidden, tc.special, got, tc.want)
+		}
+	}
+}
+
+func TestUnchangedRemote(t *testing.T) {
+	mtime := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	local := writeTestTree(t, map[string]string{"a.bin": "abc"})
+	os.Chtimes(filepath.Join(local, "a.bin"), mtime, mtime)
+	info, err := os.Stat(filepath.Join(local, "a.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := newTestDirFS(t, map[string]string{"same": "xyz", "size": "abcd", "time": "abc"})
+	fsys.Chtimes("same", mtime.Add(time.Second), mtime.Add(time.Second))
+	fsys.Chtimes("size", mtime, mtime)
+	fsys.Chtimes("time", mtime.Add(time.Hour), mtime.Add(time.Hour))
+	for name, want := range map[string]bool{"same": true, "size": false, "time": false, "missing": false} {
+		if got := unchangedRemote(fsys, name, info); got != want {
+			t.Errorf("%s: unchanged = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+type manifestEntry struct {
+	sum  string
+	name string
+}
+
+// parseChecksumManifest reads sha256sum-style lines ("HASH  NAME" or
+// "HASH *NAME"). Blank lines and lines starting with '#' are ignored.
+func parseChecksumManifest(r io.Reader) ([]manifestEntry, error) {
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok || len(name) < 2 || (name[0] != ' ' && name[0] != '*') {
+			return nil, fmt.Errorf("line %d: expected \"HASH  NAME\"", lineNo)
+		}
+		name = name[1:]
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != sha256.Size*2 {
+			return nil, fmt.Errorf("line %d: invalid sha256 digest %q", lineNo, sum)
+		}
+		entries = append(entries, manifestEntry{sum: strings.ToLower(sum), name: name})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// verifyManifest streams every remote file listed in the manifest and compares
+// its SHA-256 digest, printing one sha256sum -c style line per entry in
+// manifest order. Up to jobs files are hashed concurrently.
+func verifyManifest(ctx context.Context, share *smb2.Share, manifestPath, remoteDir string, jobs int) error {
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		return fmt.Errorf("open manifest %s: %w", manifestPath, err)
+	}
+	entries, err := parseChecksumManifest(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("parse manifest %s: %w", manifestPath, err)
+	}
+
+	remoteDir = normalizeRemotePath(remoteDir)
+	type result struct {
+		sum string
+		err error
+	}
+	results := make([]chan result, len(entries))
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	work := make(chan int)
+	for w := 0; w < jobs; w++ {
+		go func() {
+			for i := range work {
+				remote := normalizeRemotePath(path.Join(remoteDir, strings.ReplaceAll(entries[i].name, "\\", "/")))
+				sum, err := hashRemoteFile(ctx, shareFS(share), remote, "sha256")
+				results[i] <- result{sum, err}
+			}
+		}()
+	}
+	go func() {
+		for i := range entries {
+			work <- i
+		}
+		close(work)
+	}()
+
+	var ok, failed, missing int
+	for i, e := range entries {
+		r := <-results[i]
+		switch {
+		case isNotExist(r.err):
+			fmt.Printf("%s: MISSING\n", e.name)
+			missing++
+		case r.err != nil:
+			fmt.Printf("%s: FAILED open or read (%v)\n", e.name, r.err)
+			failed++
+		case r.sum != e.sum:
+			fmt.Printf("%s: FAILED\n", e.name)
+			failed++
+		default:
+			fmt.Printf("%s: OK\n", e.name)
+			ok++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d OK, %d failed, %d missing\n", ok, failed, missing)
+	if failed > 0 || missing > 0 {
+		return fmt.Errorf("%d of %d entries did not verify", failed+missing, len(entries))
+	}
+	return nil
+}
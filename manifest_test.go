@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseChecksumManifest(t *testing.T) {
+	const sum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	input := "# generated\n" +
+		sum + "  empty.txt\n" +
+		"\n" +
+		strings.ToUpper(sum) + " *dir/binary.bin\r\n" +
+		sum + "  name with spaces.csv\n"
+
+	entries, err := parseChecksumManifest(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseChecksumManifest returned error: %v", err)
+	}
+	want := []manifestEntry{
+		{sum: sum, name: "empty.txt"},
+		{sum: sum, name: "dir/binary.bin"},
+		{sum: sum, name: "name with spaces.csv"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Fatalf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestParseChecksumManifestRejectsMalformedLines(t *testing.T) {
+	for _, input := range []string{
+		"not-a-digest  file.txt\n",
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n",
+		"e3b0c44298fc1c149afbf4c8996fb924  short.txt\n",
+	} {
+		if _, err := parseChecksumManifest(strings.NewReader(input)); err == nil {
+			t.Fatalf("expected error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// markerFile is one uploaded file as seen by a done-marker template.
+type markerFile struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// markerData is what done-marker name and content templates are executed
+// with: the directory the marker goes into and the files uploaded there.
+type markerData struct {
+	Share string       `json:"share"`
+	Dir   string       `json:"dir"`
+	Files []markerFile `json:"files"`
+	Time  time.Time    `json:"time"`
+}
+
+// doneMarker is a file written next to a finished upload set for downstream
+// consumers that poll for it.
+type doneMarker struct {
+	name    *template.Template
+	content *template.Template // nil writes an empty marker
+}
+
+var markerFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.MarshalIndent(v, "", "  ")
+		return string(b), err
+	},
+}
+
+// parseDoneMarker parses the marker name template and, if contentFile is
+// set, the content template read from that local file.
+func parseDoneMarker(name, contentFile string) (*doneMarker, error) {
+	if name == "" {
+		if contentFile != "" {
+			return nil, errors.New("-done-template needs -done-marker")
+		}
+		return nil, nil
+	}
+	m := &doneMarker{}
+	var err error
+	if m.name, err = template.New("done-marker").Funcs(markerFuncs).Parse(name); err != nil {
+		return nil, fmt.Errorf("parse -done-marker: %w", err)
+	}
+	if contentFile != "" {
+		text, err := os.ReadFile(contentFile)
+		if err != nil {
+			return nil, fmt.Errorf("read -done-template: %w", err)
+		}
+		if m.content, err = template.New(contentFile).Funcs(markerFuncs).Parse(string(text)); err != nil {
+			return nil, fmt.Errorf("parse -done-template: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// render returns the marker's file name and content for one directory.
+func (m *doneMarker) render(data markerData) (string, []byte, error) {
+	var name strings.Builder
+	if err := m.name.Execute(&name, data); err != nil {
+		return "", nil, fmt.Errorf("render -done-marker: %w", err)
+	}
+	if n := name.String(); n == "" || strings.ContainsAny(n, `/\`) {
+		return "", nil, fmt.Errorf("-done-marker rendered %q, which is not a plain file name", n)
+	}
+	var content bytes.Buffer
+	if m.content != nil {
+		if err := m.content.Execute(&content, data); err != nil {
+			return "", nil, fmt.Errorf("render -done-template: %w", err)
+		}
+	}
+	return name.String(), content.Bytes(), nil
+}
+
+// groupMarkers collects the uploaded targets by share and directory, in the
+// order each directory was first named, so one marker covers each.
+func groupMarkers(targets []remoteTarget, size int64, now time.Time) []markerData {
+	var groups []markerData
+	index := make(map[remoteTarget]int)
+	for _, t := range targets {
+		key := remoteTarget{share: t.share, path: path.Dir(t.path)}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, markerData{Share: key.share, Dir: key.path, Time: now})
+		}
+		groups[i].Files = append(groups[i].Files, markerFile{Name: path.Base(t.path), Path: t.path, Size: size})
+	}
+	return groups
+}
+
+// writeDoneMarkers writes one marker per directory of the upload set. Each is
+// written under a temporary name and renamed into place, so a consumer never
+// sees a half-written marker.
+func writeDoneMarkers(shares *shareSet, m *doneMarker, groups []markerData) error {
+	for _, data := range groups {
+		name, content, err := m.render(data)
+		if err != nil {
+			return err
+		}
+		share, err := shares.mount(data.Share)
+		if err != nil {
+			return err
+		}
+		if err := writeMarker(share, joinRemote(data.Dir, name), content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMarker(share *smb2.Share, remote string, content []byte) error {
+	tmp := joinRemote(path.Dir(remote), "."+path.Base(remote)+".tmp")
+	start := time.Now()
+	err := share.WriteFile(tmp, content, 0o644)
+	opStats.observe("create", start)
+	if err != nil {
+		return fmt.Errorf("write marker %s: %w", tmp, err)
+	}
+	if err := share.Remove(remote); err != nil && !isNotExist(err) {
+		share.Remove(tmp)
+		return fmt.Errorf("replace marker %s: %w", remote, err)
+	}
+	if err := share.Rename(tmp, remote); err != nil {
+		share.Remove(tmp)
+		return fmt.Errorf("rename marker %s: %w", remote, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGroupMarkers(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	targets := []remoteTarget{
+		{share: "a", path: "in/x.csv"},
+		{share: "b", path: "in/x.csv"},
+		{share: "a", path: "in/y.csv"},
+		{share: "a", path: "z.csv"},
+	}
+	got := groupMarkers(targets, 10, now)
+	want := []markerData{
+		{Share: "a", Dir: "in", Time: now, Files: []markerFile{{"x.csv", "in/x.csv", 10}, {"y.csv", "in/y.csv", 10}}},
+		{Share: "b", Dir: "in", Time: now, Files: []markerFile{{"x.csv", "in/x.csv", 10}}},
+		{Share: "a", Dir: ".", Time: now, Files: []markerFile{{"z.csv", "z.csv", 10}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("groupMarkers = %+v, want %+v", got, want)
+	}
+}
+
+func TestDoneMarkerRender(t *testing.T) {
+	tmpl := filepath.Join(t.TempDir(), "manifest.tmpl")
+	if err := os.WriteFile(tmpl, []byte(`{{range .Files}}{{.Name}} {{.Size}}
+{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data := markerData{Share: "etl", Dir: "in", Time: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Files: []markerFile{{"a.csv", "in/a.csv", 3}, {"b.csv", "in/b.csv", 4}}}
+
+	tests := []struct {
+		name, content string
+		wantName      string
+		wantContent   string
+		wantErr       bool
+	}{
+		{name: "_SUCCESS", wantName: "_SUCCESS"},
+		{name: `{{.Time.Format "20060102"}}.done`, content: tmpl, wantName: "20240601.done", wantContent: "a.csv 3\nb.csv 4\n"},
+		{name: "{{.Dir}}/x", wantErr: true},
+	}
+	for _, tt := range tests {
+		m, err := parseDoneMarker(tt.name, tt.content)
+		if err != nil {
+			t.Fatalf("parseDoneMarker(%q): %v", tt.name, err)
+		}
+		name, content, err := m.render(data)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("render(%q) succeeded, want error", tt.name)
+			}
+			continue
+		}
+		if err != nil || name != tt.wantName || string(content) != tt.wantContent {
+			t.Errorf("render(%q) = %q, %q, %v; want %q, %q", tt.name, name, content, err, tt.wantName, tt.wantContent)
+		}
+	}
+
+	if m, err := parseDoneMarker("", ""); m != nil || err != nil {
+		t.Fatalf("no marker = %v, %v", m, err)
+	}
+	if _, err := parseDoneMarker("", tmpl); err == nil {
+		t.Fatal("template without marker name accepted")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
+// moveDestination returns where src ends up when moved to dst: inside dst
+// when dst is an existing directory, otherwise dst itself.
+func moveDestination(src, dst string, dstIsDir bool) string {
+	if dstIsDir {
+		return joinRemote(dst, path.Base(src))
+	}
+	return dst
+}
+
+// moveRemote renames src to dst on the server. An existing file at the
+// destination is only replaced with force set; SMB rename never overwrites
+// here, so it is removed first.
+func moveRemote(share remoteFS, src, dst string, force bool) error {
+	src = normalizeRemotePath(src)
+	dst = normalizeRemotePath(dst)
+	if _, err := share.Lstat(src); err != nil {
+		return fmt.Errorf("stat %s: %w", src, err)
+	}
+
+	fi, err := share.Stat(dst)
+	if err == nil && fi.IsDir() {
+		dst = moveDestination(src, dst, true)
+		fi, err = share.Stat(dst)
+	}
+	if err == nil {
+		if fi.IsDir() {
+			return fmt.Errorf("%s is an existing directory", dst)
+		}
+		if !force {
+			return fmt.Errorf("%s already exists; use -force to replace it", dst)
+		}
+		if _, err := removeEntry(share, dst); err != nil {
+			return err
+		}
+	} else if !isNotExist(err) {
+		return fmt.Errorf("stat %s: %w", dst, err)
+	}
+
+	start := time.Now()
+	err = share.Rename(src, dst)
+	opStats.observe("rename", start)
+	if err != nil {
+		return fmt.Errorf("rename %s -> %s: %w", src, dst, err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestMoveDestination(t *testing.T) {
+	tests := []struct {
+		src, dst string
+		dstIsDir bool
+		want     string
+	}{
+		{"reports/a.pdf", "archive", true, "archive/a.pdf"},
+		{"reports/a.pdf", ".", true, "a.pdf"},
+		{"reports/a.pdf", "archive/b.pdf", false, "archive/b.pdf"},
+		{"reports", "old", true, "old/reports"},
+	}
+	for _, tc := range tests {
+		if got := moveDestination(tc.src, tc.dst, tc.dstIsDir); got != tc.want {
+			t.Errorf("moveDestination(%q, %q, %v) = %q, want %q", tc.src, tc.dst, tc.dstIsDir, got, tc.want)
+		}
+	}
+}
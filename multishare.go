@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// remoteTarget is a path on a named share of the connected server.
+type remoteTarget struct {
+	share string
+	path  string
+}
+
+func (t remoteTarget) String() string {
+	return t.share + ":" + t.path
+}
+
+// parseRemoteTarget accepts either a plain remote path on defaultShare or an
+// smb://HOST/SHARE/PATH URL naming another share. All targets of one run
+// share a session, so a URL must point at the -server host.
+func parseRemoteTarget(arg, server, defaultShare string) (remoteTarget, error) {
+	if !strings.HasPrefix(arg, "smb://") {
+		if defaultShare == "" {
+			return remoteTarget{}, fmt.Errorf("%s: no share given; use -share or an smb://HOST/SHARE/PATH URL", arg)
+		}
+		return remoteTarget{share: defaultShare, path: normalizeRemotePath(arg)}, nil
+	}
+
+	u, err := url.Parse(arg)
+	if err != nil {
+		return remoteTarget{}, fmt.Errorf("parse %s: %w", arg, err)
+	}
+	host, _, err := splitServerAddress(server)
+	if err != nil {
+		return remoteTarget{}, err
+	}
+	if !strings.EqualFold(u.Hostname(), host) {
+		return remoteTarget{}, fmt.Errorf("%s: host %q does not match -server %q", arg, u.Hostname(), host)
+	}
+	share, rest, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if share == "" {
+		return remoteTarget{}, fmt.Errorf("%s: URL names no share", arg)
+	}
+	return remoteTarget{share: share, path: normalizeRemotePath(rest)}, nil
+}
+
+// hasRemoteURL reports whether any argument names its share in an smb:// URL.
+func hasRemoteURL(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "smb://") {
+			return true
+		}
+	}
+	return false
+}
+
+// shareSet mounts shares on one session as they are first needed, so a
+// command can work across several shares of a server over one connection.
+type shareSet struct {
+	session *smb2.Session
+	mu      sync.Mutex
+	mounted map[string]*smb2.Share
+}
+
+// openShareSet dials a session; the returned cleanup unmounts every share
+// and logs off. Inside an exec script the script's session is reused.
+func openShareSet(opts smbOptions) (*shareSet, func(), error) {
+	if opts.session != nil {
+		return opts.session.open(opts)
+	}
+	session, cleanup, err := dialSession(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	set := &shareSet{session: session, mounted: make(map[string]*smb2.Share)}
+	return set, func() {
+		set.umount()
+		cleanup()
+	}, nil
+}
+
+func (s *shareSet) mount(name string) (*smb2.Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if share, ok := s.mounted[name]; ok {
+		return share, nil
+	}
+	start := time.Now()
+	share, err := s.session.Mount(name)
+	opStats.observe("mount", start)
+	if err != nil {
+		return nil, fmt.Errorf("mount share %s: %w", name, err)
+	}
+	s.mounted[name] = share
+	return share, nil
+}
+
+func (s *shareSet) umount() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, share := range s.mounted {
+		share.Umount()
+		delete(s.mounted, name)
+	}
+}
+
+// remoteSizes returns the current size of every target, zero for those that
+// do not exist yet.
+func remoteSizes(shares *shareSet, targets []remoteTarget) ([]int64, error) {
+	sizes := make([]int64, len(targets))
+	for i, target := range targets {
+		share, err := shares.mount(target.share)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := share.Stat(target.path)
+		switch {
+		case err == nil:
+			sizes[i] = fi.Size()
+		case !isNotExist(err):
+			return nil, fmt.Errorf("stat %s: %w", target, err)
+		}
+	}
+	return sizes, nil
+}
+
+// uploadToTargets copies local to every target concurrently over the shared
+// session. Failures are collected per target rather than stopping the rest.
+// When appending, appendBases holds each target's size before the first
+// attempt.
+func uploadToTargets(ctx context.Context, shares *shareSet, local string, targets []remoteTarget, topts transferOptions, appendBases []int64) error {
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			topts := topts
+			if topts.appendMode {
+				topts.appendBase = appendBases[i]
+			}
+			if topts.tmpDir != "" {
+				topts.stage = stagingPath(topts.tmpDir, target.share, target.path)
+			}
+			share, err := shares.mount(target.share)
+			if err == nil {
+				err = uploadFile(ctx, share, local, target.path, topts)
+			}
+			if err != nil && len(targets) > 1 {
+				err = fmt.Errorf("%s: %w", target, err)
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// verifyTargets reads every target back and compares its SHA-256 with that
+// of local, failing for each one that differs.
+func verifyTargets(ctx context.Context, shares *shareSet, local string, targets []remoteTarget) error {
+	want, err := hashLocalFile(ctx, local)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, target := range targets {
+		share, err := shares.mount(target.share)
+		if err != nil {
+			return err
+		}
+		got, err := hashRemoteFile(ctx, shareFS(share), normalizeRemotePath(target.path), "sha256")
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("verify %s: %w", target, err))
+		case got != want:
+			errs = append(errs, fmt.Errorf("verify %s: content differs from %s", target, local))
+		}
+	}
+	return errors.Join(errs...)
+}
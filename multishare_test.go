@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestParseRemoteTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     string
+		share   string
+		want    remoteTarget
+		wantErr bool
+	}{
+		{"plain path", "reports/a.pdf", "drop", remoteTarget{"drop", "reports/a.pdf"}, false},
+		{"plain path without share", "reports/a.pdf", "", remoteTarget{}, true},
+		{"url", "smb://NAS.local/backup1/db/dump.sql", "", remoteTarget{"backup1", "db/dump.sql"}, false},
+		{"url with port", "smb://nas.local:1445/backup2/x", "drop", remoteTarget{"backup2", "x"}, false},
+		{"url share root", "smb://nas.local/backup1", "", remoteTarget{"backup1", "."}, false},
+		{"url other host", "smb://other/backup1/x", "", remoteTarget{}, true},
+		{"url without share", "smb://nas.local/", "", remoteTarget{}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRemoteTarget(tc.arg, "nas.local:1445", tc.share)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("parseRemoteTarget(%q) = %+v, want %+v", tc.arg, got, tc.want)
+			}
+		})
+	}
+}
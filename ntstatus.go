@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// NTSTATUS codes from [MS-ERREF] that the CLI needs to tell apart. go-smb2
+// keeps its own table internal, so the handful we use are mirrored here.
+const (
+	statusNoSuchFile         = 0xC000000F
+	statusObjectNameNotFound = 0xC0000034
+	statusObjectPathNotFound = 0xC000003A
+)
+
+// ntStatus returns the NTSTATUS carried by err, if any.
+func ntStatus(err error) (uint32, bool) {
+	var respErr *smb2.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.Code, true
+	}
+	return 0, false
+}
+
+// isNotExist reports whether err means the remote path does not exist. go-smb2
+// does not map NTSTATUS codes onto os.ErrNotExist, so both are checked.
+func isNotExist(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	code, ok := ntStatus(err)
+	if !ok {
+		return false
+	}
+	switch code {
+	case statusNoSuchFile, statusObjectNameNotFound, statusObjectPathNotFound:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+func TestIsNotExist(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"os not exist", &os.PathError{Op: "open", Path: "a", Err: os.ErrNotExist}, true},
+		{"object name not found", &os.PathError{Op: "open", Path: "a", Err: &smb2.ResponseError{Code: statusObjectNameNotFound}}, true},
+		{"object path not found", fmt.Errorf("stat: %w", &smb2.ResponseError{Code: statusObjectPathNotFound}), true},
+		{"access denied", &smb2.ResponseError{Code: 0xC0000022}, false},
+		{"other", errors.New("boom"), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isNotExist(tc.err); got != tc.want {
+				t.Fatalf("isNotExist(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backupSuffix is appended to the name of a destination -backup moves
+// aside.
+const backupSuffix = "~"
+
+// overwritePolicy is what put and get do with a destination that already
+// exists. The zero policy replaces it.
+type overwritePolicy struct {
+	// noClobber leaves every existing destination alone.
+	noClobber bool
+	// ifNewer replaces a destination only if the source was modified after
+	// it.
+	ifNewer bool
+	// backup renames a destination to NAME~ before replacing it.
+	backup bool
+	// remoteBackup keeps generations of a replaced remote destination.
+	remoteBackup backupSpec
+}
+
+// backupSpec names the copies -backup-remote keeps of a replaced remote
+// file: NAME+suffix for the latest, NAME+suffix+".1" for the one before, and
+// so on, keep in all. A zero keep keeps none.
+type backupSpec struct {
+	suffix string
+	keep   int
+}
+
+// maxBackups bounds the generations -backup-remote keeps.
+const maxBackups = 100
+
+// parseBackupSpec parses -backup-remote, comma-separated suffix=S and
+// keep=N, by default .bak and 1. An empty spec keeps no backups.
+func parseBackupSpec(s string) (backupSpec, error) {
+	if s == "" {
+		return backupSpec{}, nil
+	}
+	b := backupSpec{suffix: ".bak", keep: 1}
+	for _, field := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch key {
+		case "suffix":
+			if value == "" || strings.ContainsAny(value, `/\`) {
+				return backupSpec{}, fmt.Errorf("-backup-remote: bad suffix %q", value)
+			}
+			b.suffix = value
+		case "keep":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxBackups {
+				return backupSpec{}, fmt.Errorf("-backup-remote: keep must be between 1 and %d", maxBackups)
+			}
+			b.keep = n
+		default:
+			return backupSpec{}, fmt.Errorf("-backup-remote: unknown setting %q (want suffix=S or keep=N)", field)
+		}
+	}
+	return b, nil
+}
+
+// name returns the path of generation gen of the backups of p, 0 being the
+// latest.
+func (b backupSpec) name(p string, gen int) string {
+	if gen == 0 {
+		return p + b.suffix
+	}
+	return fmt.Sprintf("%s%s.%d", p, b.suffix, gen)
+}
+
+// backupRemoteFlag defines -backup-remote.
+func backupRemoteFlag(fs *flag.FlagSet, opts *smbOptions) {
+	fs.StringVar(&opts.backupRemote, "backup-remote", "", "Rename a remote file aside before replacing it: suffix=S,keep=N (default suffix=.bak,keep=1)")
+}
+
+func overwriteFlags(fs *flag.FlagSet, opts *smbOptions) {
+	fs.BoolVar(&opts.overwrite.noClobber, "no-clobber", false, "Never replace a destination that exists")
+	fs.BoolVar(&opts.overwrite.ifNewer, "if-newer", false, "Replace a destination only if the source is newer")
+	fs.BoolVar(&opts.overwrite.backup, "backup", false, "Rename a destination to NAME"+backupSuffix+" before replacing it")
+}
+
+func (p overwritePolicy) set() bool {
+	return p.noClobber || p.ifNewer || p.backup || p.remoteBackup.keep > 0
+}
+
+// remoteBackups returns the backups to keep of a remote destination.
+func (p overwritePolicy) remoteBackups() backupSpec {
+	if p.backup {
+		return backupSpec{suffix: backupSuffix, keep: 1}
+	}
+	return p.remoteBackup
+}
+
+// check rejects combinations that make no sense: -no-clobber replaces
+// nothing to compare or back up, and resuming or appending continues a
+// destination rather than replacing it.
+func (p overwritePolicy) check(resume, appendMode bool) error {
+	switch {
+	case p.noClobber && (p.ifNewer || p.backup || p.remoteBackup.keep > 0):
+		return errors.New("-no-clobber cannot be combined with -if-newer, -backup, or -backup-remote")
+	case p.backup && p.remoteBackup.keep > 0:
+		return errors.New("-backup cannot be combined with -backup-remote")
+	case p.set() && resume:
+		return errors.New("-no-clobber, -if-newer, -backup, and -backup-remote cannot be combined with -resume, which continues the destination")
+	case p.set() && appendMode:
+		return errors.New("-no-clobber, -if-newer, -backup, and -backup-remote cannot be combined with -append, which keeps the destination")
+	}
+	return nil
+}
+
+// keep returns why a destination, described by dst (nil if there is none),
+// stays as it is rather than being replaced by a source modified at
+// modTime, or "" if it is to be replaced.
+func (p overwritePolicy) keep(modTime time.Time, dst os.FileInfo) string {
+	switch {
+	case dst == nil:
+		return ""
+	case p.noClobber:
+		return "exists"
+	case p.ifNewer && (!modTime.After(dst.ModTime()) || withinWindow(modTime, dst.ModTime())):
+		return "not older than the source"
+	}
+	return ""
+}
+
+// backupRemote renames remote to its latest backup name under b, after
+// moving each earlier backup one generation older and dropping the oldest.
+// An SMB rename cannot replace a file, so one in the way is removed first.
+func backupRemote(share remoteFS, remote string, b backupSpec) error {
+	for gen := b.keep - 1; gen >= 0; gen-- {
+		from := remote
+		if gen > 0 {
+			from = b.name(remote, gen-1)
+			if _, err := share.Stat(from); isNotExist(err) {
+				continue
+			}
+		}
+		to := b.name(remote, gen)
+		if _, err := share.Stat(to); err == nil {
+			if _, err := removeEntry(share, to); err != nil {
+				return err
+			}
+		}
+		start := time.Now()
+		err := share.Rename(from, to)
+		opStats.observe("rename", start)
+		if err != nil {
+			return fmt.Errorf("back up %s to %s: %w", from, to, err)
+		}
+	}
+	return nil
+}
+
+// backupLocal renames local to local~, replacing an earlier backup.
+func backupLocal(local string) error {
+	if err := os.Rename(local, local+backupSuffix); err != nil {
+		return fmt.Errorf("back up %s: %w", local, err)
+	}
+	return nil
+}
+
+// prepareRemote applies p to the remote destination of a source modified
+// at modTime before it is written, backing it up if asked, and returns why
+// it is to be kept instead, or "" to go ahead.
+func (p overwritePolicy) prepareRemote(share remoteFS, remote string, modTime time.Time) (string, error) {
+	if !p.set() {
+		return "", nil
+	}
+	fi, err := share.Stat(remote)
+	switch {
+	case isNotExist(err):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("stat %s: %w", remote, err)
+	case fi.IsDir():
+		return "", fmt.Errorf("%s is a directory", remote)
+	}
+	if reason := p.keep(modTime, fi); reason != "" {
+		return reason, nil
+	}
+	if b := p.remoteBackups(); b.keep > 0 {
+		return "", backupRemote(share, remote, b)
+	}
+	return "", nil
+}
+
+// prepareLocal is prepareRemote for a download to local.
+func (p overwritePolicy) prepareLocal(local string, modTime time.Time) (string, error) {
+	if !p.set() {
+		return "", nil
+	}
+	fi, err := os.Stat(local)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return "", nil
+	case err != nil:
+		return "", err
+	case fi.IsDir():
+		return "", fmt.Errorf("%s is a directory", local)
+	}
+	if reason := p.keep(modTime, fi); reason != "" {
+		return reason, nil
+	}
+	if p.backup {
+		return "", backupLocal(local)
+	}
+	return "", nil
+}
+
+// prepareTargets applies the overwrite policy of a single-file put to each
+// of its targets, backing them up as asked, and returns those still to be
+// written; kept reports whether any was left alone. A target already
+// holding the file is passed on for the upload to skip, not backed up.
+func prepareTargets(shares *shareSet, local string, targets []remoteTarget, opts smbOptions) (active []remoteTarget, kept bool, err error) {
+	if !opts.overwrite.set() {
+		return targets, false, nil
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		return nil, false, fmt.Errorf("stat local %s: %w", local, err)
+	}
+	for _, target := range targets {
+		share, err := shares.mount(target.share)
+		if err != nil {
+			return nil, false, err
+		}
+		remote := normalizeRemotePath(target.path)
+		if !opts.ignoreTimes && !opts.verify && unchangedRemote(shareFS(share), remote, info) {
+			active = append(active, target)
+			continue
+		}
+		reason, err := opts.overwrite.prepareRemote(shareFS(share), remote, info.ModTime())
+		if err != nil {
+			return nil, false, err
+		}
+		if reason != "" {
+			fmt.Fprintf(os.Stderr, "skipping %s: %s\n", target, reason)
+			kept = true
+			continue
+		}
+		active = append(active, target)
+	}
+	return active, kept, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOverwritePolicyKeep(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := newTestDirFS(t, map[string]string{"f": "x"})
+	fsys.Chtimes("f", mtime, mtime)
+	dst, _ := fsys.Stat("f")
+	tests := []struct {
+		p       overwritePolicy
+		modTime time.Time
+		dst     os.FileInfo
+		want    string
+	}{
+		{overwritePolicy{}, mtime, dst, ""},
+		{overwritePolicy{noClobber: true}, mtime, nil, ""},
+		{overwritePolicy{noClobber: true}, mtime.Add(time.Hour), dst, "exists"},
+		{overwritePolicy{ifNewer: true}, mtime.Add(time.Hour), dst, ""},
+		{overwritePolicy{ifNewer: true}, mtime.Add(time.Second), dst, "not older than the source"},
+		{overwritePolicy{ifNewer: true}, mtime.Add(-time.Hour), dst, "not older than the source"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.keep(tt.modTime, tt.dst); got != tt.want {
+			t.Errorf("%+v.keep(%s) = %q, want %q", tt.p, tt.modTime, got, tt.want)
+		}
+	}
+	if err := (overwritePolicy{noClobber: true, backup: true}).check(false, false); err == nil {
+		t.Error("-no-clobber -backup accepted")
+	}
+	if err := (overwritePolicy{backup: true}).check(true, false); err == nil {
+		t.Error("-backup -resume accepted")
+	}
+}
+
+func TestBackupRemoteReplacesOldBackup(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"a.txt": "new", "a.txt~": "old"})
+	reason, err := overwritePolicy{backup: true}.prepareRemote(fsys, "a.txt", time.Now())
+	if err != nil || reason != "" {
+		t.Fatalf("prepareRemote = %q, %v", reason, err)
+	}
+	if got := readTestFile(t, fsys, "a.txt~"); got != "new" {
+		t.Errorf("backup holds %q", got)
+	}
+	if _, err := fsys.Stat("a.txt"); !isNotExist(err) {
+		t.Errorf("a.txt still there: %v", err)
+	}
+}
+
+func TestTreeUploadNoClobber(t *testing.T) {
+	local := writeTestTree(t, map[string]string{"a.txt": "alpha", "b.txt": "beta"})
+	fsys := newTestDirFS(t, map[string]string{"dst/a.txt": "remote"})
+	tu, err := scanTreeUpload(&bytes.Buffer{}, local, "dst", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.deleteSource = true
+	var out bytes.Buffer
+	tu.applyOverwrite(fsys, overwritePolicy{noClobber: true}, &out)
+	if err := tu.run(context.Background(), fsys, &out, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, fsys, "dst/a.txt"); got != "remote" {
+		t.Errorf("a.txt replaced with %q", got)
+	}
+	if got := readTestFile(t, fsys, "dst/b.txt"); got != "beta" {
+		t.Errorf("b.txt = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(local, "a.txt")); err != nil {
+		t.Errorf("kept file removed locally: %v", err)
+	}
+	if tu.skipped != 1 || tu.removed != 1 {
+		t.Errorf("skipped %d, removed %d; output:\n%s", tu.skipped, tu.removed, out.String())
+	}
+}
+
+func TestPrepareLocalBackup(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "report.pdf")
+	os.WriteFile(local, []byte("old"), 0o644)
+	reason, err := overwritePolicy{backup: true}.prepareLocal(local, time.Now())
+	if err != nil || reason != "" {
+		t.Fatalf("prepareLocal = %q, %v", reason, err)
+	}
+	if data, err := os.ReadFile(local + backupSuffix); err != nil || string(data) != "old" {
+		t.Errorf("backup = %q, %v", data, err)
+	}
+}
+
+func TestParseBackupSpec(t *testing.T) {
+	tests := []struct {
+		in   string
+		want backupSpec
+		ok   bool
+	}{
+		{"", backupSpec{}, true},
+		{"suffix=.bak", backupSpec{".bak", 1}, true},
+		{"keep=3", backupSpec{".bak", 3}, true},
+		{"suffix=.old, keep=5", backupSpec{".old", 5}, true},
+		{"keep=0", backupSpec{}, false},
+		{"suffix=", backupSpec{}, false},
+		{"suffix=/x", backupSpec{}, false},
+		{"gens=2", backupSpec{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseBackupSpec(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseBackupSpec(%q) = %+v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestBackupRemoteRotates(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"f": "v4", "f.bak": "v3", "f.bak.1": "v2", "f.bak.2": "v1"})
+	if err := backupRemote(fsys, "f", backupSpec{".bak", 3}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"f.bak": "v4", "f.bak.1": "v3", "f.bak.2": "v2"} {
+		if got := readTestFile(t, fsys, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := fsys.Stat("f"); !isNotExist(err) {
+		t.Errorf("f still there: %v", err)
+	}
+	// A gap in the generations is skipped.
+	fsys = newTestDirFS(t, map[string]string{"g": "new", "g.bak.1": "old"})
+	if err := backupRemote(fsys, "g", backupSpec{".bak", 3}); err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, fsys, "g.bak") != "new" || readTestFile(t, fsys, "g.bak.2") != "old" {
+		t.Error("gap not handled")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// patchRemote overwrites remote in place with the bytes of r, starting at
+// offset. The file must already exist and is never truncated; writing past
+// its end extends it. It returns the number of bytes written.
+func patchRemote(ctx context.Context, share *smb2.Share, remote string, r io.Reader, offset int64) (int64, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid offset %d", offset)
+	}
+	remote = normalizeRemotePath(remote)
+	start := time.Now()
+	dst, err := share.OpenFile(remote, os.O_WRONLY, 0o644)
+	opStats.observe("open", start)
+	if err != nil {
+		return 0, fmt.Errorf("open remote %s: %w", remote, err)
+	}
+	defer dst.Close()
+
+	n, err := copyChunked(timedWriter{io.NewOffsetWriter(dst, offset), "write"}, ctxReader{ctx, r})
+	if err != nil {
+		return n, fmt.Errorf("patch %s at offset %d: %w", remote, offset, err)
+	}
+	return n, dst.Close()
+}
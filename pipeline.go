@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// smallFileMax is the largest file uploadPipelined reads whole and sends in
+// a single write. Larger files are streamed; their per-file round trips are
+// noise next to the data.
+const smallFileMax = 1 << 20
+
+// remoteDirs creates each remote directory once, however many files land in
+// it and however many goroutines ask. Directories that already exist are
+// fine.
+type remoteDirs struct {
+	share remoteFS
+	mu    sync.Mutex
+	made  map[string]bool
+}
+
+func newRemoteDirs(share remoteFS) *remoteDirs {
+	return &remoteDirs{share: share, made: make(map[string]bool)}
+}
+
+func (d *remoteDirs) mkdirAll(dir string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dir == "." || d.made[dir] {
+		return nil
+	}
+	start := time.Now()
+	err := d.share.MkdirAll(dir, 0o755)
+	opStats.observe("mkdir", start)
+	if err != nil {
+		if fi, statErr := d.share.Stat(dir); statErr != nil || !fi.IsDir() {
+			return fmt.Errorf("mkdir %s: %w", dir, err)
+		}
+	}
+	d.made[dir] = true
+	return nil
+}
+
+// pipelineItem is one local file for uploadPipelined. remote is the name it
+// is stored under, so it already carries the suffixes of rule.
+type pipelineItem struct {
+	local, remote string
+	size          int64
+	modTime       time.Time
+	rule          transferRule
+	// special marks a named pipe or device, read as a stream of unknown
+	// length.
+	special bool
+}
+
+// uploadPipelined uploads items with up to depth files in flight over the
+// one session. A small file costs a create, a write, a close, and a time
+// update; go-smb2 cannot chain those into one compound request, but it
+// multiplexes requests from concurrent callers, so with many files
+// outstanding the round trips overlap instead of adding up. That is what
+// makes trees of many tiny files practical. Remote directories are created
+// as needed, once each. done is called once per item, never concurrently;
+// a failed item does not stop the others. Items not started when ctx is done
+// are left out.
+func uploadPipelined(ctx context.Context, share remoteFS, items []pipelineItem, depth int, done func(it pipelineItem, err error)) error {
+	if depth < 1 {
+		depth = 1
+	}
+	dirs := newRemoteDirs(share)
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		work = make(chan pipelineItem)
+	)
+	for w := 0; w < depth; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range work {
+				err := uploadPipelinedItem(ctx, share, dirs, it)
+				mu.Lock()
+				done(it, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, it := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- it
+	}
+	close(work)
+	wg.Wait()
+	return ctx.Err()
+}
+
+func uploadPipelinedItem(ctx context.Context, share remoteFS, dirs *remoteDirs, it pipelineItem) error {
+	if err := dirs.mkdirAll(path.Dir(it.remote)); err != nil {
+		return err
+	}
+	// A small file is read whole and written in one call, which also spares
+	// it copyChunked's buffer.
+	var (
+		data []byte
+		src  *os.File
+		err  error
+	)
+	if it.size <= smallFileMax && !it.special {
+		if data, err = os.ReadFile(it.local); err != nil {
+			return err
+		}
+	} else {
+		if src, err = os.Open(it.local); err != nil {
+			return err
+		}
+		defer src.Close()
+	}
+
+	start := time.Now()
+	dst, err := share.Create(it.remote)
+	opStats.observe("create", start)
+	if err != nil {
+		return fmt.Errorf("create remote %s: %w", it.remote, err)
+	}
+	var w io.Writer = timedWriter{dst, "write"}
+	var rw *ruleWriter
+	if it.rule.transforms() || it.rule.verify {
+		if rw, err = newRuleWriter(w, it.rule); err != nil {
+			dst.Close()
+			return err
+		}
+		w = rw
+	}
+	if src != nil {
+		_, err = copyChunked(w, ctxReader{ctx, src})
+	} else if len(data) > 0 {
+		_, err = w.Write(data)
+	}
+	if err == nil && rw != nil {
+		err = rw.Close()
+	}
+	if err != nil {
+		dst.Close()
+		return fmt.Errorf("write %s: %w", it.remote, err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", it.remote, err)
+	}
+	if rw != nil && it.rule.verify {
+		got, err := hashRemoteFile(ctx, share, it.remote, "sha256")
+		if err != nil {
+			return fmt.Errorf("verify %s: %w", it.remote, err)
+		}
+		if got != rw.stored() {
+			return fmt.Errorf("verify %s: content read back differs from what was written", it.remote)
+		}
+	}
+	if !it.modTime.IsZero() {
+		if err := share.Chtimes(it.remote, it.modTime, it.modTime); err != nil {
+			return fmt.Errorf("set times on %s: %w", it.remote, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadPipelined(t *testing.T) {
+	local := t.TempDir()
+	big := strings.Repeat("x", smallFileMax+1)
+	files := map[string]string{"a.txt": "alpha", "empty": "", "big.bin": big}
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var items []pipelineItem
+	for name, content := range files {
+		p := filepath.Join(local, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, pipelineItem{local: p, remote: "out/sub/" + name, size: int64(len(content)), modTime: mtime})
+	}
+	items = append(items, pipelineItem{local: filepath.Join(local, "missing"), remote: "out/missing"})
+
+	var mkdirs int
+	fsys := newTestDirFS(t, nil)
+	counted := interceptFS(fsys, func(op Op, next func() error) error {
+		if op.Name == "mkdir" {
+			mkdirs++
+		}
+		return next()
+	})
+	failed := map[string]error{}
+	err := uploadPipelined(context.Background(), counted, items, 3, func(it pipelineItem, err error) {
+		if err != nil {
+			failed[it.remote] = err
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed["out/missing"] == nil {
+		t.Fatalf("failures = %v, want only out/missing", failed)
+	}
+	for name, content := range files {
+		if got := readTestFile(t, fsys, "out/sub/"+name); got != content {
+			t.Errorf("%s: got %d bytes, want %d", name, len(got), len(content))
+		}
+		fi, err := fsys.Stat("out/sub/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s: mtime %v, want %v", name, fi.ModTime(), mtime)
+		}
+	}
+	if mkdirs != 2 {
+		t.Errorf("%d mkdir calls, want one each for the directories of out/sub/* and out/missing", mkdirs)
+	}
+}
+
+func TestUploadPipelinedCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var calls int
+	items := []pipelineItem{{local: "x", remote: "x"}}
+	err := uploadPipelined(ctx, newTestDirFS(t, nil), items, 2, func(pipelineItem, error) { calls++ })
+	if err != context.Canceled || calls != 0 {
+		t.Fatalf("uploadPipelined = %v with %d items done, want context.Canceled and none", err, calls)
+	}
+}
+
+func TestRemoteDirsExisting(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"d/f": "", "file": ""})
+	dirs := newRemoteDirs(fsys)
+	if err := dirs.mkdirAll("d"); err != nil {
+		t.Fatalf("existing directory: %v", err)
+	}
+	if err := dirs.mkdirAll("file"); err == nil {
+		t.Fatal("expected error making a directory over a file")
+	}
+	if err := dirs.mkdirAll("."); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// preallocate reserves disk space for f up to size, so a segmented download
+// finds out up front that the disk is too small and its segments do not
+// fragment the file. File systems without fallocate only get the size set.
+func preallocate(f *os.File, size int64) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() >= size {
+		return nil
+	}
+	err = syscall.Fallocate(int(f.Fd()), 0, fi.Size(), size-fi.Size())
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return f.Truncate(size)
+	}
+	return err
+}
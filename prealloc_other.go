@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// preallocate sets the size of f so segments can be written at their
+// offsets; without fallocate the space is only taken as they are written.
+func preallocate(f *os.File, size int64) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() >= size {
+		return nil
+	}
+	return f.Truncate(size)
+}
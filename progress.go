@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressReport describes where a transfer stands. Reports arrive after
+// every chunk moved and once more with done set when a file completes.
+type progressReport struct {
+	// path is the remote file being read or written.
+	path string
+	// bytes of path transferred so far, including bytes kept from an
+	// earlier attempt when resuming.
+	bytes int64
+	// total is the size of path, or -1 when unknown.
+	total int64
+	// files completed so far in this operation.
+	files int
+	// retries is how many times the operation reconnected or restarted a
+	// stalled transfer.
+	retries int
+	// done is set on the final report for path.
+	done bool
+}
+
+// progressReporter receives transfer progress; lineProgress draws it for
+// -progress. report may be called from several goroutines at once when a
+// call transfers files concurrently.
+type progressReporter interface {
+	report(progressReport)
+}
+
+// progressTracker accumulates the per-operation counters behind the reports
+// of one transfer call. A nil tracker reports nothing.
+type progressTracker struct {
+	r       progressReporter
+	mu      sync.Mutex
+	files   int
+	retries int
+}
+
+func newProgressTracker(r progressReporter) *progressTracker {
+	if r == nil {
+		return nil
+	}
+	return &progressTracker{r: r}
+}
+
+// retry counts a reconnect or stall restart.
+func (t *progressTracker) retry() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.retries++
+	t.mu.Unlock()
+}
+
+func (t *progressTracker) report(path string, bytes, total int64, done bool) {
+	t.mu.Lock()
+	if done {
+		t.files++
+	}
+	p := progressReport{path: path, bytes: bytes, total: total, files: t.files, retries: t.retries, done: done}
+	t.mu.Unlock()
+	t.r.report(p)
+}
+
+// reader wraps r, the data of path from byte done on, so every read is
+// reported.
+func (t *progressTracker) reader(path string, done, total int64, r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	t.report(path, done, total, false)
+	return &progressReader{r: r, t: t, path: path, bytes: done, total: total}
+}
+
+// finish sends the final report for path.
+func (t *progressTracker) finish(path string, bytes, total int64) {
+	if t == nil {
+		return
+	}
+	t.report(path, bytes, total, true)
+}
+
+// rangeReader returns a wrapper for the readers of several ranges of path
+// fetched at once, reporting their bytes together, from done on.
+func (t *progressTracker) rangeReader(path string, done, total int64) func(io.Reader) io.Reader {
+	if t == nil {
+		return func(r io.Reader) io.Reader { return r }
+	}
+	t.report(path, done, total, false)
+	bytes := new(atomic.Int64)
+	bytes.Store(done)
+	return func(r io.Reader) io.Reader {
+		return &rangeProgressReader{r: r, t: t, path: path, bytes: bytes, total: total}
+	}
+}
+
+type rangeProgressReader struct {
+	r     io.Reader
+	t     *progressTracker
+	path  string
+	bytes *atomic.Int64
+	total int64
+}
+
+func (p *rangeProgressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.t.report(p.path, p.bytes.Add(int64(n)), p.total, false)
+	}
+	return n, err
+}
+
+type progressReader struct {
+	r            io.Reader
+	t            *progressTracker
+	path         string
+	bytes, total int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.bytes += int64(n)
+		p.t.report(p.path, p.bytes, p.total, false)
+	}
+	return n, err
+}
+
+// lineProgress is the -progress display: one status line on w, redrawn at
+// most every interval and ended with a newline when a file completes.
+type lineProgress struct {
+	w        io.Writer
+	interval time.Duration
+	mu       sync.Mutex
+	last     time.Time
+	start    time.Time
+}
+
+func newLineProgress(w io.Writer) *lineProgress {
+	return &lineProgress{w: w, interval: 250 * time.Millisecond, start: time.Now()}
+}
+
+func (l *lineProgress) report(p progressReport) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if !p.done && now.Sub(l.last) < l.interval {
+		return
+	}
+	l.last = now
+	fmt.Fprintf(l.w, "\r\x1b[K%s", formatProgress(p, now.Sub(l.start)))
+	if p.done {
+		fmt.Fprintln(l.w)
+	}
+}
+
+// formatProgress renders p as "path  12.0 MiB / 40.0 MiB  30%  4.0 MiB/s".
+func formatProgress(p progressReport, elapsed time.Duration) string {
+	s := fmt.Sprintf("%s  %s", p.path, humanBytes(p.bytes))
+	if p.total >= 0 {
+		s += " / " + humanBytes(p.total)
+		if p.total > 0 {
+			s += fmt.Sprintf("  %d%%", p.bytes*100/p.total)
+		}
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		s += fmt.Sprintf("  %s/s", humanBytes(int64(float64(p.bytes)/secs)))
+	}
+	if p.retries > 0 {
+		s += fmt.Sprintf("  (%d retries)", p.retries)
+	}
+	return s
+}
+
+// progressFlag defines -progress.
+func progressFlag(fs *flag.FlagSet, opts *smbOptions) {
+	fs.BoolVar(&opts.progress, "progress", false, "Show a progress line on stderr")
+}
+
+// cliProgress returns the tracker for a command's transfers: a status line on
+// stderr with -progress, otherwise nil.
+func cliProgress(opts smbOptions) *progressTracker {
+	if !opts.progress {
+		return nil
+	}
+	return newProgressTracker(newLineProgress(os.Stderr))
+}
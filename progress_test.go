@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reportFunc adapts a function to progressReporter.
+type reportFunc func(progressReport)
+
+func (f reportFunc) report(p progressReport) { f(p) }
+
+func TestProgressTracker(t *testing.T) {
+	var reports []progressReport
+	tracker := newProgressTracker(reportFunc(func(p progressReport) { reports = append(reports, p) }))
+	tracker.retry()
+
+	r := tracker.reader("dir/a.bin", 4, 10, strings.NewReader("abcdef"))
+	if _, err := io.Copy(io.Discard, struct{ io.Reader }{r}); err != nil {
+		t.Fatal(err)
+	}
+	tracker.finish("dir/a.bin", 10, 10)
+
+	first, last := reports[0], reports[len(reports)-1]
+	if first.bytes != 4 || first.done {
+		t.Errorf("first report = %+v, want 4 resumed bytes", first)
+	}
+	want := progressReport{path: "dir/a.bin", bytes: 10, total: 10, files: 1, retries: 1, done: true}
+	if last != want {
+		t.Errorf("last report = %+v, want %+v", last, want)
+	}
+	for _, p := range reports[:len(reports)-1] {
+		if p.bytes > 10 || p.files != 0 {
+			t.Errorf("intermediate report %+v", p)
+		}
+	}
+}
+
+func TestNilProgressTracker(t *testing.T) {
+	tracker := newProgressTracker(nil)
+	src := strings.NewReader("x")
+	if r := tracker.reader("a", 0, 1, src); r != io.Reader(src) {
+		t.Fatal("nil tracker wrapped the reader")
+	}
+	tracker.retry()
+	tracker.finish("a", 1, 1)
+}
+
+func TestFormatProgress(t *testing.T) {
+	tests := []struct {
+		p    progressReport
+		want string
+	}{
+		{progressReport{path: "a.bin", bytes: 1 << 20, total: 4 << 20}, "a.bin  1.0 MiB / 4.0 MiB  25%  1.0 MiB/s"},
+		{progressReport{path: "a.bin", bytes: 2048, total: -1, retries: 2}, "a.bin  2.0 KiB  2.0 KiB/s  (2 retries)"},
+	}
+	for _, tt := range tests {
+		if got := formatProgress(tt.p, time.Second); got != tt.want {
+			t.Errorf("formatProgress(%+v) = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestLineProgressThrottles(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLineProgress(&buf)
+	l.interval = time.Hour
+	l.report(progressReport{path: "a", bytes: 1, total: 3})
+	l.report(progressReport{path: "a", bytes: 2, total: 3})
+	l.report(progressReport{path: "a", bytes: 3, total: 3, done: true})
+	out := buf.String()
+	if n := strings.Count(out, "\r"); n != 2 {
+		t.Fatalf("drew %d lines, want 2 (first and final):\n%q", n, out)
+	}
+	if !strings.HasSuffix(out, "\n") {
+		t.Fatalf("final report did not end the line: %q", out)
+	}
+}
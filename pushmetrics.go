@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// pushTimeout bounds a metrics push, so an unreachable gateway delays the
+// end of a run by seconds at most.
+const pushTimeout = 10 * time.Second
+
+// runSummary is what a one-shot run reports about itself.
+type runSummary struct {
+	command  string
+	success  bool
+	duration time.Duration
+	finished time.Time
+	ops      int64
+	read     int64
+	written  int64
+}
+
+func newRunSummary(command string, start time.Time, err error) runSummary {
+	ops, read, written := opStats.totals()
+	now := time.Now()
+	return runSummary{command: command, success: err == nil, duration: now.Sub(start), finished: now, ops: ops, read: read, written: written}
+}
+
+// writePrometheus emits the summary as gauges, followed by the operation
+// latencies.
+func (r runSummary) writePrometheus(w io.Writer) {
+	success := 0
+	if r.success {
+		success = 1
+	}
+	gauges := []struct {
+		name, help string
+		value      any
+	}{
+		{"smbput_last_run_success", "Whether the last run succeeded (1) or failed (0).", success},
+		{"smbput_last_run_timestamp_seconds", "When the last run finished, in Unix time.", r.finished.Unix()},
+		{"smbput_last_run_duration_seconds", "How long the last run took.", r.duration.Seconds()},
+		{"smbput_last_run_operations", "SMB operations the last run issued.", r.ops},
+		{"smbput_last_run_read_bytes", "File bytes the last run read from the server.", r.read},
+		{"smbput_last_run_written_bytes", "File bytes the last run wrote to the server.", r.written},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", g.name, g.help, g.name, g.name, g.value)
+	}
+	opStats.writePrometheus(w)
+}
+
+// writeStatsd emits the summary as statsd lines under smbput.COMMAND.
+func (r runSummary) writeStatsd(w io.Writer) {
+	prefix := "smbput." + r.command + "."
+	outcome := "failure"
+	if r.success {
+		outcome = "success"
+	}
+	fmt.Fprintf(w, "%sruns:1|c\n", prefix)
+	fmt.Fprintf(w, "%s%s:1|c\n", prefix, outcome)
+	fmt.Fprintf(w, "%sduration:%d|ms\n", prefix, r.duration.Milliseconds())
+	fmt.Fprintf(w, "%soperations:%d|c\n", prefix, r.ops)
+	fmt.Fprintf(w, "%sread_bytes:%d|c\n", prefix, r.read)
+	fmt.Fprintf(w, "%swritten_bytes:%d|c\n", prefix, r.written)
+}
+
+// pushMetrics sends the summary to target: a Pushgateway base URL
+// (http:// or https://), grouped under job smbput and the command name
+// unless the URL already names a /metrics/job/ path, or a statsd server
+// (statsd://HOST:PORT, over UDP).
+func pushMetrics(target string, r runSummary) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("push metrics: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if !strings.Contains(u.Path, "/metrics/job/") {
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/metrics/job/smbput/command/" + url.PathEscape(r.command)
+		}
+		var body bytes.Buffer
+		r.writePrometheus(&body)
+		req, err := http.NewRequest(http.MethodPut, u.String(), &body)
+		if err != nil {
+			return fmt.Errorf("push metrics: %w", err)
+		}
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+		resp, err := (&http.Client{Timeout: pushTimeout}).Do(req)
+		if err != nil {
+			return fmt.Errorf("push metrics: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("push metrics to %s: %s: %s", u.Host, resp.Status, strings.TrimSpace(string(msg)))
+		}
+		return nil
+	case "statsd":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "8125")
+		}
+		conn, err := net.DialTimeout("udp", u.Host, pushTimeout)
+		if err != nil {
+			return fmt.Errorf("push metrics: %w", err)
+		}
+		defer conn.Close()
+		var body bytes.Buffer
+		r.writeStatsd(&body)
+		if _, err := conn.Write(body.Bytes()); err != nil {
+			return fmt.Errorf("push metrics to %s: %w", u.Host, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("push metrics: %q: want an http(s):// Pushgateway or statsd://HOST:PORT", target)
+}
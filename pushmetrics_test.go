@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunSummaryFormats(t *testing.T) {
+	r := runSummary{command: "put", success: true, duration: 1500 * time.Millisecond, finished: time.Unix(1714564800, 0), ops: 12, written: 4096}
+	var prom bytes.Buffer
+	r.writePrometheus(&prom)
+	for _, want := range []string{
+		"# TYPE smbput_last_run_success gauge\nsmbput_last_run_success 1\n",
+		"smbput_last_run_timestamp_seconds 1714564800\n",
+		"smbput_last_run_duration_seconds 1.5\n",
+		"smbput_last_run_written_bytes 4096\n",
+		"# TYPE smbput_operation_duration_seconds summary",
+	} {
+		if !strings.Contains(prom.String(), want) {
+			t.Errorf("Prometheus output lacks %q:\n%s", want, prom.String())
+		}
+	}
+
+	r.success = false
+	var statsd bytes.Buffer
+	r.writeStatsd(&statsd)
+	want := "smbput.put.runs:1|c\nsmbput.put.failure:1|c\nsmbput.put.duration:1500|ms\nsmbput.put.operations:12|c\nsmbput.put.read_bytes:0|c\nsmbput.put.written_bytes:4096|c\n"
+	if statsd.String() != want {
+		t.Errorf("statsd output:\n%s\nwant\n%s", statsd.String(), want)
+	}
+}
+
+func TestPushMetricsPushgateway(t *testing.T) {
+	var method, path, body string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(data)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	r := newRunSummary("get", time.Now(), errors.New("boom"))
+	if err := pushMetrics(srv.URL+"/", r); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/smbput/command/get" || !strings.Contains(body, "smbput_last_run_success 0\n") {
+		t.Errorf("pushed %s %s:\n%s", method, path, body)
+	}
+	if err := pushMetrics(srv.URL+"/metrics/job/nightly/host/a", r); err != nil || path != "/metrics/job/nightly/host/a" {
+		t.Errorf("explicit grouping: %v, path %s", err, path)
+	}
+	status = http.StatusBadRequest
+	if err := pushMetrics(srv.URL, r); err == nil {
+		t.Error("no error for a rejected push")
+	}
+}
+
+func TestPushMetricsStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	if err := pushMetrics("statsd://"+conn.LocalAddr().String(), runSummary{command: "ls", success: true}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil || !strings.HasPrefix(string(buf[:n]), "smbput.ls.runs:1|c\nsmbput.ls.success:1|c\n") {
+		t.Errorf("received %q, %v", buf[:n], err)
+	}
+	if err := pushMetrics("ftp://x", runSummary{}); err == nil {
+		t.Error("no error for an unsupported scheme")
+	}
+}
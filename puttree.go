@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// treeUpload is a recursive put of a local directory. It survives
+// reconnects: files already finished, uploaded or failed for good, are not
+// sent again by the next run.
+type treeUpload struct {
+	local, remote string
+	items         []pipelineItem
+	// rels maps each item's local path to its path relative to local, for
+	// reporting.
+	rels map[string]string
+	// empty are remote directories no file lands in, created explicitly.
+	empty    []string
+	times    *dirTimes
+	skipped  int
+	finished map[string]bool
+	resumed  int
+	uploaded int
+	failed   int
+	bytes    int64
+	// deleteSource removes each local file once it is on the share, except
+	// those kept because of the overwrite policy.
+	deleteSource bool
+	removed      int
+	kept         map[string]bool
+}
+
+// scanTreeUpload lists what uploading localDir into remoteDir involves.
+// Only regular files are uploaded, and with allowSpecial, named pipes and
+// devices, read as streams; links, sockets, other special files, and files
+// the rules skip are reported to w and left out. Opening a pipe no one
+// writes to would wait forever, so special files are never read unasked.
+// Paths the filter excludes are left out silently.
+func scanTreeUpload(w io.Writer, localDir, remoteDir string, rules []transferRule, filter pathFilter, allowSpecial bool) (*treeUpload, error) {
+	t := &treeUpload{
+		local:    localDir,
+		remote:   normalizeRemotePath(remoteDir),
+		rels:     make(map[string]string),
+		times:    newDirTimes(),
+		finished: make(map[string]bool),
+		kept:     make(map[string]bool),
+	}
+	var dirs []string
+	err := filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && filter.excluded(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			dir := joinRemote(t.remote, rel)
+			dirs = append(dirs, dir)
+			t.times.record(dir, info.ModTime())
+		case !d.Type().IsRegular() && !(allowSpecial && isStreamable(d.Type())):
+			if isStreamable(d.Type()) {
+				fmt.Fprintf(w, "skipped  %s (%s; -allow-special uploads it)\n", rel, fileKind(info.Mode()))
+			} else {
+				fmt.Fprintf(w, "skipped  %s (%s)\n", rel, fileKind(info.Mode()))
+			}
+			t.skipped++
+		default:
+			rule := matchRule(rules, rel)
+			if rule.skip {
+				fmt.Fprintf(w, "skipped  %s (rule %s)\n", rel, rule.pattern)
+				t.skipped++
+				return nil
+			}
+			t.items = append(t.items, pipelineItem{
+				local:   p,
+				remote:  rule.remoteName(joinRemote(t.remote, rel)),
+				size:    info.Size(),
+				modTime: info.ModTime(),
+				rule:    rule,
+				special: !d.Type().IsRegular(),
+			})
+			t.rels[p] = rel
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", localDir, err)
+	}
+
+	// Uploading a file creates its directory and every parent, so only
+	// directories with no file below them need a mkdir of their own.
+	covered := make(map[string]bool)
+	for _, it := range t.items {
+		for dir := path.Dir(it.remote); !covered[dir]; dir = path.Dir(dir) {
+			covered[dir] = true
+			if dir == "." {
+				break
+			}
+		}
+	}
+	for _, dir := range dirs {
+		if !covered[dir] {
+			t.empty = append(t.empty, dir)
+		}
+	}
+	return t, nil
+}
+
+// fileKind names what a non-regular file is, for skip messages.
+func fileKind(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return "symbolic link"
+	case mode&fs.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeDevice != 0:
+		return "device"
+	}
+	return "not a regular file"
+}
+
+// allowSpecialFlag defines -allow-special.
+func allowSpecialFlag(fs *flag.FlagSet, opts *smbOptions) {
+	fs.BoolVar(&opts.allowSpecial, "allow-special", false, "Upload named pipes and devices by reading them as streams, instead of refusing them")
+}
+
+// isStreamable reports whether a non-regular file can still be read for
+// upload: named pipes and devices can, links and sockets cannot.
+func isStreamable(mode fs.FileMode) bool {
+	return mode&(fs.ModeNamedPipe|fs.ModeDevice) != 0
+}
+
+// skipUploaded marks finished the files that are unchanged on the share or
+// that an earlier, interrupted run already uploaded: those whose remote
+// copy carries the local modification time, which is only set once a file
+// is complete, and for files stored as they are, the local size.
+func (t *treeUpload) skipUploaded(share remoteFS) {
+	for _, it := range t.items {
+		fi, err := share.Stat(it.remote)
+		if err != nil || fi.IsDir() || !withinWindow(fi.ModTime(), it.modTime) {
+			continue
+		}
+		if !it.rule.transforms() && fi.Size() != it.size {
+			continue
+		}
+		t.finished[it.local] = true
+		t.resumed++
+	}
+}
+
+// applyOverwrite puts p into effect for the files not yet finished before
+// any is uploaded. Files whose destination is to be kept are reported as
+// skipped and, like those whose destination cannot be checked, which count
+// as failed, marked finished and kept locally. The destinations of the
+// others are backed up if p asks.
+func (t *treeUpload) applyOverwrite(share remoteFS, p overwritePolicy, w io.Writer) {
+	if !p.set() {
+		return
+	}
+	for _, it := range t.items {
+		if t.finished[it.local] {
+			continue
+		}
+		reason, err := p.prepareRemote(share, it.remote, it.modTime)
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "failed   %s: %v\n", t.rels[it.local], err)
+			t.failed++
+			t.finished[it.local] = true
+			t.kept[it.local] = true
+		case reason != "":
+			fmt.Fprintf(w, "skipped  %s (%s)\n", t.rels[it.local], reason)
+			t.skipped++
+			t.finished[it.local] = true
+			t.kept[it.local] = true
+		}
+	}
+}
+
+// run uploads the files not yet finished, jobs at a time, printing a line
+// to w for each. Files that fail because the connection dropped stay
+// pending and the connection error is returned, so a reconnect can retry
+// them; other failures are final.
+func (t *treeUpload) run(ctx context.Context, share remoteFS, w io.Writer, jobs int) error {
+	dirs := newRemoteDirs(share)
+	for _, dir := range t.empty {
+		if err := dirs.mkdirAll(dir); err != nil {
+			return err
+		}
+	}
+	var pending []pipelineItem
+	for _, it := range t.items {
+		if !t.finished[it.local] {
+			pending = append(pending, it)
+		}
+	}
+	var connErr error
+	err := uploadPipelined(ctx, share, pending, jobs, func(it pipelineItem, err error) {
+		rel := t.rels[it.local]
+		switch {
+		case err == nil:
+			fmt.Fprintf(w, "uploaded %s (%s)\n", rel, humanBytes(it.size))
+			t.uploaded++
+			t.bytes += it.size
+			t.removeSource(w, it)
+		case isConnectionError(err):
+			if connErr == nil {
+				connErr = err
+			}
+			return
+		case ctx.Err() != nil:
+			// Interrupted, not failed; a -resume run picks it up.
+			return
+		default:
+			fmt.Fprintf(w, "failed   %s: %v\n", rel, err)
+			t.failed++
+		}
+		t.finished[it.local] = true
+	})
+	if connErr != nil {
+		return connErr
+	}
+	if err != nil {
+		return err
+	}
+	// Directory times go last: every file written bumps its parent's.
+	if err := t.times.apply(share); err != nil {
+		log.Printf("warning: %v", err)
+	}
+	return nil
+}
+
+// removeSource deletes the local file of an item that is on the share, if
+// deleteSource is set. Named pipes and devices are left alone. A file that
+// cannot be removed counts as failed, though its upload went through.
+func (t *treeUpload) removeSource(w io.Writer, it pipelineItem) {
+	if !t.deleteSource || it.special || t.kept[it.local] {
+		return
+	}
+	if err := os.Remove(it.local); err != nil {
+		fmt.Fprintf(w, "failed   %s: uploaded, but %v\n", t.rels[it.local], err)
+		t.failed++
+		return
+	}
+	t.removed++
+}
+
+// summary reports the outcome, failing if any file could not be uploaded.
+func (t *treeUpload) summary(elapsed time.Duration) error {
+	fmt.Fprintf(os.Stderr, "uploaded %d files (%s) into %s in %s", t.uploaded, humanBytes(t.bytes), t.remote, elapsed.Round(time.Millisecond))
+	if t.resumed > 0 {
+		fmt.Fprintf(os.Stderr, ", %d already there", t.resumed)
+	}
+	if t.skipped > 0 {
+		fmt.Fprintf(os.Stderr, ", skipped %d", t.skipped)
+	}
+	if t.deleteSource {
+		fmt.Fprintf(os.Stderr, ", %d local files removed", t.removed)
+	}
+	if t.failed > 0 {
+		fmt.Fprintf(os.Stderr, ", %d failed", t.failed)
+	}
+	fmt.Fprintln(os.Stderr)
+	if t.failed > 0 {
+		return fmt.Errorf("%d of %d files failed", t.failed, len(t.items))
+	}
+	return nil
+}
+
+// putTree is put -r: it uploads the contents of the local directory into
+// the remote one.
+func putTree(ctx context.Context, opts smbOptions, args []string) error {
+	if len(args) != 2 {
+		return errors.New("-r takes one LOCAL_DIR and one REMOTE_DIR")
+	}
+	if opts.appendMode || opts.tmpDir != "" || opts.doneMarker != "" {
+		return errors.New("-r cannot be combined with -append, -tmp-dir, or -done-marker")
+	}
+	if info, err := os.Stat(args[0]); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", args[0])
+	}
+	target, err := parseRemoteTarget(args[1], opts.address, opts.share)
+	if err != nil {
+		return err
+	}
+	if opts.filter, err = withIgnoreFiles(args[0], opts.filter); err != nil {
+		return err
+	}
+	t, err := scanTreeUpload(os.Stdout, args[0], target.path, opts.rules, opts.filter, opts.allowSpecial)
+	if err != nil {
+		return err
+	}
+	if err := t.checkCollisions(os.Stdout, opts.renameClashes); err != nil {
+		return err
+	}
+	t.deleteSource = opts.deleteSource
+	if opts.verify {
+		for i := range t.items {
+			t.items[i].rule.verify = true
+		}
+	}
+	// With -verify every file is written and read back rather than taken
+	// to be unchanged by its size and time; -resume still trusts the
+	// files an earlier run completed.
+	skipUnchanged := opts.resume || !opts.ignoreTimes && !opts.verify
+	if opts.dryRun {
+		return withSessionReconnect(ctx, opts, func(shares *shareSet, resume bool) error {
+			share, err := shares.mount(target.share)
+			if err != nil {
+				return err
+			}
+			if skipUnchanged {
+				t.skipUploaded(shareFS(share))
+			}
+			t.applyOverwrite(dryRunFS(shareFS(share), true), opts.overwrite, os.Stdout)
+			n, bytes := t.preview(os.Stdout)
+			dryRunSummary(fmt.Sprintf("%d files to upload (%s)", n, humanBytes(bytes)))
+			return nil
+		})
+	}
+	start := time.Now()
+	first := true
+	err = withSessionReconnect(ctx, opts, func(shares *shareSet, resume bool) error {
+		share, err := shares.mount(target.share)
+		if err != nil {
+			return err
+		}
+		if first && skipUnchanged {
+			t.skipUploaded(shareFS(share))
+			for _, it := range t.items {
+				if t.finished[it.local] {
+					t.removeSource(os.Stdout, it)
+				}
+			}
+		}
+		if first {
+			t.applyOverwrite(shareFS(share), opts.overwrite, os.Stdout)
+		}
+		first = false
+		return t.run(ctx, shareFS(share), os.Stdout, opts.jobs)
+	})
+	if serr := t.summary(time.Since(start)); err == nil {
+		err = serr
+	}
+	return err
+}
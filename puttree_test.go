@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestScanTreeUpload(t *testing.T) {
+	local := writeTestTree(t, map[string]string{"a.txt": "a", "sub/b.log": "b", "sub/c.iso": "c"})
+	os.MkdirAll(filepath.Join(local, "empty", "deeper"), 0o755)
+	os.Symlink("a.txt", filepath.Join(local, "link"))
+	rules := []transferRule{{pattern: "*.iso", skip: true}, {pattern: "*.log", compress: true}}
+
+	var out bytes.Buffer
+	tu, err := scanTreeUpload(&out, local, "/dst/", rules, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var remotes []string
+	for _, it := range tu.items {
+		remotes = append(remotes, it.remote)
+	}
+	if strings.Join(remotes, " ") != "dst/a.txt dst/sub/b.log.zst" {
+		t.Errorf("items = %q", remotes)
+	}
+	if strings.Join(tu.empty, " ") != "dst/empty dst/empty/deeper" {
+		t.Errorf("empty dirs = %q", tu.empty)
+	}
+	if tu.skipped != 2 || !strings.Contains(out.String(), "skipped  link (symbolic link)") || !strings.Contains(out.String(), "skipped  sub/c.iso (rule *.iso)") {
+		t.Errorf("skipped %d:\n%s", tu.skipped, out.String())
+	}
+}
+
+func TestTreeUploadRun(t *testing.T) {
+	local := writeTestTree(t, map[string]string{"a.txt": "alpha", "sub/b.txt": "beta", "sub/c.txt": "gamma"})
+	os.Mkdir(filepath.Join(local, "empty"), 0o755)
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(local, "sub"), mtime, mtime)
+
+	var out bytes.Buffer
+	tu, err := scanTreeUpload(&out, local, "dst", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := newTestDirFS(t, nil)
+	// The first write of b.txt drops the connection; c.txt is refused.
+	dropped := false
+	share := interceptFS(fsys, func(op Op, next func() error) error {
+		switch {
+		case op.Name == "create" && op.Path == "dst/sub/b.txt" && !dropped:
+			dropped = true
+			return io.ErrUnexpectedEOF
+		case op.Name == "create" && op.Path == "dst/sub/c.txt":
+			return fmt.Errorf("access denied")
+		}
+		return next()
+	})
+
+	if err := tu.run(context.Background(), share, &out, 2); !isConnectionError(err) {
+		t.Fatalf("first run = %v, want the connection error", err)
+	}
+	if tu.uploaded != 1 || tu.failed != 1 || tu.finished[filepath.Join(local, "sub", "b.txt")] {
+		t.Fatalf("after drop: %d uploaded, %d failed, finished %v", tu.uploaded, tu.failed, tu.finished)
+	}
+	if err := tu.run(context.Background(), share, &out, 2); err != nil {
+		t.Fatal(err)
+	}
+	if tu.uploaded != 2 || tu.failed != 1 {
+		t.Errorf("after retry: %d uploaded, %d failed", tu.uploaded, tu.failed)
+	}
+	if got := readTestFile(t, fsys, "dst/sub/b.txt"); got != "beta" {
+		t.Errorf("b.txt = %q", got)
+	}
+	if fi, err := fsys.Stat("dst/empty"); err != nil || !fi.IsDir() {
+		t.Errorf("empty directory not created: %v", err)
+	}
+	if fi, err := fsys.Stat("dst/sub"); err != nil || !fi.ModTime().Equal(mtime) {
+		t.Errorf("dst/sub mtime not restored: %v", err)
+	}
+	if !strings.Contains(out.String(), "failed   sub/c.txt: ") || strings.Count(out.String(), "uploaded ") != 2 {
+		t.Errorf("output:\n%s", out.String())
+	}
+	if err := tu.summary(time.Second); err == nil || err.Error() != "1 of 3 files failed" {
+		t.Errorf("summary = %v", err)
+	}
+}
+
+func TestTreeUploadSkipUploaded(t *testing.T) {
+	local := writeTestTree(t, map[string]string{"done.txt": "done", "partial.txt": "partial", "touched.txt": "same"})
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{"done.txt", "partial.txt", "touched.txt"} {
+		os.Chtimes(filepath.Join(local, name), mtime, mtime)
+	}
+	fsys := newTestDirFS(t, map[string]string{"dst/done.txt": "done", "dst/partial.txt": "par", "dst/touched.txt": "same"})
+	fsys.Chtimes("dst/done.txt", mtime, mtime)
+	fsys.Chtimes("dst/partial.txt", mtime, mtime)
+
+	tu, err := scanTreeUpload(io.Discard, local, "dst", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.skipUploaded(fsys)
+	if tu.resumed != 1 || !tu.finished[filepath.Join(local, "done.txt")] {
+		t.Errorf("resumed %d, finished %v; want only done.txt", tu.resumed, tu.finished)
+	}
+}
+
+func TestTreeUploadDeleteSource(t *testing.T) {
+	local := writeTestTree(t, map[string]string{"a.txt": "alpha", "sub/b.txt": "beta"})
+	tu, err := scanTreeUpload(io.Discard, local, "dst", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.deleteSource = true
+	fsys := newTestDirFS(t, nil)
+	share := interceptFS(fsys, func(op Op, next func() error) error {
+		if op.Name == "create" && op.Path == "dst/sub/b.txt" {
+			return fmt.Errorf("access denied")
+		}
+		return next()
+	})
+	var out bytes.Buffer
+	if err := tu.run(context.Background(), share, &out, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(local, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("a.txt kept after upload: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(local, "sub", "b.txt")); err != nil {
+		t.Errorf("b.txt removed though its upload failed: %v", err)
+	}
+	if got := readTestFile(t, fsys, "dst/a.txt"); got != "alpha" {
+		t.Errorf("a.txt = %q", got)
+	}
+	if tu.removed != 1 || tu.failed != 1 {
+		t.Errorf("removed %d, failed %d", tu.removed, tu.failed)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestScanTreeUploadSpecialFiles(t *testing.T) {
+	local := writeTestTree(t, map[string]string{"a.txt": "a"})
+	fifo := filepath.Join(local, "pipe")
+	if err := syscall.Mkfifo(fifo, 0o644); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+
+	var out bytes.Buffer
+	tu, err := scanTreeUpload(&out, local, "dst", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tu.items) != 1 || !strings.Contains(out.String(), "skipped  pipe (named pipe; -allow-special uploads it)") {
+		t.Errorf("items %v, output:\n%s", tu.items, out.String())
+	}
+
+	tu, err = scanTreeUpload(&out, local, "dst", nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tu.items) != 2 || !tu.items[1].special {
+		t.Fatalf("items with -allow-special: %+v", tu.items)
+	}
+	go func() {
+		f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		f.WriteString("streamed")
+		f.Close()
+	}()
+	fsys := newTestDirFS(t, nil)
+	if err := tu.run(context.Background(), fsys, &out, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, fsys, "dst/pipe"); got != "streamed" {
+		t.Errorf("dst/pipe = %q", got)
+	}
+}
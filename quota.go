@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// userQuota is the caller's quota on a share. Servers with NTFS quotas (and
+// Samba with quota support) report the volume to a user as if it were only
+// as large as their limit, so a limit shows up as less space available to
+// the caller than is free on the volume. A quota whose remainder exceeds the
+// volume's free space cannot be told apart from no quota, but then the
+// volume fills first anyway.
+type userQuota struct {
+	User      string `json:"user"`
+	Share     string `json:"share"`
+	Limited   bool   `json:"limited"`
+	Limit     int64  `json:"limit,omitempty"`
+	Used      int64  `json:"used,omitempty"`
+	Remaining int64  `json:"remaining"`
+	// VolumeFree is the free space on the volume regardless of quota.
+	VolumeFree int64 `json:"volume_free"`
+}
+
+func quotaFromSpace(s shareSpace, user string) userQuota {
+	q := userQuota{User: user, Share: s.Share, Remaining: s.Available, VolumeFree: s.Free}
+	if s.Available < s.Free {
+		q.Limited = true
+		q.Limit = s.Total
+		q.Used = s.Total - s.Available
+	}
+	return q
+}
+
+// sameUser reports whether name refers to the logged-in user, ignoring case
+// and a DOMAIN\ prefix on either side.
+func sameUser(name, user string) bool {
+	strip := func(s string) string {
+		if i := strings.LastIndexByte(s, '\\'); i >= 0 {
+			s = s[i+1:]
+		}
+		return s
+	}
+	return strings.EqualFold(strip(name), strip(user))
+}
+
+func writeUserQuota(w io.Writer, q userQuota, human bool) {
+	size := func(n int64) string {
+		if human {
+			return humanBytes(n)
+		}
+		return strconv.FormatInt(n, 10)
+	}
+	if !q.Limited {
+		fmt.Fprintf(w, "no quota limits %s on %s (%s free on the volume)\n", q.User, q.Share, size(q.VolumeFree))
+		return
+	}
+	fmt.Fprintf(w, "%-20s %-20s %14s %14s %14s\n", "User", "Share", "Limit", "Used", "Remaining")
+	fmt.Fprintf(w, "%-20s %-20s %14s %14s %14s\n", q.User, q.Share, size(q.Limit), size(q.Used), size(q.Remaining))
+}
+
+// quotaRemote prints the quota of user, which must be the logged-in user:
+// reading another user's quota entries takes a QUERY_INFO request go-smb2
+// does not expose.
+func quotaRemote(share *smb2.Share, w io.Writer, shareName, loginUser, user string, human, asJSON bool) error {
+	if user != "" && !sameUser(user, loginUser) {
+		return fmt.Errorf("cannot query the quota of %s: only the logged-in user's (%s) quota is visible over this SMB client", user, loginUser)
+	}
+	s, err := statShareSpace(share, shareName, ".")
+	if err != nil {
+		return err
+	}
+	q := quotaFromSpace(s, loginUser)
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(withSchema("quota", q))
+	}
+	writeUserQuota(w, q, human)
+	return nil
+}
+
+// checkUploadRoom fails when need bytes will not fit in the space left to
+// the caller, naming the quota when one is in effect, so an upload stops
+// before it starts rather than dying part way with a disk-full error.
+// Servers that do not answer the size query are not checked.
+func checkUploadRoom(share *smb2.Share, shareName, user string, need int64) error {
+	if need <= 0 {
+		return nil
+	}
+	s, err := statShareSpace(share, shareName, ".")
+	if err != nil {
+		return nil
+	}
+	if need <= s.Available {
+		return nil
+	}
+	q := quotaFromSpace(s, user)
+	if q.Limited {
+		return fmt.Errorf("upload needs %s but %s has only %s left of a %s quota on %s", humanBytes(need), user, humanBytes(q.Remaining), humanBytes(q.Limit), shareName)
+	}
+	return fmt.Errorf("upload needs %s but only %s is free on %s", humanBytes(need), humanBytes(s.Available), shareName)
+}
+
+// checkTargetsRoom runs checkUploadRoom for every destination of a put of
+// size bytes. Bytes already at a destination count towards the upload,
+// since a replaced file's space is released first, unless keepsOld: when
+// appending, or when staging in -tmp-dir, the old file stays until the new
+// bytes are written.
+func checkTargetsRoom(shares *shareSet, targets []remoteTarget, user string, size int64, keepsOld bool) error {
+	for _, t := range targets {
+		share, err := shares.mount(t.share)
+		if err != nil {
+			return err
+		}
+		need := size
+		if !keepsOld {
+			if fi, err := share.Stat(normalizeRemotePath(t.path)); err == nil && !fi.IsDir() {
+				need -= fi.Size()
+			}
+		}
+		if err := checkUploadRoom(share, t.share, user, need); err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+	}
+	return nil
+}
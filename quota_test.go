@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestQuotaFromSpace(t *testing.T) {
+	tests := []struct {
+		name  string
+		space shareSpace
+		want  userQuota
+	}{
+		{
+			name:  "no quota",
+			space: shareSpace{Share: "drop", Total: 1000, Free: 400, Available: 400},
+			want:  userQuota{User: "alice", Share: "drop", Remaining: 400, VolumeFree: 400},
+		},
+		{
+			name:  "quota below free space",
+			space: shareSpace{Share: "home", Total: 100, Free: 400, Available: 30},
+			want:  userQuota{User: "alice", Share: "home", Limited: true, Limit: 100, Used: 70, Remaining: 30, VolumeFree: 400},
+		},
+	}
+	for _, tt := range tests {
+		if got := quotaFromSpace(tt.space, "alice"); got != tt.want {
+			t.Errorf("%s: quotaFromSpace = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSameUser(t *testing.T) {
+	tests := []struct {
+		name, user string
+		want       bool
+	}{
+		{"alice", "alice", true},
+		{"ALICE", "alice", true},
+		{`CORP\alice`, "alice", true},
+		{"alice", `CORP\alice`, true},
+		{"bob", "alice", false},
+	}
+	for _, tt := range tests {
+		if got := sameUser(tt.name, tt.user); got != tt.want {
+			t.Errorf("sameUser(%q, %q) = %v, want %v", tt.name, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestWriteUserQuota(t *testing.T) {
+	var buf bytes.Buffer
+	writeUserQuota(&buf, userQuota{User: "alice", Share: "home", Limited: true, Limit: 10 << 30, Used: 9 << 30, Remaining: 1 << 30}, true)
+	if out := buf.String(); !strings.Contains(out, "10.0 GiB") || !strings.Contains(out, "1.0 GiB") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+
+	buf.Reset()
+	writeUserQuota(&buf, userQuota{User: "alice", Share: "drop", VolumeFree: 2048}, false)
+	if out := buf.String(); !strings.HasPrefix(out, "no quota limits alice on drop") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
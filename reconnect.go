@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// withReconnect mounts the share and runs fn. When the connection drops or
+// the transfer stalls, it dials a fresh session and calls fn again with resume set,
+// so the transfer continues from the bytes already written instead of
+// restarting the file.
+//
+// go-smb2 does not expose durable or persistent handle create contexts, so
+// the open handle itself cannot survive the reconnect; reopening the file and
+// seeking to the previous position is the closest equivalent available.
+func withReconnect(ctx context.Context, opts smbOptions, fn func(share *smb2.Share, resume bool) error) error {
+	return withSessionReconnect(ctx, opts, func(shares *shareSet, resume bool) error {
+		share, err := shares.mount(opts.share)
+		if err != nil {
+			return err
+		}
+		return fn(share, resume)
+	})
+}
+
+// reconnectBackoff is the wait before the first reconnect; it doubles with
+// each further attempt, up to maxReconnectBackoff.
+const (
+	reconnectBackoff    = time.Second
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// withSessionReconnect is withReconnect for commands that mount several
+// shares on the session themselves.
+func withSessionReconnect(ctx context.Context, opts smbOptions, fn func(shares *shareSet, resume bool) error) error {
+	open := func() (*shareSet, func(), error) { return openShareSet(opts) }
+	return reconnectLoop(ctx, opts.reconnects, reconnectBackoff, open, opts.session.drop, fn)
+}
+
+// reconnectLoop runs fn on the shares from open, opening them again and
+// resuming fn after a dropped connection or a stall, up to reconnects times.
+// A failed open on one of those attempts, as while the network is still
+// down, uses up an attempt too. Attempts are spaced backoff apart, twice as
+// long each time. drop discards a shared session whose connection was lost.
+func reconnectLoop(ctx context.Context, reconnects int, backoff time.Duration, open func() (*shareSet, func(), error), drop func(), fn func(shares *shareSet, resume bool) error) error {
+	resume := false
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, maxReconnectBackoff)
+		}
+		shares, cleanup, err := open()
+		if err != nil {
+			if !resume || ctx.Err() != nil || attempt >= reconnects {
+				return err
+			}
+			log.Printf("reconnect failed (%v), trying again (%d/%d)", err, attempt+1, reconnects)
+			continue
+		}
+		err = fn(shares, resume)
+		cleanup()
+		retryable := isConnectionError(err) || errors.Is(err, errStalled)
+		if err == nil || ctx.Err() != nil || !retryable || attempt >= reconnects {
+			return err
+		}
+		if isConnectionError(err) {
+			drop()
+		}
+		if errors.Is(err, errStalled) {
+			log.Printf("transfer stalled (%v), retrying on a fresh handle (%d/%d)", err, attempt+1, reconnects)
+		} else {
+			log.Printf("connection lost (%v), reconnecting (%d/%d)", err, attempt+1, reconnects)
+		}
+		resume = true
+	}
+}
+
+// isConnectionError reports whether err was caused by the transport rather
+// than by the server rejecting the operation.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var transportErr *smb2.TransportError
+	if errors.As(err, &transportErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"transport", &smb2.TransportError{Err: io.EOF}, true},
+		{"wrapped transport", fmt.Errorf("copy: %w", &os.PathError{Op: "read", Path: "a", Err: &smb2.TransportError{Err: io.EOF}}), true},
+		{"net op", &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, true},
+		{"unexpected eof", fmt.Errorf("copy: %w", io.ErrUnexpectedEOF), true},
+		{"not found", &os.PathError{Op: "open", Path: "a", Err: os.ErrNotExist}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isConnectionError(tc.err); got != tc.want {
+				t.Fatalf("isConnectionError(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReconnectLoopRetriesFailedDials(t *testing.T) {
+	lost := &smb2.TransportError{Err: io.EOF}
+	var opens, runs int
+	dialErrs := []error{nil, errors.New("dial tcp: connection refused"), errors.New("dial tcp: connection refused"), nil}
+	open := func() (*shareSet, func(), error) {
+		err := dialErrs[opens]
+		opens++
+		return &shareSet{}, func() {}, err
+	}
+	err := reconnectLoop(context.Background(), 3, time.Millisecond, open, func() {}, func(shares *shareSet, resume bool) error {
+		runs++
+		if runs == 1 {
+			return lost
+		}
+		if !resume {
+			t.Error("second run not resumed")
+		}
+		return nil
+	})
+	if err != nil || opens != 4 || runs != 2 {
+		t.Fatalf("err = %v after %d opens and %d runs, want nil after 4 and 2", err, opens, runs)
+	}
+
+	// Failed dials count against the budget.
+	opens = 0
+	err = reconnectLoop(context.Background(), 2, time.Millisecond, func() (*shareSet, func(), error) {
+		opens++
+		if opens > 1 {
+			return nil, nil, errors.New("dial tcp: connection refused")
+		}
+		return &shareSet{}, func() {}, nil
+	}, func() {}, func(*shareSet, bool) error { return lost })
+	if err == nil || opens != 3 {
+		t.Fatalf("err = %v after %d opens, want a dial error after 3", err, opens)
+	}
+
+	// The first dial is not retried: nothing was under way yet.
+	opens = 0
+	dialErr := errors.New("logon failure")
+	err = reconnectLoop(context.Background(), 3, time.Millisecond, func() (*shareSet, func(), error) {
+		opens++
+		return nil, nil, dialErr
+	}, func() {}, func(*shareSet, bool) error { return nil })
+	if err != dialErr || opens != 1 {
+		t.Fatalf("err = %v after %d opens, want %v after 1", err, opens, dialErr)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshTarget is a file on an SSH host, written ssh://[USER@]HOST[:PORT]/PATH.
+type sshTarget struct {
+	user string
+	addr string
+	path string
+}
+
+// isSSHURL reports whether s names a file on an SSH host. scp:// and sftp://
+// count too, so that parseSSHURL can reject them with a clear error rather
+// than taking them for share paths.
+func isSSHURL(s string) bool {
+	for _, scheme := range []string{"ssh://", "scp://", "sftp://"} {
+		if strings.HasPrefix(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSSHURL(s string) (sshTarget, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return sshTarget{}, fmt.Errorf("parse %s: %w", s, err)
+	}
+	if u.Scheme != "ssh" {
+		// Data moves by running cat over an exec channel, which SFTP-only
+		// and chrooted servers do not allow.
+		return sshTarget{}, fmt.Errorf("%s: relay speaks neither SCP nor SFTP, only ssh:// to a host with a shell", s)
+	}
+	if u.Hostname() == "" {
+		return sshTarget{}, fmt.Errorf("%s: URL names no host", s)
+	}
+	p := u.Path
+	if strings.HasPrefix(p, "/~/") {
+		p = p[3:] // relative to the login directory
+	}
+	if p == "" || p == "/" {
+		return sshTarget{}, fmt.Errorf("%s: URL names no file", s)
+	}
+	t := sshTarget{user: u.User.Username(), addr: u.Host, path: p}
+	if t.user == "" {
+		t.user = os.Getenv("USER")
+	}
+	if u.Port() == "" {
+		t.addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	return t, nil
+}
+
+// shellQuote quotes s for a POSIX shell on the SSH host.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// dialSSH authenticates with the SSH agent and the default key files, and
+// checks the host key against ~/.ssh/known_hosts.
+func dialSSH(t sshTarget, timeout time.Duration) (*ssh.Client, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("load known_hosts: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			defer conn.Close()
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(key); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("no SSH agent or unencrypted key in ~/.ssh to authenticate with")
+	}
+
+	client, err := ssh.Dial("tcp", t.addr, &ssh.ClientConfig{
+		User:            t.user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ssh %s@%s: %w", t.user, t.addr, err)
+	}
+	return client, nil
+}
+
+// relaySSHToSMB streams a file from the SSH host into remote on the share.
+func relaySSHToSMB(ctx context.Context, client *ssh.Client, src sshTarget, share *smb2.Share, remote string) (int64, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := session.Start("cat -- " + shellQuote(src.path)); err != nil {
+		return 0, fmt.Errorf("read %s: %w", src.path, err)
+	}
+
+	remote = normalizeRemotePath(remote)
+	if dir := path.Dir(remote); dir != "." {
+		share.MkdirAll(dir, 0o755)
+	}
+	start := time.Now()
+	dst, err := share.Create(remote)
+	opStats.observe("create", start)
+	if err != nil {
+		return 0, fmt.Errorf("create remote %s: %w", remote, err)
+	}
+	defer dst.Close()
+
+	n, err := copyChunked(timedWriter{dst, "write"}, ctxReader{ctx, stdout})
+	if err != nil {
+		return n, fmt.Errorf("copy %s -> %s: %w", src.path, remote, err)
+	}
+	if err := session.Wait(); err != nil {
+		return n, fmt.Errorf("read %s: %w", src.path, err)
+	}
+	return n, dst.Close()
+}
+
+// relaySMBToSSH streams remote from the share into a file on the SSH host.
+func relaySMBToSSH(ctx context.Context, share *smb2.Share, remote string, client *ssh.Client, dst sshTarget) (int64, error) {
+	remote = normalizeRemotePath(remote)
+	start := time.Now()
+	src, err := share.Open(remote)
+	opStats.observe("open", start)
+	if err != nil {
+		return 0, fmt.Errorf("open remote %s: %w", remote, err)
+	}
+	defer src.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := session.Start("cat > " + shellQuote(dst.path)); err != nil {
+		return 0, fmt.Errorf("write %s: %w", dst.path, err)
+	}
+
+	n, err := copyChunked(stdin, ctxReader{ctx, timedReader{src, "read"}})
+	if err != nil {
+		return n, fmt.Errorf("copy %s -> %s: %w", remote, dst.path, err)
+	}
+	stdin.Close()
+	if err := session.Wait(); err != nil {
+		return n, fmt.Errorf("write %s: %w", dst.path, err)
+	}
+	return n, nil
+}
+
+// relay moves one file between an SSH host and the share in a single
+// streaming hop: exactly one of src and dst must be an ssh:// URL, the other
+// an smb:// URL or a path on -share.
+func relay(ctx context.Context, opts smbOptions, src, dst string) error {
+	fromSSH := isSSHURL(src)
+	if fromSSH == isSSHURL(dst) {
+		return errors.New("relay needs exactly one ssh:// URL")
+	}
+	sshArg, smbArg := src, dst
+	if !fromSSH {
+		sshArg, smbArg = dst, src
+	}
+	st, err := parseSSHURL(sshArg)
+	if err != nil {
+		return err
+	}
+	target, err := parseRemoteTarget(smbArg, opts.address, opts.share)
+	if err != nil {
+		return err
+	}
+
+	client, err := dialSSH(st, opts.timeout)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	shares, cleanup, err := openShareSet(opts)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer cleanup()
+	share, err := shares.mount(target.share)
+	if err != nil {
+		return err
+	}
+
+	var n int64
+	if fromSSH {
+		n, err = relaySSHToSMB(ctx, client, st, share, target.path)
+	} else {
+		n, err = relaySMBToSSH(ctx, share, target.path, client, st)
+	}
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "relayed %s\n", humanBytes(n))
+	}
+	return err
+}
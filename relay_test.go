@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestParseSSHURL(t *testing.T) {
+	t.Setenv("USER", "me")
+	tests := []struct {
+		in      string
+		want    sshTarget
+		wantErr bool
+	}{
+		{"ssh://bastion/var/log/app.log", sshTarget{"me", "bastion:22", "/var/log/app.log"}, false},
+		{"ssh://ops@bastion:2222/data/x.tar", sshTarget{"ops", "bastion:2222", "/data/x.tar"}, false},
+		{"ssh://bastion/~/exports/a.csv", sshTarget{"me", "bastion:22", "exports/a.csv"}, false},
+		{"sftp://ops@bastion/data/x.tar", sshTarget{}, true},
+		{"scp://bastion/~/exports/a.csv", sshTarget{}, true},
+		{"ssh://bastion/", sshTarget{}, true},
+		{"ssh:///x", sshTarget{}, true},
+	}
+	for _, tc := range tests {
+		got, err := parseSSHURL(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseSSHURL(%q) = %+v, want error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseSSHURL(%q) = %+v, %v; want %+v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := shellQuote("it's here/a b"); got != `'it'\''s here/a b'` {
+		t.Fatalf("shellQuote = %s", got)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// remoteFile is the part of *smb2.File that transfer code uses. *os.File
+// satisfies it too.
+type remoteFile interface {
+	io.Reader
+	io.ReaderAt
+	io.ReaderFrom
+	io.Writer
+	io.WriterAt
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+}
+
+// remoteFS is the part of *smb2.Share that share-side logic needs, with
+// slash-separated paths relative to the share root. Code written against it
+// can be tested with dirFS instead of a Samba container.
+type remoteFS interface {
+	Open(name string) (remoteFile, error)
+	Create(name string) (remoteFile, error)
+	OpenFile(name string, flag int, perm os.FileMode) (remoteFile, error)
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Mkdir(name string, perm os.FileMode) error
+	MkdirAll(name string, perm os.FileMode) error
+	Remove(name string) error
+	Rename(oldname, newname string) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// smbFS adapts a mounted share to remoteFS; only the methods returning files
+// need wrapping.
+type smbFS struct {
+	*smb2.Share
+}
+
+var (
+	_ remoteFS = smbFS{}
+	_ remoteFS = dirFS{}
+)
+
+// shareFS returns share as a remoteFS.
+func shareFS(share *smb2.Share) remoteFS { return smbFS{share} }
+
+func (s smbFS) Open(name string) (remoteFile, error) { return wrapFile(s.Share.Open(name)) }
+
+func (s smbFS) Create(name string) (remoteFile, error) { return wrapFile(s.Share.Create(name)) }
+
+func (s smbFS) OpenFile(name string, flag int, perm os.FileMode) (remoteFile, error) {
+	return wrapFile(s.Share.OpenFile(name, flag, perm))
+}
+
+// wrapFile keeps a nil *smb2.File from becoming a non-nil interface.
+func wrapFile(f *smb2.File, err error) (remoteFile, error) {
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// dirFS is a remoteFS backed by a local directory, for tests that should not
+// need an SMB server. Paths may not escape the root.
+type dirFS struct {
+	root string
+}
+
+func newDirFS(root string) dirFS { return dirFS{root: root} }
+
+// path maps a share path to the local file system, rejecting names that
+// would leave the root the way the server would.
+func (d dirFS) path(op, name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	clean := path.Clean(slashed)
+	if path.IsAbs(slashed) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", &os.PathError{Op: op, Path: name, Err: os.ErrInvalid}
+	}
+	return filepath.Join(d.root, filepath.FromSlash(clean)), nil
+}
+
+func (d dirFS) Open(name string) (remoteFile, error) {
+	return d.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (d dirFS) Create(name string) (remoteFile, error) {
+	return d.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (d dirFS) OpenFile(name string, flag int, perm os.FileMode) (remoteFile, error) {
+	p, err := d.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(p, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (d dirFS) Stat(name string) (os.FileInfo, error) {
+	p, err := d.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+func (d dirFS) Lstat(name string) (os.FileInfo, error) {
+	p, err := d.path("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(p)
+}
+
+func (d dirFS) ReadDir(name string) ([]os.FileInfo, error) {
+	p, err := d.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		fi, err := e.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // removed since the listing
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, fi)
+	}
+	return infos, nil
+}
+
+func (d dirFS) Mkdir(name string, perm os.FileMode) error {
+	p, err := d.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(p, perm)
+}
+
+func (d dirFS) MkdirAll(name string, perm os.FileMode) error {
+	p, err := d.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, perm)
+}
+
+// Remove deletes a file or an empty directory, as SMB does.
+func (d dirFS) Remove(name string) error {
+	p, err := d.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func (d dirFS) Rename(oldname, newname string) error {
+	from, err := d.path("rename", oldname)
+	if err != nil {
+		return err
+	}
+	to, err := d.path("rename", newname)
+	if err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+func (d dirFS) Chtimes(name string, atime, mtime time.Time) error {
+	p, err := d.path("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(p, atime, mtime)
+}
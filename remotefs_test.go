@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func newTestDirFS(t *testing.T, files map[string]string) dirFS {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newDirFS(root)
+}
+
+func readTestFile(t *testing.T, fsys dirFS, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(fsys.root, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDirFSRejectsEscapingPaths(t *testing.T) {
+	fsys := newTestDirFS(t, nil)
+	for _, name := range []string{"../outside", "a/../../outside", "/etc/passwd", `..\outside`} {
+		if _, err := fsys.Stat(name); !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("Stat(%q) = %v, want an invalid path error", name, err)
+		}
+	}
+	if _, err := fsys.Stat("."); err != nil {
+		t.Errorf("Stat(.) = %v", err)
+	}
+}
+
+func TestCopyRemote(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"a.txt": "hello", "b.txt": "old", "dir/keep": ""})
+
+	if n, err := copyRemote(fsys, "a.txt", "c.txt", false); err != nil || n != 5 {
+		t.Fatalf("copyRemote = %d, %v", n, err)
+	}
+	if got := readTestFile(t, fsys, "c.txt"); got != "hello" {
+		t.Fatalf("c.txt = %q", got)
+	}
+	if _, err := copyRemote(fsys, "a.txt", "b.txt", false); err == nil {
+		t.Fatal("expected error copying over an existing file without force")
+	}
+	if _, err := copyRemote(fsys, "a.txt", "b.txt", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, fsys, "b.txt"); got != "hello" {
+		t.Fatalf("b.txt = %q after forced copy", got)
+	}
+	if _, err := copyRemote(fsys, "a.txt", "dir", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, fsys, "dir/a.txt"); got != "hello" {
+		t.Fatalf("dir/a.txt = %q", got)
+	}
+	if _, err := copyRemote(fsys, "dir", "x", false); err == nil {
+		t.Fatal("expected error copying a directory")
+	}
+}
+
+func TestMoveRemote(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+	if err := moveRemote(fsys, "a.txt", "b.txt", false); err == nil {
+		t.Fatal("expected error moving over an existing file without force")
+	}
+	if err := moveRemote(fsys, "a.txt", "b.txt", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, fsys, "b.txt"); got != "a" {
+		t.Fatalf("b.txt = %q", got)
+	}
+	if _, err := fsys.Stat("a.txt"); !os.IsNotExist(err) {
+		t.Fatalf("a.txt still exists: %v", err)
+	}
+}
+
+func TestRemoteDirsAndRemove(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"tree/a/x.txt": "x", "tree/b.txt": "b"})
+
+	if err := makeRemoteDir(fsys, "empty/nested", false); err == nil {
+		t.Fatal("expected error creating a directory without its parent")
+	}
+	if err := makeRemoteDir(fsys, "empty/nested", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeRemoteDir(fsys, "empty"); err == nil {
+		t.Fatal("expected error removing a non-empty directory")
+	}
+	if err := removeRemoteDir(fsys, "empty/nested"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := removeRemote(fsys, "tree", false, 1); err == nil {
+		t.Fatal("expected error removing a directory without -r")
+	}
+	n, err := removeRemote(fsys, "tree", true, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatalf("removed %d entries, want 4", n)
+	}
+	if _, err := removeRemote(fsys, ".", true, 1); err == nil {
+		t.Fatal("expected refusal to remove the share root")
+	}
+}
+
+func TestRemoveRemoteConcurrent(t *testing.T) {
+	files := map[string]string{}
+	for i := range 20 {
+		files[fmt.Sprintf("tree/d%d/sub/f%d", i%4, i)] = "x"
+		files[fmt.Sprintf("tree/f%d", i)] = "x"
+	}
+	var (
+		mu             sync.Mutex
+		inFlight, most int
+	)
+	fsys := interceptFS(newTestDirFS(t, files), func(op Op, next func() error) error {
+		mu.Lock()
+		inFlight++
+		most = max(most, inFlight)
+		mu.Unlock()
+		err := next()
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return err
+	})
+	// dirFS refuses to remove a directory that is not empty, so success
+	// means every directory went after its contents.
+	n, err := removeRemote(fsys, "tree", true, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 40 + 4 + 4 + 1; n != want {
+		t.Errorf("removed %d entries, want %d", n, want)
+	}
+	if most > 3 {
+		t.Errorf("%d requests in flight, want at most 3", most)
+	}
+}
+
+func TestWalkRemote(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"data/a.txt": "", "data/logs/x.log": "", "data/logs/old/y.log": ""})
+	var got []string
+	err := walkRemote(fsys, "data", func(p string, fi os.FileInfo) error {
+		got = append(got, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"data/a.txt", "data/logs", "data/logs/old", "data/logs/old/y.log", "data/logs/x.log"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("walked %v, want %v", got, want)
+	}
+}
+
+// junctionFS lists the local symlinks at the given paths as go-smb2 lists a
+// junction or directory symlink: a directory carrying the link bit.
+type junctionFS struct {
+	dirFS
+	links map[string]bool
+}
+
+func (j junctionFS) Lstat(name string) (os.FileInfo, error) {
+	if j.links[name] {
+		return testLinkInfo(path.Base(name), true), nil
+	}
+	return j.dirFS.Lstat(name)
+}
+
+func (j junctionFS) ReadDir(name string) ([]os.FileInfo, error) {
+	if j.links[name] {
+		return nil, fmt.Errorf("readdir %s: listed through a link", name)
+	}
+	entries, err := j.dirFS.ReadDir(name)
+	for i, fi := range entries {
+		if j.links[joinRemote(name, fi.Name())] {
+			entries[i] = testLinkInfo(fi.Name(), true)
+		}
+	}
+	return entries, err
+}
+
+func TestRemoveRemoteLeavesLinkTargets(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"tree/a.txt": "a", "outside/keep.txt": "k"})
+	for _, link := range []string{"tree/link", "top"} {
+		if err := os.Symlink(filepath.Join(fsys.root, "outside"), filepath.Join(fsys.root, link)); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+	share := junctionFS{fsys, map[string]bool{"tree/link": true, "top": true}}
+	if fi, _ := share.Lstat("top"); !fi.IsDir() || !isLink(fi) {
+		t.Fatalf("test link has mode %v, want a directory link", fi.Mode())
+	}
+
+	n, err := removeRemote(share, "tree", true, 2)
+	if err != nil || n != 3 {
+		t.Fatalf("rm -r tree = %d, %v; want 3 entries removed", n, err)
+	}
+	if n, err := removeRemote(share, "top", false, 1); err != nil || n != 1 {
+		t.Fatalf("rm top = %d, %v; want the link removed", n, err)
+	}
+	if got := readTestFile(t, fsys, "outside/keep.txt"); got != "k" {
+		t.Fatalf("link target changed: keep.txt = %q", got)
+	}
+	if _, err := os.Lstat(filepath.Join(fsys.root, "top")); !os.IsNotExist(err) {
+		t.Fatalf("link top still exists: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+)
+
+// syncFile is one file a mirror plans to touch, by path relative to the
+// mirrored root. sum is the hex SHA-256 when already known.
+type syncFile struct {
+	path string
+	size int64
+	sum  string
+}
+
+// matchRemoteRenames pairs remote files a mirror --delete would remove with
+// source files it would upload when size and content agree, so the upload can
+// become a server-side rename. hashRemote is only called for remote files whose
+// size matches at least one pending upload; a hashing failure just leaves that
+// file out. Each side is used at most once and pairs are sorted by destination.
+func matchRemoteRenames(deletes, uploads []syncFile, hashRemote func(p string) (string, error)) []rename {
+	sizes := make(map[int64]bool, len(uploads))
+	for _, u := range uploads {
+		sizes[u.size] = true
+	}
+
+	byContent := make(map[string][]string)
+	for _, d := range deletes {
+		if !sizes[d.size] {
+			continue
+		}
+		sum := d.sum
+		if sum == "" {
+			var err error
+			if sum, err = hashRemote(d.path); err != nil {
+				continue
+			}
+		}
+		key := fmt.Sprintf("%d:%s", d.size, sum)
+		byContent[key] = append(byContent[key], d.path)
+	}
+	for _, paths := range byContent {
+		sort.Strings(paths)
+	}
+
+	sorted := append([]syncFile(nil), uploads...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].path < sorted[j].path })
+
+	var out []rename
+	for _, u := range sorted {
+		if u.sum == "" {
+			continue
+		}
+		key := fmt.Sprintf("%d:%s", u.size, u.sum)
+		if candidates := byContent[key]; len(candidates) > 0 {
+			out = append(out, rename{from: candidates[0], to: u.path})
+			byContent[key] = candidates[1:]
+		}
+	}
+	return out
+}
+
+// applyRemoteRename moves r.from to r.to below root on the server, creating
+// the destination directory first. The destination must not exist.
+func applyRemoteRename(share remoteFS, root string, r rename) error {
+	from := joinRemote(root, r.from)
+	to := joinRemote(root, r.to)
+	if dir := path.Dir(to); dir != "." {
+		if err := share.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("mkdir %s: %w", dir, err)
+		}
+	}
+	if err := share.Rename(from, to); err != nil {
+		return fmt.Errorf("rename %s -> %s: %w", from, to, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMatchRemoteRenames(t *testing.T) {
+	remoteSums := map[string]string{
+		"old/a.bin":  "aaa",
+		"old/b.bin":  "bbb",
+		"broken.bin": "",
+	}
+	var hashed []string
+	hashRemote := func(p string) (string, error) {
+		hashed = append(hashed, p)
+		if remoteSums[p] == "" {
+			return "", errors.New("read failed")
+		}
+		return remoteSums[p], nil
+	}
+
+	deletes := []syncFile{
+		{path: "old/a.bin", size: 10},
+		{path: "old/b.bin", size: 20},
+		{path: "old/c.bin", size: 99},
+		{path: "broken.bin", size: 10},
+	}
+	uploads := []syncFile{
+		{path: "new/b.bin", size: 20, sum: "different"},
+		{path: "new/a.bin", size: 10, sum: "aaa"},
+		{path: "new/a-copy.bin", size: 10, sum: "aaa"},
+	}
+
+	got := matchRemoteRenames(deletes, uploads, hashRemote)
+	want := []rename{{from: "old/a.bin", to: "new/a-copy.bin"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("matchRemoteRenames = %+v, want %+v", got, want)
+	}
+	for _, p := range hashed {
+		if p == "old/c.bin" {
+			t.Fatalf("hashed %s although no upload has its size", p)
+		}
+	}
+}
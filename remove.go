@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// removeRemote deletes remote and returns how many entries were removed. A
+// directory is only removed with recursive set, in which case its contents
+// go first, depth-first, so every directory is empty by the time it is
+// deleted. Up to jobs entries are removed at a time. A symlink or junction
+// to a directory is removed itself, never what it points to.
+func removeRemote(share remoteFS, remote string, recursive bool, jobs int) (int, error) {
+	remote = normalizeRemotePath(remote)
+	if remote == "." {
+		return 0, fmt.Errorf("refusing to remove the share root")
+	}
+	start := time.Now()
+	fi, err := share.Lstat(remote)
+	opStats.observe("stat", start)
+	if err != nil {
+		return 0, fmt.Errorf("stat %s: %w", remote, err)
+	}
+	if fi.IsDir() && !isLink(fi) {
+		if !recursive {
+			return 0, fmt.Errorf("%s is a directory; use -r to remove it", remote)
+		}
+		if jobs < 1 {
+			jobs = 1
+		}
+		r := &treeRemover{
+			share: share,
+			ops:   make(chan struct{}, jobs),
+			dirs:  make(chan struct{}, jobs-1),
+		}
+		r.tree(remote)
+		return r.removed, r.err
+	}
+	return removeEntry(share, remote)
+}
+
+// treeRemover deletes a directory tree with a bounded number of SMB
+// requests in flight. ops is held for every listing and removal; dirs limits
+// the subdirectories worked on in goroutines of their own, and a directory
+// that finds it full is handled inline instead. Nothing waits while holding
+// ops, so the two cannot deadlock. The first failure stops the rest.
+type treeRemover struct {
+	share remoteFS
+	ops   chan struct{}
+	dirs  chan struct{}
+
+	mu      sync.Mutex
+	removed int
+	err     error
+}
+
+func (r *treeRemover) failed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err != nil
+}
+
+// remove deletes p; the caller holds an ops slot.
+func (r *treeRemover) remove(p string) {
+	n, err := removeEntry(r.share, p)
+	r.mu.Lock()
+	r.removed += n
+	if r.err == nil {
+		r.err = err
+	}
+	r.mu.Unlock()
+}
+
+func (r *treeRemover) tree(dir string) {
+	r.ops <- struct{}{}
+	start := time.Now()
+	entries, err := r.share.ReadDir(dir)
+	opStats.observe("readdir", start)
+	<-r.ops
+	if err != nil {
+		r.mu.Lock()
+		if r.err == nil {
+			r.err = fmt.Errorf("readdir %s: %w", dir, err)
+		}
+		r.mu.Unlock()
+		return
+	}
+	var wg sync.WaitGroup
+	for _, fi := range entries {
+		if r.failed() {
+			break
+		}
+		p := joinRemote(dir, fi.Name())
+		// go-smb2 lists a directory link as a directory, and deleting
+		// through it would empty its target.
+		if !fi.IsDir() || isLink(fi) {
+			// Taking the slot before starting the goroutine keeps at
+			// most jobs of them alive however large the directory.
+			r.ops <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.remove(p)
+				<-r.ops
+			}()
+			continue
+		}
+		select {
+		case r.dirs <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.tree(p)
+				<-r.dirs
+			}()
+		default:
+			r.tree(p)
+		}
+	}
+	wg.Wait()
+	if !r.failed() {
+		r.ops <- struct{}{}
+		r.remove(dir)
+		<-r.ops
+	}
+}
+
+func removeEntry(share remoteFS, p string) (int, error) {
+	start := time.Now()
+	err := share.Remove(p)
+	opStats.observe("remove", start)
+	if err != nil {
+		return 0, fmt.Errorf("remove %s: %w", p, err)
+	}
+	return 1, nil
+}
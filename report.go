@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+type reportBucket struct {
+	Name  string `json:"name"`
+	Files int64  `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+type reportFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+type usageReport struct {
+	Root       string         `json:"root"`
+	Files      int64          `json:"files"`
+	Dirs       int64          `json:"dirs"`
+	Bytes      int64          `json:"bytes"`
+	Extensions []reportBucket `json:"extensions"`
+	Sizes      []reportBucket `json:"sizes"`
+	Ages       []reportBucket `json:"ages"`
+	Largest    []reportFile   `json:"largest"`
+	Oldest     []reportFile   `json:"oldest"`
+}
+
+type bucketBound struct {
+	name  string
+	limit int64 // exclusive upper bound; the last bucket uses -1
+}
+
+var sizeBuckets = []bucketBound{
+	{"< 1 KiB", 1 << 10},
+	{"1 KiB - 1 MiB", 1 << 20},
+	{"1 MiB - 100 MiB", 100 << 20},
+	{"100 MiB - 1 GiB", 1 << 30},
+	{">= 1 GiB", -1},
+}
+
+const day = 24 * time.Hour
+
+var ageBuckets = []bucketBound{
+	{"< 7 days", int64(7 * day)},
+	{"7 - 30 days", int64(30 * day)},
+	{"30 - 90 days", int64(90 * day)},
+	{"90 days - 1 year", int64(365 * day)},
+	{">= 1 year", -1},
+}
+
+// reportBuilder accumulates a usageReport one entry at a time so the walk
+// never holds the full listing in memory.
+type reportBuilder struct {
+	now     time.Time
+	top     int
+	report  usageReport
+	exts    map[string]*reportBucket
+	sizes   []reportBucket
+	ages    []reportBucket
+	largest []reportFile
+	oldest  []reportFile
+}
+
+func newReportBuilder(root string, now time.Time, top int) *reportBuilder {
+	b := &reportBuilder{
+		now:    now,
+		top:    top,
+		report: usageReport{Root: root},
+		exts:   make(map[string]*reportBucket),
+	}
+	for _, s := range sizeBuckets {
+		b.sizes = append(b.sizes, reportBucket{Name: s.name})
+	}
+	for _, a := range ageBuckets {
+		b.ages = append(b.ages, reportBucket{Name: a.name})
+	}
+	return b
+}
+
+func (b *reportBuilder) add(p string, fi os.FileInfo) {
+	if fi.IsDir() {
+		b.report.Dirs++
+		return
+	}
+	size := fi.Size()
+	b.report.Files++
+	b.report.Bytes += size
+
+	ext := strings.ToLower(path.Ext(fi.Name()))
+	if ext == "" {
+		ext = "(none)"
+	}
+	bucket, ok := b.exts[ext]
+	if !ok {
+		bucket = &reportBucket{Name: ext}
+		b.exts[ext] = bucket
+	}
+	bucket.Files++
+	bucket.Bytes += size
+
+	addToBucket(b.sizes, sizeBuckets, size, size)
+	addToBucket(b.ages, ageBuckets, int64(b.now.Sub(fi.ModTime())), size)
+
+	f := reportFile{Path: p, Size: size, ModTime: fi.ModTime().UTC()}
+	b.largest = insertTop(b.largest, f, b.top, func(a, c reportFile) bool { return a.Size > c.Size })
+	b.oldest = insertTop(b.oldest, f, b.top, func(a, c reportFile) bool { return a.ModTime.Before(c.ModTime) })
+}
+
+func addToBucket(buckets []reportBucket, bounds []bucketBound, value, size int64) {
+	for i, bound := range bounds {
+		if bound.limit < 0 || value < bound.limit {
+			buckets[i].Files++
+			buckets[i].Bytes += size
+			return
+		}
+	}
+}
+
+// insertTop inserts f into the sorted slice and keeps at most n entries.
+func insertTop(list []reportFile, f reportFile, n int, less func(a, b reportFile) bool) []reportFile {
+	if n <= 0 {
+		return list
+	}
+	i := sort.Search(len(list), func(i int) bool { return less(f, list[i]) })
+	if i >= n {
+		return list
+	}
+	list = append(list, reportFile{})
+	copy(list[i+1:], list[i:])
+	list[i] = f
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+func (b *reportBuilder) result() usageReport {
+	r := b.report
+	r.Extensions = make([]reportBucket, 0, len(b.exts))
+	for _, bucket := range b.exts {
+		r.Extensions = append(r.Extensions, *bucket)
+	}
+	sort.Slice(r.Extensions, func(i, j int) bool {
+		if r.Extensions[i].Bytes != r.Extensions[j].Bytes {
+			return r.Extensions[i].Bytes > r.Extensions[j].Bytes
+		}
+		return r.Extensions[i].Name < r.Extensions[j].Name
+	})
+	r.Sizes = b.sizes
+	r.Ages = b.ages
+	r.Largest = append([]reportFile{}, b.largest...)
+	r.Oldest = append([]reportFile{}, b.oldest...)
+	return r
+}
+
+// reportRemote walks remote and prints a storage usage breakdown.
+func reportRemote(share *smb2.Share, remote string, top int, asJSON bool) error {
+	remote = normalizeRemotePath(remote)
+	b := newReportBuilder(remote, time.Now(), top)
+	err := walkRemote(shareFS(share), remote, func(p string, fi os.FileInfo) error {
+		b.add(p, fi)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r := b.result()
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(withSchema("report", r))
+	}
+	writeReport(os.Stdout, r)
+	return nil
+}
+
+func writeReport(w io.Writer, r usageReport) {
+	fmt.Fprintf(w, "%s: %d files, %d directories, %s\n", r.Root, r.Files, r.Dirs, humanBytes(r.Bytes))
+
+	writeBuckets := func(title string, buckets []reportBucket) {
+		fmt.Fprintf(w, "\n%s\n", title)
+		for _, b := range buckets {
+			fmt.Fprintf(w, "  %-18s %10d %12s\n", b.Name, b.Files, humanBytes(b.Bytes))
+		}
+	}
+	writeBuckets("By extension:", r.Extensions)
+	writeBuckets("By size:", r.Sizes)
+	writeBuckets("By age:", r.Ages)
+
+	writeFiles := func(title string, files []reportFile) {
+		fmt.Fprintf(w, "\n%s\n", title)
+		for _, f := range files {
+			fmt.Fprintf(w, "  %12s %s %s\n", humanBytes(f.Size), f.ModTime.Format(time.RFC3339), f.Path)
+		}
+	}
+	writeFiles("Largest files:", r.Largest)
+	writeFiles("Oldest files:", r.Oldest)
+}
+
+// humanBytes formats n using binary units, e.g. 1536 -> "1.5 KiB".
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
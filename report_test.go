@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+func testFileInfo(name string, size int64, mtime time.Time, dir bool) os.FileInfo {
+	attrs := uint32(0x80) // FILE_ATTRIBUTE_NORMAL
+	if dir {
+		attrs = 0x10 // FILE_ATTRIBUTE_DIRECTORY
+	}
+	return &smb2.FileStat{
+		LastWriteTime:  mtime,
+		EndOfFile:      size,
+		FileAttributes: attrs,
+		FileName:       name,
+	}
+}
+
+func TestReportBuilder(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	b := newReportBuilder("data", now, 2)
+
+	b.add("data/logs", testFileInfo("logs", 0, now, true))
+	b.add("data/a.csv", testFileInfo("a.csv", 500, now.Add(-time.Hour), false))
+	b.add("data/b.CSV", testFileInfo("b.CSV", 2<<20, now.Add(-40*day), false))
+	b.add("data/logs/c", testFileInfo("c", 3<<30, now.Add(-400*day), false))
+
+	r := b.result()
+	if r.Files != 3 || r.Dirs != 1 {
+		t.Fatalf("files/dirs = %d/%d, want 3/1", r.Files, r.Dirs)
+	}
+	if want := int64(500 + 2<<20 + 3<<30); r.Bytes != want {
+		t.Fatalf("bytes = %d, want %d", r.Bytes, want)
+	}
+
+	if len(r.Extensions) != 2 || r.Extensions[0].Name != "(none)" || r.Extensions[1].Name != ".csv" || r.Extensions[1].Files != 2 {
+		t.Fatalf("unexpected extensions: %+v", r.Extensions)
+	}
+	if r.Sizes[0].Files != 1 || r.Sizes[2].Files != 1 || r.Sizes[4].Files != 1 {
+		t.Fatalf("unexpected size buckets: %+v", r.Sizes)
+	}
+	if r.Ages[0].Files != 1 || r.Ages[2].Files != 1 || r.Ages[4].Files != 1 {
+		t.Fatalf("unexpected age buckets: %+v", r.Ages)
+	}
+
+	if len(r.Largest) != 2 || r.Largest[0].Path != "data/logs/c" || r.Largest[1].Path != "data/b.CSV" {
+		t.Fatalf("unexpected largest: %+v", r.Largest)
+	}
+	if len(r.Oldest) != 2 || r.Oldest[0].Path != "data/logs/c" || r.Oldest[1].Path != "data/b.CSV" {
+		t.Fatalf("unexpected oldest: %+v", r.Oldest)
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+	for _, tc := range tests {
+		if got := humanBytes(tc.n); got != tc.want {
+			t.Fatalf("humanBytes(%d) = %q, want %q", tc.n, got, tc.want)
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/netip"
 	"strings"
 	"time"
 
@@ -16,9 +18,37 @@ var (
 	llmnrIPv6Addr = &net.UDPAddr{IP: net.ParseIP("ff02::1:3"), Port: 5355}
 )
 
-func resolveHost(ctx context.Context, host string, timeout time.Duration) ([]net.IP, error) {
-	if ip := net.ParseIP(host); ip != nil {
-		return []net.IP{ip}, nil
+// resolveStep is one method in the name resolution cascade.
+type resolveStep struct {
+	method string
+	name   string
+	lookup func(ctx context.Context, name string, timeout time.Duration) ([]net.IPAddr, error)
+}
+
+// resolveSteps returns the cascade for host in the order it is tried: the
+// system resolver, then the system resolver with a .local suffix (many systems
+// resolve *.local through mDNS), then LLMNR multicast for both names.
+func resolveSteps(host string) []resolveStep {
+	dns := func(ctx context.Context, name string, _ time.Duration) ([]net.IPAddr, error) {
+		return lookupHost(ctx, name)
+	}
+	names := []string{host}
+	if !strings.HasSuffix(host, ".local") {
+		names = append(names, host+".local")
+	}
+	var steps []resolveStep
+	for _, name := range names {
+		steps = append(steps, resolveStep{method: "dns", name: name, lookup: dns})
+	}
+	for _, name := range names {
+		steps = append(steps, resolveStep{method: "llmnr", name: name, lookup: lookupLLMNR})
+	}
+	return steps
+}
+
+func resolveHost(ctx context.Context, host string, timeout time.Duration) ([]net.IPAddr, error) {
+	if ip, ok := parseIPLiteral(host); ok {
+		return []net.IPAddr{ip}, nil
 	}
 
 	if timeout <= 0 {
@@ -29,54 +59,28 @@ func resolveHost(ctx context.Context, host string, timeout time.Duration) ([]net
 	lookupCtx, lookupCancel := context.WithDeadline(ctx, deadline)
 	defer lookupCancel()
 
-	ips, err := lookupHost(lookupCtx, host)
-	if len(ips) > 0 {
-		return uniqueIPs(ips), nil
-	}
 	var lastErr error
-	if err != nil {
-		lastErr = err
-	}
-
-	// Try common mDNS suffix before issuing multicast queries; many systems
-	// resolve *.local via their standard resolver.
-	if !strings.HasSuffix(host, ".local") {
-		if mdnsIPs, err := lookupHost(lookupCtx, host+".local"); len(mdnsIPs) > 0 {
-			return uniqueIPs(mdnsIPs), nil
-		} else if err != nil {
-			lastErr = err
+	for _, step := range resolveSteps(host) {
+		stepTimeout := remaining(deadline)
+		if stepTimeout <= 0 {
+			stepTimeout = 500 * time.Millisecond
 		}
-	}
-
-	// Fall back to LLMNR multicast queries.
-	llmnrTimeout := remaining(deadline)
-	if llmnrTimeout <= 0 {
-		llmnrTimeout = 500 * time.Millisecond
-	}
-	if llmnrIPs, err := lookupLLMNR(lookupCtx, host, llmnrTimeout); len(llmnrIPs) > 0 {
-		return uniqueIPs(llmnrIPs), nil
-	} else if err != nil {
-		lastErr = err
-	}
-
-	if !strings.HasSuffix(host, ".local") {
-		if llmnrIPs, err := lookupLLMNR(lookupCtx, host+".local", llmnrTimeout); len(llmnrIPs) > 0 {
-			return uniqueIPs(llmnrIPs), nil
-		} else if err != nil {
+		ips, err := step.lookup(lookupCtx, step.name, stepTimeout)
+		if len(ips) > 0 {
+			return uniqueIPs(ips), nil
+		}
+		if err != nil {
 			lastErr = err
 		}
 	}
 
-	if len(ips) == 0 {
-		if lastErr == nil {
-			lastErr = fmt.Errorf("no IP addresses found for %s", host)
-		}
-		return nil, lastErr
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no IP addresses found for %s", host)
 	}
-	return uniqueIPs(ips), nil
+	return nil, lastErr
 }
 
-func lookupHost(ctx context.Context, host string) ([]net.IP, error) {
+func lookupHost(ctx context.Context, host string) ([]net.IPAddr, error) {
 	resolver := net.DefaultResolver
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
@@ -87,10 +91,10 @@ func lookupHost(ctx context.Context, host string) ([]net.IP, error) {
 		return nil, err
 	}
 
-	ips := make([]net.IP, 0, len(ipAddrs))
+	ips := make([]net.IPAddr, 0, len(ipAddrs))
 	for _, addr := range ipAddrs {
-		if ip := addr.IP; ip != nil {
-			ips = append(ips, ip)
+		if addr.IP != nil {
+			ips = append(ips, addr)
 		}
 	}
 	if len(ips) == 0 {
@@ -99,7 +103,7 @@ func lookupHost(ctx context.Context, host string) ([]net.IP, error) {
 	return ips, nil
 }
 
-func lookupLLMNR(ctx context.Context, host string, timeout time.Duration) ([]net.IP, error) {
+func lookupLLMNR(ctx context.Context, host string, timeout time.Duration) ([]net.IPAddr, error) {
 	name := host
 	if !strings.HasSuffix(name, ".") {
 		name += "."
@@ -139,10 +143,10 @@ func lookupLLMNR(ctx context.Context, host string, timeout time.Duration) ([]net
 	// Best-effort IPv6 query; ignore errors on platforms without IPv6.
 	_, _ = conn.WriteToUDP(buf, llmnrIPv6Addr)
 
-	var ips []net.IP
+	var ips []net.IPAddr
 	out := make([]byte, 1500)
 	for {
-		n, _, err := conn.ReadFrom(out)
+		n, from, err := conn.ReadFromUDP(out)
 		if err != nil {
 			if ne, ok := err.(net.Error); ok && ne.Timeout() {
 				break
@@ -170,15 +174,15 @@ func lookupLLMNR(ctx context.Context, host string, timeout time.Duration) ([]net
 			}
 			switch body := answer.Body.(type) {
 			case *dnsmessage.AResource:
-				ip := net.IP(body.A[:])
-				if ip != nil {
-					ips = append(ips, ip)
-				}
+				ips = append(ips, net.IPAddr{IP: net.IP(body.A[:])})
 			case *dnsmessage.AAAAResource:
-				ip := net.IP(body.AAAA[:])
-				if ip != nil {
-					ips = append(ips, ip)
+				ip := net.IPAddr{IP: net.IP(body.AAAA[:])}
+				// A link-local answer is only reachable through the interface
+				// the response arrived on.
+				if ip.IP.IsLinkLocalUnicast() {
+					ip.Zone = from.Zone
 				}
+				ips = append(ips, ip)
 			}
 		}
 	}
@@ -190,14 +194,14 @@ func lookupLLMNR(ctx context.Context, host string, timeout time.Duration) ([]net
 	return uniqueIPs(ips), nil
 }
 
-func uniqueIPs(ips []net.IP) []net.IP {
+func uniqueIPs(ips []net.IPAddr) []net.IPAddr {
 	if len(ips) < 2 {
 		return ips
 	}
 	seen := make(map[string]struct{}, len(ips))
-	out := make([]net.IP, 0, len(ips))
+	out := make([]net.IPAddr, 0, len(ips))
 	for _, ip := range ips {
-		if ip == nil {
+		if ip.IP == nil {
 			continue
 		}
 		key := ip.String()
@@ -210,6 +214,85 @@ func uniqueIPs(ips []net.IP) []net.IP {
 	return out
 }
 
+// parseIPLiteral parses an IPv4 or IPv6 literal, keeping an IPv6 zone such as
+// the "eth0" in fe80::1%eth0.
+func parseIPLiteral(host string) (net.IPAddr, bool) {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return net.IPAddr{}, false
+	}
+	return net.IPAddr{IP: net.IP(addr.Unmap().AsSlice()), Zone: addr.Zone()}, true
+}
+
 func remaining(deadline time.Time) time.Duration {
 	return time.Until(deadline)
 }
+
+// resolveResult is the outcome of one resolveStep when explaining.
+type resolveResult struct {
+	step    resolveStep
+	ips     []net.IPAddr
+	err     error
+	elapsed time.Duration
+}
+
+// explainResolve runs every step of the cascade, even after one answers, and
+// prints each stage's timing and addresses, which stage resolveHost would have
+// used, and every candidate address seen. Each stage gets the full timeout so
+// a slow early stage cannot hide the later ones.
+func explainResolve(ctx context.Context, w io.Writer, host string, timeout time.Duration, steps []resolveStep) error {
+	if _, ok := parseIPLiteral(host); ok {
+		fmt.Fprintf(w, "%s is an IP literal; no lookup needed\n", host)
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+
+	var results []resolveResult
+	for _, step := range steps {
+		stepCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		ips, err := step.lookup(stepCtx, step.name, timeout)
+		cancel()
+		results = append(results, resolveResult{step: step, ips: uniqueIPs(ips), err: err, elapsed: time.Since(start)})
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	writeResolveExplanation(w, host, results)
+	return ctx.Err()
+}
+
+func writeResolveExplanation(w io.Writer, host string, results []resolveResult) {
+	var answered *resolveResult
+	var candidates []net.IPAddr
+	for i, r := range results {
+		outcome := formatIPs(r.ips)
+		if len(r.ips) == 0 {
+			outcome = "no answer"
+			if r.err != nil {
+				outcome = "error: " + r.err.Error()
+			}
+		} else if answered == nil {
+			answered = &results[i]
+		}
+		fmt.Fprintf(w, "%-6s %-30s %10s  %s\n", r.step.method, r.step.name, r.elapsed.Round(time.Millisecond), outcome)
+		candidates = append(candidates, r.ips...)
+	}
+
+	if answered == nil {
+		fmt.Fprintf(w, "\n%s did not resolve\n", host)
+		return
+	}
+	fmt.Fprintf(w, "\nanswered by: %s (%s)\n", answered.step.method, answered.step.name)
+	fmt.Fprintf(w, "candidates:  %s\n", formatIPs(uniqueIPs(candidates)))
+}
+
+func formatIPs(ips []net.IPAddr) string {
+	parts := make([]string, len(ips))
+	for i, ip := range ips {
+		parts[i] = ip.String()
+	}
+	return strings.Join(parts, ", ")
+}
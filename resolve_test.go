@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"net"
+	"strings"
 	"testing"
 	"time"
 )
@@ -18,28 +21,76 @@ func TestResolveHostReturnsIPWhenGivenIP(t *testing.T) {
 	if len(ips) != 1 {
 		t.Fatalf("expected single IP, got %d", len(ips))
 	}
-	if !ips[0].Equal(net.ParseIP("10.0.0.5")) {
+	if !ips[0].IP.Equal(net.ParseIP("10.0.0.5")) {
 		t.Fatalf("resolveHost returned %v, want 10.0.0.5", ips[0])
 	}
 }
 
+func TestResolveHostKeepsZone(t *testing.T) {
+	ips, err := resolveHost(context.Background(), "fe80::1%eth0", time.Second)
+	if err != nil {
+		t.Fatalf("resolveHost returned error: %v", err)
+	}
+	if len(ips) != 1 || ips[0].Zone != "eth0" || !ips[0].IP.Equal(net.ParseIP("fe80::1")) {
+		t.Fatalf("resolveHost = %v, want fe80::1%%eth0", ips)
+	}
+	if got := net.JoinHostPort(ips[0].String(), "445"); got != "[fe80::1%eth0]:445" {
+		t.Fatalf("dial address = %q", got)
+	}
+}
+
 func TestUniqueIPs(t *testing.T) {
-	ips := []net.IP{
-		net.ParseIP("192.168.1.1"),
-		net.ParseIP("192.168.1.1"),
-		net.ParseIP("192.168.1.2"),
-		nil,
-		net.ParseIP("192.168.1.2"),
+	ips := []net.IPAddr{
+		{IP: net.ParseIP("192.168.1.1")},
+		{IP: net.ParseIP("192.168.1.1")},
+		{IP: net.ParseIP("192.168.1.2")},
+		{},
+		{IP: net.ParseIP("192.168.1.2")},
+		{IP: net.ParseIP("fe80::1"), Zone: "eth0"},
+		{IP: net.ParseIP("fe80::1"), Zone: "eth1"},
 	}
 
 	out := uniqueIPs(ips)
-	if len(out) != 2 {
-		t.Fatalf("expected 2 unique IPs, got %d", len(out))
+	if len(out) != 4 {
+		t.Fatalf("expected 4 unique addresses, got %d", len(out))
 	}
-	if !out[0].Equal(net.ParseIP("192.168.1.1")) {
+	if !out[0].IP.Equal(net.ParseIP("192.168.1.1")) {
 		t.Fatalf("first IP = %v, want 192.168.1.1", out[0])
 	}
-	if !out[1].Equal(net.ParseIP("192.168.1.2")) {
+	if !out[1].IP.Equal(net.ParseIP("192.168.1.2")) {
 		t.Fatalf("second IP = %v, want 192.168.1.2", out[1])
 	}
 }
+
+func TestExplainResolveRunsEveryStage(t *testing.T) {
+	var called []string
+	step := func(method, name string, ips []net.IPAddr, err error) resolveStep {
+		return resolveStep{method: method, name: name, lookup: func(ctx context.Context, n string, _ time.Duration) ([]net.IPAddr, error) {
+			called = append(called, method+" "+n)
+			return ips, err
+		}}
+	}
+	steps := []resolveStep{
+		step("dns", "nas", nil, errors.New("no such host")),
+		step("dns", "nas.local", []net.IPAddr{{IP: net.ParseIP("192.168.1.10")}}, nil),
+		step("llmnr", "nas", []net.IPAddr{{IP: net.ParseIP("fe80::1"), Zone: "eth0"}, {IP: net.ParseIP("192.168.1.10")}}, nil),
+	}
+
+	var out bytes.Buffer
+	if err := explainResolve(context.Background(), &out, "nas", time.Second, steps); err != nil {
+		t.Fatalf("explainResolve: %v", err)
+	}
+	if len(called) != 3 {
+		t.Fatalf("ran %v, want all three stages", called)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"error: no such host",
+		"answered by: dns (nas.local)",
+		"candidates:  192.168.1.10, fe80::1%eth0",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const resumeTokenVersion = 1
+
+// resumeToken records enough of an interrupted transfer for a later run to
+// continue it. Byte offsets are deliberately left out: the resumed transfer
+// continues from whatever the destination already holds, which stays right
+// even if another attempt ran in between. Credentials are never included.
+type resumeToken struct {
+	Version int      `json:"v"`
+	Command string   `json:"cmd"`
+	Server  string   `json:"server"`
+	Share   string   `json:"share,omitempty"`
+	Args    []string `json:"args"`
+	// Offset and Length carry get's byte range, which is part of what
+	// was asked for rather than progress.
+	Offset int64 `json:"offset,omitempty"`
+	Length int64 `json:"length,omitempty"`
+	// Snapshot is get's -snapshot, so a resumed download keeps reading
+	// the same shadow copy.
+	Snapshot string `json:"snapshot,omitempty"`
+	// Recursive is put -r, whose arguments are directories.
+	Recursive bool `json:"recursive,omitempty"`
+}
+
+func (t resumeToken) encode() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeResumeToken(s string) (resumeToken, error) {
+	var t resumeToken
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &t)
+	}
+	if err != nil {
+		return resumeToken{}, fmt.Errorf("invalid -resume-token: %w", err)
+	}
+	if t.Version != resumeTokenVersion {
+		return resumeToken{}, fmt.Errorf("invalid -resume-token: unsupported version %d", t.Version)
+	}
+	if t.Command == "" {
+		return resumeToken{}, errors.New("invalid -resume-token: no command")
+	}
+	return t, nil
+}
+
+// applyResumeToken fills the server, share, byte range, and snapshot from
+// the token unless they were given as flags, and marks the server and share
+// set so a profile does not override them. The transfer always resumes.
+func applyResumeToken(opts *smbOptions, t resumeToken, setFlags map[string]bool) {
+	if !setFlags["server"] {
+		opts.address = t.Server
+		setFlags["server"] = true
+	}
+	if !setFlags["share"] && t.Share != "" {
+		opts.share = t.Share
+		setFlags["share"] = true
+	}
+	if !setFlags["offset"] {
+		opts.offset = t.Offset
+	}
+	if !setFlags["length"] {
+		opts.length = t.Length
+	}
+	if !setFlags["snapshot"] {
+		opts.snapshot = t.Snapshot
+	}
+	if t.Recursive {
+		opts.recursive = true
+	}
+	opts.resume = true
+}
+
+// offersResume reports whether a failed transfer left a partial destination
+// worth continuing: the time window ended, the connection dropped, or the
+// transfer stalled.
+func offersResume(ctx context.Context, err error) bool {
+	return ctx.Err() == context.DeadlineExceeded || isConnectionError(err) || errors.Is(err, errStalled)
+}
+
+// writeResumeToken tells the user, or with asJSON an orchestrator reading
+// stdout, how to continue the interrupted transfer.
+func writeResumeToken(stdout, stderr io.Writer, t resumeToken, cause error, asJSON bool) {
+	token := t.encode()
+	if asJSON {
+		json.NewEncoder(stdout).Encode(withSchema("resume-token", struct {
+			Status      string `json:"status"`
+			Error       string `json:"error"`
+			ResumeToken string `json:"resume_token"`
+		}{"interrupted", cause.Error(), token}))
+		return
+	}
+	fmt.Fprintf(stderr, "resume with: smbput -resume-token %s\n", token)
+}
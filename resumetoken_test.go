@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResumeTokenRoundTrip(t *testing.T) {
+	tok := resumeToken{Version: resumeTokenVersion, Command: "put", Server: "nas:1445", Share: "backup", Args: []string{"db.dump", "nightly/db.dump"}}
+	got, err := decodeResumeToken(tok.encode())
+	if err != nil {
+		t.Fatalf("decodeResumeToken: %v", err)
+	}
+	if !reflect.DeepEqual(got, tok) {
+		t.Fatalf("round trip = %+v, want %+v", got, tok)
+	}
+
+	for _, bad := range []string{"not base64!", "e30", resumeToken{Version: 99, Command: "get"}.encode()} {
+		if _, err := decodeResumeToken(bad); err == nil {
+			t.Errorf("decodeResumeToken(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestApplyResumeTokenKeepsExplicitFlags(t *testing.T) {
+	opts := smbOptions{address: "other-nas"}
+	setFlags := map[string]bool{"server": true}
+	applyResumeToken(&opts, resumeToken{Server: "nas", Share: "backup"}, setFlags)
+	if opts.address != "other-nas" || opts.share != "backup" || !opts.resume {
+		t.Fatalf("opts = %+v", opts)
+	}
+	if !setFlags["share"] {
+		t.Fatal("share from the token must count as set so profiles do not override it")
+	}
+}
+
+func TestApplyResumeTokenByteRange(t *testing.T) {
+	opts := smbOptions{length: 10}
+	applyResumeToken(&opts, resumeToken{Offset: 100, Length: 50}, map[string]bool{"length": true})
+	if opts.offset != 100 || opts.length != 10 {
+		t.Fatalf("offset/length = %d/%d, want 100/10", opts.offset, opts.length)
+	}
+}
+
+func TestApplyResumeTokenSnapshot(t *testing.T) {
+	var opts smbOptions
+	applyResumeToken(&opts, resumeToken{Snapshot: "@GMT-2024.05.01-07.00.00"}, map[string]bool{})
+	if opts.snapshot != "@GMT-2024.05.01-07.00.00" {
+		t.Fatalf("snapshot = %q", opts.snapshot)
+	}
+}
+
+func TestApplyResumeTokenRecursive(t *testing.T) {
+	var opts smbOptions
+	applyResumeToken(&opts, resumeToken{Command: "put", Recursive: true}, map[string]bool{})
+	if !opts.recursive || !opts.resume {
+		t.Fatalf("recursive = %v, resume = %v", opts.recursive, opts.resume)
+	}
+}
+
+func TestOffersResume(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"deadline", expired, context.DeadlineExceeded, true},
+		{"connection", context.Background(), fmt.Errorf("copy: %w", io.ErrUnexpectedEOF), true},
+		{"stalled", context.Background(), errStalled, true},
+		{"not found", context.Background(), errors.New("open remote x: file does not exist"), false},
+	}
+	for _, tc := range tests {
+		if got := offersResume(tc.ctx, tc.err); got != tc.want {
+			t.Errorf("%s: offersResume = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestWriteResumeTokenJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	tok := resumeToken{Version: resumeTokenVersion, Command: "get", Server: "nas", Args: []string{"a", "b"}}
+	writeResumeToken(&stdout, &stderr, tok, errStalled, true)
+	var out map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		t.Fatalf("stdout is not JSON: %v\n%s", err, stdout.String())
+	}
+	if out["status"] != "interrupted" || out["resume_token"] != tok.encode() {
+		t.Fatalf("unexpected JSON: %v", out)
+	}
+	if stderr.Len() != 0 {
+		t.Fatalf("stderr = %q, want nothing in JSON mode", stderr.String())
+	}
+
+	stdout.Reset()
+	writeResumeToken(&stdout, &stderr, tok, errStalled, false)
+	if !strings.Contains(stderr.String(), "-resume-token "+tok.encode()) || stdout.Len() != 0 {
+		t.Fatalf("text mode wrote stdout=%q stderr=%q", stdout.String(), stderr.String())
+	}
+}
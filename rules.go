@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// rulePrefix starts the profile keys that hold transfer rules, e.g.
+// "rule.*.log = compress".
+const rulePrefix = "rule."
+
+// transferRule is the handling recursive transfers give files whose names
+// match pattern.
+type transferRule struct {
+	pattern string
+	// skip leaves matching files out of the transfer.
+	skip bool
+	// compress stores files zstd-compressed under a .zst name.
+	compress bool
+	// encrypt stores files encrypted (see encryptWriter) under a .enc name.
+	encrypt bool
+	// verify reads each uploaded file back and compares its SHA-256 with
+	// the bytes that were sent.
+	verify bool
+	// key encrypts; loadRuleKey sets it on the rules that need it.
+	key []byte
+}
+
+// parseRules reads the rule.PATTERN keys of a profile. PATTERN is a glob
+// matched against base names without regard to case; the value is a comma-
+// separated list of skip, compress, encrypt, and verify. Patterns are
+// checked longest first, so *.tar.gz takes precedence over *.gz.
+func parseRules(profile map[string]string) ([]transferRule, error) {
+	var rules []transferRule
+	for key, value := range profile {
+		pattern, ok := strings.CutPrefix(key, rulePrefix)
+		if !ok {
+			continue
+		}
+		pattern = strings.ToLower(pattern)
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" || strings.Contains(pattern, "/") {
+			return nil, fmt.Errorf("%s: want a file name pattern such as rule.*.log", key)
+		}
+		r := transferRule{pattern: pattern}
+		for _, action := range strings.Split(value, ",") {
+			switch strings.TrimSpace(action) {
+			case "skip":
+				r.skip = true
+			case "compress":
+				r.compress = true
+			case "encrypt":
+				r.encrypt = true
+			case "verify":
+				r.verify = true
+			default:
+				return nil, fmt.Errorf("%s: unknown action %q; want skip, compress, encrypt, or verify", key, strings.TrimSpace(action))
+			}
+		}
+		if r.skip && (r.compress || r.encrypt || r.verify) {
+			return nil, fmt.Errorf("%s: skip cannot be combined with other actions", key)
+		}
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if len(rules[i].pattern) != len(rules[j].pattern) {
+			return len(rules[i].pattern) > len(rules[j].pattern)
+		}
+		return rules[i].pattern < rules[j].pattern
+	})
+	return rules, nil
+}
+
+// matchRule returns the rule for the file name, or the zero rule, which
+// transfers it unchanged.
+func matchRule(rules []transferRule, name string) transferRule {
+	name = strings.ToLower(path.Base(name))
+	for _, r := range rules {
+		if ok, _ := path.Match(r.pattern, name); ok {
+			return r
+		}
+	}
+	return transferRule{}
+}
+
+// loadRuleKey reads the key in keyFile for the rules that encrypt. Without
+// such rules the key is not needed and not read.
+func loadRuleKey(rules []transferRule, keyFile string) error {
+	var key []byte
+	for i := range rules {
+		if !rules[i].encrypt {
+			continue
+		}
+		if key == nil {
+			if keyFile == "" {
+				return fmt.Errorf("rule.%s encrypts but no encrypt-key file is configured", rules[i].pattern)
+			}
+			var err error
+			if key, err = loadEncryptKey(keyFile); err != nil {
+				return err
+			}
+		}
+		rules[i].key = key
+	}
+	return nil
+}
+
+// transforms reports whether the rule changes what is stored.
+func (r transferRule) transforms() bool {
+	return r.compress || r.encrypt
+}
+
+// remoteName is the name a file is stored under: .zst, then .enc, are added
+// for the transformations applied in that order.
+func (r transferRule) remoteName(name string) string {
+	if r.compress {
+		name += ".zst"
+	}
+	if r.encrypt {
+		name += ".enc"
+	}
+	return name
+}
+
+// ruleWriter is what an upload writes the local file's content to when a
+// rule applies. The content is compressed, then encrypted, then written to
+// the destination, where sum, if verifying, sees the bytes as stored.
+type ruleWriter struct {
+	io.Writer
+	sum     hash.Hash
+	closers []io.Closer
+}
+
+// newRuleWriter layers the rule's transformations over dst.
+func newRuleWriter(dst io.Writer, r transferRule) (*ruleWriter, error) {
+	rw := &ruleWriter{Writer: dst}
+	if r.verify {
+		rw.sum = sha256.New()
+		rw.Writer = io.MultiWriter(dst, rw.sum)
+	}
+	if r.encrypt {
+		ew, err := newEncryptWriter(rw.Writer, r.key)
+		if err != nil {
+			return nil, err
+		}
+		rw.Writer = ew
+		rw.closers = append(rw.closers, ew)
+	}
+	if r.compress {
+		zw, err := zstd.NewWriter(rw.Writer)
+		if err != nil {
+			return nil, err
+		}
+		rw.Writer = zw
+		rw.closers = append(rw.closers, zw)
+	}
+	return rw, nil
+}
+
+// Close flushes the transformations, outermost first. It does not close
+// the destination.
+func (rw *ruleWriter) Close() error {
+	for i := len(rw.closers) - 1; i >= 0; i-- {
+		if err := rw.closers[i].Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stored returns the SHA-256 of the bytes written to the destination, or
+// "" when not verifying.
+func (rw *ruleWriter) stored() string {
+	if rw.sum == nil {
+		return ""
+	}
+	return hex.EncodeToString(rw.sum.Sum(nil))
+}
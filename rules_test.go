@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := parseRules(map[string]string{
+		"server":        "nas",
+		"rule.*.log":    "compress",
+		"rule.*.SQL":    "compress, encrypt,verify",
+		"rule.*.iso":    "skip",
+		"rule.*.gz":     "verify",
+		"rule.*.tar.gz": "skip",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"logs/app.log", "*.log"},
+		{"DUMP.sql", "*.sql"},
+		{"x.tar.gz", "*.tar.gz"},
+		{"x.gz", "*.gz"},
+		{"notes.txt", ""},
+	}
+	for _, tt := range tests {
+		if got := matchRule(rules, tt.name); got.pattern != tt.want {
+			t.Errorf("matchRule(%q) = %q, want %q", tt.name, got.pattern, tt.want)
+		}
+	}
+	if r := matchRule(rules, "a.sql"); !r.compress || !r.encrypt || !r.verify || r.skip {
+		t.Errorf("*.sql rule = %+v", r)
+	}
+
+	for key, value := range map[string]string{
+		"rule.*.log": "shrink",
+		"rule.[":     "skip",
+		"rule.a/*":   "skip",
+		"rule.*.x":   "skip,verify",
+	} {
+		if _, err := parseRules(map[string]string{key: value}); err == nil {
+			t.Errorf("%s = %s: no error", key, value)
+		}
+	}
+}
+
+func TestLoadRuleKey(t *testing.T) {
+	plain := []transferRule{{pattern: "*.log", compress: true}}
+	if err := loadRuleKey(plain, ""); err != nil {
+		t.Errorf("key required without encrypt rules: %v", err)
+	}
+	enc := []transferRule{{pattern: "*.sql", encrypt: true}}
+	if err := loadRuleKey(enc, ""); err == nil {
+		t.Error("no error for an encrypt rule without a key")
+	}
+	keyFile := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(keyFile, []byte(strings.Repeat("01", 32)), 0o600)
+	if err := loadRuleKey(enc, keyFile); err != nil || len(enc[0].key) != 32 {
+		t.Errorf("loadRuleKey = %v, key %x", err, enc[0].key)
+	}
+}
+
+func TestRuleWriter(t *testing.T) {
+	plain := []byte(strings.Repeat("log line\n", 10000))
+	r := transferRule{pattern: "*.log", compress: true, encrypt: true, verify: true, key: testKey(7)}
+	if got := r.remoteName("app.log"); got != "app.log.zst.enc" {
+		t.Errorf("remoteName = %q", got)
+	}
+	var stored bytes.Buffer
+	rw, err := newRuleWriter(&stored, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw.Write(plain)
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rw.stored() != hexSHA256(stored.String()) {
+		t.Error("stored checksum does not match the bytes written")
+	}
+	if stored.Len() >= len(plain) {
+		t.Errorf("stored %d bytes of %d, expected compression", stored.Len(), len(plain))
+	}
+
+	dr, err := newDecryptReader(&stored, r.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zstd.NewReader(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if got, err := io.ReadAll(zr); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("round trip: %d bytes, %v", len(got), err)
+	}
+}
+
+func TestUploadPipelinedRules(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(local, []byte(strings.Repeat("x", 5000)), 0o644)
+	r := transferRule{pattern: "*.log", compress: true, verify: true}
+	fsys := newTestDirFS(t, nil)
+	items := []pipelineItem{{local: local, remote: r.remoteName("out/app.log"), size: 5000, rule: r}}
+	var failed error
+	uploadPipelined(context.Background(), fsys, items, 1, func(_ pipelineItem, err error) { failed = err })
+	if failed != nil {
+		t.Fatal(failed)
+	}
+	zr, err := zstd.NewReader(strings.NewReader(readTestFile(t, fsys, "out/app.log.zst")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if got, _ := io.ReadAll(zr); len(got) != 5000 {
+		t.Errorf("decompressed %d bytes, want 5000", len(got))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonSchemaVersion is the major version of the -json output schemas.
+// Within a version fields are only ever added; renaming or removing one, or
+// changing its type or meaning, needs a new version.
+const jsonSchemaVersion = 1
+
+// schemaName names the schema of a command's JSON output, e.g.
+// smbput.stat/v1.
+func schemaName(kind string) string {
+	return fmt.Sprintf("smbput.%s/v%d", kind, jsonSchemaVersion)
+}
+
+// schemaTagged encodes v, which must encode as a JSON object, with a
+// "schema" member in front of its own.
+type schemaTagged struct {
+	schema string
+	v      any
+}
+
+func (s schemaTagged) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(s.v)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || data[0] != '{' {
+		return nil, fmt.Errorf("%T does not encode as a JSON object", s.v)
+	}
+	name, _ := json.Marshal(s.schema)
+	var b bytes.Buffer
+	b.WriteString(`{"schema":`)
+	b.Write(name)
+	if string(data) != "{}" {
+		b.WriteByte(',')
+	}
+	b.Write(data[1:])
+	return b.Bytes(), nil
+}
+
+// withSchema tags a JSON object with the schema of kind.
+func withSchema(kind string, v any) schemaTagged {
+	return schemaTagged{schemaName(kind), v}
+}
+
+// withSchemaEach tags every element of a list, so the output stays an
+// array that each entry of can be told apart by itself.
+func withSchemaEach[T any](kind string, items []T) []schemaTagged {
+	out := make([]schemaTagged, len(items))
+	for i, it := range items {
+		out[i] = withSchema(kind, it)
+	}
+	return out
+}
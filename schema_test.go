@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWithSchema(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{struct {
+			Name string `json:"name"`
+		}{"a"}, `{"schema":"smbput.stat/v1","name":"a"}`},
+		{struct{}{}, `{"schema":"smbput.stat/v1"}`},
+		{map[string]int{"n": 1}, `{"schema":"smbput.stat/v1","n":1}`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(withSchema("stat", tt.v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("%+v encodes as %s, want %s", tt.v, data, tt.want)
+		}
+	}
+	if _, err := json.Marshal(withSchema("stat", []int{1})); err == nil {
+		t.Error("a list was tagged as an object")
+	}
+}
+
+func TestWithSchemaEachIndented(t *testing.T) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetIndent("", "  ")
+	rows := []selftestResult{{Check: "mkdir", Result: "ok"}}
+	if err := enc.Encode(withSchemaEach("selftest", rows)); err != nil {
+		t.Fatal(err)
+	}
+	want := "[\n  {\n    \"schema\": \"smbput.selftest/v1\",\n    \"check\": \"mkdir\",\n    \"result\": \"ok\"\n  }\n]\n"
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// scriptCommands are the commands exec runs. Commands that never finish on
+// their own (watch, tail -f) or work outside the share are left out.
+var scriptCommands = map[string]bool{
+	"put": true, "get": true, "rm": true, "mkdir": true, "rmdir": true,
+	"mv": true, "cp": true, "symlink": true, "ls": true, "stat": true,
+}
+
+// scriptStep is one parsed line of an exec script.
+type scriptStep struct {
+	line int
+	text string
+	cmd  *command
+	opts smbOptions
+	args []string
+}
+
+// splitScriptLine splits a line into words the way a POSIX shell would for
+// simple commands: blanks separate words, single quotes keep everything
+// literally, double quotes allow \" and \\, a backslash outside quotes
+// escapes the next character, and a # starting a word begins a comment.
+func splitScriptLine(line string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '#' && !inWord:
+			return words, nil
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, errors.New("line ends with a backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// parseScript reads a whole script and checks every line, command, flag,
+// and argument count before anything runs, so a typo near the end does not
+// surface after hundreds of operations. Each line gets its own copy of opts
+// with the command's flags applied; connection settings come from the exec
+// command line alone.
+func parseScript(r io.Reader, opts smbOptions) ([]scriptStep, error) {
+	var steps []scriptStep
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		words, err := splitScriptLine(sc.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if len(words) == 0 {
+			continue
+		}
+		cmd := lookupCommand(words[0])
+		if cmd == nil || !scriptCommands[cmd.name] {
+			return nil, fmt.Errorf("line %d: %q cannot be used in a script", n, words[0])
+		}
+		step := scriptStep{line: n, text: strings.TrimSpace(sc.Text()), cmd: cmd, opts: opts}
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		if cmd.setFlags != nil {
+			cmd.setFlags(fs, &step.opts)
+		}
+		if step.args, err = parseInterspersed(fs, words[1:]); err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n, cmd.name, err)
+		}
+		if !cmd.acceptsArgs(len(step.args)) {
+			return nil, fmt.Errorf("line %d: %s: expected %s", n, cmd.name, cmd.synopsis())
+		}
+		if opts.share == "" && !hasRemoteURL(step.args) {
+			return nil, fmt.Errorf("line %d: %s: a share is required (-share or smb:// URLs)", n, cmd.name)
+		}
+		steps = append(steps, step)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// scriptSession is the one session every step of a script shares. It is
+// dialed on first use and again after a connection error has dropped it.
+type scriptSession struct {
+	mu      sync.Mutex
+	shares  *shareSet
+	cleanup func()
+}
+
+// open returns the shared session. Its cleanup does nothing: the session
+// outlives each command and is closed by drop.
+func (s *scriptSession) open(opts smbOptions) (*shareSet, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shares == nil {
+		opts.session = nil
+		shares, cleanup, err := openShareSet(opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.shares, s.cleanup = shares, cleanup
+	}
+	return s.shares, func() {}, nil
+}
+
+// drop closes the session so the next command dials a fresh one. A nil
+// session ignores it.
+func (s *scriptSession) drop() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shares != nil {
+		s.cleanup()
+		s.shares, s.cleanup = nil, nil
+	}
+}
+
+// runScript runs steps in order over one session. Without keepGoing it
+// stops at the first failure; with it every step runs and the failures are
+// counted at the end.
+func runScript(ctx context.Context, steps []scriptStep, keepGoing bool) error {
+	session := &scriptSession{}
+	defer session.drop()
+	failed := 0
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		opts := step.opts
+		opts.session = session
+		err := step.cmd.run(ctx, opts, step.args)
+		if err == nil {
+			continue
+		}
+		if isConnectionError(err) {
+			session.drop()
+		}
+		if !keepGoing {
+			return fmt.Errorf("line %d: %s: %w", step.line, step.text, err)
+		}
+		log.Printf("line %d: %s: %v", step.line, step.text, err)
+		failed++
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d commands failed", failed, len(steps))
+	}
+	return nil
+}
+
+// execScript runs the script in name, or stdin for -.
+func execScript(ctx context.Context, opts smbOptions, name string, keepGoing bool) error {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	steps, err := parseScript(r, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return runScript(ctx, steps, keepGoing)
+}
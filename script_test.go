@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitScriptLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+		ok   bool
+	}{
+		{"put a.txt b.txt", []string{"put", "a.txt", "b.txt"}, true},
+		{"  put\t'my file.txt'  \"dir/x y\"  ", []string{"put", "my file.txt", "dir/x y"}, true},
+		{`mv a\ b "c\"d" 'e\f'`, []string{"mv", "a b", `c"d`, `e\f`}, true},
+		{"rm x # trailing comment", []string{"rm", "x"}, true},
+		{"rm a#b", []string{"rm", "a#b"}, true},
+		{"# whole line", nil, true},
+		{"put ''", []string{"put", ""}, true},
+		{"put 'open", nil, false},
+		{`put x\`, nil, false},
+	}
+	for _, tt := range tests {
+		got, err := splitScriptLine(tt.line)
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitScriptLine(%q) = %q, %v", tt.line, got, err)
+		}
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	script := `# nightly
+mkdir out
+put -resume data.csv out/data.csv
+
+rm -r out/old
+`
+	steps, err := parseScript(strings.NewReader(script), smbOptions{share: "drop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 3 {
+		t.Fatalf("got %d steps, want 3", len(steps))
+	}
+	if steps[1].line != 3 || steps[1].cmd.name != "put" || !steps[1].opts.resume || !reflect.DeepEqual(steps[1].args, []string{"data.csv", "out/data.csv"}) {
+		t.Errorf("put step = line %d %s resume=%v %q", steps[1].line, steps[1].cmd.name, steps[1].opts.resume, steps[1].args)
+	}
+	if steps[0].opts.recursive || !steps[2].opts.recursive {
+		t.Error("-r leaked between lines")
+	}
+
+	for _, bad := range []string{
+		"watch incoming",
+		"frobnicate x",
+		"put only-one-arg",
+		"rm -nope x",
+		"put -server other a b",
+		"mkdir 'x",
+	} {
+		if _, err := parseScript(strings.NewReader("mkdir ok\n"+bad+"\n"), smbOptions{share: "drop"}); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+			t.Errorf("%q: err = %v, want a line 2 error", bad, err)
+		}
+	}
+	if _, err := parseScript(strings.NewReader("mkdir x\n"), smbOptions{}); err == nil {
+		t.Error("expected an error without a share")
+	}
+	if _, err := parseScript(strings.NewReader("mkdir smb://nas/other/x\n"), smbOptions{}); err != nil {
+		t.Errorf("smb:// URL without -share: %v", err)
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	var ran []string
+	var sessions []*scriptSession
+	fail := errors.New("denied")
+	step := func(line int, name string, err error) scriptStep {
+		cmd := &command{name: name, run: func(ctx context.Context, opts smbOptions, args []string) error {
+			ran = append(ran, name)
+			sessions = append(sessions, opts.session)
+			return err
+		}}
+		return scriptStep{line: line, text: name, cmd: cmd}
+	}
+	steps := []scriptStep{step(1, "a", nil), step(2, "b", fail), step(3, "c", nil)}
+
+	err := runScript(context.Background(), steps, false)
+	if !errors.Is(err, fail) || !strings.Contains(err.Error(), "line 2: b") || !reflect.DeepEqual(ran, []string{"a", "b"}) {
+		t.Errorf("stop on error: %v after %q", err, ran)
+	}
+	if sessions[0] == nil || sessions[0] != sessions[1] {
+		t.Error("steps did not share one session")
+	}
+
+	ran = nil
+	err = runScript(context.Background(), steps, true)
+	if err == nil || err.Error() != "1 of 3 commands failed" || !reflect.DeepEqual(ran, []string{"a", "b", "c"}) {
+		t.Errorf("keep going: %v after %q", err, ran)
+	}
+}
+
+func TestScriptSessionDrop(t *testing.T) {
+	closed := 0
+	s := &scriptSession{shares: &shareSet{}, cleanup: func() { closed++ }}
+	s.drop()
+	s.drop()
+	if closed != 1 || s.shares != nil {
+		t.Fatalf("drop closed the session %d times, shares %v", closed, s.shares)
+	}
+	var none *scriptSession
+	none.drop()
+}
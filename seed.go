@@ -0,0 +1,237 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// seedBufferedMax is the largest archive member read into memory and handed
+// to the writer pool. Bigger members are streamed straight from the archive,
+// which has to be read in order anyway, so at most jobs+1 buffered members
+// are held in memory.
+const seedBufferedMax = 4 << 20
+
+// openArchive opens a tar archive, decompressing it according to its
+// extension: .tar, .tar.gz or .tgz, and .tar.zst or .tzst.
+func openArchive(name string) (io.Reader, func(), error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open archive: %w", err)
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar"):
+		return f, func() { f.Close() }, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("open archive: %w", err)
+		}
+		return zr, func() { zr.Close(); f.Close() }, nil
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("open archive: %w", err)
+		}
+		return zr, func() { zr.Close(); f.Close() }, nil
+	}
+	f.Close()
+	return nil, nil, fmt.Errorf("%s: unknown archive type; want .tar, .tar.gz, .tgz, .tar.zst, or .tzst", name)
+}
+
+// archivePath validates a member name and returns it as a clean relative
+// path. Absolute names and names escaping the root with .. are rejected so
+// a crafted archive cannot write outside the destination directory.
+func archivePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	p := path.Clean(name)
+	if strings.HasPrefix(name, "/") || p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("archive member %q escapes the destination", name)
+	}
+	return p, nil
+}
+
+// seedSink receives what an archive expands to, by path relative to the
+// destination. write may be called from several goroutines at once.
+type seedSink struct {
+	mkdir func(dir string, mtime time.Time) error
+	write func(p string, r io.Reader, mtime time.Time) error
+}
+
+type seedResult struct {
+	files, skipped int
+	bytes          int64
+}
+
+// expandArchive writes every directory and regular file of the tar stream r
+// to sink, with up to jobs files in flight. Other member types such as
+// symlinks and devices are skipped with a warning. The first failure stops
+// the expansion.
+func expandArchive(ctx context.Context, r io.Reader, sink seedSink, jobs int) (seedResult, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		res     seedResult
+		mu      sync.Mutex
+		werr    error
+		wg      sync.WaitGroup
+		pending = make(chan struct{}, jobs)
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if werr == nil {
+			werr = err
+			cancel()
+		}
+		mu.Unlock()
+	}
+	failed := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return werr
+	}
+
+	tr := tar.NewReader(ctxReader{ctx, r})
+	for failed() == nil {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fail(fmt.Errorf("read archive: %w", err))
+			break
+		}
+		p, err := archivePath(hdr.Name)
+		if err != nil {
+			fail(err)
+			break
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if p != "." {
+				if err := sink.mkdir(p, hdr.ModTime); err != nil {
+					fail(err)
+				}
+			}
+			continue
+		case tar.TypeReg:
+		default:
+			log.Printf("warning: %s: skipping archive member of type %q", p, hdr.Typeflag)
+			res.skipped++
+			continue
+		}
+
+		res.files++
+		res.bytes += hdr.Size
+		if hdr.Size > seedBufferedMax {
+			if err := sink.write(p, tr, hdr.ModTime); err != nil {
+				fail(fmt.Errorf("%s: %w", p, err))
+			}
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			fail(fmt.Errorf("read archive: %w", err))
+			break
+		}
+		pending <- struct{}{}
+		wg.Add(1)
+		go func(p string, mtime time.Time) {
+			defer func() { <-pending; wg.Done() }()
+			if err := sink.write(p, bytes.NewReader(data), mtime); err != nil {
+				fail(fmt.Errorf("%s: %w", p, err))
+			}
+		}(p, hdr.ModTime)
+	}
+	wg.Wait()
+	if err := failed(); err != nil {
+		return res, err
+	}
+	return res, ctx.Err()
+}
+
+// seedRemote expands archive into remoteDir on the share. It is meant for the
+// first copy of a large tree over a fast link: many small files are written
+// in parallel and nothing is compared with what the share already holds.
+// Directory times are applied last, deepest first, since writing into a
+// directory changes its modification time.
+func seedRemote(ctx context.Context, share *smb2.Share, archive, remoteDir string, jobs int) error {
+	r, closeArchive, err := openArchive(archive)
+	if err != nil {
+		return err
+	}
+	defer closeArchive()
+
+	remoteDir = normalizeRemotePath(remoteDir)
+	var (
+		mu    sync.Mutex
+		dirs  = newRemoteDirs(shareFS(share))
+		times = newDirTimes()
+	)
+	sink := seedSink{
+		mkdir: func(dir string, mtime time.Time) error {
+			dir = joinRemote(remoteDir, dir)
+			if err := dirs.mkdirAll(dir); err != nil {
+				return err
+			}
+			mu.Lock()
+			times.record(dir, mtime)
+			mu.Unlock()
+			return nil
+		},
+		write: func(p string, r io.Reader, mtime time.Time) error {
+			p = joinRemote(remoteDir, p)
+			if err := dirs.mkdirAll(path.Dir(p)); err != nil {
+				return err
+			}
+			start := time.Now()
+			dst, err := share.Create(p)
+			opStats.observe("create", start)
+			if err != nil {
+				return fmt.Errorf("create remote: %w", err)
+			}
+			if _, err := copyChunked(timedWriter{dst, "write"}, ctxReader{ctx, r}); err != nil {
+				dst.Close()
+				return err
+			}
+			if err := dst.Close(); err != nil {
+				return err
+			}
+			return share.Chtimes(p, mtime, mtime)
+		},
+	}
+
+	start := time.Now()
+	res, err := expandArchive(ctx, r, sink, jobs)
+	if err != nil {
+		return fmt.Errorf("seed %s: %w", remoteDir, err)
+	}
+	if err := times.apply(shareFS(share)); err != nil {
+		log.Printf("warning: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "seeded %d files (%s) into %s in %s", res.files, humanBytes(res.bytes), remoteDir, time.Since(start).Round(time.Millisecond))
+	if res.skipped > 0 {
+		fmt.Fprintf(os.Stderr, ", skipped %d non-regular members", res.skipped)
+	}
+	fmt.Fprintln(os.Stderr)
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestArchivePath(t *testing.T) {
+	tests := []struct {
+		name, want string
+		wantErr    bool
+	}{
+		{"a/b.txt", "a/b.txt", false},
+		{"./a//b/", "a/b", false},
+		{"a/../b", "b", false},
+		{"../etc/passwd", "", true},
+		{"a/../../x", "", true},
+		{"/etc/passwd", "", true},
+		{"..\\x", "", true},
+	}
+	for _, tt := range tests {
+		got, err := archivePath(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("archivePath(%q) = %q, %v; want %q, err %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+type tarMember struct {
+	name string
+	kind byte
+	body string
+}
+
+func buildTar(t *testing.T, w io.Writer, members []tarMember) {
+	t.Helper()
+	tw := tar.NewWriter(w)
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Typeflag: m.kind, Size: int64(len(m.body)), Mode: 0o644, ModTime: mtime}
+		if m.kind == tar.TypeSymlink {
+			hdr.Linkname, hdr.Size = "target", 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, m.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// memSink collects what an expansion writes.
+type memSink struct {
+	mu    sync.Mutex
+	dirs  []string
+	files map[string]string
+}
+
+func (m *memSink) sink() seedSink {
+	m.files = make(map[string]string)
+	return seedSink{
+		mkdir: func(dir string, _ time.Time) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.dirs = append(m.dirs, dir)
+			return nil
+		},
+		write: func(p string, r io.Reader, _ time.Time) error {
+			data, err := io.ReadAll(r)
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.files[p] = string(data)
+			return err
+		},
+	}
+}
+
+func TestExpandArchive(t *testing.T) {
+	big := strings.Repeat("x", seedBufferedMax+1)
+	var buf bytes.Buffer
+	buildTar(t, &buf, []tarMember{
+		{"./", tar.TypeDir, ""},
+		{"docs/", tar.TypeDir, ""},
+		{"docs/a.txt", tar.TypeReg, "alpha"},
+		{"docs/link", tar.TypeSymlink, ""},
+		{"big.bin", tar.TypeReg, big},
+		{"b.txt", tar.TypeReg, "beta"},
+	})
+
+	var m memSink
+	res, err := expandArchive(context.Background(), &buf, m.sink(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.files != 3 || res.skipped != 1 || res.bytes != int64(len(big)+9) {
+		t.Errorf("result = %+v", res)
+	}
+	if !reflect.DeepEqual(m.dirs, []string{"docs"}) {
+		t.Errorf("dirs = %v, want [docs]", m.dirs)
+	}
+	var names []string
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"b.txt", "big.bin", "docs/a.txt"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("files = %v, want %v", names, want)
+	}
+	if m.files["docs/a.txt"] != "alpha" || m.files["big.bin"] != big {
+		t.Error("file contents differ from the archive")
+	}
+}
+
+func TestExpandArchiveRejectsEscapingMembers(t *testing.T) {
+	var buf bytes.Buffer
+	buildTar(t, &buf, []tarMember{{"../evil.txt", tar.TypeReg, "x"}})
+	var m memSink
+	if _, err := expandArchive(context.Background(), &buf, m.sink(), 2); err == nil {
+		t.Fatal("archive escaping the destination was expanded")
+	}
+	if len(m.files) != 0 {
+		t.Errorf("wrote %v", m.files)
+	}
+}
+
+func TestOpenArchiveZstd(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "tree.tar.zst")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buildTar(t, zw, []tarMember{{"a.txt", tar.TypeReg, "zstd payload"}})
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, closeArchive, err := openArchive(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeArchive()
+	var m memSink
+	if _, err := expandArchive(context.Background(), r, m.sink(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if m.files["a.txt"] != "zstd payload" {
+		t.Errorf("files = %v", m.files)
+	}
+	zip := filepath.Join(t.TempDir(), "tree.zip")
+	if err := os.WriteFile(zip, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := openArchive(zip); err == nil {
+		t.Error("unknown archive type accepted")
+	}
+}
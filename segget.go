@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxSegments bounds -segments.
+	maxSegments = 32
+	// minSegmentSize is the least a segment of a download fetches; smaller
+	// files are split into fewer segments.
+	minSegmentSize = 16 << 20
+	// segmentSaveInterval is how often a segmented download records the
+	// progress of its segments.
+	segmentSaveInterval = time.Second
+)
+
+// segment is a byte range of a segmented download, of which done bytes
+// from start on are written.
+type segment struct {
+	start, end int64
+	done       int64
+}
+
+// splitSegments divides [from, to) into at most n ranges of about equal
+// size, none smaller than minSegmentSize unless there is only one.
+func splitSegments(from, to int64, n int) []segment {
+	size := to - from
+	n = int(max(min(int64(n), size/minSegmentSize), 1))
+	segs := make([]segment, n)
+	for i := range segs {
+		segs[i] = segment{start: from + size*int64(i)/int64(n), end: from + size*int64(i+1)/int64(n)}
+	}
+	return segs
+}
+
+// errSegmentAborted stops the other segments once one has failed.
+var errSegmentAborted = errors.New("segment aborted")
+
+// segmentWriter writes a segment's data at its place in the local file.
+type segmentWriter struct {
+	dst     io.WriterAt
+	seg     *segment
+	aborted *atomic.Bool
+}
+
+func (w segmentWriter) Write(p []byte) (int, error) {
+	if w.aborted.Load() {
+		return 0, errSegmentAborted
+	}
+	n, err := w.dst.WriteAt(p, w.seg.start+atomic.LoadInt64(&w.seg.done))
+	atomic.AddInt64(&w.seg.done, int64(n))
+	return n, err
+}
+
+// segmentStatePath is the sidecar file recording a segmented download of
+// local. The local file is allocated to its full size before any data
+// arrives, so unlike a plain download its size says nothing about how far
+// it got, and -resume goes by the sidecar instead.
+func segmentStatePath(local string) string {
+	return local + ".segments"
+}
+
+type segmentState struct {
+	Size     int64          `json:"size"`
+	Segments []segmentEntry `json:"segments"`
+}
+
+type segmentEntry struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+// saveSegments atomically records segs, the segments of a size-byte file,
+// at path.
+func saveSegments(path string, size int64, segs []segment) error {
+	state := segmentState{Size: size}
+	for i := range segs {
+		s := &segs[i]
+		state.Segments = append(state.Segments, segmentEntry{Start: s.start, End: s.end, Done: atomic.LoadInt64(&s.done)})
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write segment state %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename segment state %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadSegments reads the segments saveSegments recorded at path. It
+// returns nil if there are none, and an error if they are unreadable or
+// are not those of a size-byte file.
+func loadSegments(path string, size int64) ([]segment, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read segment state %s: %w", path, err)
+	}
+	var state segmentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse segment state %s: %w", path, err)
+	}
+	if state.Size != size {
+		return nil, fmt.Errorf("segment state %s is for a file of %d bytes, not %d", path, state.Size, size)
+	}
+	var segs []segment
+	for i, e := range state.Segments {
+		if e.Start > e.End || e.Done < 0 || e.Done > e.End-e.Start || (i > 0 && e.Start != segs[i-1].end) {
+			return nil, fmt.Errorf("segment state %s: invalid segment %+v", path, e)
+		}
+		segs = append(segs, segment{start: e.Start, end: e.End, done: e.Done})
+	}
+	if len(segs) == 0 || segs[len(segs)-1].end != size {
+		return nil, fmt.Errorf("segment state %s does not cover the file", path)
+	}
+	return segs, nil
+}
+
+// copySegmented downloads the segments of src concurrently, each through
+// wrap, and writes them straight to their offsets in dst (pwrite), which is
+// first allocated to its final size, so no parts are kept on disk to be
+// merged afterwards. Segments continue from their done bytes. Unless save
+// is nil, it is called with segs before dst is allocated, every
+// segmentSaveInterval while data arrives, and once the copy ends, each time
+// after what segs count as done has been synced to disk, so that whatever
+// it records is in dst even after a crash. It returns how many bytes are in
+// place contiguously from the first segment's start.
+func copySegmented(dst *os.File, src io.ReaderAt, segs []segment, wrap func(io.Reader) io.Reader, save func([]segment) error) (int64, error) {
+	if len(segs) == 0 {
+		return 0, nil
+	}
+	from, to := segs[0].start, segs[len(segs)-1].end
+	if save != nil {
+		if err := save(segs); err != nil {
+			return 0, err
+		}
+	}
+	if err := preallocate(dst, to); err != nil {
+		return 0, err
+	}
+	checkpoint := func() error {
+		// A snapshot of segs, taken before the sync, so all it counts is
+		// on disk when it is saved.
+		snap := make([]segment, len(segs))
+		for i := range segs {
+			snap[i] = segment{start: segs[i].start, end: segs[i].end, done: atomic.LoadInt64(&segs[i].done)}
+		}
+		if err := dst.Sync(); err != nil {
+			return err
+		}
+		return save(snap)
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		aborted  atomic.Bool
+	)
+	stop := make(chan struct{})
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		if save == nil {
+			return
+		}
+		tick := time.NewTicker(segmentSaveInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tick.C:
+				checkpoint() // the final checkpoint reports failures
+			}
+		}
+	}()
+	for i := range segs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := &segs[i]
+			r := wrap(io.NewSectionReader(src, s.start+s.done, s.end-s.start-s.done))
+			w := segmentWriter{dst: dst, seg: s, aborted: &aborted}
+			_, err := io.CopyBuffer(w, struct{ io.Reader }{r}, make([]byte, copyBufferSize))
+			if err != nil && !errors.Is(err, errSegmentAborted) {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				aborted.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-saved
+	if save != nil {
+		if err := checkpoint(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	done := from
+	for _, s := range segs {
+		done = s.start + s.done
+		if done < s.end {
+			break
+		}
+	}
+	return done - from, firstErr
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitSegments(t *testing.T) {
+	segs := splitSegments(10, 10+4*minSegmentSize+3, 8)
+	if len(segs) != 4 || segs[0].start != 10 || segs[3].end != 10+4*minSegmentSize+3 {
+		t.Fatalf("segments %+v", segs)
+	}
+	for i := 1; i < len(segs); i++ {
+		if segs[i].start != segs[i-1].end {
+			t.Errorf("gap between %+v and %+v", segs[i-1], segs[i])
+		}
+	}
+	if segs := splitSegments(0, 100, 8); len(segs) != 1 || segs[0].end != 100 {
+		t.Errorf("small file split into %+v", segs)
+	}
+}
+
+func TestCopySegmented(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	dst, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	dst.Write(data[:1000]) // resumed after 1000 bytes
+	segs := []segment{{start: 1000, end: 20000}, {start: 20000, end: 40000}, {start: 40000, end: int64(len(data))}}
+	n, err := copySegmented(dst, bytes.NewReader(data), segs, func(r io.Reader) io.Reader { return r }, nil)
+	if err != nil || n != int64(len(data))-1000 {
+		t.Fatalf("copySegmented = %d, %v", n, err)
+	}
+	got, _ := os.ReadFile(dst.Name())
+	if !bytes.Equal(got, data) {
+		t.Error("content differs")
+	}
+}
+
+// failingReader fails after limit bytes.
+type failingReader struct {
+	r     io.Reader
+	limit int
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.limit <= 0 {
+		return 0, errors.New("connection reset")
+	}
+	p = p[:min(len(p), f.limit)]
+	n, err := f.r.Read(p)
+	f.limit -= n
+	return n, err
+}
+
+func TestCopySegmentedResumesFromSavedSegments(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 3000)
+	dir := t.TempDir()
+	dst, err := os.Create(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	state := segmentStatePath(dst.Name())
+	size := int64(len(data))
+	save := func(segs []segment) error { return saveSegments(state, size, segs) }
+	segs := []segment{{start: 0, end: 10000}, {start: 10000, end: 20000}, {start: 20000, end: 30000}}
+	wrap := func(r io.Reader) io.Reader {
+		if _, off, _ := r.(*io.SectionReader).Outer(); off == 0 {
+			return &failingReader{r: r, limit: 4000}
+		}
+		return r
+	}
+	n, err := copySegmented(dst, bytes.NewReader(data), segs, wrap, save)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if n != 4000 {
+		t.Errorf("returned %d, want 4000 contiguous bytes", n)
+	}
+	// The file keeps its allocated size, so only the sidecar tells what
+	// arrived.
+	saved, err := loadSegments(state, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// How far the other segments got before the failure stopped them varies.
+	if len(saved) != 3 || saved[0].done != 4000 {
+		t.Fatalf("saved segments %+v", saved)
+	}
+	if n, err := copySegmented(dst, bytes.NewReader(data), saved, func(r io.Reader) io.Reader { return r }, save); err != nil || n != size {
+		t.Fatalf("resumed copySegmented = %d, %v", n, err)
+	}
+	if got, _ := os.ReadFile(dst.Name()); !bytes.Equal(got, data) {
+		t.Error("content differs after resuming")
+	}
+}
+
+func TestLoadSegments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.segments")
+	if segs, err := loadSegments(path, 100); segs != nil || err != nil {
+		t.Errorf("missing sidecar = %+v, %v", segs, err)
+	}
+	if err := saveSegments(path, 100, []segment{{start: 0, end: 50, done: 50}, {start: 50, end: 100, done: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	if segs, err := loadSegments(path, 100); err != nil || len(segs) != 2 || segs[1].done != 10 {
+		t.Errorf("loadSegments = %+v, %v", segs, err)
+	}
+	// The remote file changed size since.
+	if _, err := loadSegments(path, 200); err == nil {
+		t.Error("segments of a 100-byte file accepted for 200 bytes")
+	}
+	os.WriteFile(path, []byte(`{"size":100,"segments":[{"start":0,"end":50,"done":60},{"start":50,"end":100}]}`), 0o644)
+	if _, err := loadSegments(path, 100); err == nil {
+		t.Error("segment done past its end accepted")
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// selftestLarge is the size of the large test file, which is written the way
+// tuned uploads are, with several writes in flight.
+const selftestLarge = 8 << 20
+
+var selftestTuning = transferTuning{chunk: 1 << 20, depth: 4}
+
+// selftestEnv is what the checks run against: the share and the scratch
+// directory. chmod is separate because remoteFS has no attribute setter.
+type selftestEnv struct {
+	fs    remoteFS
+	chmod func(name string, mode os.FileMode) error
+	dir   string
+}
+
+func (e selftestEnv) path(name string) string { return joinRemote(e.dir, name) }
+
+// selftestCheck is one operation of the battery. It is skipped when a check
+// it needs did not pass, since it would only fail for the same reason.
+type selftestCheck struct {
+	name  string
+	needs []string
+	run   func(e selftestEnv) error
+}
+
+// selftestResult is one row of the compatibility matrix.
+type selftestResult struct {
+	Check    string `json:"check"`
+	Result   string `json:"result"` // "ok", "failed", or "skipped"
+	Duration string `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// patternByte is the content of the large test file at offset i, so any
+// range of it can be checked without keeping a copy.
+func patternByte(i int64) byte { return byte(i % 251) }
+
+type patternReader struct{ off, size int64 }
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	n := int64(len(p))
+	if n > r.size-r.off {
+		n = r.size - r.off
+	}
+	for i := range n {
+		p[i] = patternByte(r.off + i)
+	}
+	r.off += n
+	return int(n), nil
+}
+
+func writeRemoteFile(fsys remoteFS, name string, data []byte) error {
+	f, err := fsys.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readRemoteFile(fsys remoteFS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// selftestChecks is the battery, in the order it runs.
+var selftestChecks = []selftestCheck{
+	{name: "mkdir", run: func(e selftestEnv) error {
+		if err := e.fs.Mkdir(e.path("sub"), 0o755); err != nil {
+			return err
+		}
+		fi, err := e.fs.Stat(e.path("sub"))
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return errors.New("created directory is not listed as one")
+		}
+		return nil
+	}},
+	{name: "put-small", needs: []string{"mkdir"}, run: func(e selftestEnv) error {
+		want := []byte("smbput selftest\n")
+		if err := writeRemoteFile(e.fs, e.path("sub/small.txt"), want); err != nil {
+			return err
+		}
+		got, err := readRemoteFile(e.fs, e.path("sub/small.txt"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("read back %q, wrote %q", got, want)
+		}
+		return nil
+	}},
+	{name: "put-large", needs: []string{"mkdir"}, run: func(e selftestEnv) error {
+		f, err := e.fs.Create(e.path("sub/large.bin"))
+		if err != nil {
+			return err
+		}
+		_, err = copyTuned(f, 0, &patternReader{size: selftestLarge}, selftestTuning)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		got, err := readRemoteFile(e.fs, e.path("sub/large.bin"))
+		if err != nil {
+			return err
+		}
+		if len(got) != selftestLarge {
+			return fmt.Errorf("read back %d bytes, wrote %d", len(got), selftestLarge)
+		}
+		for i, b := range got {
+			if b != patternByte(int64(i)) {
+				return fmt.Errorf("content differs at offset %d", i)
+			}
+		}
+		return nil
+	}},
+	{name: "ranged-read", needs: []string{"put-large"}, run: func(e selftestEnv) error {
+		f, err := e.fs.Open(e.path("sub/large.bin"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// An odd offset and length straddling a 64 KiB boundary, and the
+		// tail, which must end in io.EOF rather than garbage.
+		for _, r := range []struct{ off, n int64 }{{65536 - 1000, 70001}, {selftestLarge - 100, 100}} {
+			buf := make([]byte, r.n)
+			if n, err := f.ReadAt(buf, r.off); int64(n) != r.n || err != nil && err != io.EOF {
+				return fmt.Errorf("read %d bytes at %d: got %d, %v", r.n, r.off, n, err)
+			}
+			for i, b := range buf {
+				if b != patternByte(r.off+int64(i)) {
+					return fmt.Errorf("content differs at offset %d", r.off+int64(i))
+				}
+			}
+		}
+		if n, err := f.ReadAt(make([]byte, 10), selftestLarge); n != 0 || err != io.EOF {
+			return fmt.Errorf("read past the end: got %d, %v", n, err)
+		}
+		return nil
+	}},
+	{name: "set-times", needs: []string{"put-small"}, run: func(e selftestEnv) error {
+		p := e.path("sub/small.txt")
+		mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+		if err := e.fs.Chtimes(p, mtime, mtime); err != nil {
+			return err
+		}
+		fi, err := e.fs.Stat(p)
+		if err != nil {
+			return err
+		}
+		if !withinWindow(fi.ModTime(), mtime) {
+			return fmt.Errorf("modification time reads back as %s, set %s", fi.ModTime().UTC().Format(time.RFC3339), mtime.Format(time.RFC3339))
+		}
+		return nil
+	}},
+	{name: "set-readonly", needs: []string{"put-small"}, run: func(e selftestEnv) error {
+		p := e.path("sub/readonly.txt")
+		if err := writeRemoteFile(e.fs, p, []byte("x")); err != nil {
+			return err
+		}
+		if err := e.chmod(p, 0o444); err != nil {
+			return err
+		}
+		fi, err := e.fs.Stat(p)
+		if err == nil && fi.Mode().Perm()&0o200 != 0 {
+			err = errors.New("READONLY does not read back as set")
+		}
+		// Cleared in any case, or the delete check could not remove it.
+		if cerr := e.chmod(p, 0o644); err == nil && cerr != nil {
+			err = fmt.Errorf("clear READONLY: %w", cerr)
+		}
+		return err
+	}},
+	{name: "rename", needs: []string{"put-small"}, run: func(e selftestEnv) error {
+		if err := e.fs.Rename(e.path("sub/small.txt"), e.path("sub/renamed.txt")); err != nil {
+			return err
+		}
+		if _, err := e.fs.Stat(e.path("sub/small.txt")); !isNotExist(err) {
+			return fmt.Errorf("old name still present: %v", err)
+		}
+		_, err := e.fs.Stat(e.path("sub/renamed.txt"))
+		return err
+	}},
+	{name: "delete", run: func(e selftestEnv) error {
+		for _, name := range []string{"sub/renamed.txt", "sub/small.txt", "sub/large.bin", "sub/readonly.txt"} {
+			if err := e.fs.Remove(e.path(name)); err != nil && !isNotExist(err) {
+				return err
+			}
+		}
+		if err := e.fs.Remove(e.path("sub")); err != nil && !isNotExist(err) {
+			return err
+		}
+		if _, err := e.fs.Stat(e.path("sub")); !isNotExist(err) {
+			return fmt.Errorf("directory still present after delete: %v", err)
+		}
+		return nil
+	}},
+}
+
+// runSelftest runs checks in a fresh scratch directory below dir, which is
+// removed again at the end, and returns one result per check.
+func runSelftest(fsys remoteFS, chmod func(string, os.FileMode) error, dir string, checks []selftestCheck) ([]selftestResult, error) {
+	scratch := joinRemote(normalizeRemotePath(dir), fmt.Sprintf(".smbput-selftest-%d", os.Getpid()))
+	if err := fsys.Mkdir(scratch, 0o755); err != nil {
+		return nil, fmt.Errorf("create scratch directory %s: %w", scratch, err)
+	}
+	env := selftestEnv{fs: fsys, chmod: chmod, dir: scratch}
+	passed := map[string]bool{}
+	var results []selftestResult
+	for _, c := range checks {
+		res := selftestResult{Check: c.name, Result: "ok"}
+		for _, n := range c.needs {
+			if !passed[n] {
+				res.Result, res.Error = "skipped", "needs "+n
+			}
+		}
+		if res.Result == "ok" {
+			start := time.Now()
+			err := c.run(env)
+			res.Duration = time.Since(start).Round(time.Millisecond).String()
+			if err != nil {
+				res.Result, res.Error = "failed", err.Error()
+			}
+		}
+		passed[c.name] = res.Result == "ok"
+		results = append(results, res)
+	}
+	if _, err := removeRemote(fsys, scratch, true, 1); err != nil {
+		return results, fmt.Errorf("remove scratch directory %s: %w", scratch, err)
+	}
+	return results, nil
+}
+
+// writeSelftest prints the results as a table, or as JSON.
+func writeSelftest(w io.Writer, results []selftestResult, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(withSchemaEach("selftest", results))
+	}
+	for _, r := range results {
+		line := fmt.Sprintf("%-13s %-8s %8s", r.Check, r.Result, r.Duration)
+		if r.Error != "" {
+			line += "  " + r.Error
+		}
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
+
+// selftestRemote runs the battery below dir and fails if any check did.
+func selftestRemote(fsys remoteFS, chmod func(string, os.FileMode) error, w io.Writer, dir string, asJSON bool) error {
+	results, runErr := runSelftest(fsys, chmod, dir, selftestChecks)
+	if results == nil {
+		return runErr
+	}
+	if err := writeSelftest(w, results, asJSON); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Result != "ok" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks did not pass", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func dirChmod(fsys dirFS) func(string, os.FileMode) error {
+	return func(name string, mode os.FileMode) error {
+		return os.Chmod(filepath.Join(fsys.root, filepath.FromSlash(name)), mode)
+	}
+}
+
+func TestSelftestPasses(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"tmp/keep": "k"})
+	var out bytes.Buffer
+	if err := selftestRemote(fsys, dirChmod(fsys), &out, "tmp", false); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(selftestChecks) {
+		t.Fatalf("%d lines for %d checks:\n%s", len(lines), len(selftestChecks), out.String())
+	}
+	for i, line := range lines {
+		if f := strings.Fields(line); f[0] != selftestChecks[i].name || f[1] != "ok" {
+			t.Errorf("line %q", line)
+		}
+	}
+	entries, _ := fsys.ReadDir("tmp")
+	if len(entries) != 1 {
+		t.Errorf("scratch directory left behind: %d entries in tmp", len(entries))
+	}
+}
+
+func TestSelftestSkipsDependents(t *testing.T) {
+	fsys := newTestDirFS(t, nil)
+	broken := func(string, os.FileMode) error { return errors.New("not supported") }
+	checks := append([]selftestCheck(nil), selftestChecks...)
+	checks[1].run = func(selftestEnv) error { return errors.New("write refused") } // put-small
+	results, err := runSelftest(fsys, broken, ".", checks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, r := range results {
+		got[r.Check] = r.Result
+	}
+	want := map[string]string{
+		"mkdir": "ok", "put-small": "failed", "put-large": "ok", "ranged-read": "ok",
+		"set-times": "skipped", "set-readonly": "skipped", "rename": "skipped", "delete": "ok",
+	}
+	for check, result := range want {
+		if got[check] != result {
+			t.Errorf("%s = %q, want %q", check, got[check], result)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeSelftest(&out, results, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "set-times     skipped            needs put-small") {
+		t.Errorf("output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// smbSession is one session on the server as reported by NetrSessionEnum
+// at level 10.
+type smbSession struct {
+	Client string
+	User   string
+	Active time.Duration
+	Idle   time.Duration
+}
+
+// sessionUser returns the bare account name the server reports sessions
+// under, dropping a DOMAIN\ prefix or @realm suffix.
+func sessionUser(user string) string {
+	if i := strings.LastIndexAny(user, `\/`); i >= 0 {
+		user = user[i+1:]
+	}
+	user, _, _ = strings.Cut(user, "@")
+	return user
+}
+
+// uncClient returns a client name in the \\NAME form NetrSessionDel expects.
+func uncClient(client string) string {
+	return `\\` + strings.TrimLeft(client, `\`)
+}
+
+func sessionEnumStub(server, user string) []byte {
+	var w ndrWriter
+	w.uniqueString(`\\` + server) // ServerName
+	w.uniqueString("")            // ClientName: any
+	w.uniqueString(user)          // UserName
+	w.uint32(10)                  // InfoStruct.Level
+	w.uint32(10)                  // union discriminant
+	w.referent()                  // SESSION_INFO_10_CONTAINER
+	w.uint32(0)                   // EntriesRead
+	w.uint32(0)                   // Buffer: NULL
+	w.uint32(0xffffffff)          // PreferedMaximumLength: everything
+	w.uint32(0)                   // ResumeHandle: NULL
+	return w.b
+}
+
+func parseSessionEnum(stub []byte) ([]smbSession, error) {
+	r := &ndrReader{b: stub}
+	r.uint32() // Level
+	r.uint32() // union discriminant
+	var sessions []smbSession
+	if containerPtr := r.uint32(); containerPtr != 0 {
+		r.uint32() // EntriesRead
+		if bufferPtr := r.uint32(); bufferPtr != 0 {
+			count := int(r.uint32())
+			if r.err == nil && count > len(stub)/16 {
+				return nil, fmt.Errorf("NetrSessionEnum: implausible entry count %d", count)
+			}
+			type ptrs struct{ client, user uint32 }
+			refs := make([]ptrs, count)
+			sessions = make([]smbSession, count)
+			for i := range sessions {
+				refs[i] = ptrs{r.uint32(), r.uint32()}
+				sessions[i].Active = time.Duration(r.uint32()) * time.Second
+				sessions[i].Idle = time.Duration(r.uint32()) * time.Second
+			}
+			for i := range sessions {
+				if refs[i].client != 0 {
+					sessions[i].Client = r.string()
+				}
+				if refs[i].user != 0 {
+					sessions[i].User = r.string()
+				}
+			}
+		}
+	}
+	r.uint32() // TotalEntries
+	if resumePtr := r.uint32(); resumePtr != 0 {
+		r.uint32() // ResumeHandle
+	}
+	status := r.uint32()
+	if r.err != nil {
+		return nil, fmt.Errorf("NetrSessionEnum: %w", r.err)
+	}
+	if err := werror("NetrSessionEnum", status); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func sessionDelStub(server, client, user string) []byte {
+	var w ndrWriter
+	w.uniqueString(`\\` + server)
+	w.uniqueString(uncClient(client))
+	w.uniqueString(user)
+	return w.b
+}
+
+// enumSessions lists user's sessions on server.
+func (p *rpcPipe) enumSessions(server, user string) ([]smbSession, error) {
+	stub, err := p.call(opNetrSessionEnum, sessionEnumStub(server, user))
+	if err != nil {
+		return nil, fmt.Errorf("NetrSessionEnum: %w", err)
+	}
+	return parseSessionEnum(stub)
+}
+
+// deleteSessions logs off every session user has from client.
+func (p *rpcPipe) deleteSessions(server, client, user string) error {
+	stub, err := p.call(opNetrSessionDel, sessionDelStub(server, client, user))
+	if err != nil {
+		return fmt.Errorf("NetrSessionDel: %w", err)
+	}
+	r := &ndrReader{b: stub}
+	status := r.uint32()
+	if r.err != nil {
+		return fmt.Errorf("NetrSessionDel: %w", r.err)
+	}
+	return werror("NetrSessionDel "+client, status)
+}
+
+// staleClients returns the clients whose sessions have all been idle for at
+// least idle. NetrSessionDel removes every session a user has from a client,
+// so a client that still has a live session (possibly this one) is left
+// alone.
+func staleClients(sessions []smbSession, idle time.Duration) []string {
+	stale := make(map[string]bool)
+	for _, s := range sessions {
+		old, seen := stale[s.Client]
+		stale[s.Client] = (old || !seen) && s.Idle >= idle
+	}
+	var clients []string
+	for client, ok := range stale {
+		if ok {
+			clients = append(clients, client)
+		}
+	}
+	sort.Strings(clients)
+	return clients
+}
+
+func writeSessions(w io.Writer, sessions []smbSession) {
+	fmt.Fprintf(w, "%-24s %-20s %12s %12s\n", "CLIENT", "USER", "ACTIVE", "IDLE")
+	for _, s := range sessions {
+		fmt.Fprintf(w, "%-24s %-20s %12s %12s\n", s.Client, s.User, s.Active, s.Idle)
+	}
+}
+
+// listSessions prints the sessions the connecting user has on the server.
+func listSessions(w io.Writer, opts smbOptions) error {
+	return withSrvsvc(opts, func(p *rpcPipe, server, user string) error {
+		sessions, err := p.enumSessions(server, user)
+		if err != nil {
+			return err
+		}
+		writeSessions(w, sessions)
+		return nil
+	})
+}
+
+// logoffStale tears down the connecting user's sessions from clients where
+// every session has been idle for at least idle, e.g. left behind by crashed
+// runs still holding files open.
+func logoffStale(w io.Writer, opts smbOptions, idle time.Duration) error {
+	return withSrvsvc(opts, func(p *rpcPipe, server, user string) error {
+		sessions, err := p.enumSessions(server, user)
+		if err != nil {
+			return err
+		}
+		clients := staleClients(sessions, idle)
+		if len(clients) == 0 {
+			fmt.Fprintln(w, "No stale sessions.")
+			return nil
+		}
+		for _, client := range clients {
+			if err := p.deleteSessions(server, client, user); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "logged off %s from %s\n", user, client)
+		}
+		return nil
+	})
+}
+
+func withSrvsvc(opts smbOptions, fn func(p *rpcPipe, server, user string) error) error {
+	session, cleanup, err := dialSession(opts)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	p, closePipe, err := openSrvsvc(session)
+	if err != nil {
+		return err
+	}
+	defer closePipe()
+	host, _, err := splitServerAddress(opts.address)
+	if err != nil {
+		return err
+	}
+	return fn(p, host, sessionUser(opts.user))
+}
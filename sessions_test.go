@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func ndrTestString(b []byte, s string) []byte {
+	units := utf16.Encode([]rune(s + "\x00"))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(units)))
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(units)))
+	for _, u := range units {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func TestParseSessionEnum(t *testing.T) {
+	u32 := func(b []byte, vs ...uint32) []byte {
+		for _, v := range vs {
+			b = binary.LittleEndian.AppendUint32(b, v)
+		}
+		return b
+	}
+	stub := u32(nil, 10, 10, 0x20000, 2, 0x20004, 2)
+	stub = u32(stub, 0x20008, 0x2000c, 3600, 1200)
+	stub = u32(stub, 0x20010, 0x20014, 60, 0)
+	stub = ndrTestString(stub, `\\10.0.0.5`)
+	stub = ndrTestString(stub, "alice")
+	stub = ndrTestString(stub, `\\10.0.0.9`)
+	stub = ndrTestString(stub, "alice")
+	stub = u32(stub, 2, 0, 0)
+
+	got, err := parseSessionEnum(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []smbSession{
+		{Client: `\\10.0.0.5`, User: "alice", Active: time.Hour, Idle: 20 * time.Minute},
+		{Client: `\\10.0.0.9`, User: "alice", Active: time.Minute},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("sessions = %+v, want %+v", got, want)
+	}
+
+	if _, err := parseSessionEnum(stub[:len(stub)-8]); err == nil {
+		t.Fatal("truncated response accepted")
+	}
+	denied := u32(nil, 10, 10, 0, 0, 0, 5)
+	if _, err := parseSessionEnum(denied); err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Fatalf("access denied: err = %v", err)
+	}
+}
+
+func TestStaleClients(t *testing.T) {
+	sessions := []smbSession{
+		{Client: "a", Idle: time.Hour},
+		{Client: "b", Idle: time.Hour},
+		{Client: "b", Idle: time.Second},
+		{Client: "c", Idle: 2 * time.Hour},
+		{Client: "d", Idle: time.Minute},
+	}
+	if got, want := staleClients(sessions, 30*time.Minute), []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("stale = %v, want %v", got, want)
+	}
+}
+
+func TestSessionUser(t *testing.T) {
+	for in, want := range map[string]string{
+		"alice":            "alice",
+		`CORP\alice`:       "alice",
+		"alice@corp.local": "alice",
+	} {
+		if got := sessionUser(in); got != want {
+			t.Errorf("sessionUser(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := uncClient("10.0.0.5"); got != `\\10.0.0.5` {
+		t.Errorf("uncClient = %q", got)
+	}
+	if got := uncClient(`\\host`); got != `\\host` {
+		t.Errorf("uncClient = %q", got)
+	}
+}
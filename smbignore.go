@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is the file of gitignore-style exclusions that recursive
+// uploads and sync read from every directory of the local tree.
+const ignoreFileName = ".smbignore"
+
+// parseIgnoreFile reads the patterns of an ignore file in directory base
+// of the tree ("." for its root) and returns them as filter rules in file
+// order. As in gitignore, blank lines and lines starting with # are
+// skipped, ! negates a pattern, and a pattern with a slash at its start or
+// in the middle is relative to base, while one without matches at any
+// depth below it.
+func parseIgnoreFile(r io.Reader, base string) ([]filterRule, error) {
+	var rules []filterRule
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		p := trimIgnoreLine(scanner.Text())
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		include := strings.HasPrefix(p, "!")
+		if include {
+			p = p[1:]
+		}
+		// \# and \! are kept as escapes, which newFilterRule understands.
+		anchored := strings.Contains(strings.TrimRight(p, "/"), "/")
+		p = strings.TrimLeft(p, "/")
+		switch {
+		case base != "." && anchored:
+			p = "/" + escapePattern(base) + "/" + p
+		case base != ".":
+			p = "/" + escapePattern(base) + "/**/" + p
+		case anchored:
+			p = "/" + p
+		}
+		rule, err := newFilterRule(p, include)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// trimIgnoreLine drops trailing spaces unless escaped with a backslash.
+func trimIgnoreLine(s string) string {
+	s = strings.TrimSuffix(s, "\r")
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\\ ") {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// escapePattern quotes the characters of s that patterns treat specially.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// withIgnoreFiles returns filter extended by the .smbignore files of the
+// local tree at root. The command-line patterns come first and so win; the
+// ignore files follow in an order that makes the first matching rule give
+// gitignore's answer, where a deeper file overrides a shallower one and a
+// later line an earlier one. Directories already excluded are not searched,
+// and the ignore files themselves are never transferred or deleted. A
+// missing root has no ignore files.
+func withIgnoreFiles(root string, filter pathFilter) (pathFilter, error) {
+	self, err := newFilterRule(ignoreFileName, false)
+	if err != nil {
+		return nil, err
+	}
+	var ignored pathFilter
+	combined := func() pathFilter {
+		return append(append(append(pathFilter(nil), filter...), self), ignored...)
+	}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && combined().excluded(rel, true) {
+			return filepath.SkipDir
+		}
+		f, err := os.Open(filepath.Join(p, ignoreFileName))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rules, err := parseIgnoreFile(f, rel)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Join(p, ignoreFileName), err)
+		}
+		// Later lines of this file, and files deeper than it, which the
+		// walk reaches afterwards, go in front.
+		for i, j := 0, len(rules)-1; i < j; i, j = i+1, j-1 {
+			rules[i], rules[j] = rules[j], rules[i]
+		}
+		ignored = append(rules, ignored...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return combined(), nil
+}
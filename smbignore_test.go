@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWithIgnoreFiles(t *testing.T) {
+	local := writeTestTree(t, map[string]string{
+		".smbignore":            "# build output\n*.o\n/dist/\ndocs/*.pdf\n!keep.o\nspaced.txt  \n",
+		"main.c":                "c",
+		"main.o":                "o",
+		"keep.o":                "k",
+		"spaced.txt":            "s",
+		"dist/app":              "a",
+		"lib/dist/x.c":          "x",
+		"docs/guide.pdf":        "p",
+		"docs/sub/deep.pdf":     "p",
+		"lib/.smbignore":        "*.c\n!/x.c\n",
+		"lib/x.c":               "x",
+		"lib/y.c":               "y",
+		"lib/nested/z.c":        "z",
+		"dist/.smbignore":       "!app\n",
+		"node_modules/.keep":    "",
+		"node_modules/pkg/a.js": "a",
+	})
+	filter, err := withIgnoreFiles(local, pathFilter{mustFilterRule(t, "node_modules/", false)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu, err := scanTreeUpload(&bytes.Buffer{}, local, "dst", nil, filter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rels []string
+	for _, it := range tu.items {
+		rels = append(rels, tu.rels[it.local])
+	}
+	sort.Strings(rels)
+	want := "docs/sub/deep.pdf keep.o lib/x.c main.c"
+	if got := strings.Join(rels, " "); got != want {
+		t.Errorf("uploaded %q, want %q", got, want)
+	}
+}
+
+func mustFilterRule(t *testing.T, pattern string, include bool) filterRule {
+	t.Helper()
+	r, err := newFilterRule(pattern, include)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestWithIgnoreFilesEscapesDirectories(t *testing.T) {
+	local := writeTestTree(t, map[string]string{
+		"[v1]/.smbignore": "*.log\n",
+		"[v1]/a.log":      "a",
+		"v/a.log":         "a",
+	})
+	filter, err := withIgnoreFiles(local, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.excluded("[v1]/a.log", false) || filter.excluded("v/a.log", false) {
+		t.Errorf("[v1]/.smbignore applied wrongly: %+v", filter)
+	}
+	if _, err := withIgnoreFiles(filepath.Join(local, "missing"), nil); err != nil {
+		t.Errorf("missing root: %v", err)
+	}
+	os.WriteFile(filepath.Join(local, ".smbignore"), []byte("a[b\n"), 0o644)
+	if _, err := withIgnoreFiles(local, nil); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("bad pattern: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// snapshotTokenLayout is the @GMT token naming a shadow copy (Windows
+// Previous Versions, Samba vfs_shadow_copy2). Servers accept it as the first
+// component of a path to read the share as it was at that moment, in UTC.
+const snapshotTokenLayout = "@GMT-2006.01.02-15.04.05"
+
+// snapshotInputLayouts are the forms -snapshot accepts besides a literal
+// token. Times without a zone are local, as the Previous Versions dialog
+// shows them.
+var snapshotInputLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// parseSnapshot turns a -snapshot value into an @GMT token. It must name the
+// snapshot's creation time exactly, to the second.
+func parseSnapshot(s string) (string, error) {
+	if strings.HasPrefix(s, "@GMT-") {
+		t, err := time.Parse(snapshotTokenLayout, s)
+		if err != nil {
+			return "", fmt.Errorf("invalid -snapshot %q: want %s", s, snapshotTokenLayout)
+		}
+		return t.Format(snapshotTokenLayout), nil
+	}
+	for _, layout := range snapshotInputLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.UTC().Format(snapshotTokenLayout), nil
+		}
+	}
+	return "", fmt.Errorf("invalid -snapshot %q: want a time such as 2024-05-01T13:00:00Z or an %s token", s, snapshotTokenLayout)
+}
+
+// snapshotPath rewrites a share path to the same path inside the snapshot
+// named by token. An empty token leaves p as it is.
+func snapshotPath(token, p string) string {
+	if token == "" {
+		return p
+	}
+	return joinRemote(token, normalizeRemotePath(p))
+}
+
+// snapshotFlag defines -snapshot.
+func snapshotFlag(fs *flag.FlagSet, opts *smbOptions) {
+	fs.StringVar(&opts.snapshot, "snapshot", "", "Read from the shadow copy taken at this time (RFC 3339, local YYYY-MM-DD HH:MM[:SS], or an @GMT- token)")
+}
+
+// snapshotToken is parseSnapshot for an optional flag: empty stays empty.
+func snapshotToken(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	return parseSnapshot(s)
+}
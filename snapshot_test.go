@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSnapshot(t *testing.T) {
+	local := time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local).UTC().Format(snapshotTokenLayout)
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"@GMT-2024.05.01-07.00.00", "@GMT-2024.05.01-07.00.00", false},
+		{"2024-05-01T07:00:00Z", "@GMT-2024.05.01-07.00.00", false},
+		{"2024-05-01T09:00:00+02:00", "@GMT-2024.05.01-07.00.00", false},
+		{"2024-05-01 09:30", local, false},
+		{"@GMT-2024-05-01", "", true},
+		{"yesterday", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseSnapshot(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSnapshot(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSnapshotPath(t *testing.T) {
+	const token = "@GMT-2024.05.01-07.00.00"
+	tests := []struct {
+		token, in, want string
+	}{
+		{token, "reports/q1.xlsx", token + "/reports/q1.xlsx"},
+		{token, ".", token},
+		{token, "/reports", token + "/reports"},
+		{"", "reports/q1.xlsx", "reports/q1.xlsx"},
+	}
+	for _, tt := range tests {
+		if got := snapshotPath(tt.token, tt.in); got != tt.want {
+			t.Errorf("snapshotPath(%q, %q) = %q, want %q", tt.token, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// go-smb2 keeps its DCE/RPC client internal and only uses it for share
+// enumeration, so the few srvsvc calls smbput needs are marshalled here and
+// sent as plain writes and reads on the \PIPE\srvsvc named pipe of IPC$.
+
+const (
+	rpcBind     = 11
+	rpcBindAck  = 12
+	rpcBindNak  = 13
+	rpcRequest  = 0
+	rpcResponse = 2
+	rpcFault    = 3
+
+	rpcFirstFrag = 0x01
+	rpcLastFrag  = 0x02
+
+	rpcMaxFrag = 4280
+
+	opNetrSessionEnum = 12
+	opNetrSessionDel  = 13
+)
+
+var (
+	// 4b324fc8-1670-01d3-1278-5a47bf6ee188 v3.0, in wire byte order.
+	srvsvcSyntax = []byte{0xc8, 0x4f, 0x32, 0x4b, 0x70, 0x16, 0xd3, 0x01, 0x12, 0x78, 0x5a, 0x47, 0xbf, 0x6e, 0xe1, 0x88, 3, 0, 0, 0}
+	// 8a885d04-1ceb-11c9-9fe8-08002b104860 v2 (NDR), in wire byte order.
+	ndrSyntax = []byte{0x04, 0x5d, 0x88, 0x8a, 0xeb, 0x1c, 0xc9, 0x11, 0x9f, 0xe8, 0x08, 0x00, 0x2b, 0x10, 0x48, 0x60, 2, 0, 0, 0}
+)
+
+// rpcPDU frames body as a connection-oriented DCE/RPC PDU of type ptype.
+func rpcPDU(ptype byte, callID uint32, body []byte) []byte {
+	b := make([]byte, 16, 16+len(body))
+	b[0], b[1], b[2], b[3] = 5, 0, ptype, rpcFirstFrag|rpcLastFrag
+	b[4] = 0x10 // little-endian integers, ASCII, IEEE floats
+	binary.LittleEndian.PutUint16(b[8:], uint16(16+len(body)))
+	binary.LittleEndian.PutUint32(b[12:], callID)
+	return append(b, body...)
+}
+
+func rpcBindBody() []byte {
+	b := binary.LittleEndian.AppendUint16(nil, rpcMaxFrag) // max xmit frag
+	b = binary.LittleEndian.AppendUint16(b, rpcMaxFrag)    // max recv frag
+	b = binary.LittleEndian.AppendUint32(b, 0)             // assoc group
+	b = append(b, 1, 0, 0, 0)                              // one context
+	b = append(b, 0, 0, 1, 0)                              // context 0, one transfer syntax
+	b = append(b, srvsvcSyntax...)
+	return append(b, ndrSyntax...)
+}
+
+func rpcRequestBody(opnum uint16, stub []byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(stub))) // alloc hint
+	b = binary.LittleEndian.AppendUint16(b, 0)                    // context 0
+	b = binary.LittleEndian.AppendUint16(b, opnum)
+	return append(b, stub...)
+}
+
+// rpcPipe is a bound srvsvc connection over a named pipe.
+type rpcPipe struct {
+	f      io.ReadWriter
+	callID uint32
+	buf    []byte
+}
+
+// openSrvsvc opens \PIPE\srvsvc on the IPC$ share and binds to the
+// interface. The caller closes the returned file and unmounts the share.
+func openSrvsvc(session *smb2.Session) (*rpcPipe, func(), error) {
+	start := time.Now()
+	ipc, err := session.Mount("IPC$")
+	opStats.observe("mount", start)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mount IPC$: %w", err)
+	}
+	f, err := ipc.OpenFile("srvsvc", os.O_RDWR, 0o666)
+	if err != nil {
+		ipc.Umount()
+		return nil, nil, fmt.Errorf("open srvsvc pipe: %w", err)
+	}
+	cleanup := func() {
+		f.Close()
+		ipc.Umount()
+	}
+	p := &rpcPipe{f: f}
+	if err := p.bind(); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return p, cleanup, nil
+}
+
+func (p *rpcPipe) bind() error {
+	p.callID++
+	if _, err := p.f.Write(rpcPDU(rpcBind, p.callID, rpcBindBody())); err != nil {
+		return fmt.Errorf("srvsvc bind: %w", err)
+	}
+	pdu, err := p.readPDU()
+	if err != nil {
+		return fmt.Errorf("srvsvc bind: %w", err)
+	}
+	switch pdu[2] {
+	case rpcBindAck:
+	case rpcBindNak:
+		return errors.New("srvsvc bind rejected by server")
+	default:
+		return fmt.Errorf("srvsvc bind: unexpected PDU type %d", pdu[2])
+	}
+	// The result list follows the secondary address, aligned to 4 bytes.
+	if len(pdu) < 26 {
+		return errors.New("srvsvc bind: short bind ack")
+	}
+	off := 26 + int(binary.LittleEndian.Uint16(pdu[24:]))
+	off = (off + 3) &^ 3
+	if len(pdu) < off+6 || pdu[off] < 1 {
+		return errors.New("srvsvc bind: bind ack has no results")
+	}
+	if result := binary.LittleEndian.Uint16(pdu[off+4:]); result != 0 {
+		return fmt.Errorf("srvsvc bind: presentation context rejected (result %d)", result)
+	}
+	return nil
+}
+
+// call sends one request and returns the reassembled response stub.
+func (p *rpcPipe) call(opnum uint16, stub []byte) ([]byte, error) {
+	p.callID++
+	start := time.Now()
+	defer opStats.observe("rpc", start)
+	if _, err := p.f.Write(rpcPDU(rpcRequest, p.callID, rpcRequestBody(opnum, stub))); err != nil {
+		return nil, err
+	}
+	var out []byte
+	for {
+		pdu, err := p.readPDU()
+		if err != nil {
+			return nil, err
+		}
+		if len(pdu) < 24 {
+			return nil, errors.New("short RPC response")
+		}
+		switch pdu[2] {
+		case rpcResponse:
+		case rpcFault:
+			return nil, fmt.Errorf("RPC fault 0x%08x", binary.LittleEndian.Uint32(pdu[24:]))
+		default:
+			return nil, fmt.Errorf("unexpected RPC PDU type %d", pdu[2])
+		}
+		if binary.LittleEndian.Uint32(pdu[12:]) != p.callID {
+			return nil, errors.New("RPC response for another call")
+		}
+		authLen := int(binary.LittleEndian.Uint16(pdu[10:]))
+		out = append(out, pdu[24:len(pdu)-authLen]...)
+		if pdu[3]&rpcLastFrag != 0 {
+			return out, nil
+		}
+	}
+}
+
+// readPDU returns the next complete PDU, reading from the pipe as needed.
+func (p *rpcPipe) readPDU() ([]byte, error) {
+	chunk := make([]byte, rpcMaxFrag)
+	for {
+		if len(p.buf) >= 16 {
+			n := int(binary.LittleEndian.Uint16(p.buf[8:]))
+			if n < 16 {
+				return nil, errors.New("malformed RPC PDU")
+			}
+			if len(p.buf) >= n {
+				pdu := p.buf[:n:n]
+				p.buf = p.buf[n:]
+				return pdu, nil
+			}
+		}
+		n, err := p.f.Read(chunk)
+		p.buf = append(p.buf, chunk[:n]...)
+		if err != nil && !(errors.Is(err, io.EOF) && n > 0) {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+	}
+}
+
+// ndrWriter marshals NDR (version 2, little-endian) stub data.
+type ndrWriter struct {
+	b      []byte
+	nextID uint32
+}
+
+func (w *ndrWriter) uint32(v uint32) {
+	for len(w.b)%4 != 0 {
+		w.b = append(w.b, 0)
+	}
+	w.b = binary.LittleEndian.AppendUint32(w.b, v)
+}
+
+func (w *ndrWriter) referent() {
+	w.nextID += 4
+	w.uint32(0x20000 + w.nextID)
+}
+
+// uniqueString writes a [string, unique] wchar_t* parameter; "" is NULL.
+func (w *ndrWriter) uniqueString(s string) {
+	if s == "" {
+		w.uint32(0)
+		return
+	}
+	w.referent()
+	units := utf16.Encode([]rune(s + "\x00"))
+	w.uint32(uint32(len(units))) // max count
+	w.uint32(0)                  // offset
+	w.uint32(uint32(len(units))) // actual count
+	for _, u := range units {
+		w.b = binary.LittleEndian.AppendUint16(w.b, u)
+	}
+}
+
+// ndrReader unmarshals NDR stub data; the first error sticks.
+type ndrReader struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *ndrReader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	r.off = (r.off + 3) &^ 3
+	if r.off+4 > len(r.b) {
+		r.err = errors.New("truncated RPC response")
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.b[r.off:])
+	r.off += 4
+	return v
+}
+
+// string reads a conformant varying UTF-16 string.
+func (r *ndrReader) string() string {
+	r.uint32() // max count
+	offset := int(r.uint32())
+	count := int(r.uint32())
+	if r.err != nil {
+		return ""
+	}
+	start := r.off + offset*2
+	end := start + count*2
+	if end > len(r.b) || count < 0 || offset < 0 {
+		r.err = errors.New("truncated RPC response")
+		return ""
+	}
+	units := make([]uint16, count)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(r.b[start+2*i:])
+	}
+	r.off = end
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
+
+// werror describes a Windows API status returned by a srvsvc call.
+func werror(op string, status uint32) error {
+	switch status {
+	case 0:
+		return nil
+	case 5:
+		return fmt.Errorf("%s: access denied (the server may restrict this to administrators)", op)
+	case 2221:
+		return fmt.Errorf("%s: user not found", op)
+	case 2312:
+		return fmt.Errorf("%s: no session from that client", op)
+	}
+	return fmt.Errorf("%s: server returned error %d", op, status)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// fakePipe answers each written PDU with the next queued reply.
+type fakePipe struct {
+	written [][]byte
+	replies [][]byte
+	pending bytes.Buffer
+}
+
+func (p *fakePipe) Write(b []byte) (int, error) {
+	p.written = append(p.written, append([]byte(nil), b...))
+	if len(p.replies) > 0 {
+		p.pending.Write(p.replies[0])
+		p.replies = p.replies[1:]
+	}
+	return len(b), nil
+}
+
+func (p *fakePipe) Read(b []byte) (int, error) {
+	return p.pending.Read(b)
+}
+
+func responsePDU(callID uint32, flags byte, stub []byte) []byte {
+	body := binary.LittleEndian.AppendUint32(nil, uint32(len(stub)))
+	body = append(body, 0, 0, 0, 0)
+	pdu := rpcPDU(rpcResponse, callID, append(body, stub...))
+	pdu[3] = flags
+	return pdu
+}
+
+func bindAckPDU(callID uint32, result uint16) []byte {
+	body := []byte{0xb8, 0x10, 0xb8, 0x10, 0, 0, 0, 0}
+	body = append(body, 13, 0)
+	body = append(body, `\PIPE\srvsvc`+"\x00"...)
+	for (16+len(body))%4 != 0 {
+		body = append(body, 0)
+	}
+	body = append(body, 1, 0, 0, 0)
+	body = binary.LittleEndian.AppendUint16(body, result)
+	body = append(body, 0, 0)
+	body = append(body, ndrSyntax...)
+	return rpcPDU(rpcBindAck, callID, body)
+}
+
+func TestRPCPipeBindAndCall(t *testing.T) {
+	fp := &fakePipe{replies: [][]byte{
+		bindAckPDU(1, 0),
+		append(responsePDU(2, rpcFirstFrag, []byte("hello ")), responsePDU(2, rpcLastFrag, []byte("world"))...),
+	}}
+	p := &rpcPipe{f: fp}
+	if err := p.bind(); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if got := fp.written[0]; got[2] != rpcBind || int(binary.LittleEndian.Uint16(got[8:])) != len(got) || len(got) != 72 {
+		t.Fatalf("bind PDU = %x", got)
+	}
+
+	out, err := p.call(opNetrSessionEnum, []byte{1, 2, 3, 4})
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if string(out) != "hello world" {
+		t.Fatalf("reassembled stub = %q", out)
+	}
+	req := fp.written[1]
+	if req[2] != rpcRequest || binary.LittleEndian.Uint16(req[22:]) != opNetrSessionEnum || !bytes.Equal(req[24:], []byte{1, 2, 3, 4}) {
+		t.Fatalf("request PDU = %x", req)
+	}
+}
+
+func TestRPCPipeErrors(t *testing.T) {
+	p := &rpcPipe{f: &fakePipe{replies: [][]byte{bindAckPDU(1, 2)}}}
+	if err := p.bind(); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("rejected context: err = %v", err)
+	}
+
+	fault := rpcPDU(rpcFault, 1, []byte{0, 0, 0, 0, 0, 0, 0, 0, 5, 0, 0, 0})
+	p = &rpcPipe{f: &fakePipe{replies: [][]byte{fault}}}
+	if _, err := p.call(opNetrSessionDel, nil); err == nil || !strings.Contains(err.Error(), "0x00000005") {
+		t.Fatalf("fault: err = %v", err)
+	}
+}
+
+func TestNDRStrings(t *testing.T) {
+	var w ndrWriter
+	w.uniqueString(`\\fs01`)
+	w.uniqueString("")
+	w.uint32(7)
+	want := []byte{
+		0x04, 0x00, 0x02, 0x00, // referent
+		7, 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0,
+		'\\', 0, '\\', 0, 'f', 0, 's', 0, '0', 0, '1', 0, 0, 0,
+		0, 0, // padding
+		0, 0, 0, 0, // NULL
+		7, 0, 0, 0,
+	}
+	if !bytes.Equal(w.b, want) {
+		t.Fatalf("encoded = %x\nwant      %x", w.b, want)
+	}
+
+	r := &ndrReader{b: w.b[4:]}
+	if s := r.string(); s != `\\fs01` || r.err != nil {
+		t.Fatalf("decoded %q, %v", s, r.err)
+	}
+	if r.uint32(); r.uint32() != 7 || r.err != nil {
+		t.Fatalf("trailing value not read: %v", r.err)
+	}
+	r.uint32()
+	if r.err == nil {
+		t.Fatal("reading past the end did not fail")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// errStalled marks a transfer aborted because no data moved for the
+// configured -stall-timeout, e.g. a server that granted credits but stopped
+// answering.
+var errStalled = errors.New("transfer stalled")
+
+// stallWatch cancels the share bound to it when its reader has not made
+// progress for the timeout, which aborts the in-flight SMB request.
+type stallWatch struct {
+	timeout  time.Duration
+	last     atomic.Int64
+	stalled  atomic.Bool
+	cancel   context.CancelFunc
+	done     chan struct{}
+	disabled bool
+}
+
+// watchStall returns share bound to a context the watchdog can cancel. With a
+// zero timeout it returns share unchanged and a no-op watch.
+func watchStall(ctx context.Context, share *smb2.Share, timeout time.Duration) (*smb2.Share, *stallWatch) {
+	if timeout <= 0 {
+		return share, &stallWatch{disabled: true}
+	}
+	watchCtx, cancel := context.WithCancel(ctx)
+	w := &stallWatch{timeout: timeout, cancel: cancel, done: make(chan struct{})}
+	w.touch()
+	go w.run()
+	return share.WithContext(watchCtx), w
+}
+
+func (w *stallWatch) run() {
+	tick := w.timeout / 4
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			if now.Sub(time.Unix(0, w.last.Load())) >= w.timeout {
+				w.stalled.Store(true)
+				w.cancel()
+				return
+			}
+		}
+	}
+}
+
+func (w *stallWatch) touch() {
+	w.last.Store(time.Now().UnixNano())
+}
+
+func (w *stallWatch) stop() {
+	if w.disabled {
+		return
+	}
+	close(w.done)
+	w.cancel()
+}
+
+// reader wraps r so every completed read counts as progress.
+func (w *stallWatch) reader(r io.Reader) io.Reader {
+	if w.disabled {
+		return r
+	}
+	return stallReader{r: r, w: w}
+}
+
+// cause replaces err with errStalled when the watchdog fired, since the
+// underlying error is just the cancellation it triggered.
+func (w *stallWatch) cause(err error) error {
+	if err != nil && !w.disabled && w.stalled.Load() {
+		return fmt.Errorf("%w: no progress for %s", errStalled, w.timeout)
+	}
+	return err
+}
+
+type stallReader struct {
+	r io.Reader
+	w *stallWatch
+}
+
+func (s stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 {
+		s.w.touch()
+	}
+	return n, err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingReader returns data once and then blocks until closed.
+type blockingReader struct {
+	sent    bool
+	release chan struct{}
+}
+
+func (b *blockingReader) Read(p []byte) (int, error) {
+	if !b.sent {
+		b.sent = true
+		return copy(p, "x"), nil
+	}
+	<-b.release
+	return 0, io.EOF
+}
+
+func TestStallWatchFiresWithoutProgress(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &stallWatch{timeout: 50 * time.Millisecond, done: make(chan struct{})}
+	watchCtx, watchCancel := context.WithCancel(ctx)
+	w.cancel = watchCancel
+	w.touch()
+	go w.run()
+	defer w.stop()
+
+	src := &blockingReader{release: make(chan struct{})}
+	go func() {
+		<-watchCtx.Done()
+		close(src.release)
+	}()
+
+	_, _ = io.ReadAll(w.reader(src))
+	err := w.cause(errors.New("context canceled"))
+	if !errors.Is(err, errStalled) {
+		t.Fatalf("cause = %v, want errStalled", err)
+	}
+}
+
+func TestStallWatchDisabledPassesThrough(t *testing.T) {
+	_, w := watchStall(context.Background(), nil, 0)
+	defer w.stop()
+
+	data, err := io.ReadAll(w.reader(strings.NewReader("payload")))
+	if err != nil || string(data) != "payload" {
+		t.Fatalf("ReadAll = %q, %v", data, err)
+	}
+	sentinel := errors.New("boom")
+	if got := w.cause(sentinel); got != sentinel {
+		t.Fatalf("cause = %v, want sentinel", got)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// DOS/NTFS file attribute bits as reported in FileAttributes.
+var fileAttributeNames = []struct {
+	bit  uint32
+	name string
+}{
+	{0x1, "READONLY"},
+	{0x2, "HIDDEN"},
+	{0x4, "SYSTEM"},
+	{0x10, "DIRECTORY"},
+	{0x20, "ARCHIVE"},
+	{0x80, "NORMAL"},
+	{0x100, "TEMPORARY"},
+	{0x200, "SPARSE_FILE"},
+	{0x400, "REPARSE_POINT"},
+	{0x800, "COMPRESSED"},
+	{0x1000, "OFFLINE"},
+	{0x2000, "NOT_CONTENT_INDEXED"},
+	{0x4000, "ENCRYPTED"},
+}
+
+// attributeNames lists the names of the bits set in attrs.
+func attributeNames(attrs uint32) []string {
+	names := []string{}
+	for _, a := range fileAttributeNames {
+		if attrs&a.bit != 0 {
+			names = append(names, a.name)
+		}
+	}
+	return names
+}
+
+type remoteStat struct {
+	Path           string    `json:"path"`
+	Dir            bool      `json:"dir"`
+	Size           int64     `json:"size"`
+	AllocationSize int64     `json:"allocation_size"`
+	Created        time.Time `json:"created"`
+	Modified       time.Time `json:"modified"`
+	Accessed       time.Time `json:"accessed"`
+	Changed        time.Time `json:"changed"`
+	Attributes     []string  `json:"attributes"`
+}
+
+func newRemoteStat(p string, fi os.FileInfo) remoteStat {
+	s := remoteStat{Path: p, Dir: fi.IsDir(), Size: fi.Size(), Modified: fi.ModTime().UTC(), Attributes: []string{}}
+	if st, ok := fi.(*smb2.FileStat); ok {
+		s.AllocationSize = st.AllocationSize
+		s.Created = st.CreationTime.UTC()
+		s.Accessed = st.LastAccessTime.UTC()
+		s.Changed = st.ChangeTime.UTC()
+		s.Attributes = attributeNames(st.FileAttributes)
+	}
+	return s
+}
+
+// statRemote prints the metadata the server reports for each path.
+func statRemote(share *smb2.Share, paths []string, asJSON bool) error {
+	var stats []remoteStat
+	for _, p := range paths {
+		p = normalizeRemotePath(p)
+		start := time.Now()
+		fi, err := share.Lstat(p)
+		opStats.observe("stat", start)
+		if err != nil {
+			return fmt.Errorf("stat %s: %w", p, err)
+		}
+		stats = append(stats, newRemoteStat(p, fi))
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if len(stats) == 1 {
+			return enc.Encode(withSchema("stat", stats[0]))
+		}
+		return enc.Encode(withSchemaEach("stat", stats))
+	}
+	for i, s := range stats {
+		if i > 0 {
+			fmt.Println()
+		}
+		writeRemoteStat(os.Stdout, s)
+	}
+	return nil
+}
+
+func writeRemoteStat(w io.Writer, s remoteStat) {
+	kind := "file"
+	if s.Dir {
+		kind = "directory"
+	}
+	fmt.Fprintf(w, "Path:       %s\n", s.Path)
+	fmt.Fprintf(w, "Type:       %s\n", kind)
+	fmt.Fprintf(w, "Size:       %d\n", s.Size)
+	fmt.Fprintf(w, "Allocated:  %d\n", s.AllocationSize)
+	fmt.Fprintf(w, "Created:    %s\n", s.Created.Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "Modified:   %s\n", s.Modified.Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "Accessed:   %s\n", s.Accessed.Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "Changed:    %s\n", s.Changed.Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "Attributes: %s\n", strings.Join(s.Attributes, " "))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+func TestAttributeNames(t *testing.T) {
+	got := attributeNames(0x1 | 0x2 | 0x20 | 0x400)
+	want := []string{"READONLY", "HIDDEN", "ARCHIVE", "REPARSE_POINT"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("attributeNames = %v, want %v", got, want)
+	}
+	if got := attributeNames(0); got == nil || len(got) != 0 {
+		t.Fatalf("attributeNames(0) = %#v, want empty non-nil slice", got)
+	}
+}
+
+func TestWriteRemoteStat(t *testing.T) {
+	created := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	fi := &smb2.FileStat{
+		FileName:       "a.txt",
+		EndOfFile:      10,
+		AllocationSize: 4096,
+		CreationTime:   created,
+		LastWriteTime:  created.Add(time.Hour),
+		FileAttributes: 0x20,
+	}
+	var out bytes.Buffer
+	writeRemoteStat(&out, newRemoteStat("docs/a.txt", fi))
+	for _, want := range []string{
+		"Type:       file",
+		"Size:       10",
+		"Allocated:  4096",
+		"Created:    2023-01-02T03:04:05Z",
+		"Modified:   2023-01-02T04:04:05Z",
+		"Attributes: ARCHIVE",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// copyBufferSize matches go-smb2's upper bound for a single READ/WRITE so
+// each timed call maps to one round trip on servers that negotiate the
+// maximum.
+const copyBufferSize = 1 << 20
+
+// copyChunked copies src to dst in copyBufferSize chunks. The anonymous
+// wrappers hide ReaderFrom/WriterTo so io.CopyBuffer actually uses the buffer
+// rather than falling back to 32KiB reads.
+func copyChunked(dst io.Writer, src io.Reader) (int64, error) {
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, make([]byte, copyBufferSize))
+}
+
+// opStats collects SMB round-trip latencies for the whole invocation.
+var opStats = newLatencyStats()
+
+var statsQuantiles = []float64{0.5, 0.95, 0.99}
+
+type latencyStats struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	bytes   map[string]int64
+}
+
+func newLatencyStats() *latencyStats {
+	return &latencyStats{samples: make(map[string][]time.Duration), bytes: make(map[string]int64)}
+}
+
+// addBytes records n bytes of file data moved by op.
+func (s *latencyStats) addBytes(op string, n int) {
+	s.mu.Lock()
+	s.bytes[op] += int64(n)
+	s.mu.Unlock()
+}
+
+// totals returns the number of operations observed and the bytes read and
+// written.
+func (s *latencyStats) totals() (ops int64, read, written int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, samples := range s.samples {
+		ops += int64(len(samples))
+	}
+	return ops, s.bytes["read"], s.bytes["write"]
+}
+
+// observe records the time elapsed since start under op.
+func (s *latencyStats) observe(op string, start time.Time) {
+	d := time.Since(start)
+	s.mu.Lock()
+	s.samples[op] = append(s.samples[op], d)
+	s.mu.Unlock()
+}
+
+type opSummary struct {
+	op        string
+	count     int
+	sum       time.Duration
+	quantiles []time.Duration
+}
+
+// summary returns per-operation counts and quantiles sorted by op name.
+func (s *latencyStats) summary() []opSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]opSummary, 0, len(s.samples))
+	for op, samples := range s.samples {
+		sorted := append([]time.Duration(nil), samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		sum := opSummary{op: op, count: len(sorted)}
+		for _, d := range sorted {
+			sum.sum += d
+		}
+		for _, q := range statsQuantiles {
+			sum.quantiles = append(sum.quantiles, quantile(sorted, q))
+		}
+		out = append(out, sum)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].op < out[j].op })
+	return out
+}
+
+// quantile returns the nearest-rank quantile q of an ascending slice.
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(q*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func (s *latencyStats) writeSummary(w io.Writer) {
+	fmt.Fprintf(w, "%-10s %8s %10s %10s %10s\n", "operation", "count", "p50", "p95", "p99")
+	for _, sum := range s.summary() {
+		fmt.Fprintf(w, "%-10s %8d %10s %10s %10s\n", sum.op, sum.count,
+			sum.quantiles[0].Round(time.Microsecond),
+			sum.quantiles[1].Round(time.Microsecond),
+			sum.quantiles[2].Round(time.Microsecond))
+	}
+}
+
+// writePrometheus emits the latencies as a Prometheus summary in the text
+// exposition format, suitable for the node_exporter textfile collector.
+func (s *latencyStats) writePrometheus(w io.Writer) {
+	fmt.Fprintln(w, "# HELP smbput_operation_duration_seconds SMB operation round-trip latency.")
+	fmt.Fprintln(w, "# TYPE smbput_operation_duration_seconds summary")
+	for _, sum := range s.summary() {
+		for i, q := range statsQuantiles {
+			fmt.Fprintf(w, "smbput_operation_duration_seconds{op=%q,quantile=\"%g\"} %g\n", sum.op, q, sum.quantiles[i].Seconds())
+		}
+		fmt.Fprintf(w, "smbput_operation_duration_seconds_sum{op=%q} %g\n", sum.op, sum.sum.Seconds())
+		fmt.Fprintf(w, "smbput_operation_duration_seconds_count{op=%q} %d\n", sum.op, sum.count)
+	}
+}
+
+// reportStats prints the summary and writes the metrics file when requested.
+func reportStats(opts smbOptions) error {
+	if opts.stats {
+		opStats.writeSummary(os.Stderr)
+	}
+	if opts.metricsFile == "" {
+		return nil
+	}
+	// Write to a temp file and rename so collectors never read a partial file.
+	tmp := opts.metricsFile + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create metrics file %s: %w", tmp, err)
+	}
+	opStats.writePrometheus(f)
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write metrics file %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, opts.metricsFile); err != nil {
+		return fmt.Errorf("rename metrics file %s: %w", opts.metricsFile, err)
+	}
+	return nil
+}
+
+type timedReader struct {
+	r  io.Reader
+	op string
+}
+
+func (t timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.r.Read(p)
+	opStats.observe(t.op, start)
+	opStats.addBytes(t.op, n)
+	return n, err
+}
+
+type timedWriter struct {
+	w  io.Writer
+	op string
+}
+
+func (t timedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.w.Write(p)
+	opStats.observe(t.op, start)
+	opStats.addBytes(t.op, n)
+	return n, err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuantile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.5, 50 * time.Millisecond},
+		{0.95, 95 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	}
+	for _, tc := range tests {
+		if got := quantile(sorted, tc.q); got != tc.want {
+			t.Fatalf("quantile(%v) = %v, want %v", tc.q, got, tc.want)
+		}
+	}
+	if got := quantile(nil, 0.5); got != 0 {
+		t.Fatalf("quantile(nil) = %v, want 0", got)
+	}
+}
+
+func TestLatencyStatsWritePrometheus(t *testing.T) {
+	s := newLatencyStats()
+	s.samples["read"] = []time.Duration{time.Millisecond, 3 * time.Millisecond}
+
+	var buf bytes.Buffer
+	s.writePrometheus(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE smbput_operation_duration_seconds summary",
+		`smbput_operation_duration_seconds{op="read",quantile="0.5"} 0.001`,
+		`smbput_operation_duration_seconds{op="read",quantile="0.99"} 0.003`,
+		`smbput_operation_duration_seconds_sum{op="read"} 0.004`,
+		`smbput_operation_duration_seconds_count{op="read"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// linkPolicy says what to do with symlinks and other reparse points met
+// while listing or walking the share.
+type linkPolicy int
+
+const (
+	// linksKeep reports links as links and does not descend into linked
+	// directories, so junction loops cannot trap a walk.
+	linksKeep linkPolicy = iota
+	// linksFollow treats a link as whatever it points to.
+	linksFollow
+	// linksSkip leaves links out entirely.
+	linksSkip
+)
+
+// maxLinkHops bounds how many linked directories a followed walk passes
+// through on one path, standing in for the loop detection SMB cannot offer:
+// there are no inode numbers to compare.
+const maxLinkHops = 8
+
+func newLinkPolicy(follow, skip bool) (linkPolicy, error) {
+	switch {
+	case follow && skip:
+		return 0, errors.New("-follow-symlinks and -skip-symlinks are mutually exclusive")
+	case follow:
+		return linksFollow, nil
+	case skip:
+		return linksSkip, nil
+	}
+	return linksKeep, nil
+}
+
+// linkFlags defines -follow-symlinks and -skip-symlinks.
+func linkFlags(fs *flag.FlagSet, opts *smbOptions) {
+	fs.BoolVar(&opts.followLinks, "follow-symlinks", false, "Treat symlinks and junctions as what they point to")
+	fs.BoolVar(&opts.skipLinks, "skip-symlinks", false, "Leave symlinks and junctions out")
+}
+
+// isLink reports whether fi carries the reparse-point attribute, which
+// go-smb2 maps to os.ModeSymlink. Besides symlinks and junctions this
+// includes other reparse points such as deduplicated or cloud files.
+func isLink(fi os.FileInfo) bool {
+	return fi.Mode()&os.ModeSymlink != 0
+}
+
+// readRemoteLink returns the target of a symlink or junction as the server
+// stores it. Reparse points of other kinds have no target and fail.
+func readRemoteLink(share *smb2.Share, p string) (string, error) {
+	start := time.Now()
+	target, err := share.Readlink(p)
+	opStats.observe("ioctl", start)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(target, `\??\`), nil
+}
+
+// linkSuffix is the " -> target" shown after a link's name, or "" when the
+// target cannot be read.
+func linkSuffix(share *smb2.Share, p string) string {
+	target, err := readRemoteLink(share, p)
+	if err != nil {
+		return ""
+	}
+	return " -> " + target
+}
+
+// symlinkRemote creates link on the share pointing at target. Windows servers
+// only allow it for accounts holding SeCreateSymbolicLinkPrivilege, and Samba
+// refuses unless it was built to store reparse points.
+func symlinkRemote(share *smb2.Share, target, link string) error {
+	link = normalizeRemotePath(link)
+	start := time.Now()
+	err := share.Symlink(target, link)
+	opStats.observe("ioctl", start)
+	if err != nil {
+		return fmt.Errorf("symlink %s -> %s: %w (the server may not allow this account to create symlinks)", link, target, err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// testLinkInfo returns a directory entry carrying the reparse-point
+// attribute, as a symlink or junction is listed.
+func testLinkInfo(name string, dir bool) os.FileInfo {
+	attrs := uint32(0x400) // FILE_ATTRIBUTE_REPARSE_POINT
+	if dir {
+		attrs |= 0x10
+	}
+	return &smb2.FileStat{FileAttributes: attrs, FileName: name}
+}
+
+func TestNewLinkPolicy(t *testing.T) {
+	tests := []struct {
+		follow, skip bool
+		want         linkPolicy
+		wantErr      bool
+	}{
+		{false, false, linksKeep, false},
+		{true, false, linksFollow, false},
+		{false, true, linksSkip, false},
+		{true, true, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := newLinkPolicy(tt.follow, tt.skip)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("newLinkPolicy(%v, %v) = %v, %v; want %v, error %v", tt.follow, tt.skip, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWalkTreeLinkPolicies(t *testing.T) {
+	now := time.Now()
+	dirs := map[string][]os.FileInfo{
+		"data": {
+			testFileInfo("a.txt", 1, now, false),
+			testLinkInfo("latest", true),
+			testLinkInfo("notes.lnk", false),
+			testLinkInfo("broken", false),
+			testFileInfo("logs", 0, now, true),
+		},
+		"data/logs":        {testFileInfo("x.log", 1, now, false)},
+		"data/latest":      {testFileInfo("x.log", 1, now, false)},
+		"data/logs/nested": {},
+	}
+	readDir := func(dir string) ([]os.FileInfo, error) {
+		entries, ok := dirs[dir]
+		if !ok {
+			return nil, fmt.Errorf("no such directory %s", dir)
+		}
+		return entries, nil
+	}
+	stat := func(p string) (os.FileInfo, error) {
+		switch p {
+		case "data/latest":
+			return testFileInfo("latest", 0, now, true), nil
+		case "data/notes.lnk":
+			return testFileInfo("notes.lnk", 5, now, false), nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	tests := []struct {
+		links linkPolicy
+		want  []string
+	}{
+		{linksKeep, []string{"data/a.txt", "data/latest", "data/notes.lnk", "data/broken", "data/logs", "data/logs/x.log"}},
+		{linksFollow, []string{"data/a.txt", "data/latest", "data/latest/x.log", "data/notes.lnk", "data/logs", "data/logs/x.log"}},
+		{linksSkip, []string{"data/a.txt", "data/logs", "data/logs/x.log"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := walkTree(readDir, stat, "data", tt.links, func(p string, fi os.FileInfo) error {
+			got = append(got, p)
+			if tt.links == linksFollow && isLink(fi) {
+				t.Errorf("followed walk reported %s as a link", p)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("policy %d: %v", tt.links, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("policy %d: visited %v, want %v", tt.links, got, tt.want)
+		}
+	}
+}
+
+func TestWalkTreeStopsLinkLoops(t *testing.T) {
+	// loop is a junction pointing back at its own directory.
+	readDir := func(dir string) ([]os.FileInfo, error) {
+		return []os.FileInfo{testLinkInfo("loop", true)}, nil
+	}
+	stat := func(p string) (os.FileInfo, error) {
+		return testFileInfo("loop", 0, time.Now(), true), nil
+	}
+	visited := 0
+	err := walkTree(readDir, stat, "root", linksFollow, func(p string, fi os.FileInfo) error {
+		visited++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visited != maxLinkHops+1 {
+		t.Fatalf("visited %d entries, want %d", visited, maxLinkHops+1)
+	}
+}
+
+func TestFindFilterMatchesLinks(t *testing.T) {
+	f, err := newFindFilter("", "l", 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if !f.match(testLinkInfo("current", true), now) {
+		t.Error("-type l did not match a junction")
+	}
+	if f.match(testFileInfo("a.txt", 1, now, false), now) {
+		t.Error("-type l matched a regular file")
+	}
+}
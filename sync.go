@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// syncStatePath is where a sync of root keeps the file ending in suffix:
+// $SMBPUT_SYNC_STATE, or smbput/sync under the user's configuration
+// directory, one file of each kind per destination. The delete journal ends
+// in .json.
+func syncStatePath(root, suffix string) (string, error) {
+	dir := os.Getenv("SMBPUT_SYNC_STATE")
+	if dir == "" {
+		base, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("locate sync state: %w", err)
+		}
+		dir = filepath.Join(base, "smbput", "sync")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create sync state directory: %w", err)
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+suffix), nil
+}
+
+// syncRoot names a sync destination for its journal, e.g.
+// //nas/share/backup. Server and share names are not case sensitive.
+func syncRoot(server, share, dir string) string {
+	return "//" + strings.ToLower(server) + "/" + strings.ToLower(share) + "/" + normalizeRemotePath(dir)
+}
+
+// remoteTree is a listing of a remote directory by path relative to it.
+type remoteTree struct {
+	files map[string]os.FileInfo
+	dirs  map[string]bool
+	links map[string]bool
+}
+
+// scanRemoteSide lists everything below root but what the filter excludes,
+// matching files under the names the rules stored them from. A missing root
+// is an empty tree, as for a first sync.
+func scanRemoteSide(share remoteFS, root string, filter pathFilter, rules []transferRule) (*remoteTree, error) {
+	tree := &remoteTree{files: make(map[string]os.FileInfo), dirs: make(map[string]bool), links: make(map[string]bool)}
+	err := walkRemote(share, root, func(p string, fi os.FileInfo) error {
+		rel := relRemote(root, p)
+		name := rel
+		if !fi.IsDir() {
+			_, name = storedRule(rules, rel)
+		}
+		if filter.excluded(name, fi.IsDir() && !isLink(fi)) {
+			if fi.IsDir() && !isLink(fi) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case isLink(fi):
+			tree.links[rel] = true
+		case fi.IsDir():
+			tree.dirs[rel] = true
+		default:
+			tree.files[rel] = fi
+		}
+		return nil
+	})
+	if err != nil && !isNotExist(err) {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// sameVersion reports whether dst already holds a source file of the given
+// size and modification time: the times agree (within mtimeWindow) and,
+// unless a rule stores the file transformed, so do the sizes.
+func sameVersion(size int64, modTime time.Time, dst os.FileInfo, transformed bool) bool {
+	return !dst.IsDir() && withinWindow(modTime, dst.ModTime()) && (transformed || size == dst.Size())
+}
+
+// sameContent reports whether the local file and the remote one hold the
+// same bytes. Both are only read when their sizes agree.
+func sameContent(ctx context.Context, share remoteFS, local, remote string, size int64, dst os.FileInfo) (bool, error) {
+	if dst.IsDir() || dst.Size() != size {
+		return false, nil
+	}
+	l, err := hashLocalFile(ctx, local)
+	if err != nil {
+		return false, err
+	}
+	r, err := hashRemoteFile(ctx, share, remote, "sha256")
+	if err != nil {
+		return false, err
+	}
+	return l == r, nil
+}
+
+// withParents adds p and every directory above it to set.
+func withParents(set map[string]bool, p string) {
+	for ; p != "." && !set[p]; p = path.Dir(p) {
+		set[p] = true
+	}
+}
+
+// pushPlan is what a sync to the share must do besides uploading: files it
+// can move on the server instead, and entries to delete.
+type pushPlan struct {
+	unchanged int
+	renames   []rename
+	deletes   []string
+}
+
+// planPush compares the scanned upload with the remote tree. Unchanged
+// files are marked finished in t so only new and changed ones are sent.
+// With checksum, files are unchanged when their content is, whatever their
+// times; files a rule transforms are still compared by time.
+// With del, remote entries the local tree lacks are to be deleted, except
+// links and files the rules skip, which a sync leaves alone, and a remote
+// file whose content matches a pending upload is renamed into its place.
+// That content is compared by hashing both files, or, given an index, by
+// what the index says was renamed locally.
+func planPush(ctx context.Context, share remoteFS, t *treeUpload, remote *remoteTree, rules []transferRule, del, checksum bool, backups backupSpec, index *syncIndex) (*pushPlan, error) {
+	plan := &pushPlan{}
+	keep := make(map[string]bool)
+	for dir := range t.times.times {
+		if dir != t.remote {
+			withParents(keep, relRemote(t.remote, dir))
+		}
+	}
+	var uploads []syncFile
+	byRel := make(map[string]*pipelineItem)
+	for i := range t.items {
+		it := &t.items[i]
+		rel := relRemote(t.remote, it.remote)
+		withParents(keep, rel)
+		for gen := range backups.keep {
+			keep[backups.name(rel, gen)] = true
+		}
+		fi, exists := remote.files[rel]
+		same := exists && sameVersion(it.size, it.modTime, fi, it.rule.transforms())
+		if exists && checksum && !it.rule.transforms() && !it.special {
+			var err error
+			if same, err = sameContent(ctx, share, it.local, it.remote, it.size, fi); err != nil {
+				return nil, err
+			}
+		}
+		if same {
+			t.finished[it.local] = true
+			plan.unchanged++
+			continue
+		}
+		// Renames only fill in new files: go-smb2 cannot rename over one.
+		if !exists && !it.rule.transforms() {
+			uploads = append(uploads, syncFile{path: rel, size: it.size})
+			byRel[rel] = it
+		}
+	}
+	if !del {
+		return plan, nil
+	}
+
+	// A link or skipped file keeps its directories too.
+	for rel := range remote.links {
+		withParents(keep, path.Dir(rel))
+	}
+	var deletes []syncFile
+	for rel, fi := range remote.files {
+		switch {
+		case keep[rel]:
+		case matchRule(rules, rel).skip:
+			withParents(keep, path.Dir(rel))
+		default:
+			deletes = append(deletes, syncFile{path: rel, size: fi.Size()})
+		}
+	}
+
+	if index != nil {
+		plan.renames = index.renames(deletes, uploads, remote)
+	} else {
+		// Only uploads as large as some deletion can be renames, so only
+		// those are hashed.
+		sizes := make(map[int64]bool)
+		for _, d := range deletes {
+			sizes[d.size] = true
+		}
+		for i, u := range uploads {
+			if sizes[u.size] {
+				sum, err := hashLocalFile(ctx, byRel[u.path].local)
+				if err != nil {
+					return nil, err
+				}
+				uploads[i].sum = sum
+			}
+		}
+		plan.renames = matchRemoteRenames(deletes, uploads, func(p string) (string, error) {
+			return hashRemoteFile(ctx, share, joinRemote(t.remote, p), "sha256")
+		})
+	}
+	renamed := make(map[string]bool)
+	for _, r := range plan.renames {
+		renamed[r.from] = true
+		t.finished[byRel[r.to].local] = true
+	}
+	for _, d := range deletes {
+		if !renamed[d.path] {
+			plan.deletes = append(plan.deletes, d.path)
+		}
+	}
+	for rel := range remote.dirs {
+		if !keep[rel] {
+			plan.deletes = append(plan.deletes, rel)
+		}
+	}
+	return plan, nil
+}
+
+// applyRenames carries out planned renames, printing each, and gives the
+// moved files their local modification times so the next sync sees them as
+// unchanged. A rename that fails becomes an upload and a deletion.
+func (plan *pushPlan) applyRenames(share remoteFS, t *treeUpload, w io.Writer) {
+	items := make(map[string]*pipelineItem)
+	for i := range t.items {
+		items[relRemote(t.remote, t.items[i].remote)] = &t.items[i]
+	}
+	for _, r := range plan.renames {
+		it := items[r.to]
+		err := applyRemoteRename(share, t.remote, r)
+		if err == nil {
+			err = share.Chtimes(it.remote, it.modTime, it.modTime)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "failed   rename %s -> %s: %v; uploading instead\n", r.from, r.to, err)
+			delete(t.finished, it.local)
+			plan.deletes = append(plan.deletes, r.from)
+			continue
+		}
+		fmt.Fprintf(w, "renamed  %s -> %s\n", r.from, r.to)
+	}
+}
+
+// syncPush is sync LOCAL_DIR REMOTE_DIR.
+func syncPush(ctx context.Context, opts smbOptions, args []string) error {
+	if info, err := os.Stat(args[0]); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", args[0])
+	}
+	target, err := parseRemoteTarget(args[1], opts.address, opts.share)
+	if err != nil {
+		return err
+	}
+	if opts.filter, err = withIgnoreFiles(args[0], opts.filter); err != nil {
+		return err
+	}
+	t, err := scanTreeUpload(os.Stdout, args[0], target.path, opts.rules, opts.filter, opts.allowSpecial)
+	if err != nil {
+		return err
+	}
+	if err := t.checkCollisions(os.Stdout, opts.renameClashes); err != nil {
+		return err
+	}
+	root := syncRoot(opts.address, target.share, target.path)
+	journalPath, err := syncStatePath(root, ".json")
+	if err != nil {
+		return err
+	}
+	journal, err := loadDeleteJournal(journalPath, root)
+	if err != nil {
+		return err
+	}
+	var (
+		index     *syncIndex
+		indexPath string
+	)
+	if opts.syncIndex {
+		if indexPath, err = syncStatePath(root, ".index.json"); err != nil {
+			return err
+		}
+		prev, err := loadLocalIndex(indexPath)
+		if err != nil {
+			return err
+		}
+		cur, err := buildLocalIndex(ctx, t, prev)
+		if err != nil {
+			return err
+		}
+		index = &syncIndex{prev, cur}
+	}
+
+	var (
+		plan    *pushPlan
+		deleted int
+		start   = time.Now()
+	)
+	err = withSessionReconnect(ctx, opts, func(shares *shareSet, resume bool) error {
+		smbShare, err := shares.mount(target.share)
+		if err != nil {
+			return err
+		}
+		share := shareFS(smbShare)
+		if plan == nil {
+			remote, err := scanRemoteSide(share, t.remote, opts.filter, opts.rules)
+			if err != nil {
+				return err
+			}
+			p, err := planPush(ctx, share, t, remote, opts.rules, opts.delete, opts.checksum, opts.overwrite.remoteBackup, index)
+			if err != nil {
+				return err
+			}
+			if opts.dryRun {
+				for _, r := range p.renames {
+					fmt.Fprintf(os.Stdout, "would rename %s -> %s\n", r.from, r.to)
+				}
+				t.applyOverwrite(dryRunFS(share, true), opts.overwrite, os.Stdout)
+				n, bytes := t.preview(os.Stdout)
+				journal.plan(p.deletes)
+				previewDeletes(os.Stdout, journal.Pending)
+				dryRunSummary(fmt.Sprintf("%d files to upload (%s)", n, humanBytes(bytes)), fmt.Sprintf("%d unchanged", p.unchanged),
+					fmt.Sprintf("%d to rename", len(p.renames)), fmt.Sprintf("%d to delete", len(journal.Pending)))
+				return nil
+			}
+			p.applyRenames(share, t, os.Stdout)
+			t.applyOverwrite(share, opts.overwrite, os.Stdout)
+			journal.plan(p.deletes)
+			if err := journal.save(journalPath); err != nil {
+				return err
+			}
+			plan = p
+		}
+		if err := t.run(ctx, share, os.Stdout, opts.jobs); err != nil {
+			return err
+		}
+		var uploadErr error
+		if t.failed > 0 {
+			uploadErr = fmt.Errorf("%d of %d files failed", t.failed, len(t.items)-plan.unchanged)
+		}
+		n, err := journal.apply(journalPath, uploadErr, opts.jobs, func(p string) error {
+			_, err := removeEntry(share, joinRemote(t.remote, p))
+			if err == nil {
+				fmt.Fprintf(os.Stdout, "deleted  %s\n", p)
+			}
+			return err
+		})
+		deleted += n
+		return err
+	})
+	if plan != nil {
+		fmt.Fprintf(os.Stderr, "synced %s to %s in %s: %d uploaded (%s), %d unchanged, %d renamed, %d deleted",
+			args[0], t.remote, time.Since(start).Round(time.Millisecond), t.uploaded, humanBytes(t.bytes), plan.unchanged, len(plan.renames), deleted)
+		if t.skipped > 0 {
+			fmt.Fprintf(os.Stderr, ", skipped %d", t.skipped)
+		}
+		if t.failed > 0 {
+			fmt.Fprintf(os.Stderr, ", %d failed", t.failed)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	if err == nil && t.failed > 0 {
+		err = errors.New("some files failed to upload")
+	}
+	// Until a run succeeds the index keeps the paths the share still has,
+	// so renames made since are found again by the next run.
+	if err == nil && index != nil && !opts.dryRun {
+		err = index.cur.save(indexPath)
+	}
+	return err
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanPush(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	local := writeTestTree(t, map[string]string{
+		"same.txt":    "same",
+		"changed.txt": "newer content",
+		"new.txt":     "moved content",
+		"fresh.txt":   "fresh",
+		"keep/x.txt":  "x",
+	})
+	for _, name := range []string{"same.txt", "changed.txt"} {
+		os.Chtimes(filepath.Join(local, name), mtime, mtime)
+	}
+	fsys := newTestDirFS(t, map[string]string{
+		"dst/same.txt":      "same",
+		"dst/changed.txt":   "old content",
+		"dst/old/moved.txt": "moved content",
+		"dst/gone.txt":      "gone",
+		"dst/gonedir/y.txt": "y",
+		"dst/cache/a.tmp":   "scratch",
+	})
+	for _, name := range []string{"dst/same.txt", "dst/changed.txt"} {
+		fsys.Chtimes(name, mtime, mtime)
+	}
+	rules := []transferRule{{pattern: "*.tmp", skip: true}}
+
+	tu, err := scanTreeUpload(&bytes.Buffer{}, local, "dst", rules, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := scanRemoteSide(fsys, "dst", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := planPush(context.Background(), fsys, tu, remote, rules, true, false, backupSpec{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.unchanged != 1 {
+		t.Errorf("unchanged = %d, want 1", plan.unchanged)
+	}
+	if len(plan.renames) != 1 || plan.renames[0] != (rename{from: "old/moved.txt", to: "new.txt"}) {
+		t.Errorf("renames = %v", plan.renames)
+	}
+	sort.Strings(plan.deletes)
+	if got := strings.Join(plan.deletes, " "); got != "gone.txt gonedir gonedir/y.txt old" {
+		t.Errorf("deletes = %q", got)
+	}
+
+	var out bytes.Buffer
+	plan.applyRenames(fsys, tu, &out)
+	if err := tu.run(context.Background(), fsys, &out, 2); err != nil {
+		t.Fatal(err)
+	}
+	if tu.uploaded != 3 || tu.failed != 0 {
+		t.Errorf("uploaded %d, failed %d:\n%s", tu.uploaded, tu.failed, out.String())
+	}
+	if got := readTestFile(t, fsys, "dst/new.txt"); got != "moved content" {
+		t.Errorf("new.txt = %q", got)
+	}
+	if got := readTestFile(t, fsys, "dst/changed.txt"); got != "newer content" {
+		t.Errorf("changed.txt = %q", got)
+	}
+
+	// With everything uploaded, a second plan finds nothing to do.
+	tu, _ = scanTreeUpload(&bytes.Buffer{}, local, "dst", rules, nil, false)
+	remote, _ = scanRemoteSide(fsys, "dst", nil, nil)
+	plan, err = planPush(context.Background(), fsys, tu, remote, rules, false, false, backupSpec{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.unchanged != len(tu.items) || len(plan.deletes) != 0 {
+		t.Errorf("second plan: %d of %d unchanged, deletes %v", plan.unchanged, len(tu.items), plan.deletes)
+	}
+}
+
+func TestPlanPushWithIndex(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	local := writeTestTree(t, map[string]string{"new/big.bin": "payload", "new/edited.bin": "edited"})
+	os.Chtimes(filepath.Join(local, "new", "big.bin"), mtime, mtime)
+	// The index is trusted: the remote file is never read, so its content
+	// does not matter as long as its size and time are those uploaded.
+	fsys := newTestDirFS(t, map[string]string{"dst/old/big.bin": "PAYLOAD", "dst/old/edited.bin": "edited"})
+	fsys.Chtimes("dst/old/big.bin", mtime, mtime)
+	fsys.Chtimes("dst/old/edited.bin", mtime.Add(time.Hour), mtime.Add(time.Hour))
+
+	tu, err := scanTreeUpload(&bytes.Buffer{}, local, "dst", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := buildLocalIndex(context.Background(), tu, newLocalIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := newLocalIndex()
+	prev.Entries["old/big.bin"] = cur.Entries["new/big.bin"]
+	// Changed on the share since it was uploaded, so not renamed.
+	prev.Entries["old/edited.bin"] = indexEntry{Size: 6, ModTime: mtime, SHA256: cur.Entries["new/edited.bin"].SHA256}
+	remote, err := scanRemoteSide(fsys, "dst", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := planPush(context.Background(), fsys, tu, remote, nil, true, false, backupSpec{}, &syncIndex{prev, cur})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.renames) != 1 || plan.renames[0] != (rename{from: "old/big.bin", to: "new/big.bin"}) {
+		t.Errorf("renames = %v", plan.renames)
+	}
+	sort.Strings(plan.deletes)
+	if got := strings.Join(plan.deletes, " "); got != "old old/edited.bin" {
+		t.Errorf("deletes = %q", got)
+	}
+}
+
+func TestPlanPushWithoutDelete(t *testing.T) {
+	local := writeTestTree(t, map[string]string{"a.txt": "a"})
+	fsys := newTestDirFS(t, map[string]string{"dst/stale.txt": "a"})
+	tu, err := scanTreeUpload(&bytes.Buffer{}, local, "dst", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := scanRemoteSide(fsys, "dst", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := planPush(context.Background(), fsys, tu, remote, nil, false, false, backupSpec{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.deletes) != 0 || len(plan.renames) != 0 {
+		t.Errorf("plan without -delete: deletes %v, renames %v", plan.deletes, plan.renames)
+	}
+}
+
+func TestPlanPushChecksum(t *testing.T) {
+	older := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// same.txt only differs in time, edited.txt only in content.
+	local := writeTestTree(t, map[string]string{"same.txt": "same", "edited.txt": "new!"})
+	fsys := newTestDirFS(t, map[string]string{"dst/same.txt": "same", "dst/edited.txt": "old!"})
+	os.Chtimes(filepath.Join(local, "same.txt"), newer, newer)
+	os.Chtimes(filepath.Join(local, "edited.txt"), older, older)
+	fsys.Chtimes("dst/same.txt", older, older)
+	fsys.Chtimes("dst/edited.txt", older, older)
+
+	for _, tt := range []struct {
+		checksum bool
+		want     string
+	}{{false, "same.txt"}, {true, "edited.txt"}} {
+		tu, err := scanTreeUpload(&bytes.Buffer{}, local, "dst", nil, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		remote, err := scanRemoteSide(fsys, "dst", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := planPush(context.Background(), fsys, tu, remote, nil, false, tt.checksum, backupSpec{}, nil); err != nil {
+			t.Fatal(err)
+		}
+		var sent []string
+		for _, it := range tu.items {
+			if !tu.finished[it.local] {
+				sent = append(sent, tu.rels[it.local])
+			}
+		}
+		if got := strings.Join(sent, " "); got != tt.want {
+			t.Errorf("checksum %v: uploads %q, want %q", tt.checksum, got, tt.want)
+		}
+	}
+}
+
+func TestPlanPushChecksumStopsWithContext(t *testing.T) {
+	local := writeTestTree(t, map[string]string{"a.txt": "same"})
+	fsys := newTestDirFS(t, map[string]string{"dst/a.txt": "same"})
+	tu, err := scanTreeUpload(&bytes.Buffer{}, local, "dst", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := scanRemoteSide(fsys, "dst", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := planPush(ctx, fsys, tu, remote, nil, false, true, backupSpec{}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("planPush after cancel = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestScanRemoteSideMissingRoot(t *testing.T) {
+	tree, err := scanRemoteSide(newTestDirFS(t, nil), "nowhere", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.files)+len(tree.dirs) != 0 {
+		t.Errorf("missing root listed %v %v", tree.files, tree.dirs)
+	}
+}
+
+func TestSyncStatePath(t *testing.T) {
+	t.Setenv("SMBPUT_SYNC_STATE", t.TempDir())
+	a, err := syncStatePath(syncRoot("NAS", "Backup", "/data/"), ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := syncStatePath(syncRoot("nas", "backup", "data"), ".json")
+	c, _ := syncStatePath(syncRoot("nas", "backup", "other"), ".json")
+	if a != b || a == c {
+		t.Errorf("journal paths: %s, %s, %s", a, b, c)
+	}
+}
+
+func TestPlanPushKeepsBackups(t *testing.T) {
+	local := writeTestTree(t, map[string]string{"a.txt": "a"})
+	fsys := newTestDirFS(t, map[string]string{
+		"dst/a.txt":       "old",
+		"dst/a.txt.bak":   "older",
+		"dst/a.txt.bak.1": "oldest",
+		"dst/a.txt.bak.2": "beyond keep",
+		"dst/b.txt.bak":   "of a deleted file",
+	})
+	tu, err := scanTreeUpload(&bytes.Buffer{}, local, "dst", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := scanRemoteSide(fsys, "dst", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := planPush(context.Background(), fsys, tu, remote, nil, true, false, backupSpec{suffix: ".bak", keep: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(plan.deletes)
+	if got := strings.Join(plan.deletes, " "); got != "a.txt.bak.2 b.txt.bak" {
+		t.Errorf("deletes = %q", got)
+	}
+}
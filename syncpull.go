@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// localTree is a listing of a local directory by slash-separated path
+// relative to it. other holds links and special files.
+type localTree struct {
+	files map[string]os.FileInfo
+	dirs  map[string]bool
+	other map[string]bool
+}
+
+// scanLocalSide lists everything below root but what the filter excludes. A
+// missing root is an empty tree, as for a first sync.
+func scanLocalSide(root string, filter pathFilter) (*localTree, error) {
+	tree := &localTree{files: make(map[string]os.FileInfo), dirs: make(map[string]bool), other: make(map[string]bool)}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if filter.excluded(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case d.IsDir():
+			tree.dirs[rel] = true
+		case !d.Type().IsRegular():
+			tree.other[rel] = true
+		default:
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			tree.files[rel] = info
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("scan %s: %w", root, err)
+	}
+	return tree, nil
+}
+
+// planPull compares the scanned download with the local tree, as planPush
+// does the other way: unchanged files are marked finished in t, and with
+// del, the local files and directories the remote tree lacks are returned
+// for deletion, except links, special files, and files the rules skip.
+// checksum compares content as for planPush.
+func planPull(ctx context.Context, share remoteFS, t *treeDownload, local *localTree, rules []transferRule, del, checksum bool) (unchanged int, deletes []string, err error) {
+	keep := make(map[string]bool)
+	for _, dir := range t.dirs {
+		if dir != t.local {
+			withParents(keep, localRel(t.local, dir))
+		}
+	}
+	for _, it := range t.items {
+		rel := localRel(t.local, it.local)
+		withParents(keep, rel)
+		fi, ok := local.files[rel]
+		same := ok && sameVersion(it.size, it.modTime, fi, it.rule.transforms())
+		if ok && checksum && !it.rule.transforms() {
+			if same, err = sameContent(ctx, share, it.local, it.remote, it.size, fi); err != nil {
+				return 0, nil, err
+			}
+		}
+		if same {
+			t.finished[it.remote] = true
+			unchanged++
+		}
+	}
+	if !del {
+		return unchanged, nil, nil
+	}
+	for rel := range local.other {
+		withParents(keep, path.Dir(rel))
+	}
+	for rel := range local.files {
+		switch {
+		case keep[rel]:
+		case matchRule(rules, rel).skip:
+			withParents(keep, path.Dir(rel))
+		default:
+			deletes = append(deletes, rel)
+		}
+	}
+	for rel := range local.dirs {
+		if !keep[rel] {
+			deletes = append(deletes, rel)
+		}
+	}
+	return unchanged, deletes, nil
+}
+
+// localRel returns p, a path below root, relative to root with slashes.
+func localRel(root, p string) string {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// syncPull is sync -pull REMOTE_DIR LOCAL_DIR.
+func syncPull(ctx context.Context, opts smbOptions, args []string) error {
+	target, err := parseRemoteTarget(args[0], opts.address, opts.share)
+	if err != nil {
+		return err
+	}
+	localDir, err := filepath.Abs(args[1])
+	if err != nil {
+		return err
+	}
+	if opts.filter, err = withIgnoreFiles(localDir, opts.filter); err != nil {
+		return err
+	}
+	journalPath, err := syncStatePath(localDir, ".json")
+	if err != nil {
+		return err
+	}
+	journal, err := loadDeleteJournal(journalPath, localDir)
+	if err != nil {
+		return err
+	}
+
+	var (
+		t         *treeDownload
+		unchanged int
+		deleted   int
+		start     = time.Now()
+	)
+	err = withSessionReconnect(ctx, opts, func(shares *shareSet, resume bool) error {
+		smbShare, err := shares.mount(target.share)
+		if err != nil {
+			return err
+		}
+		share := shareFS(smbShare)
+		if t == nil {
+			scanned, err := scanTreeDownload(share, os.Stdout, target.path, localDir, linksKeep, opts.rules, opts.filter)
+			if err != nil {
+				return err
+			}
+			local, err := scanLocalSide(localDir, opts.filter)
+			if err != nil {
+				return err
+			}
+			var deletes []string
+			if unchanged, deletes, err = planPull(ctx, share, scanned, local, opts.rules, opts.delete, opts.checksum); err != nil {
+				return err
+			}
+			journal.plan(deletes)
+			if opts.dryRun {
+				n, bytes := scanned.preview(os.Stdout)
+				previewDeletes(os.Stdout, journal.Pending)
+				dryRunSummary(fmt.Sprintf("%d files to download (%s)", n, humanBytes(bytes)), fmt.Sprintf("%d unchanged", unchanged),
+					fmt.Sprintf("%d to delete", len(journal.Pending)))
+				return nil
+			}
+			if err := journal.save(journalPath); err != nil {
+				return err
+			}
+			t = scanned
+		}
+		if err := t.run(ctx, share, os.Stdout, opts.jobs); err != nil {
+			return err
+		}
+		var downloadErr error
+		if t.failed > 0 {
+			downloadErr = fmt.Errorf("%d of %d files failed", t.failed, len(t.items)-unchanged)
+		}
+		n, err := journal.apply(journalPath, downloadErr, opts.jobs, func(p string) error {
+			err := os.Remove(filepath.Join(localDir, filepath.FromSlash(p)))
+			if err == nil {
+				fmt.Fprintf(os.Stdout, "deleted    %s\n", p)
+			}
+			return err
+		})
+		deleted += n
+		return err
+	})
+	if t != nil {
+		fmt.Fprintf(os.Stderr, "synced %s to %s in %s: %d downloaded (%s), %d unchanged, %d deleted",
+			t.remote, localDir, time.Since(start).Round(time.Millisecond), t.downloaded, humanBytes(t.bytes), unchanged, deleted)
+		if t.skipped > 0 {
+			fmt.Fprintf(os.Stderr, ", skipped %d", t.skipped)
+		}
+		if t.failed > 0 {
+			fmt.Fprintf(os.Stderr, ", %d failed", t.failed)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	if err == nil && t != nil && t.failed > 0 {
+		err = errors.New("some files failed to download")
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanPull(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := newTestDirFS(t, map[string]string{
+		"in/same.txt":    "same",
+		"in/changed.txt": "newer content",
+		"in/sub/new.txt": "new",
+	})
+	local := writeTestTree(t, map[string]string{
+		"same.txt":    "same",
+		"changed.txt": "old content",
+		"gone.txt":    "gone",
+		"olddir/y":    "y",
+		"notes.swp":   "editor scratch",
+	})
+	for _, name := range []string{"in/same.txt", "in/changed.txt"} {
+		fsys.Chtimes(name, mtime, mtime)
+	}
+	for _, name := range []string{"same.txt", "changed.txt"} {
+		os.Chtimes(filepath.Join(local, name), mtime, mtime)
+	}
+	os.Symlink("same.txt", filepath.Join(local, "link"))
+	rules := []transferRule{{pattern: "*.swp", skip: true}}
+
+	td, err := scanTreeDownload(fsys, &bytes.Buffer{}, "in", local, linksKeep, rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := scanLocalSide(local, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchanged, deletes, err := planPull(context.Background(), fsys, td, tree, rules, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged != 1 {
+		t.Errorf("unchanged = %d, want 1", unchanged)
+	}
+	sort.Strings(deletes)
+	if got := strings.Join(deletes, " "); got != "gone.txt olddir olddir/y" {
+		t.Errorf("deletes = %q", got)
+	}
+
+	var out bytes.Buffer
+	if err := td.run(context.Background(), fsys, &out, 2); err != nil {
+		t.Fatal(err)
+	}
+	if td.downloaded != 2 {
+		t.Errorf("downloaded %d:\n%s", td.downloaded, out.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(local, "changed.txt")); string(data) != "newer content" {
+		t.Errorf("changed.txt = %q", data)
+	}
+
+	if _, deletes, _ := planPull(context.Background(), fsys, td, tree, rules, false, false); deletes != nil {
+		t.Errorf("deletes without -delete: %v", deletes)
+	}
+}
+
+func TestScanLocalSide(t *testing.T) {
+	local := writeTestTree(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	os.Symlink("a.txt", filepath.Join(local, "link"))
+	tree, err := scanLocalSide(local, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.files) != 2 || !tree.dirs["sub"] || !tree.other["link"] {
+		t.Errorf("files %v, dirs %v, other %v", tree.files, tree.dirs, tree.other)
+	}
+	if tree, err := scanLocalSide(filepath.Join(local, "missing"), nil); err != nil || len(tree.files) != 0 {
+		t.Errorf("missing root: %v, %v", tree, err)
+	}
+}
+
+func TestPlanPullChecksum(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := newTestDirFS(t, map[string]string{"in/a.txt": "remote", "in/b.txt": "same"})
+	local := writeTestTree(t, map[string]string{"a.txt": "local!", "b.txt": "same"})
+	fsys.Chtimes("in/a.txt", mtime, mtime)
+	os.Chtimes(filepath.Join(local, "a.txt"), mtime, mtime)
+	td, err := scanTreeDownload(fsys, &bytes.Buffer{}, "in", local, linksKeep, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := scanLocalSide(local, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchanged, _, err := planPull(context.Background(), fsys, td, tree, nil, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged != 1 || !td.finished["in/b.txt"] || td.finished["in/a.txt"] {
+		t.Errorf("unchanged %d, finished %v", unchanged, td.finished)
+	}
+}
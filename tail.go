@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// tailChunkSize is how much is read per step when scanning backwards for
+// line breaks.
+const tailChunkSize = 64 << 10
+
+// lastLinesOffset returns the offset where the last n lines of the first size
+// bytes of r begin, reading backwards so only the tail is transferred. A
+// final line without a newline counts as a line.
+func lastLinesOffset(r io.ReaderAt, size int64, n int) (int64, error) {
+	if n <= 0 {
+		return size, nil
+	}
+	buf := make([]byte, tailChunkSize)
+	end := size
+	newlines := 0
+	for end > 0 {
+		start := max(end-tailChunkSize, 0)
+		chunk := buf[:end-start]
+		if _, err := r.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' {
+				continue
+			}
+			if start+int64(i) == size-1 {
+				continue // ends the last line rather than starting a new one
+			}
+			if newlines++; newlines == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// tailRemote prints the last n lines of remote. With follow set it then
+// polls the file size every interval and prints whatever was appended, until
+// ctx is done; a file that shrinks is assumed truncated and followed from
+// its new start.
+func tailRemote(ctx context.Context, share *smb2.Share, w io.Writer, remote string, n int, follow bool, interval time.Duration) error {
+	remote = normalizeRemotePath(remote)
+	start := time.Now()
+	f, err := share.Open(remote)
+	opStats.observe("open", start)
+	if err != nil {
+		return fmt.Errorf("open remote %s: %w", remote, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", remote, err)
+	}
+	size := fi.Size()
+	offset, err := lastLinesOffset(f, size, n)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", remote, err)
+	}
+	if offset, err = copyRange(w, f, offset, size); err != nil {
+		return err
+	}
+	if !follow {
+		return nil
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("stat %s: %w", remote, err)
+		}
+		size := fi.Size()
+		if size < offset {
+			fmt.Fprintf(os.Stderr, "%s: file truncated\n", remote)
+			offset = 0
+		}
+		if size > offset {
+			if offset, err = copyRange(w, f, offset, size); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// copyRange writes bytes [from, to) of f to w and returns the offset reached.
+func copyRange(w io.Writer, f *smb2.File, from, to int64) (int64, error) {
+	n, err := copyChunked(w, timedReader{io.NewSectionReader(f, from, to-from), "read"})
+	if err != nil {
+		return from + n, fmt.Errorf("read %s: %w", f.Name(), err)
+	}
+	return from + n, nil
+}
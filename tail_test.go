@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLastLinesOffset(t *testing.T) {
+	long := strings.Repeat("x", tailChunkSize+10) + "\n"
+	tests := []struct {
+		name    string
+		content string
+		n       int
+		want    string
+	}{
+		{"trailing newline", "a\nb\nc\n", 2, "b\nc\n"},
+		{"no trailing newline", "a\nb\nc", 1, "c"},
+		{"more lines than file", "a\nb\n", 5, "a\nb\n"},
+		{"zero lines", "a\nb\n", 0, ""},
+		{"empty file", "", 3, ""},
+		{"blank lines", "a\n\n\n", 2, "\n\n"},
+		{"across chunks", "first\n" + long + "last\n", 2, long + "last\n"},
+	}
+	for _, tt := range tests {
+		r := strings.NewReader(tt.content)
+		off, err := lastLinesOffset(r, int64(len(tt.content)), tt.n)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := tt.content[off:]; got != tt.want {
+			t.Errorf("%s: tail = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// displayName returns name in a form that is safe to print to a terminal.
+// Remote names are chosen by whoever can write to the share, so a name
+// carrying escape sequences, line breaks, or bidirectional overrides could
+// otherwise rewrite the screen or disguise itself as another entry. Such
+// names are printed as a double-quoted Go string with the offending
+// characters escaped; plain names are returned unchanged. raw disables this.
+func displayName(name string, raw bool) string {
+	if raw || !needsEscape(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// needsEscape reports whether name holds invalid UTF-8 or any character
+// that is not printable, or starts with a quote and could be mistaken for
+// an escaped name.
+func needsEscape(name string) bool {
+	if strings.HasPrefix(name, `"`) || !utf8.ValidString(name) {
+		return true
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestDisplayName(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  bool
+		want string
+	}{
+		{"report.csv", false, "report.csv"},
+		{"résumé 2024.docx", false, "résumé 2024.docx"},
+		{"a\x1b[2Jb", false, `"a\x1b[2Jb"`},
+		{"two\nlines", false, `"two\nlines"`},
+		{"invoice\u202etxt.exe", false, `"invoice\u202etxt.exe"`},
+		{"bad\xffutf8", false, `"bad\xffutf8"`},
+		{`"quoted"`, false, `"\"quoted\""`},
+		{"a\x1b[2Jb", true, "a\x1b[2Jb"},
+	}
+	for _, tt := range tests {
+		if got := displayName(tt.name, tt.raw); got != tt.want {
+			t.Errorf("displayName(%q, %v) = %s, want %s", tt.name, tt.raw, got, tt.want)
+		}
+	}
+}
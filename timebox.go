@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// exitTimeWindow is the exit status of a run stopped by -deadline or
+// -max-duration, so schedulers can tell it apart from a failure.
+const exitTimeWindow = 3
+
+// runContext returns a context that expires at the earlier of -max-duration
+// from now and the next occurrence of -deadline.
+func runContext(opts smbOptions, now time.Time) (context.Context, context.CancelFunc, error) {
+	var end time.Time
+	if opts.maxDuration > 0 {
+		end = now.Add(opts.maxDuration)
+	}
+	if opts.deadline != "" {
+		d, err := parseDeadline(opts.deadline, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		if end.IsZero() || d.Before(end) {
+			end = d
+		}
+	}
+	if end.IsZero() {
+		ctx, cancel := context.WithCancel(context.Background())
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), end)
+	return ctx, cancel, nil
+}
+
+// parseDeadline interprets s as a local wall-clock time (HH:MM). A time that
+// has already passed today refers to tomorrow, so "02:00" started at 23:00
+// means three hours from now.
+func parseDeadline(s string, now time.Time) (time.Time, error) {
+	t, err := time.ParseInLocation("15:04", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -deadline %q: want HH:MM", s)
+	}
+	d := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !d.After(now) {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d, nil
+}
+
+// fatalCommand reports a failed command and exits. When the time window
+// ended, the partial destination is left in place for -resume.
+func fatalCommand(ctx context.Context, command string, err error) {
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Printf("%s stopped: time window ended (%v); rerun with -resume to continue", command, err)
+		os.Exit(exitTimeWindow)
+	}
+	log.Fatalf("%s failed: %v", command, err)
+}
+
+// ctxReader stops a copy between chunks once ctx is done, so transfers end
+// on a clean boundary instead of aborting an in-flight SMB request.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
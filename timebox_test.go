@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDeadline(t *testing.T) {
+	now := time.Date(2024, 3, 10, 23, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{input: "02:00", want: time.Date(2024, 3, 11, 2, 0, 0, 0, time.UTC)},
+		{input: "23:30", want: time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC)},
+		{input: "23:00", want: time.Date(2024, 3, 11, 23, 0, 0, 0, time.UTC)},
+		{input: "2am", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		got, err := parseDeadline(tc.input, now)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("parseDeadline(%q) expected error", tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parseDeadline(%q) returned error: %v", tc.input, err)
+		}
+		if !got.Equal(tc.want) {
+			t.Fatalf("parseDeadline(%q) = %v, want %v", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestRunContextUsesEarliestLimit(t *testing.T) {
+	now := time.Now()
+	opts := smbOptions{maxDuration: time.Hour, deadline: now.Add(3 * time.Hour).Format("15:04")}
+
+	ctx, cancel, err := runContext(opts, now)
+	if err != nil {
+		t.Fatalf("runContext returned error: %v", err)
+	}
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatalf("expected context deadline")
+	}
+	if want := now.Add(time.Hour); !deadline.Equal(want) {
+		t.Fatalf("deadline = %v, want %v", deadline, want)
+	}
+}
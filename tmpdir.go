@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// stagedSuffix ends the name of an upload staged in -tmp-dir.
+const stagedSuffix = ".part"
+
+// tmpDirFlag defines -tmp-dir.
+func tmpDirFlag(fs *flag.FlagSet, opts *smbOptions) {
+	fs.StringVar(&opts.tmpDir, "tmp-dir", "", "Remote directory for partial uploads and scratch files (or tmp-dir in the profile)")
+}
+
+// stagingPath is where an upload to remote on share is written inside
+// tmpDir before being renamed into place. The name is derived from the
+// destination, so a -resume run finds the partial file an interrupted one
+// left behind.
+func stagingPath(tmpDir, share, remote string) string {
+	remote = normalizeRemotePath(remote)
+	sum := sha256.Sum256([]byte(strings.ToLower(share) + ":" + remote))
+	return joinRemote(normalizeRemotePath(tmpDir), hex.EncodeToString(sum[:8])+"-"+path.Base(remote)+stagedSuffix)
+}
+
+// commitStaged renames a completed staged upload to dst, replacing a file
+// already there. SMB rename does not overwrite, so an existing dst is
+// removed first and is briefly absent.
+func commitStaged(share remoteFS, staged, dst string) error {
+	fi, err := share.Stat(dst)
+	switch {
+	case err == nil && fi.IsDir():
+		return fmt.Errorf("%s is an existing directory", dst)
+	case err == nil:
+		if _, err := removeEntry(share, dst); err != nil {
+			return err
+		}
+	case !isNotExist(err):
+		return fmt.Errorf("stat %s: %w", dst, err)
+	}
+	start := time.Now()
+	err = share.Rename(staged, dst)
+	opStats.observe("rename", start)
+	if err != nil {
+		return fmt.Errorf("rename %s -> %s: %w", staged, dst, err)
+	}
+	return nil
+}
+
+// isTmpArtifact reports whether name is something smbput leaves in a
+// temporary directory: a staged upload or a write-size probe file.
+func isTmpArtifact(name string) bool {
+	return strings.HasSuffix(name, stagedSuffix) ||
+		strings.HasPrefix(name, ".smbput-probe-") && strings.HasSuffix(name, ".tmp")
+}
+
+// cleanTmp removes the artifacts in dir last modified before cutoff, so
+// uploads abandoned without -resume stop taking space. Artifacts still being
+// written are newer than any sensible cutoff and are left alone, as is
+// everything else in dir. It returns the number of files and bytes removed.
+func cleanTmp(share remoteFS, w io.Writer, dir string, cutoff time.Time) (int, int64, error) {
+	dir = normalizeRemotePath(dir)
+	entries, err := share.ReadDir(dir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("readdir %s: %w", dir, err)
+	}
+	var (
+		removed  int
+		freed    int64
+		firstErr error
+	)
+	for _, fi := range entries {
+		if fi.IsDir() || !isTmpArtifact(fi.Name()) || !fi.ModTime().Before(cutoff) {
+			continue
+		}
+		p := joinRemote(dir, fi.Name())
+		if err := share.Remove(p); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("remove %s: %w", p, err)
+			}
+			continue
+		}
+		fmt.Fprintf(w, "removed %s (%s, modified %s)\n", p, humanBytes(fi.Size()), fi.ModTime().Format(time.RFC3339))
+		removed++
+		freed += fi.Size()
+	}
+	return removed, freed, firstErr
+}
+
+// cleanTmpRemote is the clean-tmp command.
+func cleanTmpRemote(share remoteFS, w io.Writer, dir string, olderThan time.Duration) error {
+	removed, freed, err := cleanTmp(share, w, dir, time.Now().Add(-olderThan))
+	fmt.Fprintf(os.Stderr, "removed %d abandoned files (%s) from %s\n", removed, humanBytes(freed), normalizeRemotePath(dir))
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStagingPath(t *testing.T) {
+	p := stagingPath(".staging", "etl", "incoming/batch.csv")
+	if !strings.HasPrefix(p, ".staging/") || !strings.HasSuffix(p, "-batch.csv.part") {
+		t.Errorf("stagingPath = %q", p)
+	}
+	if q := stagingPath("/.staging/", "ETL", `\incoming\batch.csv`); q != p {
+		t.Errorf("equivalent destinations staged apart: %q and %q", p, q)
+	}
+	for _, other := range []string{
+		stagingPath(".staging", "etl", "archive/batch.csv"),
+		stagingPath(".staging", "backup", "incoming/batch.csv"),
+	} {
+		if other == p {
+			t.Errorf("different destinations share staging path %q", p)
+		}
+	}
+}
+
+func TestCommitStaged(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{".staging/x.part": "new", "out/a.txt": "old"})
+	if err := commitStaged(fsys, ".staging/x.part", "out/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, fsys, "out/a.txt"); got != "new" {
+		t.Errorf("destination = %q, want new", got)
+	}
+	if _, err := fsys.Stat(".staging/x.part"); !isNotExist(err) {
+		t.Errorf("staged file still there: %v", err)
+	}
+
+	fsys = newTestDirFS(t, map[string]string{".staging/y.part": "y", "out/dir/keep": "k"})
+	if err := commitStaged(fsys, ".staging/y.part", "out/dir"); err == nil {
+		t.Error("committed over a directory")
+	}
+}
+
+func TestCleanTmp(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{
+		"tmp/old.part":                 "12345",
+		"tmp/fresh.part":               "1",
+		"tmp/.smbput-probe-42.tmp":     "123",
+		"tmp/notes.txt":                "mine",
+		"tmp/sub/deep.part":            "1",
+		"tmp/.smbput-probe-7.tmp.keep": "1",
+	})
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	for _, p := range []string{"tmp/old.part", "tmp/.smbput-probe-42.tmp", "tmp/notes.txt", "tmp/sub/deep.part", "tmp/.smbput-probe-7.tmp.keep"} {
+		fsys.Chtimes(p, old, old)
+	}
+
+	var buf bytes.Buffer
+	removed, freed, err := cleanTmp(fsys, &buf, "tmp", now.Add(-24*time.Hour))
+	if err != nil || removed != 2 || freed != 8 {
+		t.Fatalf("cleanTmp = %d, %d, %v", removed, freed, err)
+	}
+	for _, p := range []string{"tmp/old.part", "tmp/.smbput-probe-42.tmp"} {
+		if _, err := fsys.Stat(p); !isNotExist(err) {
+			t.Errorf("%s not removed", p)
+		}
+		if !strings.Contains(buf.String(), "removed "+p) {
+			t.Errorf("output does not mention %s:\n%s", p, buf.String())
+		}
+	}
+	for _, p := range []string{"tmp/fresh.part", "tmp/notes.txt", "tmp/sub/deep.part", "tmp/.smbput-probe-7.tmp.keep"} {
+		if _, err := fsys.Stat(p); err != nil {
+			t.Errorf("%s removed: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// treeCounts tallies what a tree listing printed.
+type treeCounts struct {
+	dirs, files int
+}
+
+// treeRemote prints root and everything below it as an indented tree, at most
+// depth levels deep (all levels when depth is negative), followed by the
+// directory and file counts.
+func treeRemote(share *smb2.Share, w io.Writer, root string, depth int) error {
+	root = normalizeRemotePath(root)
+	readDir := func(dir string) ([]os.FileInfo, error) {
+		start := time.Now()
+		entries, err := share.ReadDir(dir)
+		opStats.observe("readdir", start)
+		if err != nil {
+			return nil, fmt.Errorf("readdir %s: %w", dir, err)
+		}
+		return entries, nil
+	}
+	readLink := func(p string) string { return linkSuffix(share, p) }
+	fmt.Fprintln(w, root)
+	var counts treeCounts
+	if err := writeTree(w, readDir, readLink, root, "", depth, &counts); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n%d directories, %d files\n", counts.dirs, counts.files)
+	return nil
+}
+
+// writeTree prints the entries of dir, sorted by name, under prefix, and
+// recurses into subdirectories while depth allows. Links are printed with
+// the " -> target" suffix from readLink and never descended into.
+func writeTree(w io.Writer, readDir func(string) ([]os.FileInfo, error), readLink func(string) string, dir, prefix string, depth int, counts *treeCounts) error {
+	if depth == 0 {
+		return nil
+	}
+	entries, err := readDir(dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Name()) < strings.ToLower(entries[j].Name())
+	})
+	for i, fi := range entries {
+		branch, indent := "├── ", "│   "
+		if i == len(entries)-1 {
+			branch, indent = "└── ", "    "
+		}
+		name := fi.Name()
+		if isLink(fi) {
+			counts.files++
+			fmt.Fprintf(w, "%s%s%s%s\n", prefix, branch, name, readLink(joinRemote(dir, name)))
+			continue
+		}
+		if !fi.IsDir() {
+			counts.files++
+			fmt.Fprintf(w, "%s%s%s\n", prefix, branch, name)
+			continue
+		}
+		counts.dirs++
+		fmt.Fprintf(w, "%s%s%s/\n", prefix, branch, name)
+		if err := writeTree(w, readDir, readLink, joinRemote(dir, name), prefix+indent, depth-1, counts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
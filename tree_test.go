@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWriteTree(t *testing.T) {
+	now := time.Now()
+	dirs := map[string][]os.FileInfo{
+		"data": {
+			testFileInfo("b.txt", 1, now, false),
+			testFileInfo("logs", 0, now, true),
+			testFileInfo("A.txt", 1, now, false),
+			testLinkInfo("current", true),
+		},
+		"data/logs": {
+			testFileInfo("old", 0, now, true),
+			testFileInfo("today.log", 1, now, false),
+		},
+		"data/logs/old": {
+			testFileInfo("x.log", 1, now, false),
+		},
+	}
+	readDir := func(dir string) ([]os.FileInfo, error) {
+		entries, ok := dirs[dir]
+		if !ok {
+			return nil, fmt.Errorf("no such directory %s", dir)
+		}
+		return append([]os.FileInfo(nil), entries...), nil
+	}
+	readLink := func(p string) string { return " -> logs" }
+
+	tests := []struct {
+		depth int
+		want  string
+		dirs  int
+		files int
+	}{
+		{-1, "├── A.txt\n├── b.txt\n├── current -> logs\n└── logs/\n    ├── old/\n    │   └── x.log\n    └── today.log\n", 2, 5},
+		{1, "├── A.txt\n├── b.txt\n├── current -> logs\n└── logs/\n", 1, 3},
+		{0, "", 0, 0},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		var counts treeCounts
+		if err := writeTree(&buf, readDir, readLink, "data", "", tt.depth, &counts); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("depth %d:\n%s\nwant:\n%s", tt.depth, buf.String(), tt.want)
+		}
+		if counts.dirs != tt.dirs || counts.files != tt.files {
+			t.Errorf("depth %d: counts = %+v, want %d dirs %d files", tt.depth, counts, tt.dirs, tt.files)
+		}
+	}
+}
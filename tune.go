@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// transferTuning is how an upload writes: chunk bytes per WRITE call, with
+// up to depth calls outstanding at once.
+type transferTuning struct {
+	chunk int
+	depth int
+}
+
+func (t transferTuning) String() string {
+	return fmt.Sprintf("%s chunks, %d in flight", humanBytes(int64(t.chunk)), t.depth)
+}
+
+// withDefaults fills the unset fields of t from defaultTuning.
+func (t transferTuning) withDefaults() transferTuning {
+	if t.chunk == 0 {
+		t.chunk = defaultTuning.chunk
+	}
+	if t.depth == 0 {
+		t.depth = defaultTuning.depth
+	}
+	return t
+}
+
+// defaultTuning is one write at a time of the largest size go-smb2 sends in
+// a single request.
+var defaultTuning = transferTuning{chunk: copyBufferSize, depth: 1}
+
+const (
+	// probeMinSize is the smallest upload worth probing for; below it the
+	// probe would cost more than it could save.
+	probeMinSize = 256 << 20
+	// probeBytes is written by each probe trial.
+	probeBytes = 4 << 20
+	// maxInFlight caps -inflight, bounding memory to maxInFlight chunks.
+	maxInFlight = 32
+)
+
+var (
+	probeChunks = []int{64 << 10, 256 << 10, 1 << 20}
+	probeDepths = []int{2, 4, 8}
+)
+
+// chooseTuning picks the chunk size with the best throughput at depth 1,
+// then raises the depth while that gains at least 10%: each extra write in
+// flight holds a chunk in memory and a request slot on the server, so a
+// deeper pipeline has to earn its keep. measure times writing probeBytes
+// with t. Fixed fields of want (nonzero) are kept rather than probed.
+func chooseTuning(want transferTuning, measure func(t transferTuning) (time.Duration, error)) (transferTuning, error) {
+	rate := func(t transferTuning) (float64, error) {
+		d, err := measure(t)
+		if err != nil {
+			return 0, err
+		}
+		return probeBytes / max(d.Seconds(), 1e-9), nil
+	}
+
+	best := transferTuning{chunk: want.chunk, depth: 1}
+	var bestRate float64
+	if want.chunk == 0 {
+		for _, chunk := range probeChunks {
+			r, err := rate(transferTuning{chunk: chunk, depth: 1})
+			if err != nil {
+				return defaultTuning, err
+			}
+			if r > bestRate {
+				best.chunk, bestRate = chunk, r
+			}
+		}
+	}
+	if want.depth != 0 {
+		best.depth = want.depth
+		return best, nil
+	}
+	if bestRate == 0 {
+		r, err := rate(best)
+		if err != nil {
+			return defaultTuning, err
+		}
+		bestRate = r
+	}
+	for _, depth := range probeDepths {
+		r, err := rate(transferTuning{chunk: best.chunk, depth: depth})
+		if err != nil {
+			return defaultTuning, err
+		}
+		if r < bestRate*1.1 {
+			break
+		}
+		best.depth, bestRate = depth, r
+	}
+	return best, nil
+}
+
+// probeTuning picks the tuning for uploads into dir by timing writes of a
+// scratch file there, which is removed afterwards. Fixed fields of want are
+// kept as they are.
+func probeTuning(share remoteFS, dir string, want transferTuning) (transferTuning, error) {
+	name := joinRemote(dir, fmt.Sprintf(".smbput-probe-%d.tmp", os.Getpid()))
+	f, err := share.Create(name)
+	if err != nil {
+		return defaultTuning, fmt.Errorf("create probe file %s: %w", name, err)
+	}
+	defer func() {
+		f.Close()
+		share.Remove(name)
+	}()
+	return chooseTuning(want, func(t transferTuning) (time.Duration, error) {
+		start := time.Now()
+		_, err := copyTuned(f, 0, io.LimitReader(zeroReader{}, probeBytes), t)
+		return time.Since(start), err
+	})
+}
+
+// uploadTuning settles the tuning for an upload of size bytes, probing in
+// dir. A fully fixed want is used as is; otherwise uploads
+// big enough to benefit are probed, and small ones, or a failed probe, fall
+// back to the defaults for the unset fields.
+func uploadTuning(share remoteFS, dir string, size int64, want transferTuning) transferTuning {
+	if want.chunk != 0 && want.depth != 0 || size < probeMinSize {
+		return want.withDefaults()
+	}
+	t, err := probeTuning(share, normalizeRemotePath(dir), want)
+	if err != nil {
+		log.Printf("warning: write-size probe failed, using defaults: %v", err)
+		return want.withDefaults()
+	}
+	log.Printf("tuned uploads to %s", t)
+	return t
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// copyTuned writes src to dst from offset on as t says and returns how many
+// bytes of src are in place. With several writes in flight they can finish
+// out of order, so after a failure dst is cut back to the bytes written
+// contiguously from offset: a later resume, which continues from the remote
+// size, must not skip over a hole.
+func copyTuned(dst interface {
+	io.WriterAt
+	Truncate(size int64) error
+}, offset int64, src io.Reader, t transferTuning) (int64, error) {
+	if t.depth <= 1 {
+		w := timedWriter{io.NewOffsetWriter(dst, offset), "write"}
+		return io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{src}, make([]byte, t.chunk))
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		written  = make(map[int64]int) // completed writes by offset into src
+		free     = make(chan []byte, t.depth)
+		read     int64
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+	for i := 0; i < t.depth; i++ {
+		free <- make([]byte, t.chunk)
+	}
+	for !failed() {
+		buf := <-free
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			wg.Add(1)
+			go func(buf []byte, off int64) {
+				defer wg.Done()
+				start := time.Now()
+				_, err := dst.WriteAt(buf, offset+off)
+				opStats.observe("write", start)
+				if err != nil {
+					fail(err)
+				} else {
+					opStats.addBytes("write", len(buf))
+					mu.Lock()
+					written[off] = len(buf)
+					mu.Unlock()
+				}
+				free <- buf[:cap(buf)]
+			}(buf[:n], read)
+			read += int64(n)
+		}
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			fail(err)
+		}
+	}
+	wg.Wait()
+	if firstErr == nil {
+		return read, nil
+	}
+	var done int64
+	for n, ok := written[done]; ok; n, ok = written[done] {
+		done += int64(n)
+	}
+	if done < read {
+		dst.Truncate(offset + done)
+	}
+	return done, firstErr
+}
+
+// tuningFlags defines -chunk-size and -inflight. Either left at auto is
+// probed for on big uploads.
+func tuningFlags(fs *flag.FlagSet, opts *smbOptions) {
+	fs.StringVar(&opts.chunkSize, "chunk-size", "auto", "Bytes per write request (e.g. 256k), or auto to probe on large uploads")
+	fs.StringVar(&opts.inFlight, "inflight", "auto", fmt.Sprintf("Write requests kept in flight (1-%d), or auto to probe on large uploads", maxInFlight))
+}
+
+// parseTuning turns -chunk-size and -inflight into the fields to keep fixed;
+// auto leaves a field zero.
+func parseTuning(chunkSize, inFlight string) (transferTuning, error) {
+	var t transferTuning
+	if chunkSize != "auto" {
+		n, err := parseByteSize(chunkSize)
+		if err != nil {
+			return t, fmt.Errorf("-chunk-size: %w", err)
+		}
+		if n < 4<<10 || n > 8<<20 {
+			return t, errors.New("-chunk-size must be between 4k and 8M")
+		}
+		t.chunk = int(n)
+	}
+	if inFlight != "auto" {
+		n, err := strconv.Atoi(inFlight)
+		if err != nil || n < 1 || n > maxInFlight {
+			return t, fmt.Errorf("-inflight must be auto or 1-%d", maxInFlight)
+		}
+		t.depth = n
+	}
+	return t, nil
+}
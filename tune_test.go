@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChooseTuning(t *testing.T) {
+	// Seconds per probe: 256k chunks are fastest, and depth 4 is the last
+	// step gaining 10%.
+	timings := map[transferTuning]float64{
+		{64 << 10, 1}: 4, {256 << 10, 1}: 2, {1 << 20, 1}: 3,
+		{256 << 10, 2}: 1.5, {256 << 10, 4}: 1, {256 << 10, 8}: 0.95,
+		{1 << 20, 2}: 2, {1 << 20, 4}: 1.9,
+	}
+	measure := func(tt transferTuning) (time.Duration, error) {
+		s, ok := timings[tt]
+		if !ok {
+			t.Fatalf("unexpected trial %+v", tt)
+		}
+		return time.Duration(s * float64(time.Second)), nil
+	}
+	tests := []struct {
+		want, got transferTuning
+	}{
+		{transferTuning{}, transferTuning{256 << 10, 4}},
+		{transferTuning{chunk: 1 << 20}, transferTuning{1 << 20, 2}},
+		{transferTuning{depth: 3}, transferTuning{256 << 10, 3}},
+	}
+	for _, tt := range tests {
+		got, err := chooseTuning(tt.want, measure)
+		if err != nil || got != tt.got {
+			t.Errorf("chooseTuning(%+v) = %+v, %v; want %+v", tt.want, got, err, tt.got)
+		}
+	}
+
+	boom := errors.New("boom")
+	if got, err := chooseTuning(transferTuning{}, func(transferTuning) (time.Duration, error) { return 0, boom }); err != boom || got != defaultTuning {
+		t.Errorf("failing probe = %+v, %v", got, err)
+	}
+}
+
+// memFile is an in-memory WriterAt that can fail one write.
+type memFile struct {
+	mu     sync.Mutex
+	data   []byte
+	failAt int64 // offset whose write fails; -1 for none
+}
+
+func (m *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if off == m.failAt {
+		return 0, errors.New("write failed")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if end := off + int64(len(p)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	copy(m.data[off:], p)
+	return len(p), nil
+}
+
+func (m *memFile) Truncate(size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = m.data[:min(size, int64(len(m.data)))]
+	return nil
+}
+
+func TestCopyTuned(t *testing.T) {
+	src := make([]byte, 100<<10+123)
+	for i := range src {
+		src[i] = byte(i * 7)
+	}
+	for _, tune := range []transferTuning{{4 << 10, 1}, {4 << 10, 4}, {64 << 10, 8}} {
+		dst := &memFile{data: []byte("head"), failAt: -1}
+		n, err := copyTuned(dst, 4, bytes.NewReader(src), tune)
+		if err != nil || n != int64(len(src)) {
+			t.Fatalf("%+v: copyTuned = %d, %v", tune, n, err)
+		}
+		if !bytes.Equal(dst.data[4:], src) || string(dst.data[:4]) != "head" {
+			t.Errorf("%+v: data differs", tune)
+		}
+	}
+}
+
+func TestCopyTunedFailureKeepsContiguousPrefix(t *testing.T) {
+	src := bytes.Repeat([]byte("x"), 40<<10)
+	dst := &memFile{failAt: 12 << 10}
+	n, err := copyTuned(dst, 0, bytes.NewReader(src), transferTuning{4 << 10, 4})
+	if err == nil {
+		t.Fatal("expected the write error")
+	}
+	if n != 12<<10 || int64(len(dst.data)) != n {
+		t.Fatalf("copyTuned = %d with %d bytes left, want %d of each", n, len(dst.data), 12<<10)
+	}
+}
+
+func TestParseTuning(t *testing.T) {
+	tests := []struct {
+		chunk, depth string
+		want         transferTuning
+		ok           bool
+	}{
+		{"auto", "auto", transferTuning{}, true},
+		{"256k", "auto", transferTuning{chunk: 256 << 10}, true},
+		{"auto", "8", transferTuning{depth: 8}, true},
+		{"1k", "auto", transferTuning{}, false},
+		{"16M", "auto", transferTuning{}, false},
+		{"auto", "0", transferTuning{}, false},
+		{"auto", "many", transferTuning{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseTuning(tt.chunk, tt.depth)
+		if (err == nil) != tt.ok || (tt.ok && got != tt.want) {
+			t.Errorf("parseTuning(%q, %q) = %+v, %v", tt.chunk, tt.depth, got, err)
+		}
+	}
+}
+
+func TestProbeTuningRemovesScratchFile(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"up/keep": ""})
+	got, err := probeTuning(fsys, "up", transferTuning{chunk: 64 << 10, depth: 2})
+	if err != nil || got != (transferTuning{64 << 10, 2}) {
+		t.Fatalf("probeTuning = %+v, %v", got, err)
+	}
+	entries, err := fsys.ReadDir("up")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("up holds %d entries after probing, want only keep (%v)", len(entries), err)
+	}
+	if got := uploadTuning(fsys, "up", 10, transferTuning{}); got != defaultTuning {
+		t.Errorf("small upload tuning = %+v, want defaults", got)
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Conflict policies of a two-way sync: which side wins when a file changed
+// on both since the last run.
+const (
+	conflictNewer  = "newer"
+	conflictLocal  = "local"
+	conflictRemote = "remote"
+	conflictRename = "rename"
+)
+
+// syncPair is a file as both sides held it when a two-way sync last left
+// them in agreement. The remote size is what is stored, which differs from
+// the local one for files a rule compresses or encrypts.
+type syncPair struct {
+	LocalSize  int64     `json:"local_size"`
+	LocalTime  time.Time `json:"local_time"`
+	RemoteSize int64     `json:"remote_size"`
+	RemoteTime time.Time `json:"remote_time"`
+}
+
+// syncState is what a two-way sync remembers between runs, by local path
+// relative to the synced directories. A file in neither the state nor on
+// one side is new on the other; a file in the state but missing on one side
+// was deleted there.
+type syncState struct {
+	Version int                 `json:"version"`
+	Root    string              `json:"root"`
+	Files   map[string]syncPair `json:"files"`
+}
+
+const syncStateVersion = 1
+
+// loadSyncState reads the state of a two-way sync of root. A missing file
+// is an empty state, as for a first run.
+func loadSyncState(path, root string) (*syncState, error) {
+	s := &syncState{Version: syncStateVersion, Root: root, Files: make(map[string]syncPair)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read sync state %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parse sync state %s: %w", path, err)
+	}
+	if s.Version != syncStateVersion {
+		return nil, fmt.Errorf("sync state %s has unsupported version %d", path, s.Version)
+	}
+	if s.Root != root {
+		return nil, fmt.Errorf("sync state %s belongs to a sync of %s, not %s", path, s.Root, root)
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]syncPair)
+	}
+	return s, nil
+}
+
+// save writes the state atomically.
+func (s *syncState) save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write sync state %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename sync state %s: %w", path, err)
+	}
+	return nil
+}
+
+// storedFile is a remote file of a two-way sync, under its local name.
+type storedFile struct {
+	rel  string
+	fi   os.FileInfo
+	rule transferRule
+}
+
+// remoteByName maps the remote files to the local names they stand for,
+// leaving out those the rules skip.
+func remoteByName(remote *remoteTree, rules []transferRule) map[string]storedFile {
+	files := make(map[string]storedFile, len(remote.files))
+	for rel, fi := range remote.files {
+		rule, orig := storedRule(rules, rel)
+		if !rule.skip {
+			files[orig] = storedFile{rel: rel, fi: fi, rule: rule}
+		}
+	}
+	return files
+}
+
+// localByName is the local files minus those the rules skip.
+func localByName(local *localTree, rules []transferRule) map[string]os.FileInfo {
+	files := make(map[string]os.FileInfo, len(local.files))
+	for rel, fi := range local.files {
+		if !matchRule(rules, rel).skip {
+			files[rel] = fi
+		}
+	}
+	return files
+}
+
+// twoWayPlan is what a two-way sync does: transfers each way, deletions on
+// each side, and for the rename policy, local files to move aside.
+type twoWayPlan struct {
+	up           *treeUpload
+	down         *treeDownload
+	deleteRemote []string
+	deleteLocal  []string
+	// copies renames conflicting local files to the names they are kept
+	// under, before the remote version is downloaded in their place.
+	copies    []rename
+	conflicts int
+}
+
+// conflictName is the name the rename policy keeps the local side of a
+// conflict under: report.txt becomes report.conflict-20240501-120000.txt.
+func conflictName(rel string, at time.Time) string {
+	ext := path.Ext(rel)
+	return strings.TrimSuffix(rel, ext) + ".conflict-" + at.Format("20060102-150405") + ext
+}
+
+// planTwoWay decides, file by file, what a two-way sync of localRoot and
+// remoteRoot does. A side changed if its file differs from the state (or is
+// missing from it); a change on one side is copied or, for a deletion,
+// repeated on the other. A change on both sides is a conflict, settled by
+// policy, except that a modification always beats a deletion. Conflicts are
+// reported to w.
+func planTwoWay(w io.Writer, localRoot, remoteRoot string, local map[string]os.FileInfo, remote map[string]storedFile, state *syncState, rules []transferRule, policy string, now time.Time) *twoWayPlan {
+	plan := &twoWayPlan{
+		up: &treeUpload{
+			local: localRoot, remote: remoteRoot,
+			rels: make(map[string]string), times: newDirTimes(), finished: make(map[string]bool),
+		},
+		down: &treeDownload{
+			remote: remoteRoot, local: localRoot,
+			times: make(map[string]time.Time), finished: make(map[string]bool),
+		},
+	}
+	names := make(map[string]bool)
+	for rel := range local {
+		names[rel] = true
+	}
+	for rel := range remote {
+		names[rel] = true
+	}
+	for rel := range state.Files {
+		names[rel] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for rel := range names {
+		sorted = append(sorted, rel)
+	}
+	sort.Strings(sorted)
+
+	dirs := make(map[string]bool)
+	push := func(rel string, fi os.FileInfo) {
+		p := filepath.Join(localRoot, filepath.FromSlash(rel))
+		rule := matchRule(rules, rel)
+		plan.up.items = append(plan.up.items, pipelineItem{
+			local:   p,
+			remote:  rule.remoteName(joinRemote(remoteRoot, rel)),
+			size:    fi.Size(),
+			modTime: fi.ModTime(),
+			rule:    rule,
+		})
+		plan.up.rels[p] = rel
+	}
+	pull := func(rel string, r storedFile) {
+		p := filepath.Join(localRoot, filepath.FromSlash(rel))
+		if dir := filepath.Dir(p); !dirs[dir] {
+			dirs[dir] = true
+			plan.down.dirs = append(plan.down.dirs, dir)
+		}
+		plan.down.items = append(plan.down.items, downloadItem{
+			remote:  joinRemote(remoteRoot, r.rel),
+			rel:     rel,
+			local:   p,
+			size:    r.fi.Size(),
+			modTime: r.fi.ModTime(),
+			rule:    r.rule,
+		})
+	}
+
+	for _, rel := range sorted {
+		l, lok := local[rel]
+		r, rok := remote[rel]
+		s, sok := state.Files[rel]
+		if !sok && lok && rok && sameVersion(l.Size(), l.ModTime(), r.fi, r.rule.transforms()) {
+			continue
+		}
+		lChanged := lok != sok || lok && (l.Size() != s.LocalSize || !withinWindow(l.ModTime(), s.LocalTime))
+		rChanged := rok != sok || rok && (r.fi.Size() != s.RemoteSize || !withinWindow(r.fi.ModTime(), s.RemoteTime))
+		switch {
+		case !lChanged && !rChanged:
+		case lChanged && !rChanged && lok:
+			push(rel, l)
+		case lChanged && !rChanged:
+			plan.deleteRemote = append(plan.deleteRemote, r.rel)
+		case rChanged && !lChanged && rok:
+			pull(rel, r)
+		case rChanged && !lChanged:
+			plan.deleteLocal = append(plan.deleteLocal, rel)
+		case !lok && !rok:
+		case !lok || !rok:
+			plan.conflicts++
+			fmt.Fprintf(w, "conflict   %s (deleted on one side, modified on the other: kept)\n", rel)
+			if lok {
+				push(rel, l)
+			} else {
+				pull(rel, r)
+			}
+		case sameVersion(l.Size(), l.ModTime(), r.fi, r.rule.transforms()):
+		default:
+			plan.conflicts++
+			fmt.Fprintf(w, "conflict   %s (%s)\n", rel, policy)
+			switch {
+			case policy == conflictRename:
+				moved := conflictName(rel, now)
+				plan.copies = append(plan.copies, rename{from: rel, to: moved})
+				push(moved, l)
+				pull(rel, r)
+			case policy == conflictLocal, policy == conflictNewer && l.ModTime().After(r.fi.ModTime()):
+				push(rel, l)
+			default:
+				pull(rel, r)
+			}
+		}
+	}
+	return plan
+}
+
+// recordSyncState updates the state from fresh scans of both sides. Files
+// both sides now agree on are recorded and files gone from both dropped;
+// the rest, whose transfer or deletion failed, keep their old entry so the
+// next run tries again.
+func recordSyncState(state *syncState, local map[string]os.FileInfo, remote map[string]storedFile) {
+	for rel := range state.Files {
+		if _, ok := local[rel]; !ok {
+			if _, ok := remote[rel]; !ok {
+				delete(state.Files, rel)
+			}
+		}
+	}
+	for rel, l := range local {
+		r, ok := remote[rel]
+		if ok && sameVersion(l.Size(), l.ModTime(), r.fi, r.rule.transforms()) {
+			state.Files[rel] = syncPair{LocalSize: l.Size(), LocalTime: l.ModTime(), RemoteSize: r.fi.Size(), RemoteTime: r.fi.ModTime()}
+		}
+	}
+}
+
+// syncTwoWay is sync -two-way LOCAL_DIR REMOTE_DIR.
+func syncTwoWay(ctx context.Context, opts smbOptions, args []string) error {
+	switch opts.conflict {
+	case conflictNewer, conflictLocal, conflictRemote, conflictRename:
+	default:
+		return fmt.Errorf("invalid -conflict %q: want newer, local, remote, or rename", opts.conflict)
+	}
+	if opts.pull || opts.delete {
+		return errors.New("-two-way cannot be combined with -pull or -delete: deletions on either side are propagated")
+	}
+	if opts.checksum {
+		return errors.New("-two-way cannot be combined with -checksum: changes are told apart by their times")
+	}
+	localDir, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(localDir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", args[0])
+	}
+	if opts.filter, err = withIgnoreFiles(localDir, opts.filter); err != nil {
+		return err
+	}
+	target, err := parseRemoteTarget(args[1], opts.address, opts.share)
+	if err != nil {
+		return err
+	}
+	remoteDir := normalizeRemotePath(target.path)
+	root := syncRoot(opts.address, target.share, remoteDir) + " <-> " + localDir
+	statePath, err := syncStatePath(root, ".state.json")
+	if err != nil {
+		return err
+	}
+	state, err := loadSyncState(statePath, root)
+	if err != nil {
+		return err
+	}
+
+	var (
+		plan          *twoWayPlan
+		deleted, done int
+		start         = time.Now()
+	)
+	err = withSessionReconnect(ctx, opts, func(shares *shareSet, resume bool) error {
+		smbShare, err := shares.mount(target.share)
+		if err != nil {
+			return err
+		}
+		share := shareFS(smbShare)
+		if plan == nil {
+			local, err := scanLocalSide(localDir, opts.filter)
+			if err != nil {
+				return err
+			}
+			// Renamed copies would come back as new remote files, so
+			// collisions cannot be renamed away here.
+			if groups := localCaseCollisions(local, opts.rules); len(groups) > 0 {
+				return caseCollisionError(groups, "rename them or exclude all but one")
+			}
+			remote, err := scanRemoteSide(share, remoteDir, opts.filter, opts.rules)
+			if err != nil {
+				return err
+			}
+			p := planTwoWay(os.Stdout, localDir, remoteDir, localByName(local, opts.rules), remoteByName(remote, opts.rules), state, opts.rules, opts.conflict, time.Now())
+			if opts.dryRun {
+				for _, c := range p.copies {
+					fmt.Fprintf(os.Stdout, "would keep %s as %s\n", c.from, c.to)
+				}
+				up, upBytes := p.up.preview(os.Stdout)
+				down, downBytes := p.down.preview(os.Stdout)
+				previewDeletes(os.Stdout, p.deleteRemote)
+				previewDeletes(os.Stdout, p.deleteLocal)
+				dryRunSummary(fmt.Sprintf("%d files to upload (%s)", up, humanBytes(upBytes)), fmt.Sprintf("%d to download (%s)", down, humanBytes(downBytes)),
+					fmt.Sprintf("%d to delete", len(p.deleteRemote)+len(p.deleteLocal)), fmt.Sprintf("%d conflicts", p.conflicts))
+				return nil
+			}
+			for _, c := range p.copies {
+				from := filepath.Join(localDir, filepath.FromSlash(c.from))
+				if err := os.Rename(from, filepath.Join(localDir, filepath.FromSlash(c.to))); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stdout, "kept       %s as %s\n", c.from, c.to)
+			}
+			plan = p
+		}
+		if err := plan.up.run(ctx, share, os.Stdout, opts.jobs); err != nil {
+			return err
+		}
+		if err := plan.down.run(ctx, share, os.Stdout, opts.jobs); err != nil {
+			return err
+		}
+		// Deletions are done in order; done counts those behind us when a
+		// dropped connection brings us back here.
+		all := append(append([]string(nil), plan.deleteRemote...), plan.deleteLocal...)
+		for ; done < len(all); done++ {
+			var err error
+			if done < len(plan.deleteRemote) {
+				_, err = removeEntry(share, joinRemote(remoteDir, all[done]))
+			} else {
+				err = os.Remove(filepath.Join(localDir, filepath.FromSlash(all[done])))
+			}
+			switch {
+			case err == nil:
+				fmt.Fprintf(os.Stdout, "deleted    %s\n", all[done])
+				deleted++
+			case isConnectionError(err):
+				return err
+			case !isNotExist(err):
+				fmt.Fprintf(os.Stdout, "failed     delete %s: %v\n", all[done], err)
+			}
+		}
+
+		local, err := scanLocalSide(localDir, opts.filter)
+		if err != nil {
+			return err
+		}
+		remote, err := scanRemoteSide(share, remoteDir, opts.filter, opts.rules)
+		if err != nil {
+			return err
+		}
+		recordSyncState(state, localByName(local, opts.rules), remoteByName(remote, opts.rules))
+		return state.save(statePath)
+	})
+	if plan != nil {
+		failed := plan.up.failed + plan.down.failed
+		fmt.Fprintf(os.Stderr, "synced %s and %s in %s: %d uploaded (%s), %d downloaded (%s), %d deleted, %d conflicts",
+			localDir, remoteDir, time.Since(start).Round(time.Millisecond), plan.up.uploaded, humanBytes(plan.up.bytes),
+			plan.down.downloaded, humanBytes(plan.down.bytes), deleted, plan.conflicts)
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, ", %d failed", failed)
+		}
+		fmt.Fprintln(os.Stderr)
+		if err == nil && failed > 0 {
+			err = fmt.Errorf("%d files failed to transfer", failed)
+		}
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// planTestTwoWay plans a two-way sync of local and dst on fsys.
+func planTestTwoWay(t *testing.T, local string, fsys dirFS, state *syncState, policy string) (*twoWayPlan, string) {
+	t.Helper()
+	lt, err := scanLocalSide(local, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := scanRemoteSide(fsys, "dst", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	plan := planTwoWay(&out, local, "dst", localByName(lt, nil), remoteByName(rt, nil), state, nil, policy, now)
+	return plan, out.String()
+}
+
+func twoWayActions(plan *twoWayPlan) string {
+	var parts []string
+	for _, it := range plan.up.items {
+		parts = append(parts, "up:"+plan.up.rels[it.local])
+	}
+	for _, it := range plan.down.items {
+		parts = append(parts, "down:"+it.rel)
+	}
+	for _, rel := range plan.deleteRemote {
+		parts = append(parts, "rm-remote:"+rel)
+	}
+	for _, rel := range plan.deleteLocal {
+		parts = append(parts, "rm-local:"+rel)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestPlanTwoWayFirstRun(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	local := writeTestTree(t, map[string]string{"both.txt": "same", "mine.txt": "m", "c.txt": "local edit"})
+	fsys := newTestDirFS(t, map[string]string{"dst/both.txt": "same", "dst/theirs.txt": "t", "dst/c.txt": "remote"})
+	os.Chtimes(filepath.Join(local, "both.txt"), older, older)
+	fsys.Chtimes("dst/both.txt", older, older)
+	os.Chtimes(filepath.Join(local, "c.txt"), newer, newer)
+	fsys.Chtimes("dst/c.txt", older, older)
+
+	state := &syncState{Files: map[string]syncPair{}}
+	tests := []struct {
+		policy, want string
+	}{
+		{conflictNewer, "up:c.txt up:mine.txt down:theirs.txt"},
+		{conflictRemote, "up:mine.txt down:c.txt down:theirs.txt"},
+		{conflictRename, "up:c.conflict-20240501-120000.txt up:mine.txt down:c.txt down:theirs.txt"},
+	}
+	for _, tt := range tests {
+		plan, out := planTestTwoWay(t, local, fsys, state, tt.policy)
+		if got := twoWayActions(plan); got != tt.want {
+			t.Errorf("%s: actions = %q, want %q", tt.policy, got, tt.want)
+		}
+		if plan.conflicts != 1 || !strings.Contains(out, "conflict   c.txt") {
+			t.Errorf("%s: %d conflicts, output %q", tt.policy, plan.conflicts, out)
+		}
+	}
+}
+
+func TestPlanTwoWayWithState(t *testing.T) {
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	local := writeTestTree(t, map[string]string{"same.txt": "s", "edited.txt": "e", "kept.txt": "local edit"})
+	fsys := newTestDirFS(t, map[string]string{"dst/same.txt": "s", "dst/edited.txt": "remote edit", "dst/dropped.txt": "d"})
+	for _, name := range []string{"same.txt", "edited.txt"} {
+		os.Chtimes(filepath.Join(local, name), mtime, mtime)
+	}
+	for _, name := range []string{"same.txt", "dropped.txt"} {
+		fsys.Chtimes("dst/"+name, mtime, mtime)
+	}
+	pair := func(size int64) syncPair {
+		return syncPair{LocalSize: size, LocalTime: mtime, RemoteSize: size, RemoteTime: mtime}
+	}
+	// dropped.txt was deleted locally, edited.txt changed remotely, and
+	// kept.txt deleted remotely but changed locally, which keeps it.
+	state := &syncState{Files: map[string]syncPair{
+		"same.txt": pair(1), "edited.txt": pair(1), "dropped.txt": pair(1), "kept.txt": pair(1),
+	}}
+	plan, out := planTestTwoWay(t, local, fsys, state, conflictNewer)
+	if got, want := twoWayActions(plan), "up:kept.txt down:edited.txt rm-remote:dropped.txt"; got != want {
+		t.Errorf("actions = %q, want %q", got, want)
+	}
+	if plan.conflicts != 1 {
+		t.Errorf("conflicts = %d:\n%s", plan.conflicts, out)
+	}
+}
+
+func TestRecordSyncState(t *testing.T) {
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	local := writeTestTree(t, map[string]string{"a.txt": "a", "pending.txt": "p"})
+	fsys := newTestDirFS(t, map[string]string{"dst/a.txt": "a", "dst/pending.txt": "old"})
+	os.Chtimes(filepath.Join(local, "a.txt"), mtime, mtime)
+	fsys.Chtimes("dst/a.txt", mtime, mtime)
+
+	old := syncPair{LocalSize: 3}
+	state := &syncState{Files: map[string]syncPair{"pending.txt": old, "gone.txt": old}}
+	lt, _ := scanLocalSide(local, nil)
+	rt, _ := scanRemoteSide(fsys, "dst", nil, nil)
+	recordSyncState(state, localByName(lt, nil), remoteByName(rt, nil))
+	if _, ok := state.Files["gone.txt"]; ok {
+		t.Error("gone.txt still recorded")
+	}
+	if state.Files["pending.txt"] != old {
+		t.Errorf("pending.txt = %+v, want the old entry", state.Files["pending.txt"])
+	}
+	if p := state.Files["a.txt"]; p.LocalSize != 1 || !p.LocalTime.Equal(mtime) {
+		t.Errorf("a.txt = %+v", p)
+	}
+}
+
+func TestLoadSyncState(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "state.json")
+	s, err := loadSyncState(p, "a")
+	if err != nil || len(s.Files) != 0 {
+		t.Fatalf("missing state: %+v, %v", s, err)
+	}
+	s.Files["x"] = syncPair{LocalSize: 1}
+	if err := s.save(p); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := loadSyncState(p, "a"); err != nil || s.Files["x"].LocalSize != 1 {
+		t.Errorf("reloaded: %+v, %v", s, err)
+	}
+	if _, err := loadSyncState(p, "b"); err == nil {
+		t.Error("state of another root accepted")
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// usageRecord is the traffic smbput has sent to one destination over all
+// runs on this machine.
+type usageRecord struct {
+	Runs         int64     `json:"runs"`
+	Ops          int64     `json:"ops"`
+	BytesRead    int64     `json:"bytes_read"`
+	BytesWritten int64     `json:"bytes_written"`
+	First        time.Time `json:"first"`
+	Last         time.Time `json:"last"`
+}
+
+// usageDB maps destinations, "server/share" or just "server" for commands
+// that mount no share, to their accumulated usage.
+type usageDB struct {
+	Version      int                     `json:"version"`
+	Destinations map[string]*usageRecord `json:"destinations"`
+}
+
+const usageDBVersion = 1
+
+// usagePath returns the usage database location: $SMBPUT_USAGE, or
+// smbput/usage.json under the user's configuration directory. It is empty
+// when SMBPUT_USAGE=off disables accounting.
+func usagePath() string {
+	if p := os.Getenv("SMBPUT_USAGE"); p != "" {
+		if p == "off" {
+			return ""
+		}
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "smbput", "usage.json")
+}
+
+func usageKey(server, share string) string {
+	if share == "" {
+		return server
+	}
+	return server + "/" + share
+}
+
+func loadUsage(path string) (*usageDB, error) {
+	db := &usageDB{Version: usageDBVersion, Destinations: make(map[string]*usageRecord)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read usage %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, fmt.Errorf("parse usage %s: %w", path, err)
+	}
+	if db.Version != usageDBVersion {
+		return nil, fmt.Errorf("usage %s has unsupported version %d", path, db.Version)
+	}
+	if db.Destinations == nil {
+		db.Destinations = make(map[string]*usageRecord)
+	}
+	return db, nil
+}
+
+func (db *usageDB) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write usage %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename usage %s: %w", path, err)
+	}
+	return nil
+}
+
+// add accumulates one run against key.
+func (db *usageDB) add(key string, ops, read, written int64, now time.Time) {
+	r := db.Destinations[key]
+	if r == nil {
+		r = &usageRecord{First: now}
+		db.Destinations[key] = r
+	}
+	r.Runs++
+	r.Ops += ops
+	r.BytesRead += read
+	r.BytesWritten += written
+	r.Last = now
+}
+
+// lockUsage serialises updates from concurrent smbput processes with a lock
+// file, giving up after a few seconds rather than delaying the command.
+func lockUsage(path string) (func(), error) {
+	lock := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lock), 0o755); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		// A lock older than any update could take was left by a killed run.
+		if fi, statErr := os.Stat(lock); statErr == nil && time.Since(fi.ModTime()) > time.Minute {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("usage database %s is locked", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// recordUsage adds this run's operations and bytes to the usage database.
+// Traffic to other shares reached through smb:// URLs is counted against
+// the -share destination.
+func recordUsage(opts smbOptions) error {
+	path := usagePath()
+	ops, read, written := opStats.totals()
+	if path == "" || ops == 0 {
+		return nil
+	}
+	unlock, err := lockUsage(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	db, err := loadUsage(path)
+	if err != nil {
+		return err
+	}
+	db.add(usageKey(opts.address, opts.share), ops, read, written, time.Now().UTC())
+	return db.save(path)
+}
+
+// writeUsage prints the database sorted by destination.
+func writeUsage(w io.Writer, db *usageDB, human bool) {
+	size := func(n int64) string {
+		if human {
+			return humanBytes(n)
+		}
+		return strconv.FormatInt(n, 10)
+	}
+	keys := make([]string, 0, len(db.Destinations))
+	for k := range db.Destinations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "%-32s %6s %10s %14s %14s  %s\n", "destination", "runs", "ops", "read", "written", "last")
+	for _, k := range keys {
+		r := db.Destinations[k]
+		fmt.Fprintf(w, "%-32s %6d %10d %14s %14s  %s\n", k, r.Runs, r.Ops, size(r.BytesRead), size(r.BytesWritten), r.Last.Format(time.RFC3339))
+	}
+}
+
+// showUsage implements the stats command.
+func showUsage(w io.Writer, asJSON, human, reset bool) error {
+	path := usagePath()
+	if path == "" {
+		return errors.New("usage accounting is disabled (SMBPUT_USAGE=off)")
+	}
+	if reset {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("reset usage: %w", err)
+		}
+		return nil
+	}
+	db, err := loadUsage(path)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		out := make(map[string]schemaTagged, len(db.Destinations))
+		for k, r := range db.Destinations {
+			out[k] = withSchema("stats", r)
+		}
+		return enc.Encode(out)
+	}
+	writeUsage(w, db, human)
+	return nil
+}
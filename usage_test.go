@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsageAccumulatesAcrossRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	first := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		db, err := loadUsage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.add(usageKey("nas.local", "backup"), 10, 100, 1000, first.Add(time.Duration(i)*time.Hour))
+		db.add(usageKey("nas.local", ""), 2, 0, 0, first)
+		if err := db.save(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := loadUsage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := *db.Destinations["nas.local/backup"]
+	want := usageRecord{Runs: 2, Ops: 20, BytesRead: 200, BytesWritten: 2000, First: first, Last: first.Add(time.Hour)}
+	if got != want {
+		t.Fatalf("record = %+v, want %+v", got, want)
+	}
+
+	var buf bytes.Buffer
+	writeUsage(&buf, db, true)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "nas.local ") || !strings.Contains(lines[2], "2.0 KiB") {
+		t.Errorf("unexpected listing:\n%s", buf.String())
+	}
+}
+
+func TestRecordUsage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	t.Setenv("SMBPUT_USAGE", path)
+	saved := opStats
+	t.Cleanup(func() { opStats = saved })
+	opStats = newLatencyStats()
+
+	var sink bytes.Buffer
+	if _, err := (timedWriter{&sink, "write"}).Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordUsage(smbOptions{address: "nas.local", share: "drop"}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadUsage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := db.Destinations["nas.local/drop"]
+	if r == nil || r.Runs != 1 || r.Ops != 1 || r.BytesWritten != 5 || r.BytesRead != 0 {
+		t.Fatalf("record = %+v", r)
+	}
+
+	t.Setenv("SMBPUT_USAGE", "off")
+	if usagePath() != "" {
+		t.Error("SMBPUT_USAGE=off did not disable accounting")
+	}
+}
+
+func TestLockUsageIsExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	unlock, err := lockUsage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		unlock2, err := lockUsage(path)
+		if err == nil {
+			unlock2()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("second lock acquired while the first was held")
+	case <-time.After(200 * time.Millisecond):
+	}
+	unlock()
+	<-done
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// Set at link time, e.g. -ldflags "-X main.version=v1.2.0".
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// features lists optional capabilities and whether this build has them, so
+// automation can check before relying on newer flags.
+var features = map[string]bool{
+	"ntlm":        true,
+	"llmnr":       true,
+	"metrics":     true,
+	"kerberos":    false,
+	"sspi":        false,
+	"quic":        false,
+	"compression": false,
+	"fuse":        false,
+}
+
+type buildInfo struct {
+	Version   string          `json:"version"`
+	Commit    string          `json:"commit,omitempty"`
+	BuildDate string          `json:"build_date,omitempty"`
+	GoVersion string          `json:"go_version"`
+	Platform  string          `json:"platform"`
+	Features  map[string]bool `json:"features"`
+}
+
+// currentBuildInfo returns the link-time values, falling back to the VCS
+// stamp Go embeds in module builds.
+func currentBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Features:  features,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			}
+		}
+	}
+	return info
+}
+
+func printVersion(w io.Writer, asJSON bool) error {
+	info := currentBuildInfo()
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(withSchema("version", info))
+	}
+
+	fmt.Fprintf(w, "smbput %s\n", info.Version)
+	if info.Commit != "" {
+		fmt.Fprintf(w, "commit:   %s\n", info.Commit)
+	}
+	if info.BuildDate != "" {
+		fmt.Fprintf(w, "built:    %s\n", info.BuildDate)
+	}
+	fmt.Fprintf(w, "go:       %s %s\n", info.GoVersion, info.Platform)
+	fmt.Fprintf(w, "features: %s\n", formatFeatures(info.Features))
+	return nil
+}
+
+// formatFeatures renders features as "+enabled -disabled", sorted by name.
+func formatFeatures(m map[string]bool) string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		if m[name] {
+			parts = append(parts, "+"+name)
+		} else {
+			parts = append(parts, "-"+name)
+		}
+	}
+	return strings.Join(parts, " ")
+}
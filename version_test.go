@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestFormatFeatures(t *testing.T) {
+	got := formatFeatures(map[string]bool{"quic": false, "ntlm": true, "fuse": false})
+	if want := "-fuse +ntlm -quic"; got != want {
+		t.Fatalf("formatFeatures = %q, want %q", got, want)
+	}
+}
+
+func TestPrintVersionJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printVersion(&buf, true); err != nil {
+		t.Fatalf("printVersion returned error: %v", err)
+	}
+	var info buildInfo
+	if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	if info.Version == "" || info.GoVersion == "" || info.Platform == "" {
+		t.Fatalf("missing fields in %+v", info)
+	}
+	if _, ok := info.Features["kerberos"]; !ok {
+		t.Fatalf("features missing kerberos: %v", info.Features)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// joinRemote joins a normalized remote directory and an entry name.
+func joinRemote(dir, name string) string {
+	if dir == "." || dir == "" {
+		return name
+	}
+	return path.Join(dir, name)
+}
+
+// checkEntryName fails a name a server listed in a directory that is not a
+// single path element: empty, . or .., or containing a separator or a
+// drive or stream colon. Such a name from a hostile or broken server would
+// otherwise lead a walk, and the local paths built from it, out of the
+// tree being listed.
+func checkEntryName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		return fmt.Errorf("server listed an invalid entry name %q", name)
+	}
+	return nil
+}
+
+// walkRemote calls fn for every entry below root (root itself excluded),
+// descending into each directory right after visiting it. Returning
+// fs.SkipDir from fn for a directory skips its contents. Links are reported
+// but not descended into. A listed name checkEntryName rejects fails the
+// walk.
+func walkRemote(share remoteFS, root string, fn func(p string, fi os.FileInfo) error) error {
+	return walkRemoteLinks(share, root, linksKeep, fn)
+}
+
+// walkRemoteLinks is walkRemote with a choice of what to do with links.
+func walkRemoteLinks(share remoteFS, root string, links linkPolicy, fn func(p string, fi os.FileInfo) error) error {
+	readDir := func(dir string) ([]os.FileInfo, error) {
+		start := time.Now()
+		entries, err := share.ReadDir(dir)
+		opStats.observe("readdir", start)
+		if err != nil {
+			return nil, fmt.Errorf("readdir %s: %w", dir, err)
+		}
+		return entries, nil
+	}
+	stat := func(p string) (os.FileInfo, error) {
+		start := time.Now()
+		fi, err := share.Stat(p)
+		opStats.observe("stat", start)
+		return fi, err
+	}
+	return walkTree(readDir, stat, normalizeRemotePath(root), links, fn)
+}
+
+// walkTree is walkRemote over plain functions: readDir lists a directory and
+// stat resolves a link to what it points at.
+func walkTree(readDir func(string) ([]os.FileInfo, error), stat func(string) (os.FileInfo, error), root string, links linkPolicy, fn func(p string, fi os.FileInfo) error) error {
+	return walkTreeDir(readDir, stat, root, links, 0, fn)
+}
+
+func walkTreeDir(readDir func(string) ([]os.FileInfo, error), stat func(string) (os.FileInfo, error), dir string, links linkPolicy, hops int, fn func(p string, fi os.FileInfo) error) error {
+	entries, err := readDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range entries {
+		if err := checkEntryName(fi.Name()); err != nil {
+			return fmt.Errorf("readdir %s: %w", dir, err)
+		}
+		p := joinRemote(dir, fi.Name())
+		descend, nextHops := fi.IsDir(), hops
+		if isLink(fi) {
+			switch links {
+			case linksSkip:
+				continue
+			case linksKeep:
+				descend = false
+			case linksFollow:
+				target, err := stat(p)
+				if err != nil {
+					log.Printf("warning: %s: cannot follow link: %v", p, err)
+					continue
+				}
+				fi = target
+				descend = fi.IsDir()
+				if descend {
+					if nextHops++; nextHops > maxLinkHops {
+						log.Printf("warning: %s: not following more than %d nested links", p, maxLinkHops)
+						descend = false
+					}
+				}
+			}
+		}
+		err := fn(p, fi)
+		if descend && err == fs.SkipDir {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if descend {
+			if err := walkTreeDir(readDir, stat, p, links, nextHops, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJoinRemote(t *testing.T) {
+	tests := []struct {
+		dir, name, want string
+	}{
+		{".", "file.txt", "file.txt"},
+		{"", "file.txt", "file.txt"},
+		{"reports", "weekly.pdf", "reports/weekly.pdf"},
+		{"a/b", "c", "a/b/c"},
+	}
+
+	for _, tc := range tests {
+		if got := joinRemote(tc.dir, tc.name); got != tc.want {
+			t.Fatalf("joinRemote(%q, %q) = %q, want %q", tc.dir, tc.name, got, tc.want)
+		}
+	}
+}
+
+// hostileFS lists extra entries a server made up in the given directories.
+type hostileFS struct {
+	dirFS
+	extra map[string][]string
+}
+
+func (h hostileFS) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := h.dirFS.ReadDir(name)
+	for _, n := range h.extra[name] {
+		entries = append(entries, testFileInfo(n, 1, time.Time{}, false))
+	}
+	return entries, err
+}
+
+func TestCheckEntryName(t *testing.T) {
+	for _, name := range []string{"a.txt", ".hidden", "..a", "a b"} {
+		if err := checkEntryName(name); err != nil {
+			t.Errorf("checkEntryName(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "../x", `..\x`, "a/../../x", "C:x", "a:stream"} {
+		if err := checkEntryName(name); err == nil {
+			t.Errorf("checkEntryName(%q) accepted", name)
+		}
+	}
+}
+
+func TestWalksRejectEscapingNames(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"src/a.txt": "a", "src/sub/b.txt": "b"})
+	share := hostileFS{fsys, map[string][]string{"src/sub": {"../escape"}}}
+	local := filepath.Join(t.TempDir(), "out")
+	if _, err := scanTreeDownload(share, &strings.Builder{}, "src", local, linksKeep, nil, nil); err == nil || !strings.Contains(err.Error(), "../escape") {
+		t.Errorf("scanTreeDownload = %v, want the name rejected", err)
+	}
+	if _, err := scanRemoteSide(share, "src", nil, nil); err == nil {
+		t.Error("scanRemoteSide accepted ../escape")
+	}
+}
+
+func TestLocalPathUnder(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "out")
+	if p, err := localPathUnder(root, "sub/a.txt"); err != nil || p != filepath.Join(root, "sub", "a.txt") {
+		t.Errorf("localPathUnder = %q, %v", p, err)
+	}
+	for _, rel := range []string{"../x", "a/../../x", ".."} {
+		if _, err := localPathUnder(root, rel); err == nil {
+			t.Errorf("localPathUnder(%q) accepted", rel)
+		}
+	}
+}
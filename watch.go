@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+)
+
+// watchEvent is one change seen by watch.
+type watchEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"` // create, modify, delete, or rename
+	Path    string    `json:"path"`
+	OldPath string    `json:"old_path,omitempty"`
+	Size    int64     `json:"size"`
+	Dir     bool      `json:"dir,omitempty"`
+}
+
+// watchEntry is what watch remembers about a path between polls.
+type watchEntry struct {
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+// scanWatch lists root, and with recursive everything below it, keyed by
+// path.
+func scanWatch(share remoteFS, root string, recursive bool) (map[string]watchEntry, error) {
+	entries := make(map[string]watchEntry)
+	err := walkRemote(share, root, func(p string, fi os.FileInfo) error {
+		entries[p] = watchEntry{size: fi.Size(), modTime: fi.ModTime(), dir: fi.IsDir()}
+		if fi.IsDir() && !recursive {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// diffWatch turns two scans into events, sorted by path. A file that
+// disappears while one of the same size and modification time appears is
+// reported as a rename, since that is how a rename looks between polls.
+// Directories only report create, delete, and rename; their timestamps
+// change with their contents.
+func diffWatch(prev, cur map[string]watchEntry, now time.Time) []watchEvent {
+	var created, deleted, events []watchEvent
+	for p, e := range cur {
+		old, ok := prev[p]
+		switch {
+		case !ok:
+			created = append(created, watchEvent{Time: now, Type: "create", Path: p, Size: e.size, Dir: e.dir})
+		case old.dir != e.dir:
+			events = append(events,
+				watchEvent{Time: now, Type: "delete", Path: p, Size: old.size, Dir: old.dir},
+				watchEvent{Time: now, Type: "create", Path: p, Size: e.size, Dir: e.dir})
+		case !e.dir && (old.size != e.size || !old.modTime.Equal(e.modTime)):
+			events = append(events, watchEvent{Time: now, Type: "modify", Path: p, Size: e.size})
+		}
+	}
+	for p, e := range prev {
+		if _, ok := cur[p]; !ok {
+			deleted = append(deleted, watchEvent{Time: now, Type: "delete", Path: p, Size: e.size, Dir: e.dir})
+		}
+	}
+	sortWatchEvents(created)
+	sortWatchEvents(deleted)
+
+	for i := range created {
+		c := &created[i]
+		for j := range deleted {
+			d := &deleted[j]
+			if d.Type != "delete" || d.Dir != c.Dir || d.Size != c.Size || !prev[d.Path].modTime.Equal(cur[c.Path].modTime) {
+				continue
+			}
+			c.Type, c.OldPath = "rename", d.Path
+			d.Type = "" // consumed by the rename
+			break
+		}
+	}
+	events = append(events, created...)
+	for _, d := range deleted {
+		if d.Type != "" {
+			events = append(events, d)
+		}
+	}
+	events = dropRenamedChildren(events)
+	sortWatchEvents(events)
+	return events
+}
+
+// dropRenamedChildren removes the create and delete events of entries inside
+// a renamed directory, which moved along with it.
+func dropRenamedChildren(events []watchEvent) []watchEvent {
+	var dirs []watchEvent
+	for _, e := range events {
+		if e.Type == "rename" && e.Dir {
+			dirs = append(dirs, e)
+		}
+	}
+	if len(dirs) == 0 {
+		return events
+	}
+	kept := events[:0]
+	for _, e := range events {
+		moved := false
+		for _, d := range dirs {
+			if (e.Type == "create" || e.Type == "rename") && isBelow(e.Path, d.Path) ||
+				e.Type == "delete" && isBelow(e.Path, d.OldPath) {
+				moved = true
+				break
+			}
+		}
+		if !moved {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// isBelow reports whether p lies inside directory dir.
+func isBelow(p, dir string) bool {
+	return len(p) > len(dir) && p[:len(dir)] == dir && p[len(dir)] == '/'
+}
+
+func sortWatchEvents(events []watchEvent) {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+}
+
+func writeWatchEvent(w io.Writer, e watchEvent, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(withSchema("watch", e))
+	}
+	line := fmt.Sprintf("%s %-6s %s", e.Time.Format(time.RFC3339), e.Type, e.Path)
+	if e.Dir {
+		line += "/"
+	}
+	if e.OldPath != "" {
+		line += " (from " + e.OldPath + ")"
+	}
+	_, err := fmt.Fprintln(w, line)
+	return err
+}
+
+// watchRemote scans dir every interval and prints what changed since the
+// previous scan, until ctx is done. The first scan is the baseline and
+// prints nothing. Changes that come and go within one interval are not
+// seen.
+func watchRemote(ctx context.Context, share remoteFS, w io.Writer, dir string, recursive bool, interval time.Duration, asJSON bool) error {
+	dir = normalizeRemotePath(dir)
+	fi, err := share.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", dir, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	prev, err := scanWatch(share, dir, recursive)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			cur, err := scanWatch(share, dir, recursive)
+			if err != nil {
+				return err
+			}
+			for _, e := range diffWatch(prev, cur, now.UTC().Truncate(time.Second)) {
+				if err := writeWatchEvent(w, e, asJSON); err != nil {
+					return err
+				}
+			}
+			prev = cur
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffWatch(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	t1, t2 := now.Add(-time.Hour), now.Add(-time.Minute)
+	tests := []struct {
+		name      string
+		prev, cur map[string]watchEntry
+		want      []watchEvent
+	}{
+		{
+			name: "no change",
+			prev: map[string]watchEntry{"a": {size: 1, modTime: t1}},
+			cur:  map[string]watchEntry{"a": {size: 1, modTime: t1}},
+		},
+		{
+			name: "create modify delete",
+			prev: map[string]watchEntry{"a": {size: 1, modTime: t1}, "b": {size: 2, modTime: t1}},
+			cur:  map[string]watchEntry{"a": {size: 3, modTime: t2}, "c": {size: 4, modTime: t2}},
+			want: []watchEvent{
+				{Time: now, Type: "modify", Path: "a", Size: 3},
+				{Time: now, Type: "delete", Path: "b", Size: 2},
+				{Time: now, Type: "create", Path: "c", Size: 4},
+			},
+		},
+		{
+			name: "touched file",
+			prev: map[string]watchEntry{"a": {size: 1, modTime: t1}},
+			cur:  map[string]watchEntry{"a": {size: 1, modTime: t2}},
+			want: []watchEvent{{Time: now, Type: "modify", Path: "a", Size: 1}},
+		},
+		{
+			name: "rename",
+			prev: map[string]watchEntry{"in/a.tmp": {size: 5, modTime: t1}},
+			cur:  map[string]watchEntry{"in/a.csv": {size: 5, modTime: t1}},
+			want: []watchEvent{{Time: now, Type: "rename", Path: "in/a.csv", OldPath: "in/a.tmp", Size: 5}},
+		},
+		{
+			name: "different size is not a rename",
+			prev: map[string]watchEntry{"a": {size: 5, modTime: t1}},
+			cur:  map[string]watchEntry{"b": {size: 6, modTime: t1}},
+			want: []watchEvent{
+				{Time: now, Type: "delete", Path: "a", Size: 5},
+				{Time: now, Type: "create", Path: "b", Size: 6},
+			},
+		},
+		{
+			name: "renamed directory hides its children",
+			prev: map[string]watchEntry{"old": {dir: true, modTime: t1}, "old/x": {size: 1, modTime: t1}},
+			cur:  map[string]watchEntry{"new": {dir: true, modTime: t1}, "new/x": {size: 1, modTime: t1}},
+			want: []watchEvent{{Time: now, Type: "rename", Path: "new", OldPath: "old", Dir: true}},
+		},
+		{
+			name: "directory timestamps are ignored",
+			prev: map[string]watchEntry{"d": {dir: true, modTime: t1}},
+			cur:  map[string]watchEntry{"d": {dir: true, modTime: t2}},
+		},
+		{
+			name: "file replaced by directory",
+			prev: map[string]watchEntry{"a": {size: 1, modTime: t1}},
+			cur:  map[string]watchEntry{"a": {dir: true, modTime: t2}},
+			want: []watchEvent{
+				{Time: now, Type: "delete", Path: "a", Size: 1},
+				{Time: now, Type: "create", Path: "a", Dir: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := diffWatch(tt.prev, tt.cur, now); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: diffWatch =\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScanWatch(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"in/a": "1", "in/sub/b": "22"})
+	flat, err := scanWatch(fsys, "in", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := flat["in/sub/b"]; ok || len(flat) != 2 {
+		t.Errorf("non-recursive scan = %v, want in/a and in/sub only", flat)
+	}
+	deep, err := scanWatch(fsys, "in", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := deep["in/sub/b"]; !ok || e.size != 2 || len(deep) != 3 {
+		t.Errorf("recursive scan = %v", deep)
+	}
+}
+
+func TestWriteWatchEvent(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	writeWatchEvent(&buf, watchEvent{Time: now, Type: "rename", Path: "new", OldPath: "old", Dir: true}, false)
+	if got, want := buf.String(), "2024-05-01T12:00:00Z rename new/ (from old)\n"; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+	buf.Reset()
+	writeWatchEvent(&buf, watchEvent{Time: now, Type: "create", Path: "a", Size: 3}, true)
+	if got := buf.String(); !strings.Contains(got, `"type":"create"`) || !strings.Contains(got, `"size":3`) || strings.Contains(got, "old_path") {
+		t.Errorf("json = %s", got)
+	}
+}
+
+func TestWatchRemoteRejectsFile(t *testing.T) {
+	fsys := newTestDirFS(t, map[string]string{"a": "x"})
+	if err := watchRemote(t.Context(), fsys, &bytes.Buffer{}, "a", false, time.Second, false); err == nil {
+		t.Fatal("expected error watching a file")
+	}
+}